@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+var (
+	aggregateGroupBy string // comma separated columns the rows are grouped by
+	aggregateCount   bool   // write the number of rows of every group
+	aggregateSum     string // comma separated columns summed by group
+	aggregateAvg     string // comma separated columns averaged by group
+)
+
+// aggregation the groups written instead of the rows by the aggregate command, nil otherwise
+var aggregation *downloader.Aggregation
+
+func init() {
+	RootCmd.AddCommand(aggregateCmd)
+	aggregateCmd.Flags().StringVarP(&aggregateGroupBy, "group-by", "", "", "Comma separated columns the rows are grouped by, e.g. status_code,depth (defaults to a single group of every row)")
+	aggregateCmd.Flags().BoolVarP(&aggregateCount, "count", "", false, "If passed, the number of rows of every group is written (the default without --sum nor --avg)")
+	aggregateCmd.Flags().StringVarP(&aggregateSum, "sum", "", "", "Comma separated columns summed by group, e.g. size, written as sum_size")
+	aggregateCmd.Flags().StringVarP(&aggregateAvg, "avg", "", "", "Comma separated columns averaged by group, e.g. response_ms, written as avg_response_ms")
+}
+
+var aggregateCmd = &cobra.Command{
+	Use:   "aggregate",
+	Short: "Download a crawl but only write the counts, sums or averages of groups of rows",
+	Long: `Download a crawl like the root command does, but write a row per group of rows instead of the rows,
+e.g. the pages by status code with --group-by=status_code --count. The download flags apply: --filter, --where
+and --transform select and shape the rows before they're grouped, --output and --output-format where the
+groups are written. The groups are held in memory and written once the download completes, ordered by their
+values, the download being started again rather than resumed.`,
+	Example: `$ data-downloader aggregate --crawl=12345 --group-by=status_code --count
+$ data-downloader aggregate --crawl=12345 --group-by=depth --count --avg=response_ms --output=depths.csv --output-format=csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnvironment(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyKeyring(cmd.Flags()); err != nil {
+			return err
+		}
+		// the download flags are the persistent flags of the root command
+		if err := customFlagsValidation(RootCmd); err != nil {
+			return err
+		}
+		if err := aggregateValidation(); err != nil {
+			return err
+		}
+		aggregation = &downloader.Aggregation{
+			GroupBy:  downloader.ParseColumns(aggregateGroupBy),
+			Count:    aggregateCount,
+			Sums:     downloader.ParseColumns(aggregateSum),
+			Averages: downloader.ParseColumns(aggregateAvg),
+		}
+
+		// the groups streamed to stdout are kept apart from the messages, printed to stderr
+		if output == "" && !dryRun {
+			color.Output = colorable.NewColorableStderr()
+		}
+		flushTraces, err := setupTracing()
+		if err != nil {
+			return err
+		}
+		defer flushTraces()
+		return performDownload(interruptContext(), output)
+	},
+}
+
+// aggregateValidation refuses the flags that don't apply to groups of rows
+func aggregateValidation() error {
+	if sample != "" || diffBaseline != "" || splitRows > 0 || splitSize != "" || partitionBy != "" || sortBy != "" {
+		return CError("aggregate can't be used with --sample, --diff, --split-rows, --split-size, --partition-by nor --sort-by")
+	}
+	if targets != "" {
+		return CError("aggregate can't be used with --targets")
+	}
+	if mustResume {
+		return CError("--resume can't be used with aggregate, the rows are grouped in memory")
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	keyring "github.com/zalando/go-keyring"
+)
+
+// keyringService the name the credentials are stored under in the OS keychain
+const keyringService = "audisto-data-downloader"
+
+var (
+	passwordStdin bool // read the password of auth login from stdin
+)
+
+// keyringCredentials the credentials stored in the OS keychain, one entry per profile
+type keyringCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func init() {
+	RootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authLoginCmd.Flags().BoolVarP(&passwordStdin, "password-stdin", "", false, "If passed, the password is read from stdin, so it's not part of the command line")
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Store the API credentials in the OS keychain",
+	Long: `Store the API credentials in the OS keychain (macOS Keychain, the Secret Service of libsecret,
+Windows Credential Manager), so the downloads need no --username and --password anymore.
+Credentials passed as flags, set in the environment or in the config file take precedence.
+With --profile, the credentials are stored for that profile only.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Verify the credentials and store them in the OS keychain",
+	Long: `Verify the credentials against the API, then store them in the OS keychain, e.g.
+  data-downloader auth login --username=USERNAME --password-stdin < password.txt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if apiToken != "" {
+			return CError("auth login stores a username and password, an API token can be set in the environment or in the config file")
+		}
+		if passwordStdin {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return CError("cannot read the password from stdin: %v", err)
+			}
+			if err = cmd.Flags().Set("password", strings.TrimRight(line, "\r\n")); err != nil {
+				return err
+			}
+		}
+
+		client, err := accountClient(cmd)
+		if err != nil {
+			return err
+		}
+		if _, err = client.GetCrawls(); err != nil {
+			return err
+		}
+
+		if err = storeKeyringCredentials(); err != nil {
+			return err
+		}
+		PrintBlue("Credentials of %s stored in the OS keychain for the %q profile", username, keyringProfile())
+		return nil
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the credentials from the OS keychain",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := keyring.Delete(keyringService, keyringProfile())
+		if err == keyring.ErrNotFound {
+			PrintYellow("No credentials stored in the OS keychain for the %q profile", keyringProfile())
+			return nil
+		}
+		if err != nil {
+			return CError("cannot remove the credentials from the OS keychain: %v", err)
+		}
+		PrintBlue("Credentials removed from the OS keychain for the %q profile", keyringProfile())
+		return nil
+	},
+}
+
+// keyringProfile the profile the credentials are stored for in the OS keychain
+func keyringProfile() string {
+	return configProfile()
+}
+
+// storeKeyringCredentials stores the username and password in the OS keychain, for the profile
+func storeKeyringCredentials() error {
+	secret, err := json.Marshal(keyringCredentials{Username: username, Password: password})
+	if err != nil {
+		return err
+	}
+	if err = keyring.Set(keyringService, keyringProfile(), string(secret)); err != nil {
+		return CError("cannot store the credentials in the OS keychain: %v", err)
+	}
+	return nil
+}
+
+// applyKeyring sets the credentials that were neither passed, set in the environment nor in the config file
+// from the OS keychain. Without a keychain (e.g. a server without a secret service), nothing is set.
+func applyKeyring(flags *pflag.FlagSet) error {
+	if password != "" || apiToken != "" {
+		return nil
+	}
+	secret, err := keyring.Get(keyringService, keyringProfile())
+	if err != nil {
+		return nil
+	}
+
+	var stored keyringCredentials
+	if err = json.Unmarshal([]byte(secret), &stored); err != nil {
+		return CError("invalid credentials stored in the OS keychain, run auth login again: %v", err)
+	}
+	// the stored password is only the one of the stored username
+	if username != "" && username != stored.Username {
+		return nil
+	}
+	for key, value := range map[string]string{"username": stored.Username, "password": stored.Password} {
+		if err = flags.Set(key, value); err != nil {
+			return CError("invalid credentials stored in the OS keychain: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+// crawlList the IDs of the crawls of --crawl, comma separated
+type crawlList []uint64
+
+func (l *crawlList) String() string {
+	ids := make([]string, len(*l))
+	for i, id := range *l {
+		ids[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(ids, ",")
+}
+
+// Set adds the given comma separated IDs, so --crawl can be repeated and listed in the config file
+func (l *crawlList) Set(value string) error {
+	ids := *l
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		number, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || number == 0 {
+			return fmt.Errorf("invalid crawl ID %q", id)
+		}
+		ids = ids.with(number)
+	}
+	*l = ids
+	return nil
+}
+
+func (l *crawlList) Type() string {
+	return "ids"
+}
+
+// first returns the first crawl, 0 if there's none
+func (l crawlList) first() uint64 {
+	if len(l) == 0 {
+		return 0
+	}
+	return l[0]
+}
+
+// with returns the crawls along with the given one, unless it's already listed
+func (l crawlList) with(id uint64) crawlList {
+	for _, listed := range l {
+		if listed == id {
+			return l
+		}
+	}
+	return append(l, id)
+}
+
+// readCrawlsFile reads the IDs of a file of crawls, one per line; blank lines and # comments are skipped
+func readCrawlsFile(path string) (crawlList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, CError("cannot read --crawls-file: %v", err)
+	}
+	defer file.Close()
+
+	var ids crawlList
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		id := scanner.Text()
+		if i := strings.Index(id, "#"); i >= 0 {
+			id = id[:i]
+		}
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		number, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || number == 0 {
+			return nil, CError("invalid crawl ID %q on line %d of --crawls-file %s", id, line, path)
+		}
+		ids = ids.with(number)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, CError("cannot read --crawls-file: %v", err)
+	}
+	return ids, nil
+}
+
+// crawlsValidation adds the crawls of --crawls-file, then makes sure the crawls are downloaded to their own output
+func crawlsValidation() error {
+	if crawlsFile != "" {
+		ids, err := readCrawlsFile(crawlsFile)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			crawlIDs = crawlIDs.with(id)
+		}
+		if len(crawlIDs) == 0 {
+			return CError("no crawl ID in --crawls-file %s", crawlsFile)
+		}
+	}
+	if parallelCrawls < 1 {
+		return CError("--parallel-crawls has to be at least 1")
+	}
+	if err := downloader.ValidateOutputTemplate(output); err != nil {
+		return CError(err.Error())
+	}
+	if len(crawlIDs) < 2 {
+		return nil
+	}
+
+	// several crawls are downloaded to outputs named after the crawl
+	if output == "" {
+		return CError("Set --output to download several crawls, e.g. --output='export_%s.tsv'", downloader.CrawlIDPlaceholder)
+	}
+	if !downloader.HasPlaceholder(output, downloader.CrawlIDPlaceholder) {
+		return CError("Add %s to --output to download several crawls to their own output, e.g. --output='export_%s.tsv'",
+			downloader.CrawlIDPlaceholder, downloader.CrawlIDPlaceholder)
+	}
+	if targets != "" || diffBaseline != "" {
+		return CError("--targets and --diff can't be used with several crawls")
+	}
+	return nil
+}
+
+// downloadCrawls downloads several crawls, --parallel-crawls at a time. A failed crawl is reported,
+// the other crawls are still downloaded unless interrupted.
+func downloadCrawls(ctx context.Context, output string) error {
+	workers := parallelCrawls
+	if dryRun || workers > len(crawlIDs) {
+		workers = 1
+	}
+
+	var mutex sync.Mutex
+	var failed []crawlError
+	queue := make(chan uint64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for crawl := range queue {
+				err := downloadCrawl(ctx, crawl, output)
+				if err == nil {
+					if downloadsInParallel() && !quiet {
+						PrintBlue("Crawl %d downloaded", crawl)
+					}
+					continue
+				}
+				if ctx.Err() == nil {
+					PrintRed("Crawl %d failed: %v", crawl, err)
+				}
+				mutex.Lock()
+				failed = append(failed, crawlError{crawl: crawl, err: err})
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, crawl := range crawlIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- crawl
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return &crawlsError{failed: failed, total: len(crawlIDs)}
+}
+
+// downloadsInParallel tells if several crawls are downloaded at once, their progress not being rendered then
+func downloadsInParallel() bool {
+	return parallelCrawls > 1 && len(crawlIDs) > 1 && !dryRun
+}
+
+// downloadCrawl downloads a crawl to its output. With --mode=all, every mode is downloaded in turn,
+// to the output of {mode} if any, or to its own output file.
+func downloadCrawl(ctx context.Context, crawl uint64, output string) error {
+	output, err := crawlOutput(output, crawl)
+	if err != nil {
+		return err
+	}
+	if mode != downloader.AllModes {
+		return downloadMode(ctx, crawl, mode, expandMode(output, mode))
+	}
+
+	templated := downloader.HasPlaceholder(output, downloader.ModePlaceholder)
+	for _, m := range downloader.Modes {
+		modeOutput := expandMode(output, m)
+		if !templated {
+			modeOutput = downloader.ModeOutputFilename(modeOutput, m, compression)
+		}
+		// a previous run may have completed some of the modes already
+		if !noResume && downloader.IsDownloadCompleted(modeOutput) {
+			PrintYellow("%s already downloaded to %s, skipping", m, modeOutput)
+			continue
+		}
+		if err := downloadMode(ctx, crawl, m, modeOutput); err != nil {
+			return &modeError{mode: m, err: err}
+		}
+	}
+	return nil
+}
+
+// crawlOutput returns the output of a crawl, its ID, domain, profile and the date of today replacing the placeholders
+// of the output. The domain is asked to the API only when the output has a {domain}.
+func crawlOutput(output string, crawl uint64) (string, error) {
+	values := map[string]string{
+		downloader.CrawlIDPlaceholder: strconv.FormatUint(crawl, 10),
+		downloader.DatePlaceholder:    time.Now().Format(downloader.DatePlaceholderFormat),
+		downloader.ProfilePlaceholder: configProfile(),
+	}
+	if downloader.HasPlaceholder(output, downloader.DomainPlaceholder) {
+		client, err := crawlClient(crawl)
+		if err != nil {
+			return "", err
+		}
+		info, err := client.GetCrawl()
+		if err != nil {
+			return "", fmt.Errorf("cannot get the domain of the crawl %d: %v", crawl, err)
+		}
+		values[downloader.DomainPlaceholder] = downloader.DomainValue(info.Domain)
+	}
+	return downloader.ExpandOutput(output, values), nil
+}
+
+// expandMode returns the output of a mode, the mode replacing the {mode} of the output
+func expandMode(output string, mode string) string {
+	return downloader.ExpandOutput(output, map[string]string{downloader.ModePlaceholder: mode})
+}
@@ -3,15 +3,14 @@
 package main
 
 import (
-	"fmt"
-
 	"github.com/fatih/color"
 )
 
-// CError a Red-colored Error string (with Ansi escape codes, supports Windows)
+// CError a Red-colored Error string (with Ansi escape codes, supports Windows),
+// for invalid arguments: the CLI exits with exitInvalidArgs
 func CError(format string, a ...interface{}) error {
 	// Append a new line for a better error readibility.
-	return fmt.Errorf(color.HiRedString(format+"\n", a...))
+	return &usageError{message: color.HiRedString(format+"\n", a...)}
 }
 
 // PrintRed prints a red text into the terminal
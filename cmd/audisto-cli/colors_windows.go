@@ -21,8 +21,6 @@ uilive might need to be patched for this use case.
 package main
 
 import (
-	"fmt"
-
 	"github.com/fatih/color"
 )
 
@@ -46,10 +44,11 @@ func StringRed(text string) string {
 	return text
 }
 
-// CError a Red-colored Error string (with Ansi escape codes, supports Windows)
+// CError a Red-colored Error string (with Ansi escape codes, supports Windows),
+// for invalid arguments: the CLI exits with exitInvalidArgs
 func CError(format string, a ...interface{}) error {
 	// Append a new line for a better error readibility.
-	return fmt.Errorf(color.HiRedString(format+"\n", a...))
+	return &usageError{message: color.HiRedString(format+"\n", a...)}
 }
 
 // PrintRed prints a red text into the terminal
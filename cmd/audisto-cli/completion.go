@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script of data-downloader for the given shell, completing the subcommands, the flags
+and the values of --mode, --output-format, --compress, --log-format and --profile (from the config file), e.g.
+
+  bash:        source <(data-downloader completion bash)
+               or once: data-downloader completion bash > /etc/bash_completion.d/data-downloader
+  zsh:         data-downloader completion zsh > "${fpath[1]}/_data-downloader"
+  fish:        data-downloader completion fish > ~/.config/fish/completions/data-downloader.fish
+  PowerShell:  data-downloader completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.ExactValidArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return RootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return RootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return RootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			return RootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+	},
+}
+
+// flagCompletions the completion of the values of the flags, by flag name
+var flagCompletions = map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+	"mode":          fixedCompletion(append([]string{downloader.AllModes}, downloader.Modes...)...),
+	"output-format": fixedCompletion(downloader.TSVOutputFormat, downloader.CSVOutputFormat, downloader.JSONOutputFormat, downloader.SQLiteOutputFormat, downloader.ParquetOutputFormat),
+	"compress":      fixedCompletion(downloader.GzipCompression, downloader.ZstdCompression),
+	"log-format":    fixedCompletion(textLogFormat, jsonLogFormat),
+	"profile":       profileCompletion,
+}
+
+// registerFlagCompletions completes the values of the flags, for the command and its subcommands alike.
+// It has to be called once the flags are registered
+func registerFlagCompletions(cmd *cobra.Command) {
+	for name, values := range flagCompletions {
+		cmd.RegisterFlagCompletionFunc(name, values)
+	}
+}
+
+// rootCompletion completes the values of the flags of the root command, which parses its flags itself
+// (see DisableFlagParsing), passed as --flag value or --flag=value. The flag names are completed by cobra.
+func rootCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.HasPrefix(toComplete, "-") {
+		i := strings.Index(toComplete, "=")
+		if i < 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		complete, ok := valueCompletion(cmd, toComplete[:i])
+		if !ok || complete == nil {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		values, directive := complete(cmd, args, toComplete[i+1:])
+		for j := range values {
+			values[j] = toComplete[:i+1] + values[j]
+		}
+		return values, directive
+	}
+	if len(args) > 0 && !strings.Contains(args[len(args)-1], "=") {
+		if complete, ok := valueCompletion(cmd, args[len(args)-1]); ok {
+			if complete == nil {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return complete(cmd, args, toComplete)
+		}
+	}
+	// the root command takes no arguments
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// valueCompletion returns the completion of the values of a flag, e.g. --mode or -m, nil if it has none.
+// It's not ok unless the flag takes a value.
+func valueCompletion(cmd *cobra.Command, arg string) (func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective), bool) {
+	var flag *pflag.Flag
+	switch {
+	case strings.HasPrefix(arg, "--"):
+		flag = cmd.Flags().Lookup(arg[2:])
+	case strings.HasPrefix(arg, "-") && len(arg) == 2:
+		flag = cmd.Flags().ShorthandLookup(arg[1:])
+	}
+	// boolean flags take no value, see NoOptDefVal
+	if flag == nil || flag.NoOptDefVal != "" {
+		return nil, false
+	}
+	return flagCompletions[flag.Name], true
+}
+
+// fixedCompletion completes the given values
+func fixedCompletion(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// profileCompletion completes the names of the profiles of the config file, the one of --config if passed
+func profileCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	path, explicit := completedConfigPath(args)
+	if !explicit {
+		path = getDefaultConfigPath()
+	}
+	conf, err := loadConfig(path, explicit)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	profiles := make([]string, 0, len(conf))
+	for name := range conf {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completedConfigPath returns the --config of the command line being completed. The flags of the root command
+// are not parsed while completing, see DisableFlagParsing, its arguments are looked up instead.
+func completedConfigPath(args []string) (string, bool) {
+	if configPath != "" {
+		return configPath, true
+	}
+	for i, arg := range args {
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if strings.HasPrefix(arg, "config=") {
+			return strings.TrimPrefix(arg, "config="), true
+		}
+		if arg == "config" && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// configFileName the name of the config file looked up in the home directory
+	configFileName = ".audisto-downloader.yaml"
+
+	// defaultProfile the profile used when --profile is not passed
+	defaultProfile = "default"
+)
+
+// configurableFlags the flags that can be set from a config file profile
+var configurableFlags = map[string]bool{
+	"username":        true,
+	"password":        true,
+	"api-token":       true,
+	"auth-cache-file": true,
+	"crawl":           true,
+	"crawls-file":     true,
+	"parallel-crawls": true,
+	"chunk-size":      true,
+	"mode":            true,
+	"no-details":      true,
+	"output":          true,
+	"filter":          true,
+	"no-filter-check": true,
+	"where":           true,
+	"urls-file":       true,
+	"limit":           true,
+	"sample":          true,
+	"transform":       true,
+	"order":           true,
+	"sort-by":         true,
+	"tmp-dir":         true,
+	"columns":         true,
+	"add-columns":     true,
+	"no-header":       true,
+	"targets":         true,
+	"output-format":   true,
+	"row-group-size":  true,
+	"delimiter":       true,
+	"line-ending":     true,
+	"encoding":        true,
+	"sanitize":        true,
+	"null-as":         true,
+	"compress":        true,
+	"compress-level":  true,
+	"encrypt":         true,
+	"checksum":        true,
+	"post-process":    true,
+	"no-atomic":       true,
+	"force":           true,
+	"split-rows":      true,
+	"split-size":      true,
+	"partition-by":    true,
+	"enrich-pages":    true,
+	"diff":            true,
+	"diff-key":        true,
+	"diff-split":      true,
+	"append":          true,
+	"append-key":      true,
+	"concurrency":     true,
+	"buffer-size":     true,
+	"no-prefetch":     true,
+	"pagination":      true,
+	"drift-check":     true,
+	"max-retries":     true,
+	"retry-backoff":   true,
+	"rate-limit":      true,
+	"proxy":           true,
+	"api-base-url":    true,
+	"api-version":     true,
+	"user-agent":      true,
+	"header":          true,
+	"record":          true,
+	"replay":          true,
+	"request-timeout": true,
+	"job-timeout":     true,
+	"max-api-calls":   true,
+	"max-bytes":       true,
+	"wait-for-crawl":  true,
+	"wait-for-lock":   true,
+	"poll-interval":   true,
+	"max-wait":        true,
+	"max-idle-conns":  true,
+	"http2":           true,
+	"idle-timeout":    true,
+	"keep-alive":      true,
+	"ca-cert":         true,
+	"client-cert":     true,
+	"client-key":      true,
+	"max-bandwidth":   true,
+	"notify-webhook":  true,
+	"notify-email":    true,
+	"smtp-host":       true,
+	"smtp-port":       true,
+	"smtp-username":   true,
+	"smtp-password":   true,
+	"smtp-from":       true,
+	"quiet":           true,
+	"verbose":         true,
+	"log-format":      true,
+	"summary-file":    true,
+	"timing-report":   true,
+	"control-socket":  true,
+	// skips the scheduled downloads whose remote object is unchanged
+	"skip-if-unchanged": true,
+}
+
+// environmentFlags the flags that can be set from environment variables, by variable name
+var environmentFlags = map[string]string{
+	"AUDISTO_USERNAME": "username",
+	"AUDISTO_PASSWORD": "password",
+	"AUDISTO_TOKEN":    "api-token",
+	"AUDISTO_CRAWL_ID": "crawl",
+	// keeps the SMTP password out of the config file
+	"AUDISTO_SMTP_PASSWORD": "smtp-password",
+}
+
+// config profiles, by name. Each profile sets flags by their long name, e.g.
+//
+//	default:
+//	  username: USERNAME
+//	  password: PASSWORD
+//	prod:
+//	  crawl: 12345
+//	  filter: "status:200"
+//	  transform:
+//	    - "url: url_decode | lower"
+type config map[string]map[string]interface{}
+
+// getDefaultConfigPath returns the path of the config file in the home directory
+func getDefaultConfigPath() string {
+	homeDir, _ := homedir.Dir()
+	return filepath.Join(homeDir, configFileName)
+}
+
+// loadConfig reads the config file. A missing file is not an error unless it was explicitly passed.
+func loadConfig(path string, explicit bool) (config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return config{}, nil
+	}
+	if err != nil {
+		return nil, CError("cannot read config file: %v", err)
+	}
+
+	conf := config{}
+	if err = yaml.Unmarshal(data, &conf); err != nil {
+		return nil, CError("invalid config file %s: %v", path, err)
+	}
+	return conf, nil
+}
+
+// saveConfigProfile writes the settings to a profile of the config file, created if missing.
+// The settings of the profile that are not given are kept, the other profiles are left as is.
+func saveConfigProfile(path string, name string, settings map[string]interface{}) error {
+	conf, err := loadConfig(path, false)
+	if err != nil {
+		return err
+	}
+	if conf[name] == nil {
+		conf[name] = map[string]interface{}{}
+	}
+	for key, value := range settings {
+		conf[name][key] = value
+	}
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	// the config file may hold credentials
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		return CError("cannot write config file: %v", err)
+	}
+	return nil
+}
+
+// applyEnvironment sets the flags that were not passed on the command line from environment variables
+func applyEnvironment(flags *pflag.FlagSet) error {
+	for variable, key := range environmentFlags {
+		value, ok := os.LookupEnv(variable)
+		if !ok || value == "" || flags.Changed(key) {
+			continue
+		}
+		if err := flags.Set(key, value); err != nil {
+			return CError("invalid %s environment variable: %v", variable, err)
+		}
+	}
+	return nil
+}
+
+// loadFlagsConfig reads the config file of --config, the default one if NOT explicitly set, and returns its path
+func loadFlagsConfig(flags *pflag.FlagSet) (config, string, error) {
+	path, explicit := configPath, flags.Changed("config")
+	if !explicit {
+		path = getDefaultConfigPath()
+	}
+	conf, err := loadConfig(path, explicit)
+	return conf, path, err
+}
+
+// configProfile returns the config file profile in use, the default one if NOT explicitly set
+func configProfile() string {
+	if profile == "" {
+		return defaultProfile
+	}
+	return profile
+}
+
+// applyConfig sets the flags that were not passed on the command line from the selected config profile
+func applyConfig(flags *pflag.FlagSet) error {
+	conf, path, err := loadFlagsConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	name := profile
+	if name == "" {
+		name = defaultProfile
+	}
+	settings, ok := conf[name]
+	if !ok {
+		// there's nothing to apply without a config file or a default profile
+		if profile == "" {
+			return nil
+		}
+		return CError("profile %q not found in config file %s", profile, path)
+	}
+
+	// sort the settings, so errors are reported consistently
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !configurableFlags[key] {
+			return CError("unknown setting %q in profile %q of config file %s", key, name, path)
+		}
+		// flags passed on the command line take precedence
+		if flags.Changed(key) {
+			continue
+		}
+		// a list sets a repeatable flag once per item
+		values, ok := settings[key].([]interface{})
+		if !ok {
+			values = []interface{}{settings[key]}
+		}
+		for _, value := range values {
+			if err = flags.Set(key, fmt.Sprint(value)); err != nil {
+				return CError("invalid %q setting in profile %q of config file %s: %v", key, name, path, err)
+			}
+		}
+	}
+	return nil
+}
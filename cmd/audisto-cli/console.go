@@ -0,0 +1,13 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+)
+
+// setupConsole prepares the console to render the progress bar, terminals interpret the escape codes
+// and UTF-8 as they are
+func setupConsole(terminal *os.File) bool {
+	return true
+}
@@ -0,0 +1,38 @@
+// +build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// utf8CodePage the code page of UTF-8, the bar and the messages are printed in UTF-8
+const utf8CodePage = 65001
+
+var setConsoleOutputCP = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetConsoleOutputCP")
+
+// setupConsole prepares the console to render the progress bar: the cursor is moved by ANSI escape codes,
+// only interpreted by the consoles having the virtual terminal processing enabled (Windows 10 and later),
+// and the bar is drawn with UTF-8 characters, printed as garbage by the default code page of the console.
+// It returns false when the console can't render the bar, e.g. a legacy console.
+func setupConsole(terminal *os.File) bool {
+	handle := windows.Handle(terminal.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING == 0 {
+		if err := windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+			return false
+		}
+	}
+	if err := setConsoleOutputCP.Find(); err != nil {
+		return false
+	}
+	if ok, _, _ := setConsoleOutputCP.Call(utf8CodePage); ok == 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+var (
+	crawlInfoID   uint64 // ID of the crawl to describe, --crawl if NOT explicitly set
+	crawlInfoJSON bool   // print the crawl info as JSON instead of text
+)
+
+func init() {
+	RootCmd.AddCommand(crawlCmd)
+	crawlCmd.AddCommand(crawlInfoCmd)
+	crawlInfoCmd.Flags().Uint64VarP(&crawlInfoID, "id", "", 0, "ID of the crawl to describe (defaults to --crawl)")
+	crawlInfoCmd.Flags().BoolVarP(&crawlInfoJSON, "json", "", false, "If passed, the crawl info is printed as JSON for scripting")
+}
+
+var crawlCmd = &cobra.Command{
+	Use:   "crawl",
+	Short: "Inspect a crawl",
+	Long:  `Inspect a crawl of the Audisto account`,
+}
+
+var crawlInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show a crawl metadata and element counts",
+	Long: `Show a crawl metadata, settings, total pages and links, and the estimated size of their downloads.
+The sizes are estimated from the first elements, with details unless --no-details is passed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := accountClient(cmd); err != nil {
+			return err
+		}
+		if crawlInfoID == 0 {
+			crawlInfoID = crawlIDs.first()
+		}
+		if crawlInfoID == 0 {
+			return CError("--id is required")
+		}
+
+		client, err := crawlClient(crawlInfoID)
+		if err != nil {
+			return err
+		}
+		info, err := client.GetCrawlInfo()
+		if err != nil {
+			return err
+		}
+
+		if crawlInfoJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(info)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%d\n", info.ID)
+		fmt.Fprintf(w, "Domain:\t%s\n", info.Domain)
+		fmt.Fprintf(w, "Started:\t%s\n", info.StartedAt)
+		fmt.Fprintf(w, "Status:\t%s\n", info.Status)
+		fmt.Fprintf(w, "Total pages:\t%d\t(~%s download)\n", info.TotalPages, PrettyByteSize(info.EstimatedPagesSize))
+		fmt.Fprintf(w, "Total links:\t%d\t(~%s download)\n", info.TotalLinks, PrettyByteSize(info.EstimatedLinksSize))
+
+		if len(info.Settings) > 0 {
+			fmt.Fprintln(w, "Settings:")
+			keys := make([]string, 0, len(info.Settings))
+			for key := range info.Settings {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "  %s:\t%v\n", key, info.Settings[key])
+			}
+		}
+		return w.Flush()
+	},
+}
+
+// crawlClient returns the API client of a crawl, with the credentials, endpoint and transport of the flags
+func crawlClient(crawl uint64) (*downloader.AudistoAPIClient, error) {
+	var client *downloader.AudistoAPIClient
+	var err error
+	if apiToken != "" {
+		client, err = downloader.NewTokenClient(apiToken, crawl, "", noDetails, 0, 0, "", "")
+	} else {
+		client, err = downloader.NewClient(username, password, crawl, "", noDetails, 0, 0, "", "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = client.SetEndpoint(apiBaseURL, apiVersion); err != nil {
+		return nil, CError(err.Error())
+	}
+	if err = applyTransport(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+var (
+	crawlsJSON bool // print the crawls as JSON instead of a table
+)
+
+func init() {
+	RootCmd.AddCommand(crawlsCmd)
+	crawlsCmd.AddCommand(crawlsListCmd)
+	crawlsListCmd.Flags().BoolVarP(&crawlsJSON, "json", "", false, "If passed, crawls are printed as JSON for scripting")
+}
+
+var crawlsCmd = &cobra.Command{
+	Use:   "crawls",
+	Short: "Manage the crawls of the account",
+	Long:  `Manage the crawls of the Audisto account`,
+}
+
+var crawlsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the crawls of the account",
+	Long:  `List the crawls of the Audisto account: ID, domain, start date, status and page count`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := accountClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		crawls, err := client.GetCrawls()
+		if err != nil {
+			return err
+		}
+
+		if crawlsJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(crawls)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDOMAIN\tSTARTED\tSTATUS\tPAGES")
+		for _, crawl := range crawls {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", crawl.ID, crawl.Domain, crawl.StartedAt, crawl.Status, crawl.PageCount)
+		}
+		return w.Flush()
+	},
+}
+
+// applyTransport sets the connection, TLS and header settings of the flags on the client,
+// warning on stderr when certificates are not verified
+func applyTransport(client *downloader.AudistoAPIClient) error {
+	header, err := downloader.ParseHeaders(headers)
+	if err != nil {
+		return CError(err.Error())
+	}
+	client.SetHeaders(requestUserAgent(), header)
+	client.SetRequestTimeout(requestTimeout)
+	if transport := transportOptions(); !transport.IsZero() {
+		client.SetTransportOptions(transport)
+	}
+	if tlsOptions().IsZero() {
+		return nil
+	}
+	config, err := downloader.NewTLSConfig(tlsOptions())
+	if err != nil {
+		return CError(err.Error())
+	}
+	if config.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, StringYellow("WARNING: the TLS certificate of the API is not verified, the credentials and the data can be intercepted"))
+	}
+	client.SetTLSConfig(config)
+	return nil
+}
+
+// requestUserAgent returns the User-Agent of the requests to the API, data-downloader/VERSION unless set
+func requestUserAgent() string {
+	if userAgent != "" {
+		return userAgent
+	}
+	return "data-downloader/" + VERSION
+}
+
+// accountClient makes an Audisto API client of the account, the credentials being
+// passed as flags, set in the environment, in the config file or stored in the OS keychain
+func accountClient(cmd *cobra.Command) (*downloader.AudistoAPIClient, error) {
+	if err := applyEnvironment(cmd.Flags()); err != nil {
+		return nil, err
+	}
+	if err := applyConfig(cmd.Flags()); err != nil {
+		return nil, err
+	}
+	if err := applyKeyring(cmd.Flags()); err != nil {
+		return nil, err
+	}
+	if err := credentialsValidation(); err != nil {
+		return nil, err
+	}
+	if apiToken == "" && (username == "" || password == "") {
+		return nil, CError("--username and --password (or --api-token) are required, either passed, set in the environment, in the config file or stored by auth login")
+	}
+	var client *downloader.AudistoAPIClient
+	var err error
+	if apiToken != "" {
+		client, err = downloader.NewTokenAccountClient(apiToken)
+	} else {
+		client, err = downloader.NewAccountClient(username, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = client.SetEndpoint(apiBaseURL, apiVersion); err != nil {
+		return nil, CError(err.Error())
+	}
+	if proxy != "" {
+		proxyURL, err := downloader.ParseProxy(proxy)
+		if err != nil {
+			return nil, CError(err.Error())
+		}
+		client.SetProxy(proxyURL)
+	}
+	if err = applyTransport(client); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
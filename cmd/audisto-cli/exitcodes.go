@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+// exit codes, so scripts can tell failures apart. A download interrupted by a signal exits with
+// 128 + the signal number, like shells do: 130 on SIGINT (Ctrl+C), 143 on SIGTERM.
+const (
+	exitFailure     = 1  // any other failure
+	exitInvalidArgs = 2  // invalid flags, environment variables or config file
+	exitAuthFailure = 3  // Audisto API refused the credentials
+	exitNetwork     = 4  // Audisto API unreachable or unavailable, after every retry
+	exitDiskFull    = 5  // no space left on the device to write the output
+	exitJobTimeout  = 6  // the download did not complete within --job-timeout
+	exitUnfinished  = 7  // the crawl was still in progress once --max-wait elapsed
+	exitSkipped     = 8  // the download completed without the chunks skipped by --skip-failed-chunks
+	exitLocked      = 9  // the output was being written by another download
+	exitBudget      = 10 // the API calls or bytes of --max-api-calls or --max-bytes were exhausted
+	exitPostProcess = 11 // the --post-process command of a completed file failed
+	exitPermission  = 12 // the account can't access the crawl
+	exitQuota       = 13 // the API quota of the account is exceeded
+)
+
+// exitCodesHelp documents the exit codes in --help
+const exitCodesHelp = `Exit codes:
+  0    the download completed
+  1    the download failed
+  2    invalid arguments: flags, environment variables or config file
+  3    authentication failure: wrong credentials
+  4    network failure: Audisto API unreachable or unavailable after every retry
+  5    disk full: no space left to write the output, or not enough for the estimated download
+  6    job timeout: the download did not complete within --job-timeout
+  7    crawl unfinished: the crawl was still in progress once --max-wait elapsed
+  8    chunks skipped: the download completed without the chunks failed with --skip-failed-chunks
+  9    output locked: the output was being written by another download, see --wait-for-lock
+  10   budget exhausted: the run made --max-api-calls or downloaded --max-bytes
+  11   post-process failed: the --post-process command of a completed file failed
+  12   permission denied: the account can't access the crawl, or the API
+  13   quota exceeded: the API quota of the account is exceeded, resume the download once it resets
+  130  interrupted by SIGINT (Ctrl+C), 143 by SIGTERM`
+
+// usageError is returned for invalid arguments, see CError
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+// modeError is the failure of one of the modes downloaded with --mode=all
+type modeError struct {
+	mode string
+	err  error
+}
+
+func (e *modeError) Error() string {
+	return e.mode + ": " + e.err.Error()
+}
+
+// crawlError is the failure of one of several crawls
+type crawlError struct {
+	crawl uint64
+	err   error
+}
+
+// crawlsError is the failure of some of several crawls, the other ones being downloaded
+type crawlsError struct {
+	failed []crawlError
+	total  int
+}
+
+func (e *crawlsError) Error() string {
+	messages := make([]string, len(e.failed))
+	for i, failed := range e.failed {
+		messages[i] = fmt.Sprintf("crawl %d: %v", failed.crawl, failed.err)
+	}
+	return fmt.Sprintf("%d of %d crawls failed: %s", len(e.failed), e.total, strings.Join(messages, "; "))
+}
+
+// exitCode returns the exit code matching the class of the error, the first failed crawl's one for several crawls,
+// the exit code of the first failed profile for several profiles, of the first failed job for run --jobs
+func exitCode(err error) int {
+	if profilesErr, ok := err.(*profilesError); ok {
+		return profilesErr.failed[0].code
+	}
+	if jobsErr, ok := err.(*jobsError); ok {
+		return jobsErr.failed[0].code
+	}
+	if crawlsErr, ok := err.(*crawlsError); ok {
+		err = crawlsErr.failed[0].err
+	}
+	if modeErr, ok := err.(*modeError); ok {
+		err = modeErr.err
+	}
+	switch {
+	case err == nil:
+		return 0
+	case isUsageError(err):
+		return exitInvalidArgs
+	case downloader.IsPermissionDenied(err):
+		return exitPermission
+	case downloader.IsQuotaExceeded(err):
+		return exitQuota
+	case downloader.IsAuthError(err):
+		return exitAuthFailure
+	case downloader.IsNetworkError(err):
+		return exitNetwork
+	case downloader.IsDiskFull(err):
+		return exitDiskFull
+	case downloader.IsJobTimeout(err):
+		return exitJobTimeout
+	case downloader.IsCrawlNotFinished(err):
+		return exitUnfinished
+	case downloader.IsSkippedChunks(err):
+		return exitSkipped
+	case downloader.IsOutputLocked(err):
+		return exitLocked
+	case downloader.IsBudgetExhausted(err):
+		return exitBudget
+	case downloader.IsPostProcessFailed(err):
+		return exitPostProcess
+	}
+	return exitFailure
+}
+
+func isUsageError(err error) bool {
+	_, ok := err.(*usageError)
+	return ok
+}
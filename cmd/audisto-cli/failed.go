@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(retryFailedCmd)
+}
+
+var retryFailedCmd = &cobra.Command{
+	Use:   "retry-failed <manifest>",
+	Short: "Download again the chunks skipped by --skip-failed-chunks",
+	Long: `Download again the chunks listed in the manifest written by a download with --skip-failed-chunks,
+[OUTPUT]` + downloader.FailedChunksSuffix + `, with the settings of that download. Their rows are written to a file of
+their own next to the output, e.g. crawl.retry1.tsv for crawl.tsv. The chunks failing again are kept in the manifest,
+to be retried later, the manifest is removed once every chunk is downloaded.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnvironment(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyKeyring(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := credentialsValidation(); err != nil {
+			return err
+		}
+		if apiToken == "" && (username == "" || password == "") {
+			return CError("--username and --password (or --api-token) are required, either passed, set in the environment, in the config file or stored by auth login")
+		}
+		manifest, err := downloader.ReadFailedChunksManifest(args[0])
+		if err != nil {
+			return err
+		}
+
+		options, err := downloadOptions(manifest.CrawlID, manifest.Mode, manifest.Output)
+		if err != nil {
+			return err
+		}
+		if err = downloader.RetryFailedChunks(interruptContext(), args[0], options); err != nil {
+			printSkippedChunks(err)
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", StringGreen(fmt.Sprintf("The %d failed chunks are downloaded to %s",
+			len(manifest.Chunks), downloader.RetryFilename(manifest.Output, manifest.Retries+1))))
+		return nil
+	},
+}
+
+// printSkippedChunks prints the chunks skipped by a download with --skip-failed-chunks, along with the command
+// to download them again, if the download skipped any
+func printSkippedChunks(err error) {
+	skipped, ok := err.(*downloader.SkippedChunksError)
+	if !ok {
+		return
+	}
+	PrintYellow("The download completed without the rows of %d chunks, failed after every retry:", len(skipped.Chunks))
+	for _, chunk := range skipped.Chunks {
+		PrintYellow("  elements %d to %d: %s", chunk.Start, chunk.End-1, chunk.Error)
+	}
+	PrintYellow("Run `data-downloader retry-failed %s` to download them again", skipped.Manifest)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// historyFileName the name of the history file in the home directory, one JSON run per line
+const historyFileName = ".audisto-downloader-history.jsonl"
+
+// historySecretFlags the flags that are not recorded in the history, see applyEnvironment and applyKeyring:
+// the secrets, along with the headers and the webhook URL that may hold tokens
+var historySecretFlags = map[string]bool{
+	"password":       true,
+	"api-token":      true,
+	"smtp-password":  true,
+	"header":         true,
+	"notify-webhook": true,
+}
+
+// historyRedactedFlags the URL flags recorded without their password, see downloader.RedactOutput
+var historyRedactedFlags = map[string]bool{
+	"output": true,
+	"proxy":  true,
+}
+
+// historyDownloadFlags the flags recorded as the ones of the download, see historyNotifier.args
+var historyDownloadFlags = map[string]bool{
+	"crawl":           true,
+	"crawls-file":     true,
+	"parallel-crawls": true,
+	"mode":            true,
+	"output":          true,
+}
+
+var (
+	historyJSON  bool // print the history as JSON instead of a table
+	historyLimit int  // the number of runs listed, the last ones
+)
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	historyCmd.AddCommand(historyRerunCmd)
+	historyCmd.PersistentFlags().BoolVarP(&historyJSON, "json", "", false, "If passed, the runs are printed as JSON for scripting")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "", 20, "Number of runs listed, the last ones, 0 for every run")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the past downloads",
+	Long: `List the past downloads, the last ones first: crawl, mode, rows, duration, outcome and output.
+Every download run from the command line or on a schedule is recorded in ~/` + historyFileName + `,
+with its settings but the password, the API token, the SMTP password, the headers and the webhook URL;
+the passwords of the output and proxy URLs are redacted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := loadHistory()
+		if err != nil {
+			return err
+		}
+		if historyLimit > 0 && len(runs) > historyLimit {
+			runs = runs[len(runs)-historyLimit:]
+		}
+		// the last runs first
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+		if historyJSON {
+			return printJSON(runs)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tCRAWL\tMODE\tROWS\tDURATION\tOUTCOME\tOUTPUT")
+		for _, run := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04"),
+				run.CrawlID, run.Mode, run.Rows, run.Duration, run.Event, run.Output)
+		}
+		return w.Flush()
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a past download and its settings",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, err := historyRun(args[0])
+		if err != nil {
+			return err
+		}
+		if historyJSON {
+			return printJSON(run)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID:\t%d\n", run.ID)
+		fmt.Fprintf(w, "Started:\t%s\n", run.StartedAt.Local().Format(time.RFC1123))
+		fmt.Fprintf(w, "Duration:\t%s\n", run.Duration)
+		fmt.Fprintf(w, "Crawl:\t%d\n", run.CrawlID)
+		fmt.Fprintf(w, "Mode:\t%s\n", run.Mode)
+		fmt.Fprintf(w, "Rows:\t%d\n", run.Rows)
+		fmt.Fprintf(w, "Output:\t%s\n", run.Output)
+		fmt.Fprintf(w, "Outcome:\t%s\n", run.Event)
+		if run.Error != "" {
+			fmt.Fprintf(w, "Error:\t%s\n", run.Error)
+		}
+		command := []string{"data-downloader"}
+		for _, arg := range run.Args {
+			// quoted for the shell, so the command can be copied
+			if strings.ContainsAny(arg, " \t'\"$`\\*?&|;<>()") {
+				arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+			}
+			command = append(command, arg)
+		}
+		fmt.Fprintf(w, "Command:\t%s\n", strings.Join(command, " "))
+		return w.Flush()
+	},
+}
+
+var historyRerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Run a past download again, with the same settings",
+	Long: `Run a past download again, with the same settings and to the same output. The flags passed take precedence,
+e.g. --no-resume to download it from scratch. The password, API token, SMTP password, headers and webhook URL
+are taken from the environment, the config file or the OS keychain, as they're not recorded; an output or proxy
+URL recorded with a redacted password has to be passed again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, err := historyRun(args[0])
+		if err != nil {
+			return err
+		}
+		flags := cmd.Flags()
+		passed := map[string]bool{}
+		flags.Visit(func(f *pflag.Flag) {
+			passed[f.Name] = true
+		})
+		for _, arg := range run.Args {
+			setting := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+			if len(setting) != 2 {
+				return CError("invalid setting %s of the run %d", arg, run.ID)
+			}
+			// the flags passed take precedence, a repeated flag (e.g. --transform) is set once per value
+			if passed[setting[0]] {
+				continue
+			}
+			if historyRedactedFlags[setting[0]] && isRedactedURL(setting[1]) {
+				return CError("the password of --%s of the run %d is not recorded, pass --%s again", setting[0], run.ID, setting[0])
+			}
+			if err = flags.Set(setting[0], setting[1]); err != nil {
+				return CError("invalid setting %s of the run %d: %v", arg, run.ID, err)
+			}
+		}
+
+		for _, apply := range []func(*pflag.FlagSet) error{applyEnvironment, applyConfig, applyKeyring} {
+			if err = apply(flags); err != nil {
+				return err
+			}
+		}
+		if err = customFlagsValidation(RootCmd); err != nil {
+			return err
+		}
+		flushTraces, err := setupTracing()
+		if err != nil {
+			return err
+		}
+		defer flushTraces()
+		return performDownload(interruptContext(), output)
+	},
+}
+
+// isRedactedURL tells if the password of a URL was redacted by downloader.RedactOutput
+func isRedactedURL(location string) bool {
+	u, err := url.Parse(location)
+	if err != nil || u.User == nil {
+		return false
+	}
+	password, ok := u.User.Password()
+	return ok && password == "xxxxx"
+}
+
+// historyEntry a past download, as recorded in the history file
+type historyEntry struct {
+	ID              int       `json:"id"`
+	StartedAt       time.Time `json:"startedAt"`
+	Event           string    `json:"event"`
+	CrawlID         uint64    `json:"crawlID"`
+	Mode            string    `json:"mode"`
+	Rows            uint64    `json:"rows"`
+	Duration        string    `json:"duration"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Output          string    `json:"output"`
+	Error           string    `json:"error,omitempty"`
+	// Args the flags of the download, e.g. --crawl=12345, without the secrets
+	Args []string `json:"args"`
+}
+
+// historyPath returns the path of the history file in the home directory
+func historyPath() string {
+	homeDir, _ := homedir.Dir()
+	return filepath.Join(homeDir, historyFileName)
+}
+
+// loadHistory reads the past downloads, in the order they were recorded. A missing history is empty.
+func loadHistory() ([]historyEntry, error) {
+	file, err := os.Open(historyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the history: %v", err)
+	}
+	defer file.Close()
+
+	var runs []historyEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var run historyEntry
+		// a line that can't be read, e.g. cut by a full disk, is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &run); err == nil {
+			runs = append(runs, run)
+		}
+	}
+	return runs, scanner.Err()
+}
+
+// historyRun returns the past download of the given ID
+func historyRun(id string) (historyEntry, error) {
+	number, err := strconv.Atoi(id)
+	if err != nil {
+		return historyEntry{}, CError("invalid run ID %q, see history", id)
+	}
+	runs, err := loadHistory()
+	if err != nil {
+		return historyEntry{}, err
+	}
+	for _, run := range runs {
+		if run.ID == number {
+			return run, nil
+		}
+	}
+	return historyEntry{}, CError("no run %d in the history", number)
+}
+
+// historyNotifier records the download of a crawl and mode in the history once it completes or fails
+type historyNotifier struct {
+	crawl  uint64
+	mode   string
+	output string // the output as passed, e.g. the dated output of a scheduled run, unlike the redacted one notified
+}
+
+func newHistoryNotifier(crawl uint64, mode string, output string) *historyNotifier {
+	return &historyNotifier{crawl: crawl, mode: mode, output: output}
+}
+
+// Notify appends the download to the history, the ID following the last recorded one
+func (h *historyNotifier) Notify(notification downloader.Notification) error {
+	runs, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	run := historyEntry{
+		ID:              1,
+		StartedAt:       time.Now().Add(-time.Duration(notification.DurationSeconds * float64(time.Second))).UTC(),
+		Event:           notification.Event,
+		CrawlID:         notification.CrawlID,
+		Mode:            notification.Mode,
+		Rows:            notification.Rows,
+		Duration:        notification.Duration,
+		DurationSeconds: notification.DurationSeconds,
+		Output:          notification.Output,
+		Error:           notification.Error,
+		Args:            h.args(),
+	}
+	if len(runs) > 0 {
+		run.ID = runs[len(runs)-1].ID + 1
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	// the recorded outputs may hold database credentials
+	file, err := os.OpenFile(historyPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot record the download in the history: %v", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// args returns the flags set, passed or not, without the secrets and with the passwords of the URLs redacted.
+// The crawl, mode and output are the ones of the download, a run of --mode=all or of several crawls being
+// recorded as a run per crawl and mode.
+func (h *historyNotifier) args() []string {
+	args := []string{"--crawl=" + strconv.FormatUint(h.crawl, 10), "--mode=" + h.mode}
+	if h.output != "" {
+		args = append(args, "--output="+downloader.RedactOutput(h.output))
+	}
+	RootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed || historySecretFlags[f.Name] || historyDownloadFlags[f.Name] {
+			return
+		}
+		if values, ok := f.Value.(pflag.SliceValue); ok {
+			for _, value := range values.GetSlice() {
+				args = append(args, "--"+f.Name+"="+value)
+			}
+			return
+		}
+		value := f.Value.String()
+		if historyRedactedFlags[f.Name] {
+			value = downloader.RedactOutput(value)
+		}
+		args = append(args, "--"+f.Name+"="+value)
+	})
+	return args
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	jobsFile     string // the job-spec file of the downloads to run
+	parallelJobs int    // how many jobs are run at a time, the concurrency of the job-spec file if NOT set
+	jobsPlanOnly bool   // print the plan of the jobs without running them
+)
+
+// jobManagedFlags the flags set by the planner for every job, they can't be set by the job-spec file
+var jobManagedFlags = map[string]bool{
+	"crawl":             true,
+	"crawls-file":       true,
+	"mode":              true,
+	"output":            true,
+	"config":            true,
+	"profiles":          true,
+	"parallel-profiles": true,
+	"parallel-crawls":   true,
+	"summary-file":      true,
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringVarP(&jobsFile, "jobs", "", "", "The job-spec file (YAML) of the downloads to run, e.g. jobs.yaml (required)")
+	runCmd.Flags().IntVarP(&parallelJobs, "parallel-jobs", "", 0, "Number of jobs run at a time (defaults to the concurrency of the job-spec file, 1 if not set)")
+	runCmd.Flags().BoolVarP(&jobsPlanOnly, "plan", "", false, "If passed, the plan of the jobs is printed, nothing is downloaded")
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the downloads of a job-spec file",
+	Long: `Run the downloads described by a job-spec file: every job downloads its crawls and modes to its output,
+once the jobs it runs after completed. The jobs are run --parallel-jobs at a time, by a process of their own,
+their messages being prefixed by their name; --rate-limit is shared by the jobs running, every job getting its
+share. A failed job is reported, the jobs running after it are skipped, the other jobs still run.
+The jobs, their results and their downloads are summed up once done, to --summary-file too if set.
+It exits with the exit code of the first failed job.`,
+	Example: `  data-downloader run --jobs jobs.yaml --parallel-jobs 2 --rate-limit 10/s
+  data-downloader run --jobs jobs.yaml --plan`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if jobsFile == "" {
+			return CError("--jobs is required")
+		}
+		if parallelJobs < 0 {
+			return CError("--parallel-jobs can't be negative")
+		}
+		spec, err := loadJobSpec(jobsFile)
+		if err != nil {
+			return err
+		}
+		plan, err := newJobPlan(spec, cmd.Flags())
+		if err != nil {
+			return err
+		}
+		if jobsPlanOnly {
+			return plan.print()
+		}
+		return plan.run(interruptContext())
+	},
+}
+
+// jobSpec the job-spec file of run --jobs, e.g.
+//
+//	concurrency: 2
+//	rate-limit: 10/s
+//	defaults:
+//	  profile: prod
+//	  chunk-size: 5000
+//	jobs:
+//	  - name: pages
+//	    crawls: [12345, 12346]
+//	    output: "exports/{crawl_id}_pages.tsv.gz"
+//	    flags:
+//	      compress: gzip
+//	  - name: links
+//	    crawls: [12345]
+//	    modes: [links]
+//	    output: "exports/{crawl_id}_links.tsv"
+//	    after: [pages]
+type jobSpec struct {
+	Concurrency int                    `yaml:"concurrency"` // how many jobs are run at a time, 1 if not set
+	RateLimit   string                 `yaml:"rate-limit"`  // the rate limit shared by the jobs running
+	Defaults    map[string]interface{} `yaml:"defaults"`    // the flags of every job, by their long name
+	Jobs        []jobDefinition        `yaml:"jobs"`
+}
+
+// jobDefinition a job of the job-spec file: the downloads of its crawls × modes
+type jobDefinition struct {
+	Name   string                 `yaml:"name"`
+	Crawls []uint64               `yaml:"crawls"`
+	Modes  []string               `yaml:"modes"`  // pages if not set, all downloads both to their own output
+	Output string                 `yaml:"output"` // {crawl_id} and {mode} telling the downloads apart
+	After  []string               `yaml:"after"`  // the jobs that have to complete first
+	Flags  map[string]interface{} `yaml:"flags"`  // the flags of the job, taking precedence over the defaults
+}
+
+// loadJobSpec reads a job-spec file
+func loadJobSpec(path string) (*jobSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, CError("cannot read --jobs: %v", err)
+	}
+	spec := &jobSpec{}
+	if err = yaml.Unmarshal(data, spec); err != nil {
+		return nil, CError("invalid job-spec file %s: %v", path, err)
+	}
+	if len(spec.Jobs) == 0 {
+		return nil, CError("no job in the job-spec file %s", path)
+	}
+	return spec, nil
+}
+
+// plannedJob a download of a job: a crawl and a mode of the job, run by a process of its own
+type plannedJob struct {
+	index  int    // the position of the job in the plan
+	job    string // the name of the job it's a download of
+	label  string // the job, along with the crawl and the mode telling its downloads apart
+	crawl  uint64
+	mode   string
+	output string
+	after  []string // the jobs that have to complete first
+	args   []string // the arguments of its process
+}
+
+// jobPlan the downloads of a job-spec file, in the order they're run: a job's downloads follow the jobs it
+// runs after
+type jobPlan struct {
+	jobs      []*plannedJob
+	downloads map[string]int // the number of downloads of every job
+	workers   int
+	rateLimit string // the share of the rate limit of every job running, "" for no limit
+}
+
+// newJobPlan validates a job-spec file and plans its downloads. The flags of the command set the rate limit
+// shared by the jobs and the config file of every job.
+func newJobPlan(spec *jobSpec, flags *pflag.FlagSet) (*jobPlan, error) {
+	plan := &jobPlan{downloads: map[string]int{}, workers: 1}
+	if spec.Concurrency < 0 {
+		return nil, CError("the concurrency of the job-spec file can't be negative")
+	}
+	if parallelJobs > 0 {
+		plan.workers = parallelJobs
+	} else if spec.Concurrency > 0 {
+		plan.workers = spec.Concurrency
+	}
+	shared := spec.RateLimit
+	if flags.Changed("rate-limit") {
+		shared = rateLimit
+	}
+	if shared != "" {
+		share, err := rateLimitShare(shared, plan.workers)
+		if err != nil {
+			return nil, CError(err.Error())
+		}
+		plan.rateLimit = share
+	}
+
+	definitions, err := orderJobs(spec.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]string{}
+	for _, definition := range definitions {
+		settings, err := jobSettings(spec.Defaults, definition, plan.rateLimit != "")
+		if err != nil {
+			return nil, err
+		}
+		modes, err := jobModes(definition)
+		if err != nil {
+			return nil, err
+		}
+		if err = jobOutputValidation(definition, modes); err != nil {
+			return nil, err
+		}
+		for _, crawl := range definition.Crawls {
+			for _, m := range modes {
+				job := &plannedJob{index: len(plan.jobs), job: definition.Name, label: definition.Name, crawl: crawl,
+					mode: m, after: definition.After}
+				job.output = downloader.ExpandOutput(definition.Output, map[string]string{
+					downloader.CrawlIDPlaceholder: strconv.FormatUint(crawl, 10)})
+				if m != downloader.AllModes {
+					job.output = expandMode(job.output, m)
+				}
+				if other, ok := outputs[job.output]; ok {
+					return nil, CError("the jobs %q and %q are downloaded to the same output %s", other, definition.Name, job.output)
+				}
+				outputs[job.output] = definition.Name
+				if len(definition.Crawls) > 1 {
+					job.label += "/" + strconv.FormatUint(crawl, 10)
+				}
+				if len(modes) > 1 {
+					job.label += "/" + m
+				}
+				job.args = plan.jobArgs(job, settings, flags)
+				plan.jobs = append(plan.jobs, job)
+				plan.downloads[definition.Name]++
+			}
+		}
+	}
+	return plan, nil
+}
+
+// orderJobs orders the jobs of a job-spec file so the jobs they run after come first, the order of the file
+// being kept otherwise. Their names have to be unique, the jobs they run after have to exist, without cycles.
+func orderJobs(definitions []jobDefinition) ([]jobDefinition, error) {
+	byName := map[string]jobDefinition{}
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			return nil, CError("every job of the job-spec file needs a name")
+		}
+		if _, ok := byName[definition.Name]; ok {
+			return nil, CError("the job-spec file has several jobs named %q", definition.Name)
+		}
+		byName[definition.Name] = definition
+	}
+	for _, definition := range definitions {
+		for _, after := range definition.After {
+			if _, ok := byName[after]; !ok {
+				return nil, CError("the job %q runs after the unknown job %q", definition.Name, after)
+			}
+		}
+	}
+
+	var ordered []jobDefinition
+	// visiting the jobs being ordered, the ones ordered already are done
+	visiting, done := map[string]bool{}, map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		path = append(path, name)
+		if visiting[name] {
+			return CError("the jobs run after each other: %s", strings.Join(path, " -> "))
+		}
+		visiting[name] = true
+		for _, after := range byName[name].After {
+			if err := visit(after, path); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		ordered = append(ordered, byName[name])
+		return nil
+	}
+	for _, definition := range definitions {
+		if err := visit(definition.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// jobModes returns the modes of a job, pages if not set
+func jobModes(definition jobDefinition) ([]string, error) {
+	if len(definition.Modes) == 0 {
+		return []string{downloader.Modes[0]}, nil
+	}
+	var modes []string
+	listed := map[string]bool{}
+	for _, m := range definition.Modes {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m != downloader.AllModes && !downloader.IsExportMode(m) {
+			return nil, CError("invalid mode %q of the job %q, the modes are 'pages', 'links', 'hints' or 'all'", m, definition.Name)
+		}
+		if !listed[m] {
+			modes, listed[m] = append(modes, m), true
+		}
+	}
+	if len(modes) > 1 && listed[downloader.AllModes] {
+		return nil, CError("the mode 'all' of the job %q downloads every mode already, list it alone", definition.Name)
+	}
+	return modes, nil
+}
+
+// jobOutputValidation makes sure the downloads of a job are written to their own output
+func jobOutputValidation(definition jobDefinition, modes []string) error {
+	if len(definition.Crawls) == 0 {
+		return CError("the job %q has no crawls", definition.Name)
+	}
+	if definition.Output == "" || definition.Output == downloader.StdoutOutput {
+		return CError("Set the output of the job %q: the rows of several jobs can't be streamed to stdout", definition.Name)
+	}
+	if err := downloader.ValidateOutputTemplate(definition.Output); err != nil {
+		return CError("the output of the job %q: %v", definition.Name, err)
+	}
+	if len(definition.Crawls) > 1 && !downloader.HasPlaceholder(definition.Output, downloader.CrawlIDPlaceholder) {
+		return CError("Add %s to the output of the job %q, it downloads several crawls", downloader.CrawlIDPlaceholder, definition.Name)
+	}
+	if len(modes) > 1 && !downloader.HasPlaceholder(definition.Output, downloader.ModePlaceholder) {
+		return CError("Add %s to the output of the job %q, it downloads several modes", downloader.ModePlaceholder, definition.Name)
+	}
+	return nil
+}
+
+// jobSettings returns the flags of a job, its own taking precedence over the defaults of the job-spec file.
+// The flags set by the planner can't be set, nor the rate limit when it's shared.
+func jobSettings(defaults map[string]interface{}, definition jobDefinition, sharedRateLimit bool) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	for _, flags := range []map[string]interface{}{defaults, definition.Flags} {
+		for key, value := range flags {
+			if jobManagedFlags[key] {
+				return nil, CError("the %q flag of the job %q is set by the job-spec file itself, e.g. by its crawls, modes or output",
+					key, definition.Name)
+			}
+			if key == "rate-limit" && sharedRateLimit {
+				return nil, CError("the rate limit of the job %q is shared by every job, set the one of the job-spec file", definition.Name)
+			}
+			if RootCmd.PersistentFlags().Lookup(key) == nil {
+				return nil, CError("unknown flag %q of the job %q", key, definition.Name)
+			}
+			if _, ok := value.(map[interface{}]interface{}); ok {
+				return nil, CError("invalid %q flag of the job %q: expected a value or a list", key, definition.Name)
+			}
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
+
+// jobArgs returns the arguments of the process of a download: its crawl, mode and output, then its flags
+func (p *jobPlan) jobArgs(job *plannedJob, settings map[string]interface{}, flags *pflag.FlagSet) []string {
+	args := []string{"--crawl=" + strconv.FormatUint(job.crawl, 10), "--mode=" + job.mode, "--output=" + job.output}
+	if flags.Changed("config") {
+		args = append(args, "--config="+configPath)
+	}
+	if p.rateLimit != "" {
+		args = append(args, "--rate-limit="+p.rateLimit)
+	}
+	// sort the flags, so the jobs are run consistently
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// a list sets a repeatable flag once per item
+		values, ok := settings[key].([]interface{})
+		if !ok {
+			values = []interface{}{settings[key]}
+		}
+		for _, value := range values {
+			args = append(args, "--"+key+"="+fmt.Sprint(value))
+		}
+	}
+	return args
+}
+
+// rateLimitShare returns the share of a rate limit of every job running, per hour so it's not rounded down to
+// nothing, e.g. 10/s for 4 jobs is 9000/h each
+func rateLimitShare(limit string, workers int) (string, error) {
+	requests, per, err := downloader.ParseRateLimit(limit)
+	if err != nil {
+		return "", err
+	}
+	share := int64(float64(requests) * float64(time.Hour) / float64(per) / float64(workers))
+	if share < 1 {
+		share = 1
+	}
+	return fmt.Sprintf("%d/h", share), nil
+}
+
+// print prints the plan: the downloads in the order they're run, with the jobs they run after
+func (p *jobPlan) print() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Jobs:\t%d downloads, %d at a time\n", len(p.jobs), p.workers)
+	if p.rateLimit != "" {
+		fmt.Fprintf(w, "Rate limit:\t%s per job\n", p.rateLimit)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "#\tJOB\tCRAWL\tMODE\tOUTPUT\tAFTER")
+	for _, job := range p.jobs {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", job.index+1, job.label, job.crawl, job.mode, job.output, strings.Join(job.after, ", "))
+	}
+	return w.Flush()
+}
+
+// jobResult the result of a download of a job
+type jobResult struct {
+	job      *plannedJob
+	skipped  string // why it was not run, "" if it was
+	err      error
+	code     int // the exit code of its process
+	duration time.Duration
+	summary  *runSummary // the summary of its process, nil if it's not known
+}
+
+// jobError is the failure of one of several jobs, with the exit code of its process
+type jobError struct {
+	job  string
+	code int
+	err  error
+}
+
+// jobsError is the failure of some of the jobs of a job-spec file, the other ones being downloaded
+type jobsError struct {
+	failed  []jobError
+	skipped int
+	total   int
+}
+
+func (e *jobsError) Error() string {
+	messages := make([]string, len(e.failed))
+	for i, failed := range e.failed {
+		messages[i] = fmt.Sprintf("job %s: %v", failed.job, failed.err)
+	}
+	message := fmt.Sprintf("%d of %d jobs failed", len(e.failed), e.total)
+	if e.skipped > 0 {
+		message += fmt.Sprintf(", %d skipped", e.skipped)
+	}
+	return message + ": " + strings.Join(messages, "; ")
+}
+
+// run runs the downloads of the plan, --parallel-jobs at a time, in the order of the plan: a download starts once
+// the jobs it runs after completed, it's skipped once one of them failed. An interrupt stops every job once the
+// chunks being downloaded are written, the processes sharing the terminal; the jobs not started are skipped.
+func (p *jobPlan) run(ctx context.Context) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// the summaries of the jobs, read once they're done
+	dir, err := ioutil.TempDir("", "audisto-jobs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	started := time.Now()
+	remaining := map[string]int{}
+	for job, downloads := range p.downloads {
+		remaining[job] = downloads
+	}
+	failedJobs := map[string]bool{}
+	var results []*jobResult
+	finished := func(result *jobResult) {
+		remaining[result.job.job]--
+		if result.err != nil || result.skipped != "" {
+			failedJobs[result.job.job] = true
+		}
+		results = append(results, result)
+		switch {
+		case result.skipped != "":
+			PrintYellow("Job %s skipped: %s", result.job.label, result.skipped)
+		case result.err != nil:
+			if ctx.Err() == nil {
+				PrintRed("Job %s failed: %v", result.job.label, result.err)
+			}
+		case !quiet:
+			PrintBlue("Job %s downloaded in %s", result.job.label, PrettyTime(result.duration))
+		}
+	}
+
+	done := make(chan *jobResult)
+	pending, running := p.jobs, 0
+	for len(pending) > 0 || running > 0 {
+		// start the downloads ready, skip the ones whose jobs failed, until nothing changes
+		for changed := true; changed; {
+			changed = false
+			var waiting []*plannedJob
+			for _, job := range pending {
+				reason, ready := "", true
+				for _, after := range job.after {
+					if failedJobs[after] {
+						reason = "the job " + after + " did not complete"
+					} else if remaining[after] > 0 {
+						ready = false
+					}
+				}
+				if ctx.Err() != nil {
+					reason = "interrupted"
+				}
+				switch {
+				case reason != "":
+					finished(&jobResult{job: job, skipped: reason})
+					changed = true
+				case ready && running < p.workers:
+					running++
+					changed = true
+					go func(job *plannedJob) {
+						done <- runJob(executable, job, dir)
+					}(job)
+				default:
+					waiting = append(waiting, job)
+				}
+			}
+			pending = waiting
+		}
+		if running == 0 {
+			continue
+		}
+		finished(<-done)
+		running--
+	}
+
+	err = p.summarize(results, time.Since(started))
+	jobsErr := &jobsError{total: len(p.jobs)}
+	for _, result := range results {
+		if result.skipped != "" {
+			jobsErr.skipped++
+		} else if result.err != nil {
+			jobsErr.failed = append(jobsErr.failed, jobError{job: result.job.label, code: result.code, err: result.err})
+		}
+	}
+	if len(jobsErr.failed) > 0 {
+		return jobsErr
+	}
+	if jobsErr.skipped > 0 {
+		return fmt.Errorf("%d of %d jobs skipped", jobsErr.skipped, jobsErr.total)
+	}
+	return err
+}
+
+// runJob runs a download of a job in a process of its own
+func runJob(executable string, job *plannedJob, dir string) *jobResult {
+	summaryPath := filepath.Join(dir, strconv.Itoa(job.index)+".json")
+	process := exec.Command(executable, append(job.args, "--summary-file="+summaryPath)...)
+	stdout := newPrefixedWriter(os.Stdout, "["+job.label+"] ")
+	stderr := newPrefixedWriter(os.Stderr, "["+job.label+"] ")
+	process.Stdout, process.Stderr = stdout, stderr
+
+	started := time.Now()
+	err := process.Run()
+	stdout.flush()
+	stderr.flush()
+	result := &jobResult{job: job, duration: time.Since(started)}
+	if data, readErr := ioutil.ReadFile(summaryPath); readErr == nil {
+		summary := &runSummary{}
+		if json.Unmarshal(data, summary) == nil {
+			result.summary = summary
+		}
+	}
+	if err != nil {
+		result.err, result.code = err, exitFailure
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.code = exitErr.ExitCode()
+		}
+	}
+	return result
+}
+
+// jobsSummary the JSON summary of run --jobs written to --summary-file: the totals of the downloads of every
+// job, then every download, then every job
+type jobsSummary struct {
+	runSummary
+	Jobs []jobSummary `json:"jobs"`
+}
+
+// jobSummary the result of a download of a job
+type jobSummary struct {
+	Job             string  `json:"job"`
+	Crawl           uint64  `json:"crawl"`
+	Mode            string  `json:"mode"`
+	Output          string  `json:"output"`
+	Status          string  `json:"status"` // completed, failed or skipped
+	Rows            uint64  `json:"rows"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// summarize prints the result of every download of the plan, in the order of the plan, then writes the summary
+// of the run to --summary-file if set
+func (p *jobPlan) summarize(results []*jobResult, duration time.Duration) error {
+	sort.Slice(results, func(i, j int) bool { return results[i].job.index < results[j].job.index })
+	summary := jobsSummary{runSummary: runSummary{Event: downloader.CompletedEvent, DurationSeconds: duration.Seconds(),
+		Downloads: []downloader.RunSummary{}}}
+	for _, result := range results {
+		job := jobSummary{Job: result.job.label, Crawl: result.job.crawl, Mode: result.job.mode, Output: result.job.output,
+			Status: downloader.CompletedEvent, DurationSeconds: result.duration.Seconds()}
+		switch {
+		case result.skipped != "":
+			job.Status, job.Error = "skipped", result.skipped
+		case result.err != nil:
+			job.Status, job.Error = downloader.FailedEvent, result.err.Error()
+		}
+		if job.Status != downloader.CompletedEvent {
+			summary.Event = downloader.FailedEvent
+		}
+		if result.summary != nil {
+			job.Rows, job.Bytes = result.summary.Rows, result.summary.Bytes
+			summary.Elements += result.summary.Elements
+			summary.Rows += result.summary.Rows
+			summary.Bytes += result.summary.Bytes
+			summary.APICalls += result.summary.APICalls
+			summary.Retries += result.summary.Retries
+			summary.Downloads = append(summary.Downloads, result.summary.Downloads...)
+		}
+		summary.Jobs = append(summary.Jobs, job)
+	}
+
+	if !quiet {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "JOB\tCRAWL\tMODE\tSTATUS\tROWS\tSIZE\tDURATION\tOUTPUT")
+		for _, job := range summary.Jobs {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%s\t%s\t%s\n", job.Job, job.Crawl, job.Mode, job.Status, job.Rows,
+				PrettyByteSize(uint64(job.Bytes)), PrettyTime(time.Duration(job.DurationSeconds*float64(time.Second))), job.Output)
+		}
+		fmt.Fprintf(w, "Total\t\t\t\t%d\t%s\t%s\t\n", summary.Rows, PrettyByteSize(uint64(summary.Bytes)), PrettyTime(duration))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if summaryFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if summaryFile == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(summaryFile, data, 0644)
+}
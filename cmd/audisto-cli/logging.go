@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// textLogFormat human-readable log lines
+	textLogFormat = "text"
+	// jsonLogFormat one JSON object per log entry
+	jsonLogFormat = "json"
+)
+
+// newLogger makes the logger download events are sent to, as per the logging flags:
+// only errors are logged by default and with --quiet, every event with --verbose,
+// and from chunks finished on with --log-format=json
+func newLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = os.Stderr
+
+	if logFormat == jsonLogFormat {
+		logger.Formatter = &logrus.JSONFormatter{}
+	} else {
+		logger.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	}
+
+	switch {
+	case quiet:
+		logger.Level = logrus.ErrorLevel
+	case verbose:
+		logger.Level = logrus.DebugLevel
+	case logFormat == jsonLogFormat:
+		logger.Level = logrus.InfoLevel
+	default:
+		logger.Level = logrus.ErrorLevel
+	}
+	return logger
+}
+
+// showProgressBar checks if the progress is rendered, events being logged instead with
+// --verbose and --log-format=json, and nothing but errors being printed with --quiet
+func showProgressBar() bool {
+	return !quiet && !verbose && logFormat != jsonLogFormat
+}
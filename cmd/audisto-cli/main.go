@@ -7,7 +7,27 @@ import (
 func main() {
 
 	if err := RootCmd.Execute(); err != nil {
+		if sig := interruptSignal(); sig != nil {
+			PrintYellow(interruptedMessage())
+			os.Exit(signalExitCode(sig))
+		}
+		code := exitCode(err)
+		if code == exitJobTimeout {
+			// with --mode=all, the modes share the job timeout
+			PrintRed("The download did not complete within --job-timeout=%v", jobTimeout)
+			if resumableOutput() {
+				PrintYellow("Run the same command again to resume it")
+			}
+			os.Exit(code)
+		}
+		if code == exitBudget {
+			PrintRed(err.Error())
+			if resumableOutput() {
+				PrintYellow("Run the same command again to resume it, once the quota allows")
+			}
+			os.Exit(code)
+		}
 		PrintRed(err.Error())
-		os.Exit(-1)
+		os.Exit(code)
 	}
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+var (
+	// runningDownloads the downloads running, several crawls being downloaded in parallel, paused and resumed
+	// together by SIGUSR1 and the control socket
+	runningDownloads   = map[*downloader.Downloader]bool{}
+	runningDownloadsMu sync.Mutex
+	// downloadsPaused the downloads are paused, the ones starting being paused too
+	downloadsPaused bool
+)
+
+// trackDownload tracks a download while it runs, for it to be paused and resumed. It returns the function
+// untracking it once it returned.
+func trackDownload(download *downloader.Downloader) func() {
+	runningDownloadsMu.Lock()
+	defer runningDownloadsMu.Unlock()
+	runningDownloads[download] = true
+	if downloadsPaused {
+		download.Pause()
+	}
+	return func() {
+		runningDownloadsMu.Lock()
+		defer runningDownloadsMu.Unlock()
+		delete(runningDownloads, download)
+	}
+}
+
+// setDownloadsPaused pauses or resumes the downloads running. It returns false when they were already.
+func setDownloadsPaused(paused bool) bool {
+	runningDownloadsMu.Lock()
+	defer runningDownloadsMu.Unlock()
+	if downloadsPaused == paused {
+		return false
+	}
+	downloadsPaused = paused
+	for download := range runningDownloads {
+		if paused {
+			download.Pause()
+		} else {
+			download.Resume()
+		}
+	}
+	if paused {
+		PrintYellow("Pausing once the current chunks are written%s", resumeHint())
+	} else {
+		PrintYellow("Resuming")
+	}
+	return true
+}
+
+// pausedDownloads tells if the downloads are paused
+func pausedDownloads() bool {
+	runningDownloadsMu.Lock()
+	defer runningDownloadsMu.Unlock()
+	return downloadsPaused
+}
+
+// resumeHint tells how the paused downloads are resumed
+func resumeHint() string {
+	hints := []string{}
+	if pauseSignalName != "" {
+		hints = append(hints, fmt.Sprintf("send %s to process %d", pauseSignalName, os.Getpid()))
+	}
+	if controlSocket != "" {
+		hints = append(hints, fmt.Sprintf("send resume to %s", controlSocket))
+	}
+	if len(hints) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(hints, " or ") + " to resume"
+}
+
+// serveControlSocket listens on the --control-socket unix socket, if set: every line sent is a command,
+// pause, resume or status, answered with the status of the downloads, paused or running. It returns the
+// function closing the socket.
+func serveControlSocket() (func(), error) {
+	if controlSocket == "" {
+		return func() {}, nil
+	}
+	// a socket left by a process that didn't exit cleanly is replaced, other files are not
+	if info, err := os.Lstat(controlSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(controlSocket)
+	}
+	listener, err := net.Listen("unix", controlSocket)
+	if err != nil {
+		return nil, CError("cannot listen on --control-socket: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveControlConn(conn)
+		}
+	}()
+	return func() { listener.Close() }, nil
+}
+
+// serveControlConn answers the commands of a connection to the control socket, until it's closed
+func serveControlConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch command := strings.ToLower(strings.TrimSpace(scanner.Text())); command {
+		case "":
+			continue
+		case "pause":
+			setDownloadsPaused(true)
+		case "resume":
+			setDownloadsPaused(false)
+		case "status":
+		default:
+			fmt.Fprintf(conn, "error: unknown command %q, the commands are pause, resume and status\n", command)
+			continue
+		}
+		status := "running"
+		if pausedDownloads() {
+			status = "paused"
+		}
+		fmt.Fprintln(conn, status)
+	}
+}
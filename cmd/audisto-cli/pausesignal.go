@@ -0,0 +1,28 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// pauseSignalName the signal toggling the pause of the downloads
+const pauseSignalName = "SIGUSR1"
+
+var pauseSignalOnce sync.Once
+
+// watchPauseSignal pauses the downloads on SIGUSR1 and resumes them on the next one
+func watchPauseSignal() {
+	pauseSignalOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR1)
+		go func() {
+			for range signals {
+				setDownloadsPaused(!pausedDownloads())
+			}
+		}()
+	})
+}
@@ -0,0 +1,9 @@
+// +build windows
+
+package main
+
+// pauseSignalName Windows has no signal to pause the downloads with, only --control-socket
+const pauseSignalName = ""
+
+// watchPauseSignal does nothing under Windows: it has no SIGUSR1
+func watchPauseSignal() {}
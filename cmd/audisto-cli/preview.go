@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// previewMaxRows the most rows previewed, they're downloaded in a single chunk
+	previewMaxRows = 1000
+
+	// previewCellWidth the width values are truncated to, unless --wide is passed
+	previewCellWidth = 40
+)
+
+var (
+	previewID   uint64 // ID of the crawl to preview, --crawl if NOT explicitly set
+	previewRows int    // the number of rows previewed
+	previewWide bool   // print the values in full instead of truncating them
+)
+
+func init() {
+	RootCmd.AddCommand(previewCmd)
+	previewCmd.Flags().Uint64VarP(&previewID, "id", "", 0, "ID of the crawl to preview (defaults to --crawl)")
+	previewCmd.Flags().IntVarP(&previewRows, "rows", "n", 20, fmt.Sprintf("Number of rows printed, at most %d", previewMaxRows))
+	previewCmd.Flags().BoolVarP(&previewWide, "wide", "", false, fmt.Sprintf("If passed, the values are printed in full instead of being truncated to %d characters", previewCellWidth))
+}
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Print the first rows of a crawl as a table",
+	Long: `Download the first rows of a crawl in a single small chunk and print them as an aligned table, to check
+--filter, --order, --columns, --where and --transform before running the real export. Nothing is written,
+e.g. data-downloader preview --id 12345 --mode pages -n 20 --columns status_code,url`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnvironment(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyKeyring(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := credentialsValidation(); err != nil {
+			return err
+		}
+		if apiToken == "" && (username == "" || password == "") {
+			return CError("--username and --password (or --api-token) are required, either passed, set in the environment, in the config file or stored by auth login")
+		}
+		normalizeFlags()
+		if previewID == 0 {
+			previewID = crawlIDs.first()
+		}
+		if previewID == 0 {
+			return CError("--id is required")
+		}
+		if !downloader.IsExportMode(mode) {
+			return CError("mode has to be 'links', 'pages' or 'hints' to preview a crawl")
+		}
+		if previewRows < 1 || previewRows > previewMaxRows {
+			return CError("--rows has to be between 1 and %d", previewMaxRows)
+		}
+		if !noFilterCheck {
+			if err := downloader.ValidateFilter(mode, filter); err != nil {
+				return CError(err.Error())
+			}
+		}
+
+		rows, err := previewCrawl(previewID, mode)
+		if err != nil {
+			return err
+		}
+		if len(rows) < 2 {
+			PrintYellow("No rows to preview")
+			return nil
+		}
+		return printTable(os.Stdout, rows, previewWide)
+	},
+}
+
+// previewCrawl downloads the first rows of a crawl with the settings of the flags, header included, to a
+// temporary tsv file removed once read
+func previewCrawl(crawl uint64, mode string) ([][]string, error) {
+	dir, err := ioutil.TempDir(tmpDir, "data-downloader-preview")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "preview.tsv")
+
+	options, err := downloadOptions(crawl, mode, output)
+	if err != nil {
+		return nil, err
+	}
+	// a single chunk of the first rows, written as is from scratch: only the settings selecting
+	// and shaping the rows are kept
+	options.Limit = uint64(previewRows)
+	options.ChunkSize = uint64(previewRows)
+	options.AutoChunkSize = false
+	options.ChunkNumber = 0
+	options.Concurrency = 1
+	options.NoResume = true
+	options.MustResume = false
+	options.NoHeader = false
+	options.Sample = ""
+	options.OutputFormat = downloader.TSVOutputFormat
+	options.Compression = ""
+	options.Encrypt = ""
+	options.Checksum = false
+	options.SplitRows = 0
+	options.SplitSize = 0
+	options.PartitionBy = ""
+	options.DiffBaseline = ""
+	options.DiffKey = nil
+	options.DiffSplit = false
+	options.SkipFailedChunks = false
+	options.DiskSpaceCheck = false
+	options.WaitForCrawl = false
+	options.Notifiers = nil
+
+	if err = downloader.New(options).Run(interruptContext()); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(strings.TrimRight(line, "\r"), "\t"))
+		}
+	}
+	return rows, nil
+}
+
+// printTable prints the rows as a table aligned on the widest value of every column, the first row
+// being the header. The values are truncated to previewCellWidth characters unless wide
+func printTable(w io.Writer, rows [][]string, wide bool) error {
+	var widths []int
+	for i, row := range rows {
+		for j, value := range row {
+			if !wide {
+				value = truncateCell(value, previewCellWidth)
+			}
+			rows[i][j] = value
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(value); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	line := func(row []string) string {
+		cells := make([]string, len(row))
+		for j, value := range row {
+			cells[j] = value + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(value))
+		}
+		return strings.TrimRight(strings.Join(cells, "  "), " ")
+	}
+	separators := make([]string, len(widths))
+	for j, width := range widths {
+		separators[j] = strings.Repeat("-", width)
+	}
+
+	if _, err := fmt.Fprintln(w, line(rows[0])); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, line(separators)); err != nil {
+		return err
+	}
+	for _, row := range rows[1:] {
+		if _, err := fmt.Fprintln(w, line(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateCell truncates a value to width characters, ending it with an ellipsis when truncated
+func truncateCell(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width {
+		return value
+	}
+	runes := []rune(value)
+	return string(runes[:width-1]) + "…"
+}
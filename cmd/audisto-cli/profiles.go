@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/pflag"
+)
+
+// profileCredentialVariables the environment variables of the credentials, they're not passed to the profiles:
+// they'd take precedence over the credentials of every profile
+var profileCredentialVariables = []string{"AUDISTO_USERNAME", "AUDISTO_PASSWORD", "AUDISTO_TOKEN"}
+
+// profileError is the failure of one of several profiles, with the exit code of its process
+type profileError struct {
+	profile string
+	code    int
+	err     error
+}
+
+// profilesError is the failure of some of several profiles, the other ones being downloaded
+type profilesError struct {
+	failed []profileError
+	total  int
+}
+
+func (e *profilesError) Error() string {
+	messages := make([]string, len(e.failed))
+	for i, failed := range e.failed {
+		messages[i] = fmt.Sprintf("profile %s: %v", failed.profile, failed.err)
+	}
+	return fmt.Sprintf("%d of %d profiles failed: %s", len(e.failed), e.total, strings.Join(messages, "; "))
+}
+
+// profilesValidation returns the profiles of --profiles, making sure they're in the config file and downloaded to
+// their own output
+func profilesValidation(flags *pflag.FlagSet) ([]string, error) {
+	if profile != "" {
+		return nil, CError("either --profile or --profiles can be used, not both")
+	}
+	if parallelProfiles < 1 {
+		return nil, CError("--parallel-profiles has to be at least 1")
+	}
+	if flags.Changed("username") || flags.Changed("password") || flags.Changed("api-token") {
+		return nil, CError("the credentials of --profiles are the ones of every profile, don't pass --username, --password nor --api-token")
+	}
+
+	conf, path, err := loadFlagsConfig(flags)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	outputs := map[string]string{}
+	for _, name := range strings.Split(profiles, ",") {
+		if name = strings.TrimSpace(name); name == "" || containsProfile(names, name) {
+			continue
+		}
+		settings, ok := conf[name]
+		if !ok {
+			return nil, CError("profile %q not found in config file %s", name, path)
+		}
+
+		// the output passed applies to every profile, the {profile} telling them apart
+		profileOutput := output
+		if !flags.Changed("output") && settings["output"] != nil {
+			profileOutput = fmt.Sprint(settings["output"])
+		}
+		if profileOutput == "" || profileOutput == downloader.StdoutOutput {
+			return nil, CError("Set --output, or the output of the profile %q, to use --profiles: the rows of several profiles can't be streamed to stdout", name)
+		}
+		profileOutput = downloader.ExpandOutput(profileOutput, map[string]string{downloader.ProfilePlaceholder: name})
+		if other, ok := outputs[profileOutput]; ok {
+			return nil, CError("the profiles %q and %q are downloaded to the same output %s, add %s to --output",
+				other, name, profileOutput, downloader.ProfilePlaceholder)
+		}
+		outputs[profileOutput] = name
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, CError("no profile in --profiles")
+	}
+	return names, nil
+}
+
+func containsProfile(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runProfiles runs the download for every profile of --profiles, --parallel-profiles at a time. Every profile is
+// run by a process of its own with the arguments of the command and --profile, so the credentials, rate limits
+// and outputs of the profiles stay apart. Their messages are prefixed by their profile. A failed profile is
+// reported, the other profiles are still downloaded unless interrupted: the processes share the terminal, an
+// interrupt stops every profile once the chunks being downloaded are written.
+func runProfiles(ctx context.Context, flags *pflag.FlagSet, args []string) error {
+	names, err := profilesValidation(flags)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	workers := parallelProfiles
+	if workers > len(names) {
+		workers = len(names)
+	}
+	var mutex sync.Mutex
+	var failed []profileError
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				failure := runProfile(executable, args, name)
+				if failure == nil {
+					if !quiet {
+						PrintBlue("Profile %s downloaded", name)
+					}
+					continue
+				}
+				if ctx.Err() == nil {
+					PrintRed("Profile %s failed: %v", name, failure.err)
+				}
+				mutex.Lock()
+				failed = append(failed, *failure)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return &profilesError{failed: failed, total: len(names)}
+}
+
+// runProfile runs the download of a profile in a process of its own, nil once it succeeded
+func runProfile(executable string, args []string, name string) *profileError {
+	process := exec.Command(executable, profileArgs(args, name)...)
+	stdout := newPrefixedWriter(os.Stdout, "["+name+"] ")
+	stderr := newPrefixedWriter(os.Stderr, "["+name+"] ")
+	process.Stdout, process.Stderr, process.Stdin = stdout, stderr, os.Stdin
+	process.Env = profileEnvironment()
+
+	err := process.Run()
+	stdout.flush()
+	stderr.flush()
+	if err == nil {
+		return nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &profileError{profile: name, code: exitErr.ExitCode(), err: err}
+	}
+	return &profileError{profile: name, code: exitFailure, err: err}
+}
+
+// profileArgs returns the arguments of the command for a profile: --profiles and --parallel-profiles are
+// replaced with --profile
+func profileArgs(args []string, name string) []string {
+	var profileArgs []string
+	for i := 0; i < len(args); i++ {
+		flag := strings.TrimLeft(strings.SplitN(args[i], "=", 2)[0], "-")
+		if strings.HasPrefix(args[i], "-") && (flag == "profiles" || flag == "parallel-profiles") {
+			// the value is the next argument, unless given with =
+			if !strings.Contains(args[i], "=") {
+				i++
+			}
+			continue
+		}
+		profileArgs = append(profileArgs, args[i])
+	}
+	return append(profileArgs, "--profile="+name)
+}
+
+// profileEnvironment returns the environment of the processes of the profiles, without the credentials
+func profileEnvironment() []string {
+	var environment []string
+	for _, variable := range os.Environ() {
+		credential := false
+		for _, name := range profileCredentialVariables {
+			credential = credential || strings.HasPrefix(variable, name+"=")
+		}
+		if !credential {
+			environment = append(environment, variable)
+		}
+	}
+	return environment
+}
+
+// prefixedOutput serializes the lines of the profiles written to the same output
+var prefixedOutput sync.Mutex
+
+// prefixedWriter writes the lines written to it with a prefix, a line at a time
+type prefixedWriter struct {
+	w      io.Writer
+	prefix string
+	line   bytes.Buffer
+}
+
+func newPrefixedWriter(w io.Writer, prefix string) *prefixedWriter {
+	return &prefixedWriter{w: w, prefix: prefix}
+}
+
+func (w *prefixedWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.line.WriteByte(b)
+		if b == '\n' {
+			if err := w.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the line written so far, if any
+func (w *prefixedWriter) flush() error {
+	if w.line.Len() == 0 {
+		return nil
+	}
+	prefixedOutput.Lock()
+	defer prefixedOutput.Unlock()
+	_, err := fmt.Fprint(w.w, w.prefix+w.line.String())
+	w.line.Reset()
+	return err
+}
@@ -2,31 +2,73 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
 
 	"github.com/audisto/data-downloader/pkg/downloader"
 	"github.com/gosuri/uilive"
 	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
-// RenderProgress render the progressbar animation and the download status information
-func RenderProgress(progressReport <-chan downloader.StatusReport) {
-	// Make a realtime Stdout writer using uilive
+const (
+	// ProgressLogInterval time between two progress lines, when stdout is not a terminal
+	ProgressLogInterval = 10 * time.Second
+)
+
+// RenderProgress render the progressbar animation and the download status information, until the
+// progress channel is closed. It returns the last status report.
+// When stdout is not a terminal (e.g. redirected to a file or a CI log), periodic progress lines
+// are printed to stderr instead, as they are on the consoles that can't render the bar (legacy Windows
+// consoles). When the rows are streamed to stdout, the progress goes to stderr.
+func RenderProgress(progressReport <-chan downloader.StatusReport) downloader.StatusReport {
+	if terminal := progressOutput(); isatty.IsTerminal(terminal.Fd()) && setupConsole(terminal) {
+		return renderProgressBar(progressReport, terminal)
+	}
+	return renderProgressLog(progressReport, os.Stderr)
+}
+
+// progressOutput returns the terminal the progress and the messages are printed to:
+// stdout, unless the rows are streamed to it
+func progressOutput() *os.File {
+	if output == "" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printCompletion prints some useful basic download stats, once the download completed without errors
+func printCompletion(lastProgress downloader.StatusReport, duration time.Duration) {
+	finishMessage := "\n\nDownload Completed in " + PrettyTime(duration)
+
+	fi, e := os.Stat(lastProgress.OutputFilename)
+	if e == nil {
+		filesize := uint64(fi.Size())
+		filesizeStr := PrettyByteSize(filesize)
+		finishMessage += fmt.Sprintf("\nGot %s Saved to: %s", filesizeStr, lastProgress.OutputFilename)
+	} else if downloader.IsRemoteOutput(lastProgress.OutputFilename) {
+		finishMessage += fmt.Sprintf("\nUploaded to: %s", lastProgress.OutputFilename)
+	} else if downloader.IsTableOutputLocation(lastProgress.OutputFilename) {
+		finishMessage += fmt.Sprintf("\nLoaded into: %s", lastProgress.OutputFilename)
+	}
+
+	fmt.Fprintln(colorable.NewColorable(progressOutput()), fStringGreen(finishMessage))
+}
+
+// renderProgressBar render the progressbar animation in the terminal, until the progress channel is closed
+func renderProgressBar(progressReport <-chan downloader.StatusReport, terminal *os.File) downloader.StatusReport {
+	// Make a realtime terminal writer using uilive
 	writer := uilive.New()
+	writer.Out = terminal
 	// Make a new progres bar with 100 as its target/percentage
 	bar := pb.New(100)
 	var bar2 *pb.ProgressBar
 
-	// By default, the percentage is 0, to be incremented by the progress report
-	// percentage := 0
-	// Keep track of the time this has been called, so we can know how much time
-	// the whole download progress took.
-	startTime := time.Now()
 	// Don't show the built-in counters
 	bar.ShowCounters = false
 
@@ -52,10 +94,12 @@ func RenderProgress(progressReport <-chan downloader.StatusReport) {
 
 	var msg string                           // this hold what will be rendered in Stdout
 	var lastProgress downloader.StatusReport // keep a reference to the last status report
+	var speed throughput
 
 	for progress := range progressReport { // for each element received on the channel
 		// keep track of the last progress made, we'll need it for stats later
 		lastProgress = progress
+		bytesPerSecond, eta := speed.update(progress)
 		// clean the message on each new iteration
 		msg = "\n"
 		// print the log messages received, BEFORE the progress bar rendering
@@ -94,11 +138,15 @@ func RenderProgress(progressReport <-chan downloader.StatusReport) {
 		}
 
 		// build up the progress bar
-		preMsg := fmt.Sprintf("ETA %s |", progress.ETA)
-		preMsg += fmt.Sprintf(" Chunk size %d |", progress.ChunkSize)
+		preMsg := fmt.Sprintf("ETA %s |", PrettyTime(eta))
+		preMsg += fmt.Sprintf(" %s/s |", PrettyByteSize(uint64(bytesPerSecond)))
+		preMsg += fmt.Sprintf(" Chunk %d (size %d) |", progress.CurrentChunk, progress.ChunkSize)
 		preMsg += fmt.Sprintf("%d of %d %s |", progress.DoneElements, progress.TotalElements, progress.Mode)
 		preMsg += fmt.Sprintf(" %d Timeouts |", progress.TimeoutsCount)
 		preMsg += fmt.Sprintf(" %d Errors ", progress.ErrorsCount)
+		if progress.Paused {
+			preMsg = "Paused | " + preMsg
+		}
 		bar.Prefix(preMsg)
 		percentage := math.Ceil(progress.ProgressPercentage)
 		bar.Set(int(percentage))
@@ -116,19 +164,75 @@ func RenderProgress(progressReport <-chan downloader.StatusReport) {
 		// flush the previous writer buffer
 		writer.Flush()
 	}
+	return lastProgress
+}
 
-	// no more progress is being made
-	// reaching this block means the downloader has finished downloading without errors
-	// Print some useful basic download stats
-	finishMessage := "\n\nDownload Completed in " + PrettyTime(time.Since(startTime))
+// renderProgressLog prints the log messages as they come, and a progress line every ProgressLogInterval,
+// until the progress channel is closed
+func renderProgressLog(progressReport <-chan downloader.StatusReport, w io.Writer) downloader.StatusReport {
+	var lastProgress downloader.StatusReport // keep a reference to the last status report
+	var lastLine time.Time
+	var speed throughput
+	printedLogs := 0
 
-	fi, e := os.Stat(lastProgress.OutputFilename)
-	if e == nil {
-		filesize := uint64(fi.Size())
-		filesizeStr := PrettyByteSize(filesize)
-		finishMessage += fmt.Sprintf("\nGot %s Saved to: %s", filesizeStr, lastProgress.OutputFilename)
+	for progress := range progressReport {
+		lastProgress = progress
+		bytesPerSecond, eta := speed.update(progress)
+
+		// the logs are reported from the start, only print the new ones
+		if len(progress.Logs) < printedLogs {
+			printedLogs = 0
+		}
+		for _, f := range progress.Logs[printedLogs:] {
+			for key, value := range f {
+				if key == downloader.WARNING {
+					value = "WARNING: " + value
+				}
+				fmt.Fprintln(w, strings.TrimRight(value, "\n"))
+			}
+		}
+		printedLogs = len(progress.Logs)
+
+		if time.Since(lastLine) < ProgressLogInterval && !progress.IsDone() {
+			continue
+		}
+		lastLine = time.Now()
+
+		fmt.Fprintf(w, "%.1f%% | %d of %d %s | Chunk %d (size %d) | %s/s | ETA %s | %d Timeouts | %d Errors\n",
+			progress.ProgressPercentage, progress.DoneElements, progress.TotalElements, progress.Mode,
+			progress.CurrentChunk, progress.ChunkSize, PrettyByteSize(uint64(bytesPerSecond)), PrettyTime(eta),
+			progress.TimeoutsCount, progress.ErrorsCount)
 	}
+	return lastProgress
+}
+
+// throughput measures the download speed and estimates the time left,
+// from the progress made since the first status report of the current target
+type throughput struct {
+	start         time.Time
+	startBytes    uint64
+	startElements uint64
+}
 
-	msg += fStringGreen(finishMessage)
-	fmt.Fprintf(colorable.NewColorableStdout(), msg+"\n")
+// update returns the bytes downloaded per second and the estimated time left, 0 until it can be measured
+func (t *throughput) update(progress downloader.StatusReport) (bytesPerSecond float64, eta time.Duration) {
+	// elements are counted again from 0 for every target, the measure starts over
+	if t.start.IsZero() || progress.DoneElements < t.startElements {
+		t.start = time.Now()
+		t.startBytes = progress.DownloadedBytes
+		t.startElements = progress.DoneElements
+		return 0, 0
+	}
+
+	elapsed := time.Since(t.start).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	bytesPerSecond = float64(progress.DownloadedBytes-t.startBytes) / elapsed
+
+	elementsPerSecond := float64(progress.DoneElements-t.startElements) / elapsed
+	if elementsPerSecond > 0 && progress.TotalElements > progress.DoneElements {
+		eta = time.Duration(float64(progress.TotalElements-progress.DoneElements) / elementsPerSecond * float64(time.Second))
+	}
+	return bytesPerSecond, eta
 }
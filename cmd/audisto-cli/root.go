@@ -1,66 +1,353 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/mattn/go-colorable"
 
 	"github.com/audisto/data-downloader/pkg/downloader"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // RootCmd the root (default) command to data-downloader
 var RootCmd = &cobra.Command{
 	Use:   "data-downloader",
 	Short: "Audisto Data Downloader",
-	Long:  "A simple CLI tool to download data using Audisto API",
+	Long:  "A simple CLI tool to download data using Audisto API\n\n" + exitCodesHelp,
 	// disable Cobra flags parsing we'll call our custom parse ourselves
 	// to support the one-dash non-shorthand flags
 	DisableFlagParsing: true,
 	Example:            getExamples(),
+	// the flags are completed by rootCompletion, their parsing being disabled
+	ValidArgsFunction: rootCompletion,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// run our custom flags parsing
 		err := customFlagsParse(cmd, args)
 		if err != nil {
 			return err
 		}
+		// several profiles are run as a process each, with the credentials and settings of their profile
+		if profiles != "" {
+			return runProfiles(interruptContext(), cmd.PersistentFlags(), args)
+		}
+		// fill in the flags that were not passed from the environment, then from the config file:
+		// flags take precedence over environment variables, which take precedence over the config file
+		err = applyEnvironment(cmd.PersistentFlags())
+		if err != nil {
+			return err
+		}
+		err = applyConfig(cmd.PersistentFlags())
+		if err != nil {
+			return err
+		}
+		// then from the OS keychain, see auth login
+		err = applyKeyring(cmd.PersistentFlags())
+		if err != nil {
+			return err
+		}
 		// Run our custom flags [values] validation
 		err = customFlagsValidation(cmd)
 		if err != nil {
 			return err
 		}
 
+		// the rows streamed to stdout are kept apart from the messages, printed to stderr
+		if output == "" && !dryRun {
+			color.Output = colorable.NewColorableStderr()
+		}
+
+		// the downloads are traced once an OTLP endpoint is set in the environment
+		flushTraces, err := setupTracing()
+		if err != nil {
+			return err
+		}
+		defer flushTraces()
+
 		// all looks good, perform the download
-		return performDownload()
+		return performDownload(interruptContext(), output)
 	},
 }
 
 func init() {
 	// eatly register global flags that apply to the root command
 	registerPersistentFlags(RootCmd)
+	registerFlagCompletions(RootCmd)
+	// flags errors of the subcommands are invalid arguments too
+	RootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		if err == pflag.ErrHelp {
+			return err
+		}
+		return CError(err.Error())
+	})
 	// make Cobra output support colors for Windows
 	RootCmd.SetOutput(colorable.NewColorableStderr())
 }
 
-// use Audisto downloader package to initiate/resume API downloads
-func performDownload() error {
-	progressReport := make(chan downloader.StatusReport)
-	download := downloader.New(progressReport)
-
-	err := download.Setup(username, password, crawlID, mode, noDetails,
-		chunkNumber, chunkSize, output, filter, noResume, order, targets)
+// use Audisto downloader package to initiate/resume API downloads to the given output.
+// With --mode=all, every mode is downloaded in turn, to its own output file. Several crawls
+// are downloaded to the outputs of their {crawl_id}, see downloadCrawls. The summary of the run is
+// written to --summary-file once done, if set.
+func performDownload(ctx context.Context, output string) error {
+	started := time.Now()
+	if jobTimeout > 0 {
+		jobDeadline = started.Add(jobTimeout)
+	}
+	var err error
+	if runBudget, err = newRunBudget(); err != nil {
+		return err
+	}
+	// the downloads are paused and resumed by SIGUSR1 and the control socket
+	watchPauseSignal()
+	closeControlSocket, err := serveControlSocket()
+	if err != nil {
+		return err
+	}
+	defer closeControlSocket()
+	if len(crawlIDs) > 1 {
+		err = downloadCrawls(ctx, output)
+	} else {
+		err = downloadCrawl(ctx, crawlIDs.first(), output)
+	}
+	// the summary is written whether the downloads completed or not, a failed summary failing the run
+	if summaryErr := writeRunSummary(err, time.Since(started)); err == nil {
+		err = summaryErr
+	}
+	if timingsErr := writeTimingReport(time.Since(started)); err == nil {
+		err = timingsErr
+	}
+	return err
+}
 
+// downloadMode initiates/resumes the download of a given crawl and mode to the given output
+func downloadMode(ctx context.Context, crawl uint64, mode string, output string) error {
+	options, err := downloadOptions(crawl, mode, output)
 	if err != nil {
 		return err
 	}
+	options.Notifiers = append(options.Notifiers, newHistoryNotifier(crawl, mode, output))
+
+	var progressReport chan downloader.StatusReport
+	if showProgressBar() && !dryRun && !downloadsInParallel() {
+		progressReport = make(chan downloader.StatusReport)
+		options.Status = progressReport
+	}
+	download := downloader.New(options)
+
+	if dryRun {
+		download.SetDryRun(true)
+		if err = download.Prepare(); err != nil {
+			return err
+		}
+		estimate, err := download.Estimate()
+		if err != nil {
+			return err
+		}
+		return printEstimate(estimate)
+	}
 
-	go RenderProgress(progressReport)
+	// the downloader closes the progress channel once it returns
+	rendered := make(chan downloader.StatusReport, 1)
+	if progressReport != nil {
+		go func() {
+			rendered <- RenderProgress(progressReport)
+		}()
+	}
 
-	err = download.Start()
+	started := time.Now()
+	untrack := trackDownload(download)
+	err = download.Run(ctx)
+	untrack()
+	recordSummary(download, err)
+	recordTimings(download)
+	if progressReport != nil {
+		lastProgress := <-rendered
+		if err == nil && download.Unchanged() {
+			PrintYellow("%s unchanged since the previous download, skipped", downloader.RedactOutput(output))
+		} else if err == nil {
+			printCompletion(lastProgress, time.Since(started))
+		}
+	}
 	if err != nil {
+		printSkippedChunks(err)
 		return err
 	}
-	// Give the progress bar a small time in order to refresh its rendering
-	time.Sleep(time.Millisecond * 100)
 	return nil
 }
+
+// downloadMetrics the metrics the downloads are recorded in, nil unless served, see schedule --metrics-port
+var downloadMetrics *downloader.Metrics
+
+// jobDeadline when the download has to complete by, as per --job-timeout, shared by the modes of --mode=all
+var jobDeadline time.Time
+
+// runBudget the API calls and bytes the downloads of the run may spend, as per --max-api-calls and --max-bytes,
+// shared by the modes of --mode=all and several crawls; nil for no limit
+var runBudget *downloader.Budget
+
+// newRunBudget returns the budget of a run, every scheduled run getting its own
+func newRunBudget() (*downloader.Budget, error) {
+	if maxAPICalls == 0 && maxBytes == "" {
+		return nil, nil
+	}
+	var bytes int64
+	if maxBytes != "" {
+		var err error
+		if bytes, err = downloader.ParseSize(maxBytes); err != nil {
+			return nil, CError("--max-bytes: " + err.Error())
+		}
+	}
+	budget, err := downloader.NewBudget(maxAPICalls, bytes)
+	if err != nil {
+		return nil, CError(err.Error())
+	}
+	return budget, nil
+}
+
+// remainingJobTimeout returns the time left until the job deadline, 0 for no limit
+func remainingJobTimeout() time.Duration {
+	if jobDeadline.IsZero() {
+		return 0
+	}
+	if remaining := time.Until(jobDeadline); remaining > 0 {
+		return remaining
+	}
+	// elapsed already, the download stops right away
+	return time.Nanosecond
+}
+
+// downloadOptions returns the download options of the flags
+func downloadOptions(crawl uint64, mode string, output string) (downloader.Options, error) {
+	options := downloader.Options{
+		Username:         username,
+		Password:         password,
+		APIToken:         apiToken,
+		AuthCacheFile:    authCacheFile,
+		CrawlID:          crawl,
+		Mode:             mode,
+		Output:           output,
+		Filter:           filter,
+		Where:            where,
+		URLsFile:         urlsFile,
+		Limit:            limit,
+		Sample:           sample,
+		Aggregation:      aggregation,
+		Transforms:       transforms,
+		Order:            order,
+		Targets:          targets,
+		NoDetails:        noDetails,
+		Columns:          downloader.ParseColumns(columns),
+		AddColumns:       downloader.ParseColumns(addColumns),
+		NoHeader:         noHeader,
+		NoResume:         noResume,
+		MustResume:       mustResume,
+		ChunkNumber:      chunkNumber,
+		ChunkSize:        chunkSize,
+		AutoChunkSize:    autoChunkSize,
+		Concurrency:      concurrency,
+		BufferSize:       bufferSize,
+		NoPrefetch:       noPrefetch,
+		Pagination:       pagination,
+		DriftCheck:       driftCheck,
+		SortBy:           sortBy,
+		TempDir:          tmpDir,
+		OutputFormat:     outputFormat,
+		Delimiter:        delimiter,
+		LineEnding:       lineEnding,
+		Encoding:         encoding,
+		Sanitize:         sanitize,
+		Nulls:            nulls,
+		NullAs:           nullAs,
+		Compression:      compression,
+		CompressionLevel: compressionLevel,
+		Encrypt:          encrypt,
+		Checksum:         checksum,
+		PostProcess:      postProcess,
+		SkipIfUnchanged:  skipIfUnchanged,
+		NoAtomic:         noAtomic,
+		DiskSpaceCheck:   !dryRun,
+		ForceDiskSpace:   force,
+		RowGroupSize:     rowGroupSize << 20,
+		SplitRows:        splitRows,
+		PartitionBy:      partitionBy,
+		EnrichPages:      enrichPages && mode == "links",
+		SkipFailedChunks: skipFailed,
+		ReportDuplicates: reportDupes && mode == "pages",
+		DiffBaseline:     diffBaseline,
+		DiffKey:          downloader.ParseColumns(diffKey),
+		DiffSplit:        diffSplit,
+		Append:           appendOutput,
+		AppendKey:        downloader.ParseColumns(appendKey),
+		RetryPolicy:      &downloader.RetryPolicy{MaxRetries: maxRetries, Backoff: retryBackoff},
+		Proxy:            proxy,
+		APIBaseURL:       apiBaseURL,
+		APIVersion:       apiVersion,
+		UserAgent:        requestUserAgent(),
+		Headers:          headers,
+		TimingReport:     timingsFile != "",
+		Record:           record,
+		Replay:           replay,
+		TLS:              tlsOptions(),
+		Transport:        transportOptions(),
+		RequestTimeout:   requestTimeout,
+		JobTimeout:       remainingJobTimeout(),
+		Budget:           runBudget,
+		WaitForCrawl:     waitForCrawl && !dryRun,
+		WaitForLock:      waitForLock,
+		PollInterval:     pollInterval,
+		MaxCrawlWait:     maxWait,
+		Logger:           newLogger(),
+		Metrics:          downloadMetrics,
+	}
+
+	var err error
+	if rateLimit != "" {
+		if options.RateLimit, options.RateLimitPer, err = downloader.ParseRateLimit(rateLimit); err != nil {
+			return options, CError(err.Error())
+		}
+	}
+	if splitSize != "" {
+		if options.SplitSize, err = downloader.ParseSize(splitSize); err != nil {
+			return options, CError(err.Error())
+		}
+	}
+	if maxBandwidth != "" {
+		if options.MaxBandwidth, err = downloader.ParseBandwidth(maxBandwidth); err != nil {
+			return options, CError(err.Error())
+		}
+	}
+
+	if notifyWebhook != "" {
+		notifier, err := downloader.NewWebhookNotifier(notifyWebhook)
+		if err != nil {
+			return options, CError(err.Error())
+		}
+		options.Notifiers = append(options.Notifiers, notifier)
+	}
+	if notifyEmail != "" {
+		notifier, err := downloader.NewEmailNotifier(smtpSettings(), emailRecipients())
+		if err != nil {
+			return options, CError(err.Error())
+		}
+		options.Notifiers = append(options.Notifiers, notifier)
+	}
+	return options, nil
+}
+
+// printEstimate prints the estimate of a dry run
+func printEstimate(estimate downloader.DownloadEstimate) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Mode:\t%s\n", estimate.Mode)
+	fmt.Fprintf(w, "Total rows:\t%d\n", estimate.TotalElements)
+	fmt.Fprintf(w, "Columns:\t%s\n", strings.Join(estimate.Columns, ", "))
+	fmt.Fprintf(w, "Estimated size:\t~%s\n", PrettyByteSize(estimate.Bytes))
+	fmt.Fprintf(w, "Chunks:\t%d of %d elements, %d in parallel\n", estimate.Chunks, estimate.ChunkSize, estimate.Concurrency)
+	fmt.Fprintf(w, "Estimated duration:\t~%s\n", PrettyTime(estimate.Duration))
+	return w.Flush()
+}
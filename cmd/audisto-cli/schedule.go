@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/robfig/cron"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scheduleCron        string // cron expression of the recurring download
+	scheduleMetricsPort uint   // port of the Prometheus metrics endpoint, 0 for none
+)
+
+func init() {
+	RootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.Flags().StringVarP(&scheduleCron, "cron", "", "", `Cron expression of the download schedule, e.g. "0 3 * * *" for every day at 3am (required)`)
+	scheduleCmd.Flags().UintVarP(&scheduleMetricsPort, "metrics-port", "", 0, "If set, Prometheus metrics of the downloads are served on http://0.0.0.0:PORT/metrics")
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run a download on a schedule",
+	Long: `Run as a long-lived process, downloading on the given cron schedule (minute, hour, day of month, month,
+day of week, or a descriptor like @daily). Every run downloads to its own output, the date and time of the
+run being appended to the output name, e.g. crawl.tsv -> crawl_20181014_0300.tsv.
+A failed run is reported, the next runs still happen. The download flags are the ones of the root command.
+With --metrics-port, the Prometheus metrics of the downloads are served on /metrics.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnvironment(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyKeyring(cmd.Flags()); err != nil {
+			return err
+		}
+		// the download flags are the persistent flags of the root command
+		if err := customFlagsValidation(RootCmd); err != nil {
+			return err
+		}
+
+		if scheduleCron == "" {
+			return CError("--cron is required")
+		}
+		schedule, err := cron.ParseStandard(scheduleCron)
+		if err != nil {
+			return CError("invalid --cron expression: " + err.Error())
+		}
+		if output == "" {
+			return CError("Set --output to use schedule, every run is downloaded to its own dated output")
+		}
+		if targets != "" {
+			return CError("--targets can't be used with schedule")
+		}
+
+		if scheduleMetricsPort > 0 {
+			if err := serveMetrics(scheduleMetricsPort); err != nil {
+				return err
+			}
+		}
+		flushTraces, err := setupTracing()
+		if err != nil {
+			return err
+		}
+		defer flushTraces()
+
+		ctx := interruptContext()
+		for {
+			next := schedule.Next(time.Now())
+			PrintYellow("Next download at %s", next.Format(time.RFC1123))
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			// the date is appended to the output unless it has a {date} already, or it's compared with the
+			// object of the previous run
+			dated := downloader.ExpandOutput(output, map[string]string{downloader.DatePlaceholder: next.Format(downloader.DatePlaceholderFormat)})
+			if !downloader.HasPlaceholder(output, downloader.DatePlaceholder) && !skipIfUnchanged {
+				dated = downloader.DatedOutputFilename(output, next, compression)
+			}
+			if err := performDownload(ctx, dated); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				PrintRed("Download to %s failed: %v", downloader.RedactOutput(dated), err)
+			}
+		}
+	},
+}
+
+// serveMetrics serves the Prometheus metrics of the downloads on the given port, in the background.
+// The port is listened on right away, so a port already in use fails the command.
+func serveMetrics(port uint) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return CError("cannot serve the metrics: %v", err)
+	}
+	downloadMetrics = downloader.NewMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", downloadMetrics.Handler())
+	go http.Serve(listener, mux)
+	fmt.Printf("Metrics served on http://0.0.0.0:%d/metrics\n", port)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+var schemaJSON bool // print the schema as JSON instead of a table
+
+func init() {
+	RootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().BoolVarP(&schemaJSON, "json", "", false, "If passed, the schema is printed as JSON for scripting, the columns by mode")
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "List the columns of the export of a mode",
+	Long: `List the columns of the export of a mode, with their type and description, to write --columns, --where,
+--order and --filter expressions. --mode=all lists the columns of the pages and of the links, --enrich-pages
+adds the columns of the pages joined onto the links, e.g. target_title.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modes := []string{strings.ToLower(strings.TrimSpace(mode))}
+		if modes[0] == downloader.AllModes {
+			modes = downloader.Modes
+		}
+		schema := map[string][]downloader.SchemaColumn{}
+		for _, m := range modes {
+			columns, err := downloader.Schema(m, enrichPages)
+			if err != nil {
+				return CError("mode has to be 'links', 'pages', 'hints' or 'all'")
+			}
+			schema[m] = columns
+		}
+
+		if schemaJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(schema)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for i, m := range modes {
+			if len(modes) > 1 {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "%s:\n", m)
+			}
+			fmt.Fprintln(w, "COLUMN\tTYPE\tDESCRIPTION")
+			for _, column := range schema[m] {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", column.Name, column.Type, column.Description)
+			}
+		}
+		return w.Flush()
+	},
+}
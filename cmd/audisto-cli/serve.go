@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/audisto/data-downloader/web"
+	"github.com/spf13/cobra"
+)
+
+var (
+	servePort           uint   = 5051
+	serveToken          string // bearer token the API requests have to send
+	serveOutputDir      string = "."
+	serveAllowedOutputs []string
+)
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().UintVarP(&servePort, "port", "P", 5051, "Control API port (default is 5051)")
+	serveCmd.Flags().StringVarP(&serveToken, "token", "", "", "If set, API requests have to send an \"Authorization: Bearer <token>\" header, defaults to AUDISTO_SERVE_TOKEN.\nWithout a token, the API only listens on 127.0.0.1")
+	serveCmd.Flags().StringVarP(&serveOutputDir, "output-dir", "", ".", "Directory the downloads are written to, the outputs requested being relative paths inside it")
+	serveCmd.Flags().StringSliceVarP(&serveAllowedOutputs, "allow-output", "", nil, "URL schemes of the remote outputs the downloads may be written to, e.g. s3,gs (none by default)")
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as a daemon exposing a REST API to start, follow and cancel downloads",
+	Long: `Run as a daemon exposing a REST API to start, follow and cancel downloads:
+
+  POST   /api/downloads      start a download, from a JSON payload
+  GET    /api/downloads      list the downloads started so far
+  GET    /api/downloads/:id  get the status and progress of a download
+  DELETE /api/downloads/:id  cancel a download (POST /api/downloads/:id/cancel works too)
+  GET    /metrics            Prometheus metrics of the downloads
+
+Downloads run one at a time, in the order they were requested.
+The --username and --password flags (or --api-token), the environment, config file and OS keychain are the default credentials.
+Without a --token, the API only listens on 127.0.0.1. The outputs are paths inside --output-dir, remote outputs
+have to be allowed with --allow-output.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyEnvironment(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := applyKeyring(cmd.Flags()); err != nil {
+			return err
+		}
+		if serveToken == "" {
+			serveToken = os.Getenv("AUDISTO_SERVE_TOKEN")
+		}
+		if err := credentialsValidation(); err != nil {
+			return err
+		}
+		controlAPI := web.NewControlAPI(username, password, serveToken)
+		controlAPI.APIToken = apiToken
+		controlAPI.OutputDir, controlAPI.AllowedOutputs = serveOutputDir, serveAllowedOutputs
+		controlAPI.APIBaseURL, controlAPI.APIVersion = apiBaseURL, apiVersion
+		controlAPI.TLS, controlAPI.Transport = tlsOptions(), transportOptions()
+		controlAPI.Metrics = downloader.NewMetrics()
+		flushTraces, err := setupTracing()
+		if err != nil {
+			return err
+		}
+		defer flushTraces()
+		return web.StartControlAPI(servePort, controlAPI)
+	},
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+var (
+	interruptMu sync.Mutex
+	interrupted os.Signal // the signal that interrupted the download, nil if none
+)
+
+// interruptContext returns a context cancelled on SIGINT or SIGTERM: the download stops once the chunks
+// being downloaded are written, the output being flushed and the resume state persisted.
+// A second signal exits right away, the download can still be resumed from the last written chunk.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		interruptMu.Lock()
+		interrupted = sig
+		interruptMu.Unlock()
+		PrintYellow("\nInterrupted, stopping once the current chunks are written (interrupt again to quit now)")
+		cancel()
+
+		sig = <-signals
+		os.Exit(signalExitCode(sig))
+	}()
+	return ctx
+}
+
+// interruptSignal returns the signal that interrupted the download, nil if it was not interrupted
+func interruptSignal() os.Signal {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	return interrupted
+}
+
+// interruptedMessage tells the download is interrupted, and how to resume it when it can be
+func interruptedMessage() string {
+	if !resumableOutput() {
+		return "Download interrupted"
+	}
+	return "Download interrupted, run the same command again to resume it"
+}
+
+// resumableOutput checks if a stopped download can be resumed, its output being a local file
+func resumableOutput() bool {
+	return output != "" && !downloader.IsRemoteOutput(output) && !downloader.IsTableOutputLocation(output) &&
+		!downloader.IsTableOutputFormat(outputFormat) && !downloader.IsPipeOutput(output)
+}
+
+// signalExitCode the shell convention exit code of a process terminated by the signal: 128 + the signal number
+func signalExitCode(sig os.Signal) int {
+	if number, ok := sig.(syscall.Signal); ok {
+		return 128 + int(number)
+	}
+	return 1
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(exportStateCmd)
+	RootCmd.AddCommand(importStateCmd)
+}
+
+var exportStateCmd = &cobra.Command{
+	Use:   "export-state [bundle]",
+	Short: "Export the resume state of an unfinished download",
+	Long: `Export the resume state of the unfinished download of --output to a portable bundle, [OUTPUT]` + downloader.StateBundleSuffix + `
+unless given, - to print it. The bundle holds the resume state along with the size and SHA-256 of what's written
+of the output so far: copy it and the output files to another machine, then run import-state there to complete
+the download.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := stateOutputValidation(cmd); err != nil {
+			return err
+		}
+		bundle := output + downloader.StateBundleSuffix
+		if len(args) > 0 {
+			bundle = args[0]
+		}
+		if bundle == "-" {
+			return downloader.ExportState(output, os.Stdout)
+		}
+
+		file, err := os.Create(bundle)
+		if err != nil {
+			return err
+		}
+		if err = downloader.ExportState(output, file); err != nil {
+			file.Close()
+			os.Remove(bundle)
+			return err
+		}
+		if err = file.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "The state of %s is exported to %s, copy it along with the output files\n", output, bundle)
+		return nil
+	},
+}
+
+var importStateCmd = &cobra.Command{
+	Use:   "import-state <bundle>",
+	Short: "Import the resume state of a download begun elsewhere",
+	Long: `Import a bundle written by export-state, so the download is resumed to --output: the output files copied
+from the other machine have to be next to it, named after it. They're checked against the bundle first.
+A download begun with --targets needs the same targets file, passed with --targets, and again when resumed.
+Then run the download with the same --output and settings to complete it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := stateOutputValidation(cmd); err != nil {
+			return err
+		}
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+		if err := downloader.ImportState(r, output, targets); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "The state is imported, resume the download of %s with the settings it was begun with\n", output)
+		return nil
+	},
+}
+
+// stateOutputValidation checks the output the resume state is exported or imported for, a local file
+func stateOutputValidation(cmd *cobra.Command) error {
+	if err := applyEnvironment(cmd.Flags()); err != nil {
+		return err
+	}
+	if err := applyConfig(cmd.Flags()); err != nil {
+		return err
+	}
+	if output == "" || output == "-" || downloader.IsRemoteOutput(output) || downloader.IsTableOutputLocation(output) {
+		return CError("Set a local file --output, only the downloads of local files are resumed")
+	}
+	if targets == "self" {
+		return CError("The state of --targets=self downloads can't be exported nor imported")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+// runSummary the JSON summary of a run written to --summary-file: the totals of its downloads, then every download
+type runSummary struct {
+	Event           string                  `json:"event"` // completed once every download completed, failed otherwise
+	Elements        uint64                  `json:"elements"`
+	Rows            uint64                  `json:"rows"`
+	Bytes           int64                   `json:"bytes"`
+	APICalls        int64                   `json:"apiCalls"`
+	DurationSeconds float64                 `json:"durationSeconds"`
+	Retries         int64                   `json:"retries"`
+	Error           string                  `json:"error,omitempty"`
+	Downloads       []downloader.RunSummary `json:"downloads"`
+}
+
+var (
+	// summaries the summaries of the downloads of the run, crawls being downloaded in parallel
+	summaries   []downloader.RunSummary
+	summariesMu sync.Mutex
+)
+
+// recordSummary records the summary of a download once Run() returned err, for --summary-file
+func recordSummary(download *downloader.Downloader, err error) {
+	if summaryFile == "" {
+		return
+	}
+	summary := download.Summary(err)
+	summariesMu.Lock()
+	defer summariesMu.Unlock()
+	summaries = append(summaries, summary)
+}
+
+// writeRunSummary writes the summary of the run, its downloads having returned err, to --summary-file if set.
+// The summaries recorded are reset, a scheduled download writing the summary of every run.
+func writeRunSummary(err error, duration time.Duration) error {
+	if summaryFile == "" {
+		return nil
+	}
+	summariesMu.Lock()
+	summary := runSummary{Event: downloader.CompletedEvent, DurationSeconds: duration.Seconds(), Downloads: summaries}
+	summaries = nil
+	summariesMu.Unlock()
+
+	if summary.Downloads == nil {
+		summary.Downloads = []downloader.RunSummary{}
+	}
+	for _, download := range summary.Downloads {
+		summary.Elements += download.Elements
+		summary.Rows += download.Rows
+		summary.Bytes += download.Bytes
+		summary.APICalls += download.APICalls
+		summary.Retries += download.Retries
+	}
+	if err != nil {
+		summary.Event, summary.Error = downloader.FailedEvent, err.Error()
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if summaryFile == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(summaryFile, data, 0644)
+}
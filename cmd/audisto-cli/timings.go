@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+)
+
+// timingReport the JSON timing of the chunks of a run written to --timing-report, by download
+type timingReport struct {
+	DurationSeconds float64                   `json:"durationSeconds"`
+	Downloads       []downloader.TimingReport `json:"downloads"`
+}
+
+var (
+	// timings the timing reports of the downloads of the run, crawls being downloaded in parallel
+	timings   []downloader.TimingReport
+	timingsMu sync.Mutex
+)
+
+// recordTimings records the timing report of a download once Run() returned, for --timing-report
+func recordTimings(download *downloader.Downloader) {
+	if timingsFile == "" {
+		return
+	}
+	report := download.TimingReport()
+	timingsMu.Lock()
+	defer timingsMu.Unlock()
+	timings = append(timings, report)
+}
+
+// writeTimingReport writes the timing of the chunks of the run to --timing-report if set, whether its downloads
+// completed or not. The reports recorded are reset, as the summaries.
+func writeTimingReport(duration time.Duration) error {
+	if timingsFile == "" {
+		return nil
+	}
+	timingsMu.Lock()
+	report := timingReport{DurationSeconds: duration.Seconds(), Downloads: timings}
+	timings = nil
+	timingsMu.Unlock()
+	if report.Downloads == nil {
+		report.Downloads = []downloader.TimingReport{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if timingsFile == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(timingsFile, data, 0644)
+}
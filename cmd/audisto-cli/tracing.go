@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// tracingServiceName the service name of the traces, unless OTEL_SERVICE_NAME is set
+	tracingServiceName = "audisto-data-downloader"
+	// tracingShutdownTimeout how long the pending spans may take to be exported before exiting
+	tracingShutdownTimeout = 5 * time.Second
+)
+
+// tracingEnabled checks if the traces are exported: once an OTLP endpoint is set in the environment,
+// unless the SDK or the traces exporter are disabled
+func tracingEnabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" ||
+		os.Getenv("OTEL_TRACES_EXPORTER") == "otlp"
+}
+
+// setupTracing exports the spans of the downloads over OTLP/HTTP, as configured by the standard OTEL_*
+// environment variables (endpoint, headers, certificate, timeout, sampler, service name and resource attributes).
+// The returned function exports the pending spans, it has to be called before exiting.
+func setupTracing() (func(), error) {
+	if !tracingEnabled() {
+		return func() {}, nil
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "http/protobuf" {
+		return nil, CError("unsupported OTLP protocol %q, the traces are exported with http/protobuf", protocol)
+	}
+
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, CError("cannot export the traces: %v", err)
+	}
+	// the environment takes precedence over the default service name and version
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", tracingServiceName), attribute.String("service.version", VERSION)),
+		resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, CError("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, StringYellow(fmt.Sprintf("Cannot export the traces: %v", err)))
+		}
+	}, nil
+}
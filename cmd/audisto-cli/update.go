@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// updateReleasesURL the latest release of the GitHub repository
+	updateReleasesURL = "https://api.github.com/repos/audisto/data-downloader/releases/latest"
+	// updateDownloadsURL the releases page, for builds that can't update themselves
+	updateDownloadsURL = "https://github.com/audisto/data-downloader/releases"
+	// updateChecksumsAsset the release asset listing the SHA-256 of the binaries, see make release-checksums
+	updateChecksumsAsset = "SHA256SUMS"
+	// updateSignatureAsset the base64 Ed25519 signature of the checksums asset
+	updateSignatureAsset = updateChecksumsAsset + ".sig"
+	// updateTimeout how long every request to GitHub may take, downloading the binary included
+	updateTimeout = 5 * time.Minute
+)
+
+// updatePublicKey the base64 Ed25519 public key the releases are signed with, set at build time by make release:
+// go build -ldflags "-X main.updatePublicKey=..." . Without it, the releases can't be verified, they're not installed.
+var updatePublicKey string
+
+var (
+	updateCheck bool // only report if a newer version is released
+)
+
+func init() {
+	RootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().BoolVarP(&updateCheck, "check", "", false, "If passed, only check if a newer version is released, without installing it")
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update data-downloader to the latest release",
+	Long: `Check the GitHub releases for a newer version and replace the running binary with it.
+The binary is verified against the SHA256SUMS of the release, and SHA256SUMS against its signature by the
+release public key embedded in the release builds: unsigned releases are refused. HTTPS_PROXY is honored.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := &http.Client{Timeout: updateTimeout}
+		release, err := latestRelease(client)
+		if err != nil {
+			return err
+		}
+		latest := strings.TrimPrefix(release.TagName, "v")
+		if compareVersions(latest, VERSION) <= 0 {
+			PrintBlue("data-downloader v%s is the latest version", VERSION)
+			return nil
+		}
+		if updateCheck {
+			PrintYellow("data-downloader v%s is released, you're running v%s: run update to install it", latest, VERSION)
+			return nil
+		}
+
+		if updatePublicKey == "" {
+			return fmt.Errorf("this build has no release public key to verify v%s with, download it from %s", latest, updateDownloadsURL)
+		}
+		name := releaseAssetName()
+		binary, err := release.download(client, name)
+		if err != nil {
+			return err
+		}
+		if err = release.verify(client, name, binary); err != nil {
+			return err
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("cannot find the running binary: %v", err)
+		}
+		if executable, err = filepath.EvalSymlinks(executable); err != nil {
+			return fmt.Errorf("cannot find the running binary: %v", err)
+		}
+		if err = replaceExecutable(executable, binary); err != nil {
+			return err
+		}
+		PrintBlue("data-downloader updated from v%s to v%s", VERSION, latest)
+		return nil
+	},
+}
+
+// release a GitHub release, along with its assets
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// latestRelease gets the latest release from GitHub
+func latestRelease(client *http.Client) (*release, error) {
+	body, err := httpGet(client, updateReleasesURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check the latest release: %v", err)
+	}
+	var latest release
+	if err = json.Unmarshal(body, &latest); err != nil {
+		return nil, fmt.Errorf("cannot read the latest release: %v", err)
+	}
+	if latest.TagName == "" {
+		return nil, fmt.Errorf("cannot read the latest release: no tag")
+	}
+	return &latest, nil
+}
+
+// hasAsset tells if the release has an asset of the given name
+func (r *release) hasAsset(name string) bool {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// download downloads an asset of the release
+func (r *release) download(client *http.Client, name string) ([]byte, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			body, err := httpGet(client, asset.URL)
+			if err != nil {
+				return nil, fmt.Errorf("cannot download %s: %v", name, err)
+			}
+			return body, nil
+		}
+	}
+	return nil, fmt.Errorf("the release %s has no %s asset", r.TagName, name)
+}
+
+// verify checks the checksums of the release against their signature, then the binary against the checksums
+func (r *release) verify(client *http.Client, name string, binary []byte) error {
+	checksums, err := r.download(client, updateChecksumsAsset)
+	if err != nil {
+		return err
+	}
+	if err = verifySignature(client, r, checksums); err != nil {
+		return err
+	}
+
+	expected := ""
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		// sha256sum lines: the hex digest, then the file name, prefixed with * in binary mode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			expected = strings.ToLower(fields[0])
+		}
+	}
+	if expected == "" {
+		return fmt.Errorf("%s of the release %s has no checksum of %s", updateChecksumsAsset, r.TagName, name)
+	}
+	digest := sha256.Sum256(binary)
+	if hex.EncodeToString(digest[:]) != expected {
+		return fmt.Errorf("the checksum of %s does not match %s, the binary is not installed", name, updateChecksumsAsset)
+	}
+	return nil
+}
+
+// verifySignature checks the signature of the checksums of the release against the release public key
+func verifySignature(client *http.Client, r *release, checksums []byte) error {
+	key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key embedded in this build")
+	}
+	if !r.hasAsset(updateSignatureAsset) {
+		return fmt.Errorf("the release %s is not signed, it has no %s asset: the binary is not installed", r.TagName, updateSignatureAsset)
+	}
+	encoded, err := r.download(client, updateSignatureAsset)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), checksums, signature) {
+		return fmt.Errorf("invalid signature of %s of the release %s, the binary is not installed", updateChecksumsAsset, r.TagName)
+	}
+	return nil
+}
+
+// httpGet gets a URL, failing on any status but 200
+func httpGet(client *http.Client, url string) ([]byte, error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "data-downloader/"+VERSION)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil, fmt.Errorf("%s: %s", url, response.Status)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// releaseAssetName the name of the binary of the running OS and architecture, as built by make release
+func releaseAssetName() string {
+	goos := runtime.GOOS
+	if goos == "darwin" {
+		goos = "macosx"
+	}
+	name := "audisto-cli-" + goos + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// compareVersions compares dotted versions numerically, e.g. 0.10 > 0.9: -1, 0 or 1.
+// Missing numbers are 0, anything following the numbers of a part (e.g. -rc1) is ignored.
+func compareVersions(a string, b string) int {
+	left, right := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		x, y := versionNumber(left, i), versionNumber(right, i)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionNumber(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := strings.IndexFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+	if digits < 0 {
+		digits = len(parts[i])
+	}
+	number, _ := strconv.Atoi(parts[i][:digits])
+	return number
+}
+
+// replaceExecutable replaces the running binary with the new one. The new binary is written next to it first,
+// then renamed over it; the running binary is moved aside, Windows not allowing to overwrite it.
+func replaceExecutable(executable string, binary []byte) error {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(executable)
+	next, err := ioutil.TempFile(dir, ".data-downloader-update")
+	if err != nil {
+		return fmt.Errorf("cannot write the new binary to %s: %v", dir, err)
+	}
+	defer os.Remove(next.Name())
+	_, err = next.Write(binary)
+	if closeErr := next.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write the new binary to %s: %v", dir, err)
+	}
+	if err = os.Chmod(next.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+
+	previous := executable + ".old"
+	os.Remove(previous)
+	if err = os.Rename(executable, previous); err != nil {
+		return fmt.Errorf("cannot replace %s: %v", executable, err)
+	}
+	if err = os.Rename(next.Name(), executable); err != nil {
+		// the running binary is put back
+		os.Rename(previous, executable)
+		return fmt.Errorf("cannot replace %s: %v", executable, err)
+	}
+	// the running binary can't be removed on Windows, it's removed by the next update
+	os.Remove(previous)
+	return nil
+}
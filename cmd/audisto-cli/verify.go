@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyID      uint64 // ID of the crawl the export is verified against, --crawl if NOT explicitly set
+	verifyFile    string // the export verified
+	verifySamples int    // rows spot-checked against the API
+	verifyJSON    bool   // print the report as JSON instead of text
+)
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().Uint64VarP(&verifyID, "id", "", 0, "ID of the crawl the export was downloaded from (defaults to --crawl)")
+	verifyCmd.Flags().StringVarP(&verifyFile, "file", "", "", "The export to verify, a tsv or csv file, compressed or not (required)")
+	verifyCmd.Flags().IntVarP(&verifySamples, "samples", "", downloader.DefaultVerifySamples, "Number of rows spot-checked against the API, 0 for none")
+	verifyCmd.Flags().BoolVarP(&verifyJSON, "json", "", false, "If passed, the report is printed as JSON for scripting")
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify an export is complete and untampered",
+	Long: `Verify an export downloaded before against the API: its rows are counted against the elements of --mode,
+with the --filter it was downloaded with, its SHA-256 is checked against its .sha256 sidecar if any, and a
+random sample of its rows is compared with the elements of the API at their position, column by column.
+The rows of an export sorted by --sort-by, filtered by --where or transformed can only be counted, pass
+--samples=0. It exits with 1 if the export fails the verification.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := accountClient(cmd); err != nil {
+			return err
+		}
+		if verifyID == 0 {
+			verifyID = crawlIDs.first()
+		}
+		if verifyID == 0 {
+			return CError("--id is required")
+		}
+		if verifyFile == "" {
+			return CError("--file is required")
+		}
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if !downloader.IsExportMode(mode) {
+			return CError("--mode has to be 'pages', 'links' or 'hints', the mode the export was downloaded with")
+		}
+		if verifySamples < 0 {
+			return CError("--samples can't be negative")
+		}
+
+		client, err := crawlClient(verifyID)
+		if err != nil {
+			return err
+		}
+		client.Mode, client.Filter = mode, strings.TrimSpace(filter)
+		options := downloader.VerifyOptions{File: verifyFile, Format: exportFormat(cmd, verifyFile), Delimiter: delimiter,
+			NoHeader: noHeader, Samples: verifySamples}
+		if verifySamples == 0 {
+			options.Samples = -1
+		}
+		report, err := downloader.Verify(client, options)
+		if err != nil {
+			return err
+		}
+
+		if verifyJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err = encoder.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			printVerifyReport(report)
+		}
+		if !report.Passed {
+			return fmt.Errorf("%s failed the verification", verifyFile)
+		}
+		return nil
+	},
+}
+
+// exportFormat returns the format of an export, the one of --output-format if passed, else the one of its
+// extension, e.g. csv for crawl.csv.gz
+func exportFormat(cmd *cobra.Command, file string) string {
+	if cmd.Flags().Changed("output-format") {
+		return outputFormat
+	}
+	name := strings.ToLower(file)
+	for _, ext := range []string{".gz", ".zst"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if filepath.Ext(name) == "."+downloader.CSVOutputFormat {
+		return downloader.CSVOutputFormat
+	}
+	return downloader.TSVOutputFormat
+}
+
+// printVerifyReport prints the report of a verification, and why it failed if it did
+func printVerifyReport(report *downloader.VerifyReport) {
+	fmt.Printf("Rows: %d of %d elements\n", report.Rows, report.Total)
+	if report.Checksum != "" {
+		fmt.Printf("Checksum: %s\n", report.Checksum)
+	}
+	matched := 0
+	for _, sample := range report.Samples {
+		if sample.Matched {
+			matched++
+		}
+	}
+	fmt.Printf("Rows spot-checked: %d of %d matched\n", matched, len(report.Samples))
+	if report.Passed {
+		PrintGreen("PASS: %s is complete", report.File)
+		return
+	}
+	PrintRed("FAIL: %s", report.File)
+	for _, failure := range report.Failures() {
+		PrintRed("  %s", failure)
+	}
+}
@@ -2,22 +2,94 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-// VERSION Audisto data downloader version number
-const VERSION = "0.6"
+// VERSION Audisto data downloader version number, set at build time by make for the tagged releases:
+// go build -ldflags "-X main.VERSION=0.7"
+var VERSION = "0.6"
+
+// the build of the binary, set at build time by make:
+// go build -ldflags "-X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	commit    = "unknown" // the commit the binary is built from
+	buildDate = "unknown" // when the binary is built, RFC 3339 in UTC
+)
+
+// versionCheckTimeout how long checking the latest release may take
+const versionCheckTimeout = 10 * time.Second
+
+var (
+	versionJSON        bool // print the build as JSON
+	versionCheckLatest bool // compare the version against the latest release
+)
 
 func init() {
 	RootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVarP(&versionJSON, "json", "", false, "If passed, the build is printed as JSON for scripting")
+	versionCmd.Flags().BoolVarP(&versionCheckLatest, "check-latest", "", false, "If passed, the version is compared against the latest release on GitHub")
+}
+
+// buildInfo the build of the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	Latest    string `json:"latest,omitempty"`   // the latest release, with --check-latest
+	UpToDate  *bool  `json:"upToDate,omitempty"` // the version is the latest release, with --check-latest
+}
+
+// currentBuild returns the build of the running binary
+func currentBuild() buildInfo {
+	return buildInfo{
+		Version:   VERSION,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
 }
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of data-downloader",
-	Long:  `Print the version number of data-downloader`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("data-downloader v" + VERSION)
+	Long: `Print the version number of data-downloader, along with the commit and the date it was built from,
+the Go version and the platform: the build to report when asking for support.
+With --check-latest, the version is compared against the latest release on GitHub.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		build := currentBuild()
+		if versionCheckLatest {
+			release, err := latestRelease(&http.Client{Timeout: versionCheckTimeout})
+			if err != nil {
+				return err
+			}
+			upToDate := compareVersions(strings.TrimPrefix(release.TagName, "v"), VERSION) <= 0
+			build.Latest, build.UpToDate = strings.TrimPrefix(release.TagName, "v"), &upToDate
+		}
+		if versionJSON {
+			return printJSON(build)
+		}
+
+		fmt.Println("data-downloader v" + build.Version)
+		fmt.Printf("  commit:     %s\n", build.Commit)
+		fmt.Printf("  built:      %s\n", build.BuildDate)
+		fmt.Printf("  go version: %s\n", build.GoVersion)
+		fmt.Printf("  platform:   %s\n", build.Platform)
+		if build.UpToDate == nil {
+			return nil
+		}
+		if *build.UpToDate {
+			PrintBlue("data-downloader v%s is the latest version", VERSION)
+		} else {
+			PrintYellow("data-downloader v%s is released, you're running v%s: run update to install it", build.Latest, VERSION)
+		}
+		return nil
 	},
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+const (
+	// the answers of the wizard to "Run the download now or save it as a profile?"
+	wizardRun  = "run"
+	wizardSave = "save"
+	wizardBoth = "both"
+
+	// the answers of the wizard to "Where are the credentials stored?"
+	storeKeychain = "keychain"
+	storeProfile  = "profile"
+	storeNowhere  = "nowhere"
+)
+
+func init() {
+	RootCmd.AddCommand(wizardCmd)
+}
+
+var wizardCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up a download step by step, then run it or save it as a config profile",
+	Long: `Set up a download by answering questions: the credentials (unless already set in the environment,
+the config file or the OS keychain), the crawl picked from the crawls of the account, the mode, the filter
+and the output. The download is then run, saved as a profile of the config file to be run with --profile, or both.
+The flags passed, e.g. --crawl, are the default answers.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		p := &prompter{reader: bufio.NewReader(os.Stdin)}
+		for _, apply := range []func(*pflag.FlagSet) error{applyEnvironment, applyConfig, applyKeyring} {
+			if err := apply(flags); err != nil {
+				return err
+			}
+		}
+
+		typed := apiToken == "" && (username == "" || password == "")
+		if typed {
+			if err := p.askCredentials(flags); err != nil {
+				return err
+			}
+		}
+		client, err := accountClient(cmd)
+		if err != nil {
+			return err
+		}
+		crawls, err := client.GetCrawls()
+		if err != nil {
+			return err
+		}
+
+		crawl, err := p.askCrawl(crawls)
+		if err != nil {
+			return err
+		}
+		selectedMode, err := p.choose("Mode", append(append([]string{}, downloader.ExportModes...), downloader.AllModes), mode)
+		if err != nil {
+			return err
+		}
+		selectedFilter, err := p.ask("Filter, e.g. status:200 (optional)", filter)
+		if err != nil {
+			return err
+		}
+		format, err := p.choose("Output format", []string{downloader.TSVOutputFormat, downloader.CSVOutputFormat,
+			downloader.JSONOutputFormat, downloader.SQLiteOutputFormat, downloader.ParquetOutputFormat}, outputFormat)
+		if err != nil {
+			return err
+		}
+		defaultOutput := output
+		if defaultOutput == "" {
+			defaultOutput = fmt.Sprintf("crawl_%d.%s", crawl, format)
+		}
+		selectedOutput, err := p.ask("Output file", defaultOutput)
+		if err != nil {
+			return err
+		}
+
+		answers := map[string]interface{}{"crawl": crawl, "mode": selectedMode,
+			"filter": selectedFilter, "output-format": format, "output": selectedOutput}
+		// the crawl answered replaces the ones passed, see crawlList.Set
+		crawlIDs, crawlsFile = nil, ""
+		for key, value := range answers {
+			if err = flags.Set(key, fmt.Sprint(value)); err != nil {
+				return CError("invalid %s: %v", key, err)
+			}
+		}
+		if err = customFlagsValidation(RootCmd); err != nil {
+			return err
+		}
+
+		next, err := p.choose("Run the download now, save it as a config profile, or both", []string{wizardRun, wizardSave, wizardBoth}, wizardRun)
+		if err != nil {
+			return err
+		}
+		if next != wizardRun {
+			if err = p.saveProfile(answers, typed); err != nil {
+				return err
+			}
+		}
+		if next == wizardSave {
+			return nil
+		}
+		return performDownload(interruptContext(), output)
+	},
+}
+
+// prompter asks the questions of the wizard, reading the answers from stdin
+type prompter struct {
+	reader *bufio.Reader
+}
+
+// ask asks a question, the default answer being used when nothing is answered
+func (p *prompter) ask(question string, defaultAnswer string) (string, error) {
+	if defaultAnswer != "" {
+		fmt.Printf("%s [%s]: ", question, defaultAnswer)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", CError("init needs the answers on stdin: %v", err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return defaultAnswer, nil
+}
+
+// askSecret asks a question without echoing the answer on a terminal
+func (p *prompter) askSecret(question string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return p.ask(question, "")
+	}
+	fmt.Printf("%s: ", question)
+	secret, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", CError("cannot read the answer: %v", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// choose asks a question until one of the choices is answered
+func (p *prompter) choose(question string, choices []string, defaultAnswer string) (string, error) {
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", ")), defaultAnswer)
+		if err != nil {
+			return "", err
+		}
+		for _, choice := range choices {
+			if strings.EqualFold(answer, choice) {
+				return choice, nil
+			}
+		}
+		PrintYellow("Answer one of: %s", strings.Join(choices, ", "))
+	}
+}
+
+// askCredentials asks the username and password, or the API token when no username is answered
+func (p *prompter) askCredentials(flags *pflag.FlagSet) error {
+	user, err := p.ask("Audisto API username (leave empty to use an API token)", username)
+	if err != nil {
+		return err
+	}
+	credentials := map[string]string{}
+	if user == "" {
+		if credentials["api-token"], err = p.askSecret("API token"); err != nil {
+			return err
+		}
+	} else {
+		credentials["username"] = user
+		if credentials["password"], err = p.askSecret("Password"); err != nil {
+			return err
+		}
+	}
+	for key, value := range credentials {
+		if value == "" {
+			return CError("the %s is required", key)
+		}
+		if err = flags.Set(key, value); err != nil {
+			return CError("invalid %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// askCrawl lists the crawls of the account, then asks which one is downloaded, by number or by ID
+func (p *prompter) askCrawl(crawls []downloader.Crawl) (uint64, error) {
+	if len(crawls) == 0 {
+		return 0, fmt.Errorf("the account has no crawl to download")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tID\tDOMAIN\tSTARTED\tSTATUS\tPAGES")
+	for i, crawl := range crawls {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%d\n", i+1, crawl.ID, crawl.Domain, crawl.StartedAt, crawl.Status, crawl.PageCount)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+
+	defaultAnswer := "1"
+	if crawl := crawlIDs.first(); crawl != 0 {
+		defaultAnswer = strconv.FormatUint(crawl, 10)
+	}
+	for {
+		answer, err := p.ask("Crawl to download (# or ID)", defaultAnswer)
+		if err != nil {
+			return 0, err
+		}
+		number, err := strconv.ParseUint(answer, 10, 64)
+		if err == nil && number >= 1 && number <= uint64(len(crawls)) {
+			return crawls[number-1].ID, nil
+		}
+		for _, crawl := range crawls {
+			if err == nil && crawl.ID == number {
+				return crawl.ID, nil
+			}
+		}
+		PrintYellow("Answer the # of a crawl listed above, or its ID")
+	}
+}
+
+// saveProfile saves the answers as a profile of the config file. Credentials that were typed are stored
+// in the OS keychain, in the profile, or nowhere as answered.
+func (p *prompter) saveProfile(answers map[string]interface{}, typed bool) error {
+	defaultName := profile
+	if defaultName == "" {
+		defaultName = defaultProfile
+	}
+	name, err := p.ask("Profile name", defaultName)
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{}
+	for key, value := range answers {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+
+	if typed {
+		choices := []string{storeKeychain, storeProfile, storeNowhere}
+		if apiToken != "" {
+			// the OS keychain stores a username and password, see auth login
+			choices = choices[1:]
+		}
+		store, err := p.choose("Store the credentials in", choices, choices[0])
+		if err != nil {
+			return err
+		}
+		switch store {
+		case storeKeychain:
+			profile = name
+			if err = storeKeyringCredentials(); err != nil {
+				return err
+			}
+		case storeProfile:
+			for key, value := range map[string]string{"username": username, "password": password, "api-token": apiToken} {
+				if value != "" {
+					settings[key] = value
+				}
+			}
+		}
+	}
+
+	path := configPath
+	if path == "" {
+		path = getDefaultConfigPath()
+	}
+	if err = saveConfigProfile(path, name, settings); err != nil {
+		return err
+	}
+	command := "data-downloader"
+	if name != defaultProfile {
+		command += " --profile=" + name
+	}
+	if configPath != "" {
+		command += " --config=" + configPath
+	}
+	PrintBlue("Profile %q saved to %s, run it with: %s", name, path, command)
+	return nil
+}
@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AggregateCount the column of the number of rows of every group of an aggregation
+	AggregateCount = "count"
+
+	// AggregateSumPrefix the prefix of the columns of the sums of an aggregation, e.g. sum_size
+	AggregateSumPrefix = "sum_"
+
+	// AggregateAvgPrefix the prefix of the columns of the averages of an aggregation, e.g. avg_response_ms
+	AggregateAvgPrefix = "avg_"
+)
+
+// Aggregation groups the rows by the values of columns, and writes a row per group with its number of rows,
+// and the sums and averages of columns, instead of the rows. Values that aren't numbers, e.g. empty ones,
+// are left out of the sums and averages.
+type Aggregation struct {
+	GroupBy  []string // the columns the rows are grouped by, none for a single group of every row
+	Count    bool     // write the number of rows of every group
+	Sums     []string // the columns summed
+	Averages []string // the columns averaged
+}
+
+// rowAggregation the groups of the rows of an aggregation, bound to the header of the chunks
+type rowAggregation struct {
+	Aggregation
+	groupIndexes []int // the positions of the GroupBy columns in the rows
+	valueIndexes []int // the positions of the Sums then the Averages columns in the rows
+	groups       map[string]*rowGroup
+	rows         uint64 // the rows aggregated
+}
+
+// rowGroup the rows of a group, counted and summed
+type rowGroup struct {
+	values  []string  // the values of the GroupBy columns
+	count   uint64    // the rows of the group
+	sums    []float64 // the sums of the Sums then the Averages columns
+	numbers []uint64  // the numbers summed by column, the other values being left out
+}
+
+// SetAggregation makes the downloader write a row per group of rows instead of the rows, see Aggregation.
+// Without Sums nor Averages the rows are counted. nil for every row (default). The groups are held in memory
+// and written once the download is completed. It has to be called before Setup()
+func (d *Downloader) SetAggregation(aggregation *Aggregation) error {
+	if aggregation == nil {
+		d.aggregation = nil
+		return nil
+	}
+	a := &rowAggregation{Aggregation: *aggregation, groups: map[string]*rowGroup{}}
+	a.GroupBy = normalizeColumns(a.GroupBy)
+	a.Sums = normalizeColumns(a.Sums)
+	a.Averages = normalizeColumns(a.Averages)
+	if len(a.Sums) == 0 && len(a.Averages) == 0 {
+		a.Count = true
+	}
+	for _, column := range append(append([]string(nil), a.GroupBy...), a.values()...) {
+		if column == "" {
+			return fmt.Errorf("invalid aggregation: empty column name")
+		}
+	}
+	d.aggregation = a
+	return nil
+}
+
+// normalizeColumns trims and lower-cases the names of columns
+func normalizeColumns(columns []string) []string {
+	normalized := make([]string, 0, len(columns))
+	for _, column := range columns {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(column)))
+	}
+	return normalized
+}
+
+// values returns the columns summed, then the columns averaged
+func (a *rowAggregation) values() []string {
+	return append(append([]string(nil), a.Sums...), a.Averages...)
+}
+
+// header returns the header of the aggregated rows: the GroupBy columns, then the count, sums and averages
+func (a *rowAggregation) header() []string {
+	header := append([]string(nil), a.GroupBy...)
+	if a.Count {
+		header = append(header, AggregateCount)
+	}
+	for _, column := range a.Sums {
+		header = append(header, AggregateSumPrefix+column)
+	}
+	for _, column := range a.Averages {
+		header = append(header, AggregateAvgPrefix+column)
+	}
+	return header
+}
+
+// bind finds the columns of the aggregation in a chunk header
+func (a *rowAggregation) bind(header []string) error {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	find := func(columns []string) ([]int, error) {
+		indexes := make([]int, len(columns))
+		for i, column := range columns {
+			position, ok := positions[column]
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q in the aggregation, the available columns are: %s", column, strings.Join(header, ", "))
+			}
+			indexes[i] = position
+		}
+		return indexes, nil
+	}
+	var err error
+	if a.groupIndexes, err = find(a.GroupBy); err != nil {
+		return err
+	}
+	a.valueIndexes, err = find(a.values())
+	return err
+}
+
+// aggregationWriter adds the rows of the chunks to their group, instead of writing them
+type aggregationWriter struct {
+	aggregation *rowAggregation
+}
+
+func (w *aggregationWriter) WriteHeader() error {
+	return nil
+}
+
+func (w *aggregationWriter) WriteRow(fields []string) error {
+	a := w.aggregation
+	values := make([]string, len(a.groupIndexes))
+	for i, index := range a.groupIndexes {
+		if index < len(fields) {
+			values[i] = fields[index]
+		}
+	}
+	key := strings.Join(values, "\t")
+	group, ok := a.groups[key]
+	if !ok {
+		group = &rowGroup{values: values, sums: make([]float64, len(a.valueIndexes)), numbers: make([]uint64, len(a.valueIndexes))}
+		a.groups[key] = group
+	}
+	group.count++
+	for i, index := range a.valueIndexes {
+		if index >= len(fields) {
+			continue
+		}
+		if value, err := strconv.ParseFloat(strings.TrimSpace(fields[index]), 64); err == nil {
+			group.sums[i] += value
+			group.numbers[i]++
+		}
+	}
+	a.rows++
+	return nil
+}
+
+func (w *aggregationWriter) Flush() error {
+	return nil
+}
+
+// newAggregationWriter returns the writer of the rows of a chunk into their groups
+func (d *Downloader) newAggregationWriter(header []string) (RowWriter, error) {
+	if err := d.aggregation.bind(header); err != nil {
+		return nil, err
+	}
+	return &aggregationWriter{aggregation: d.aggregation}, nil
+}
+
+// lessGroupValue compares the values of a GroupBy column, as numbers if both are
+func lessGroupValue(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// formatAggregate formats a sum or an average, without a trailing .0
+func formatAggregate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// writeAggregation writes a row per group to the output once the download is completed, ordered by their values
+func (d *Downloader) writeAggregation() error {
+	a := d.aggregation
+	if a == nil || a.groupIndexes == nil {
+		return nil
+	}
+	groups := make([]*rowGroup, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		for k := range groups[i].values {
+			if x, y := groups[i].values[k], groups[j].values[k]; x != y {
+				return lessGroupValue(x, y)
+			}
+		}
+		return false
+	})
+
+	writer, err := d.newOutputWriter(a.header())
+	if err != nil {
+		return err
+	}
+	// the writer of the aggregation didn't write the header of the chunks
+	d.headerWritten = false
+	if err = d.writeHeader(writer); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		row := append([]string(nil), group.values...)
+		if a.Count {
+			row = append(row, strconv.FormatUint(group.count, 10))
+		}
+		for i := range a.valueIndexes {
+			if i < len(a.Sums) {
+				row = append(row, formatAggregate(group.sums[i]))
+			} else if group.numbers[i] > 0 {
+				row = append(row, formatAggregate(group.sums[i]/float64(group.numbers[i])))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if err = writer.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	d.stats.rows = uint64(len(groups))
+	d.appendLog(INFO, fmt.Sprintf("Wrote %d groups of %d rows", len(groups), a.rows))
+	return d.flushOutput()
+}
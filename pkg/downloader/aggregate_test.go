@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAggregation(t *testing.T) {
+	rows := []string{"200\t1\t100", "404\t2\t", "200\t2\t300", "301\t1\t50", "200\t3\t200", "1000\t1\t10"}
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			fmt.Fprintf(w, `{"chunk":{"total":%d,"page":0,"size":2}}`, len(rows))
+			return
+		}
+		var chunk int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Fprint(w, "status_code\tdepth\tsize\n")
+		for i := chunk * 2; i < chunk*2+2 && i < len(rows); i++ {
+			fmt.Fprintln(w, rows[i])
+		}
+	})()
+	dir, err := ioutil.TempDir("", "aggregate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		aggregation Aggregation
+		expected    string
+	}{
+		// the groups are ordered by their values, as numbers
+		{Aggregation{GroupBy: []string{"status_code"}}, "status_code\tcount\n200\t3\n301\t1\n404\t1\n1000\t1\n"},
+		// the empty size is left out of the average
+		{Aggregation{GroupBy: []string{"Depth"}, Count: true, Sums: []string{"size"}, Averages: []string{"size"}},
+			"depth\tcount\tsum_size\tavg_size\n1\t3\t160\t53.333333333333336\n2\t2\t300\t300\n3\t1\t200\t200\n"},
+		{Aggregation{Sums: []string{"size"}}, "sum_size\n660\n"},
+	} {
+		output := filepath.Join(dir, "crawl.tsv")
+		aggregation := test.aggregation
+		options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+			Aggregation: &aggregation}
+		if err = New(options).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("unexpected aggregation %q, expected %q", data, test.expected)
+		}
+	}
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 2, Aggregation: &Aggregation{GroupBy: []string{"content_type"}}}
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected an unknown column to fail")
+	}
+}
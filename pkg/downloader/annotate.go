@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnnotationColumns the metadata columns that can be added to every row, see SetAddColumns
+var AnnotationColumns = []string{"crawl_id", "exported_at", "mode"}
+
+// rowAnnotations the metadata columns added to every row, along with their values, constant for a download
+type rowAnnotations struct {
+	columns []string
+	values  []string // nil until bound, see bindAnnotations
+}
+
+// SetAddColumns makes the downloader append the given metadata columns to every row, after the columns
+// written: crawl_id, exported_at (when the download was begun, in RFC 3339 UTC, kept when resumed) and mode.
+// It keeps the provenance of the rows once the exports of several crawls are concatenated. Every output
+// format gets them, as any other column.
+// It has to be called before Setup()
+func (d *Downloader) SetAddColumns(columns []string) error {
+	d.annotations = nil
+	if len(columns) == 0 {
+		return nil
+	}
+	if err := ValidateAddColumns(columns); err != nil {
+		return err
+	}
+	annotations := &rowAnnotations{}
+	for _, column := range columns {
+		annotations.columns = append(annotations.columns, strings.ToLower(strings.TrimSpace(column)))
+	}
+	d.annotations = annotations
+	return nil
+}
+
+// ValidateAddColumns checks the columns to add are AnnotationColumns, each added once
+func ValidateAddColumns(columns []string) error {
+	seen := map[string]bool{}
+	for _, column := range columns {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !isAnnotationColumn(column) {
+			return fmt.Errorf("unknown column %q to add, the columns that can be added are: %s", column, strings.Join(AnnotationColumns, ", "))
+		}
+		if seen[column] {
+			return fmt.Errorf("column %q is added twice", column)
+		}
+		seen[column] = true
+	}
+	return nil
+}
+
+// isAnnotationColumn checks if a column is one of the AnnotationColumns
+func isAnnotationColumn(column string) bool {
+	for _, annotation := range AnnotationColumns {
+		if column == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// bindAnnotations sets the values of the added columns, once the download is set up: the export time is the
+// one the download was begun with
+func (d *Downloader) bindAnnotations() {
+	if d.annotations == nil || d.annotations.values != nil {
+		return
+	}
+	if d.Progress.ExportedAt == "" {
+		d.Progress.ExportedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	values := make([]string, len(d.annotations.columns))
+	for i, column := range d.annotations.columns {
+		switch column {
+		case "crawl_id":
+			values[i] = strconv.FormatUint(d.client.CrawlID, 10)
+		case "exported_at":
+			values[i] = d.Progress.ExportedAt
+		case "mode":
+			values[i] = d.client.Mode
+		}
+	}
+	d.annotations.values = values
+}
+
+// header returns the header written along with the added columns
+func (a *rowAnnotations) header(header []string) []string {
+	if a == nil {
+		return header
+	}
+	return append(append([]string{}, header...), a.columns...)
+}
+
+// row returns the fields written along with the values of the added columns
+func (a *rowAnnotations) row(fields []string) []string {
+	if a == nil {
+		return fields
+	}
+	return append(append(make([]string, 0, len(fields)+len(a.values)), fields...), a.values...)
+}
+
+// names returns the comma separated added columns, "" for none
+func (a *rowAnnotations) names() string {
+	if a == nil {
+		return ""
+	}
+	return strings.Join(a.columns, ",")
+}
@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetAddColumns(t *testing.T) {
+	d := &Downloader{}
+	if err := d.SetAddColumns([]string{" Mode", "crawl_id"}); err != nil {
+		t.Fatal(err)
+	}
+	if names := d.annotations.names(); names != "mode,crawl_id" {
+		t.Errorf("unexpected added columns %q", names)
+	}
+	for _, invalid := range [][]string{{"url"}, {"mode", "MODE"}, {""}} {
+		if err := d.SetAddColumns(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+}
+
+func TestRunAddColumns(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "annotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.csv")
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		OutputFormat: CSVOutputFormat, Columns: []string{"url"}, AddColumns: []string{"crawl_id", "mode", "exported_at"}})
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(written), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "url,crawl_id,mode,exported_at" {
+		t.Fatalf("unexpected output %q", written)
+	}
+	for i, url := range []string{"http://example.com/a", "http://example.com/b"} {
+		fields := strings.Split(lines[i+1], ",")
+		if len(fields) != 4 || fields[0] != url || fields[1] != "12345" || fields[2] != "pages" {
+			t.Errorf("unexpected row %q", lines[i+1])
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, fields[3]); err != nil || fields[3] != d.Progress.ExportedAt {
+			t.Errorf("unexpected export time %q", fields[3])
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// PartialSuffix the suffix of a local output file being written, renamed to the output once completed
+const PartialSuffix = ".partial"
+
+// SetAtomic when set to false, local output files are written in place. Otherwise (default) they're written
+// to [OUTPUT].partial, renamed to the output once completed, so whatever watches the output never picks up
+// a half-written file. A failed or stopped download keeps the partial file along with its resume state.
+// Partitioned outputs and the files of a split diff are always written in place.
+// It has to be called before Setup()
+func (d *Downloader) SetAtomic(atomic bool) {
+	d.noAtomic = !atomic
+}
+
+// writtenFilename returns the file a local output is written to until it's completed
+func (d *Downloader) writtenFilename(output string) string {
+	if d.noAtomic {
+		return output
+	}
+	return output + PartialSuffix
+}
+
+// writtenOutputExists returns nil if the file of the output being written exists, to be resumed
+func (d *Downloader) writtenOutputExists() error {
+	if d.partitionBy != "" {
+		return d.outputExists()
+	}
+	if err := fExists(d.writtenFilename(d.OutputFilename)); err == nil {
+		return nil
+	}
+	// begun in place, e.g. with SetAtomic(false)
+	return fExists(d.OutputFilename)
+}
+
+// openWrittenOutput opens the file of the output being written to resume it. An output begun in place
+// is moved to its partial file first, unless written in place.
+func (d *Downloader) openWrittenOutput() (*os.File, error) {
+	written := d.writtenFilename(d.OutputFilename)
+	if written != d.OutputFilename && fExists(written) != nil {
+		if err := os.Rename(d.OutputFilename, written); err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(written, os.O_WRONLY|os.O_APPEND, 0777)
+}
+
+// writeFileAtomic replaces a file with the data as a whole, through a temporary file. If writing fails,
+// e.g. the disk is full, the previous file is kept.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	temp := filename + ".tmp"
+	if err := ioutil.WriteFile(temp, data, perm); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, filename)
+}
+
+// completeOutputFile renames the partial file of a completed local output to the output
+func completeOutputFile(file *os.File, output string) error {
+	if file == nil || file.Name() == output {
+		return nil
+	}
+	return os.Rename(file.Name(), output)
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAtomicResumeOfOutputWrittenInPlace(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := r.URL.Query().Get("chunk")
+		if chunk == "1" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprintf(w, "id\turl\n%s\thttp://example.com/%s\n", chunk, chunk)
+	})()
+	dir, err := ioutil.TempDir("", "atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// written in place, the second chunk outlasting the job timeout
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		ChunkSize: 1, JobTimeout: 100 * time.Millisecond, NoAtomic: true}
+	if err = New(options).Run(context.Background()); !IsJobTimeout(err) {
+		t.Fatalf("expected a job timeout, got %v", err)
+	}
+	if fExists(output) != nil || fExists(output+PartialSuffix) == nil {
+		t.Fatal("the output should be written in place")
+	}
+
+	// resumed atomically, the output is moved to its partial file, then renamed once completed
+	options.JobTimeout, options.NoAtomic = 0, false
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n2\thttp://example.com/2\n" {
+		t.Errorf("unexpected resumed output %q", written)
+	}
+	if fExists(output+PartialSuffix) == nil {
+		t.Error("the partial file should be renamed to the output once completed")
+	}
+}
@@ -3,6 +3,7 @@ package downloader
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,7 +12,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -54,9 +57,18 @@ type AudistoAPIClient struct {
 	BasePath string
 	Username string
 	Password string
+	Token    string // API token, authenticating the requests instead of the username and password
 	Mode     string
 	CrawlID  uint64
 
+	// API endpoint, see SetEndpoint()
+	BaseURL    string // scheme, host and path prefix of the API, e.g. https://api.audisto.com, "" for the default
+	APIVersion string // version of the API, "" for AudistoAPIVersion
+
+	// request headers, see SetHeaders()
+	UserAgent string      // "" for the Go default User-Agent
+	Header    http.Header // added to every request, nil for none
+
 	// request query params
 	Deep        bool
 	Filter      string
@@ -67,9 +79,35 @@ type AudistoAPIClient struct {
 
 	// HTTP Client
 	httpClient http.Client
+	// RetryPolicy how failed requests are retried
+	RetryPolicy RetryPolicy
+	// RateLimiter limits the requests sent to the API, nil for no limit.
+	// It's shared by the copies of the client making parallel requests.
+	RateLimiter *RateLimiter
+	// BandwidthLimiter limits the bytes read from the responses, nil for no limit.
+	// It's shared by the copies of the client making parallel requests.
+	BandwidthLimiter *BandwidthLimiter
+	// Logger the structured logger retries are reported to, nil for no logging
+	Logger logrus.FieldLogger
+	// Metrics the metrics retries are recorded in, nil for no metrics
+	Metrics *Metrics
+	// Context when cancelled, pending retries are cancelled, nil for no cancellation.
+	// Requests already sent are let complete.
+	Context context.Context
 
 	// meta
 	requestMethod string
+	// traceContext the context of the span the requests are traced as children of, nil for root spans
+	traceContext context.Context
+	// counters the errors and timeouts of the requests, shared by the copies of the client, nil for no counting
+	counters *requestCounters
+	// pagination how the chunks are paged through, shared by the copies of the client, nil for their offset
+	pagination pagination
+	// retries receives the retries of the requests of a copy of the client, e.g. of a chunk, nil for none
+	retries *int
+	// session the session cookies reused instead of the credentials, shared by the copies of the client,
+	// nil to always send the credentials
+	session *authSession
 }
 
 // chunk is used to get unmarshal the json containing the total number of chunks
@@ -83,17 +121,33 @@ type chunk struct {
 
 // NewClient make a new Audisto API Client and checks if it's valid
 func NewClient(username string, password string, crawl uint64, mode string,
+	noDetails bool, chunknumber uint64, chunkSize uint64, filter string,
+	order string) (*AudistoAPIClient, error) {
+	return newClient(username, password, "", crawl, mode, noDetails, chunknumber, chunkSize, filter, order)
+}
+
+// NewTokenClient make a new Audisto API Client authenticated by an API token and checks if it's valid
+func NewTokenClient(token string, crawl uint64, mode string,
+	noDetails bool, chunknumber uint64, chunkSize uint64, filter string,
+	order string) (*AudistoAPIClient, error) {
+	return newClient("", "", token, crawl, mode, noDetails, chunknumber, chunkSize, filter, order)
+}
+
+// newClient make a new Audisto API Client authenticated by either the username and password or the token
+func newClient(username string, password string, token string, crawl uint64, mode string,
 	noDetails bool, chunknumber uint64, chunkSize uint64, filter string,
 	order string) (*AudistoAPIClient, error) {
 	client := &AudistoAPIClient{
 		Username:    strings.TrimSpace(username),
 		Password:    strings.TrimSpace(password),
+		Token:       strings.TrimSpace(token),
 		CrawlID:     crawl,
 		Mode:        strings.TrimSpace(mode),
 		Deep:        noDetails != true,
 		Order:       strings.TrimSpace(order),
 		Filter:      strings.TrimSpace(filter),
 		ChunkNumber: chunknumber,
+		RetryPolicy: DefaultRetryPolicy(),
 	}
 	client.SetChunkSize(chunkSize)
 	return client, client.IsValid()
@@ -102,30 +156,117 @@ func NewClient(username string, password string, crawl uint64, mode string,
 // IsValid check if the struct info look good. This does not do any remote request.
 func (api *AudistoAPIClient) IsValid() error {
 
-	if api.Username == "" || api.Password == "" || api.CrawlID == 0 {
-		return fmt.Errorf("username, password or crawl should NOT be empty")
+	if err := api.credentialsError(); err != nil {
+		return err
 	}
 
-	if api.Mode != "" && api.Mode != "pages" && api.Mode != "links" {
-		return fmt.Errorf("mode has to be 'links' or 'pages'")
+	if api.CrawlID == 0 {
+		return fmt.Errorf("crawl should NOT be empty")
+	}
+
+	if api.Mode != "" && !IsExportMode(api.Mode) {
+		return fmt.Errorf("mode has to be 'pages', 'links' or 'hints'")
 	}
 
 	return nil
 }
 
+// credentialsError checks the client is authenticated by either a username and password or an API token
+func (api *AudistoAPIClient) credentialsError() error {
+	if api.Token == "" {
+		if api.Username == "" || api.Password == "" {
+			return fmt.Errorf("username and password, or an API token should NOT be empty")
+		}
+		return nil
+	}
+	if api.Username != "" || api.Password != "" {
+		return fmt.Errorf("either an API token or a username and password can be used, not both")
+	}
+	return nil
+}
+
+// ParseAPIBaseURL checks the base URL of a staging or on-premises Audisto API, e.g. https://audisto.example.com/api,
+// returned without its trailing slash
+func ParseAPIBaseURL(baseURL string) (string, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API base URL %q: %v", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid API base URL %q, expected e.g. https://api.audisto.com", baseURL)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid API base URL %q, the credentials and query params can't be part of it", baseURL)
+	}
+	return baseURL, nil
+}
+
+// SetEndpoint sends the requests to the given base URL and API version instead of the default ones,
+// e.g. to test against a staging instance. Empty values keep the default ones.
+func (api *AudistoAPIClient) SetEndpoint(baseURL string, version string) error {
+	baseURL, err := ParseAPIBaseURL(baseURL)
+	if err != nil {
+		return err
+	}
+	version = strings.Trim(strings.TrimSpace(version), "/")
+	if strings.ContainsAny(version, "/?# ") {
+		return fmt.Errorf("invalid API version %q, expected e.g. %s", version, AudistoAPIVersion)
+	}
+	api.BaseURL, api.APIVersion = baseURL, version
+	return nil
+}
+
+// apiBase returns the scheme and the host, followed by the path prefix if any, of the API
+func (api *AudistoAPIClient) apiBase() (string, string) {
+	if api.BaseURL == "" {
+		return EndpointSchema, AudistoAPIDomain
+	}
+	u, err := url.Parse(api.BaseURL)
+	if err != nil {
+		return EndpointSchema, AudistoAPIDomain
+	}
+	return u.Scheme, u.Host + strings.TrimRight(u.Path, "/")
+}
+
+// apiVersion returns the version of the API the requests are sent to
+func (api *AudistoAPIClient) apiVersion() string {
+	if api.APIVersion == "" {
+		return AudistoAPIVersion
+	}
+	return api.APIVersion
+}
+
 // GetAPIEndpoint constructs the Audisto API endpoint without the query params nor the dsn part.
 func (api *AudistoAPIClient) GetAPIEndpoint() string {
 	endpoint := strings.Trim(AudistoAPIEndpoint, "/")
-	urlParts := []string{AudistoAPIDomain, AudistoAPIVersion, endpoint}
+	_, host := api.apiBase()
+	urlParts := []string{host, api.apiVersion(), endpoint}
 	return strings.Join(urlParts, "/")
 }
 
+// credentials returns the username and password the requests are authenticated by, nil when authenticated
+// by an API token
+func (api *AudistoAPIClient) credentials() *url.Userinfo {
+	if api.Token != "" {
+		return nil
+	}
+	return url.UserPassword(api.Username, api.Password)
+}
+
 // GetBaseURL construct the base url for quering Audisto API in the form of:
-// username:password@api.audisto.com
+// username:password@api.audisto.com, or api.audisto.com when authenticated by an API token
 func (api *AudistoAPIClient) GetBaseURL() string {
+	scheme, _ := api.apiBase()
+	if api.Token != "" {
+		return fmt.Sprintf("%s://%s", scheme, api.GetAPIEndpoint())
+	}
 	return fmt.Sprintf(
 		"%s://%s:%s@%s",
-		EndpointSchema, api.Username, api.Password, api.GetAPIEndpoint())
+		scheme, api.Username, api.Password, api.GetAPIEndpoint())
 }
 
 // GetURLPath returns the full url for interacting with Audisto API, WITHOUT query params
@@ -138,9 +279,14 @@ func (api *AudistoAPIClient) GetURLPath() string {
 // e.g. /2.0/crawls/123456/links
 func (api *AudistoAPIClient) GetRelativePath() string {
 	endpoint := strings.Trim(AudistoAPIEndpoint, "/")
+	_, host := api.apiBase()
+	prefix := ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		prefix = host[i:]
+	}
 	return fmt.Sprintf(
-		"/%s/%s/%v/%s",
-		AudistoAPIVersion, endpoint, api.CrawlID, api.Mode)
+		"%s/%s/%s/%v/%s",
+		prefix, api.apiVersion(), endpoint, api.CrawlID, api.Mode)
 }
 
 // GetQueryParams use net/url package to construct query params
@@ -175,8 +321,7 @@ func (api *AudistoAPIClient) GetQueryParams(forTheFirstRequest bool) url.Values
 			urlQueryParams.Add("output", api.Output)
 		}
 
-		urlQueryParams.Add("chunk", strconv.FormatUint(api.ChunkNumber, 10))
-		urlQueryParams.Add("chunk_size", strconv.FormatUint(api.ChunkSize, 10))
+		api.chunkParams(urlQueryParams)
 	}
 	return urlQueryParams
 }
@@ -239,28 +384,71 @@ func (api *AudistoAPIClient) GetRequestURL() (*url.URL, error) {
 }
 
 // Do execute an http request adding Audisto API header values
-// This also do variable validation before executing the request for less http roundtrips
+// This also do variable validation before executing the request for less http roundtrips.
+// Network errors and transient responses are retried as per the client RetryPolicy.
 func (api *AudistoAPIClient) Do(request *http.Request) (*http.Response, error) {
 	err := api.IsValid()
 	if err != nil {
 		return nil, err
 	}
+	return api.do(request)
+}
 
+// do execute an http request adding Audisto API header values, without validating the client
+func (api *AudistoAPIClient) do(request *http.Request) (*http.Response, error) {
 	bodyParams := url.Values{}
 	request.Header = http.Header{}
 	request.Header.Add("Content-Length", strconv.Itoa(len(bodyParams.Encode())))
 	request.Header.Add("Connection", ConnectionType)
 	request.Header.Add("Accept-Encoding", AcceptEncoding)
 	request.Header.Add("Content-Type", ContentType)
-	return api.httpClient.Do(request)
+	// a cached session authenticates the request instead of the credentials
+	session := api.session.apply(request)
+	if !session && api.Token != "" {
+		request.Header.Add("Authorization", "Bearer "+api.Token)
+	}
+	api.applyHeaders(request)
+	response, err := api.doWithRetries(request)
+	if session && err == nil && response.StatusCode == http.StatusUnauthorized {
+		// the session expired: the request is sent again with the credentials
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		api.session.reject()
+		if request.GetBody != nil {
+			if request.Body, err = request.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		request.URL.User = api.credentials()
+		request.Header.Del("Cookie")
+		if api.Token != "" {
+			request.Header.Add("Authorization", "Bearer "+api.Token)
+		}
+		api.applyHeaders(request)
+		response, err = api.doWithRetries(request)
+	} else if session && err == nil {
+		api.session.accepted()
+	}
+	if err == nil {
+		api.session.store(response)
+	}
+	return response, err
 }
 
 // FetchRawChunk makes an http request to the server for a given chunk
 func (api *AudistoAPIClient) FetchRawChunk(forTheFirstRequest bool) ([]byte, int, error) {
+	request, err := api.chunkRequest(forTheFirstRequest)
+	if err != nil {
+		return []byte(""), 0, err
+	}
+	return api.fetch(request)
+}
 
+// chunkRequest makes the http request for the current chunk, after validating the client
+func (api *AudistoAPIClient) chunkRequest(forTheFirstRequest bool) (*http.Request, error) {
 	requestURL, err := api.GetRequestURL()
 	if err != nil {
-		return []byte(""), 0, err
+		return nil, err
 	}
 	bodyParameters := url.Values{}
 	requestURL.RawQuery = api.GetQueryParams(forTheFirstRequest).Encode()
@@ -269,35 +457,121 @@ func (api *AudistoAPIClient) FetchRawChunk(forTheFirstRequest bool) ([]byte, int
 		api.GetRequestMethod(), requestURL.String(),
 		bytes.NewBufferString(bodyParameters.Encode()))
 	if err != nil {
-		return []byte(""), 0, fmt.Errorf("Failed to get the URL %s: %s", requestURL, err)
+		return nil, fmt.Errorf("Failed to get the URL %s: %s", requestURL, err)
+	}
+
+	if err = api.IsValid(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// fetch executes the request and reads the whole response body, decompressing it if needed
+func (api *AudistoAPIClient) fetch(request *http.Request) ([]byte, int, error) {
+	body, statusCode, _, err := api.fetchWithHeader(request)
+	return body, statusCode, err
+}
+
+// fetchWithHeader executes the request and reads the whole response body, decompressing it if needed.
+// The response header is returned along with it.
+func (api *AudistoAPIClient) fetchWithHeader(request *http.Request) ([]byte, int, http.Header, error) {
+	stream, statusCode, header, err := api.fetchStream(request)
+	if err != nil {
+		return []byte(""), statusCode, header, err
 	}
+	defer stream.Close()
 
-	response, err := api.Do(request)
+	responseBody, err := ioutil.ReadAll(stream)
 	if err != nil {
-		return []byte(""), 0, fmt.Errorf("Failed to get the URL %s: %s", requestURL, err)
+		return []byte(""), statusCode, header, err
 	}
+	return responseBody, statusCode, header, nil
+}
 
-	defer response.Body.Close()
+// fetchStream executes the request and returns the response body to be read, decompressed if needed.
+// The stream has to be closed once read.
+func (api *AudistoAPIClient) fetchStream(request *http.Request) (*chunkStream, int, http.Header, error) {
+	response, err := api.do(request)
+	// not a network error, the request is missing from the fixtures replayed
+	if urlErr, ok := err.(*url.Error); ok && IsFixtureNotFound(urlErr.Err) {
+		return nil, 0, nil, urlErr.Err
+	}
+	if err != nil {
+		return nil, 0, nil, &NetworkError{Err: fmt.Errorf("Failed to get the URL %s: %s", request.URL, err)}
+	}
 
-	var responseReader io.ReadCloser
-	switch response.Header.Get("Content-Encoding") {
-	case "gzip":
-		decompressedBodyReader, err := gzip.NewReader(response.Body)
+	// the bandwidth limit applies to the bytes received, before decompression
+	var body io.Reader = response.Body
+	if api.BandwidthLimiter != nil {
+		body = &throttledReader{reader: response.Body, limiter: api.BandwidthLimiter}
+	}
+
+	stream := &chunkStream{reader: body, closers: []io.Closer{response.Body}, url: request.URL.String(), counters: api.counters}
+	if response.Header.Get("Content-Encoding") == "gzip" {
+		decompressedBodyReader, err := gzip.NewReader(body)
 		if err != nil {
-			return []byte(""), response.StatusCode, err
+			response.Body.Close()
+			return nil, response.StatusCode, response.Header, err
 		}
-		responseReader = decompressedBodyReader
-		defer responseReader.Close()
-	default:
-		responseReader = response.Body
+		stream.reader = decompressedBodyReader
+		stream.closers = append(stream.closers, decompressedBodyReader)
+	}
+	stream.resume = func(retry int, skip int) (*chunkStream, error) {
+		return api.resumeStream(request, retry, skip)
+	}
+	return stream, response.StatusCode, response.Header, nil
+}
+
+// FetchChunk requests a given chunk, without altering the client chunk number and size.
+// It's safe to be called concurrently.
+func (api *AudistoAPIClient) FetchChunk(number uint64, size uint64) ([]byte, int, error) {
+	body, statusCode, _, err := api.fetchChunk(number, size)
+	return body, statusCode, err
+}
+
+// fetchChunk requests a given chunk like FetchChunk, the response header is returned along with it
+func (api *AudistoAPIClient) fetchChunk(number uint64, size uint64) ([]byte, int, http.Header, error) {
+	stream, statusCode, header, err := api.fetchChunkStream(number, size)
+	if err != nil {
+		return []byte(""), statusCode, header, err
 	}
+	defer stream.Close()
 
-	responseBody, err := ioutil.ReadAll(responseReader)
+	body, err := ioutil.ReadAll(stream)
 	if err != nil {
-		return []byte(""), response.StatusCode, err
+		return []byte(""), statusCode, header, err
 	}
+	return body, statusCode, header, nil
+}
 
-	return responseBody, response.StatusCode, nil
+// fetchChunkStream requests a given chunk like fetchChunk, its body being returned to be read as it's received.
+// The span of the request ends once the stream is closed.
+func (api *AudistoAPIClient) fetchChunkStream(number uint64, size uint64) (*chunkStream, int, http.Header, error) {
+	client := *api
+	client.ChunkNumber = number
+	client.ChunkSize = size
+
+	request, err := client.chunkRequest(false)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	ctx, span := startSpan(api.traceContext, "chunk request",
+		attribute.String("audisto.mode", client.Mode),
+		attribute.Int64("audisto.chunk", int64(number)),
+		attribute.Int64("audisto.chunk_size", int64(size)))
+	client.traceContext = ctx
+	stream, statusCode, header, err := client.fetchStream(request)
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	if err != nil {
+		endSpan(span, err)
+		return nil, statusCode, header, err
+	}
+	if statusCode == http.StatusOK {
+		client.observeChunk(number, size, header)
+	}
+	stream.span = span
+	return stream, statusCode, header, nil
 }
 
 // FetchTotalElements sets up the request for the first chunk in json,
@@ -315,50 +589,29 @@ func (api *AudistoAPIClient) FetchTotalElements() ([]byte, int, error) {
 
 // GetTotalElements asks the server the total number of elements
 func (api *AudistoAPIClient) GetTotalElements() (uint64, error) {
-	var body []byte
-	var statusCode int
+	// transient errors are already retried by the client, as per its retry policy
+	request, err := api.chunkRequest(true)
+	if err != nil {
+		return 0, err
+	}
+	body, statusCode, header, err := api.fetchWithHeader(request)
+	if err != nil {
+		return 0, err
+	}
 
-	err := retry(5, 3, func() error {
-		var err error
-		body, statusCode, err = api.FetchTotalElements()
-		if err != nil {
-			return err
+	if statusCode >= 400 { // we've got a status code that reflects an error
+		switch statusCode {
+		case 401, 402, 403:
+			return 0, statusCodeError(statusCode, header, api.CrawlID)
 		}
-
-		errorString, ok := StatusCodesErrors[statusCode]
-
-		if !ok && statusCode >= 400 { // we've got a status code that reflects an error
-
-			switch statusCode {
-			case 429, 504: // errors that require sleep
-				{
-					// 429: multiple requests
-					// 504: timeout
-					time.Sleep(time.Second * 5)
-					return fmt.Errorf(errorString)
-				}
-
-			case 401, 403, 404: // no-sleep errors
-				{
-					return fmt.Errorf(errorString)
-				}
-			default: // unknown errors
-				{
-					if statusCode < 500 {
-						return fmt.Errorf("Unknown error occurred (code %v)", statusCode)
-					}
-					// server errors, seelp
-					time.Sleep(time.Second * 5)
-					return fmt.Errorf("Error while getting total number of elements: %v, server error", statusCode)
-				}
-			}
+		if errorString, ok := StatusCodesErrors[statusCode]; ok {
+			return 0, &APIError{StatusCode: statusCode, Message: errorString}
 		}
-
-		return nil
-	}, nil)
-
-	if err != nil {
-		return 0, err
+		message := fmt.Sprintf("Error while getting total number of elements: %v, server error", statusCode)
+		if statusCode < 500 {
+			message = fmt.Sprintf("Unknown error occurred (code %v)", statusCode)
+		}
+		return 0, &APIError{StatusCode: statusCode, Message: message}
 	}
 
 	var firstChunk chunk
@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuthSessionMaxAge how long the session cookies sent by the API without an expiry are reused for
+var AuthSessionMaxAge = 30 * time.Minute
+
+// authSession the session cookies the API authenticates the requests by, reused instead of sending the
+// credentials with every request. It's shared by the copies of the client making parallel requests, and
+// persisted to a file when set, see SetAuthCacheFile.
+type authSession struct {
+	mu            sync.Mutex
+	filename      string // the sessions are persisted to, "" to keep them in memory only
+	key           string // the account and API the session belongs to, in the file
+	cookies       []cachedCookie
+	loaded        bool // the file was read
+	authenticated bool // a request was authenticated by the current cookies
+	disabled      bool // the cookies don't authenticate the requests, the credentials are sent instead
+}
+
+// cachedCookie a session cookie, along with when it expires
+type cachedCookie struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetAuthCacheFile persists the session cookies the API authenticates the requests by to the given file, so
+// short-lived downloads, e.g. scheduled ones, reuse them instead of authenticating again. The sessions are
+// always reused within a download; they're refreshed as the API sends new cookies, and dropped once they
+// expire or are refused, the credentials being sent again then. The file holds the sessions of every
+// account and API, it's only readable by its owner.
+// It has to be called before Setup()
+func (d *Downloader) SetAuthCacheFile(filename string) {
+	d.authCacheFile = filename
+}
+
+// newAuthSession returns the session of the account and the API of the client, persisted to the file if set
+func newAuthSession(filename string, api *AudistoAPIClient) *authSession {
+	digest := sha256.Sum256([]byte(api.GetAPIEndpoint() + "\n" + api.Username + "\n" + api.Token))
+	return &authSession{filename: filename, key: hex.EncodeToString(digest[:])}
+}
+
+// apply adds the cookies of the session to the request instead of its credentials. It returns false when
+// there is no session to reuse, the credentials being sent.
+func (s *authSession) apply(request *http.Request) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disabled {
+		return false
+	}
+	s.load()
+
+	now := time.Now()
+	valid := s.cookies[:0]
+	for _, cookie := range s.cookies {
+		if cookie.Expires.After(now) {
+			valid = append(valid, cookie)
+		}
+	}
+	s.cookies = valid
+	if len(s.cookies) == 0 {
+		return false
+	}
+	for _, cookie := range s.cookies {
+		request.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	request.URL.User = nil
+	return true
+}
+
+// accepted records a request was authenticated by the session, it's persisted from then on
+func (s *authSession) accepted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.authenticated {
+		s.authenticated = true
+		s.persist()
+	}
+}
+
+// reject drops the session once the API refused it: it expired, the credentials authenticate again.
+// Cookies refused before they authenticated any request aren't a session, they're not reused.
+func (s *authSession) reject() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.authenticated {
+		s.disabled = true
+	}
+	s.cookies, s.authenticated = nil, false
+	s.persist()
+}
+
+// store keeps the cookies the API sent along with the response, replacing the previous ones
+func (s *authSession) store(response *http.Response) {
+	if s == nil {
+		return
+	}
+	cookies := response.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disabled {
+		return
+	}
+	s.load()
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		kept := s.cookies[:0]
+		for _, previous := range s.cookies {
+			if previous.Name != cookie.Name {
+				kept = append(kept, previous)
+			}
+		}
+		s.cookies = kept
+		// a negative max age deletes the cookie
+		if cookie.MaxAge < 0 {
+			continue
+		}
+		expires := now.Add(AuthSessionMaxAge)
+		if cookie.MaxAge > 0 {
+			expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		} else if !cookie.Expires.IsZero() {
+			expires = cookie.Expires
+		}
+		s.cookies = append(s.cookies, cachedCookie{Name: cookie.Name, Value: cookie.Value, Expires: expires})
+	}
+	// the cookies are persisted once they authenticated a request
+	if s.authenticated {
+		s.persist()
+	}
+}
+
+// load reads the session of the file once, a missing or corrupted file holding no session.
+// The sessions persisted authenticated the requests of a previous download.
+func (s *authSession) load() {
+	if s.loaded || s.filename == "" {
+		return
+	}
+	s.loaded = true
+	s.cookies = s.readFile()[s.key]
+	s.authenticated = len(s.cookies) > 0
+}
+
+// readFile returns the sessions of the file, by account and API
+func (s *authSession) readFile() map[string][]cachedCookie {
+	sessions := map[string][]cachedCookie{}
+	data, err := ioutil.ReadFile(s.filename)
+	if err != nil {
+		return sessions
+	}
+	if err = json.Unmarshal(data, &sessions); err != nil || sessions == nil {
+		return map[string][]cachedCookie{}
+	}
+	return sessions
+}
+
+// persist writes the session to the file along with the sessions of the other accounts, the expired ones
+// being dropped. A session that can't be persisted is still reused in memory.
+func (s *authSession) persist() {
+	if s.filename == "" {
+		return
+	}
+	now := time.Now()
+	sessions := map[string][]cachedCookie{}
+	for key, cookies := range s.readFile() {
+		for _, cookie := range cookies {
+			if key != s.key && cookie.Expires.After(now) {
+				sessions[key] = append(sessions[key], cookie)
+			}
+		}
+	}
+	if len(s.cookies) > 0 {
+		sessions[s.key] = s.cookies
+	}
+	data, err := json.MarshalIndent(sessions, "", "	")
+	if err != nil {
+		return
+	}
+	writeFileAtomic(s.filename, data, 0600)
+}
@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAuthSession(t *testing.T) {
+	var mu sync.Mutex
+	session, authenticated, requests := "first", 0, 0
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if cookie, err := r.Cookie("session"); err == nil && cookie.Value == session {
+			if _, _, ok := r.BasicAuth(); ok {
+				t.Error("the credentials should not be sent along with the session")
+			}
+		} else if _, _, ok := r.BasicAuth(); ok {
+			authenticated++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: session})
+		} else {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+	dir, err := ioutil.TempDir("", "authcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := filepath.Join(dir, "auth.json")
+	download := func() {
+		options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages",
+			Output: filepath.Join(dir, "crawl.tsv"), NoResume: true, AuthCacheFile: cache}
+		if err := New(options).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the session is reused within the download
+	download()
+	if authenticated != 1 || requests < 2 {
+		t.Errorf("expected the session to be reused, %d of %d requests authenticated", authenticated, requests)
+	}
+	if info, err := os.Stat(cache); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the session to be persisted, only readable by its owner: %v", err)
+	}
+
+	// and by the next download
+	download()
+	if authenticated != 1 {
+		t.Errorf("expected the persisted session to be reused, %d requests authenticated", authenticated)
+	}
+
+	// an expired session is refused, the credentials authenticate again
+	mu.Lock()
+	session = "second"
+	mu.Unlock()
+	download()
+	if authenticated != 2 {
+		t.Errorf("expected the refused session to be renewed, %d requests authenticated", authenticated)
+	}
+}
+
+func TestAuthSessionNotAuthenticating(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		// the cookie is not a session, the credentials are always required
+		http.SetCookie(w, &http.Cookie{Name: "balancer", Value: "a"})
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+	dir, err := ioutil.TempDir("", "authcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv")})
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !d.client.session.disabled {
+		t.Error("cookies not authenticating the requests should not be reused")
+	}
+}
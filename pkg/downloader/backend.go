@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// OutputBackend a custom output the rows are written to, e.g. a message queue or an internal blob store,
+// registered by RegisterOutputBackend for an URL scheme. Like database outputs, custom outputs are written
+// from scratch: they're not compressed, split nor resumed.
+type OutputBackend interface {
+	// Open opens the output at the location, e.g. amqp://broker/queue, before any row is written
+	Open(location string, options OutputBackendOptions) error
+	// WriteRows writes the rows of a chunk, all at once, with the columns of the header: the header is the same
+	// for every chunk of the download
+	WriteRows(header []string, rows [][]string) error
+	// Close completes the output once the download completed
+	Close() error
+}
+
+// OutputBackendAborter is implemented by the backends that can discard the output of a failed or stopped
+// download, e.g. a transaction that shouldn't be committed. The other backends are closed.
+type OutputBackendAborter interface {
+	Abort(err error) error
+}
+
+// OutputBackendProgress is implemented by the backends notified of the progress of the download,
+// every time the rows of a chunk are written
+type OutputBackendProgress interface {
+	Progress(progress BackendProgress)
+}
+
+// OutputBackendOptions the download the backend is opened for
+type OutputBackendOptions struct {
+	CrawlID uint64
+	Mode    string // pages or links
+	Replace bool   // an existing output has to be replaced, it's appended to or an error otherwise
+}
+
+// BackendProgress the progress of a download, once the rows of a chunk are written
+type BackendProgress struct {
+	DoneElements  uint64 // the elements downloaded so far
+	TotalElements uint64
+	Rows          uint64 // the rows written so far, the rows not matching the where expression excluded
+}
+
+// OutputBackendFactory creates the backend of a download, every download opening its own
+type OutputBackendFactory func() OutputBackend
+
+// backendScheme matches the URL schemes of RFC 3986
+var backendScheme = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// RegisterOutputBackend registers the backend of an URL scheme, e.g. "amqp" for amqp://broker/queue outputs.
+// The schemes of the built-in outputs (s3, gs, postgres, bq, kafka...) can't be registered again.
+// It has to be called before any download, e.g. from an init function.
+func RegisterOutputBackend(scheme string, factory OutputBackendFactory) error {
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	if !backendScheme.MatchString(scheme) {
+		return fmt.Errorf("invalid output backend scheme %q", scheme)
+	}
+	if factory == nil {
+		return fmt.Errorf("no factory for the %s output backend", scheme)
+	}
+	_, remote := remoteOutputs[scheme]
+	_, table := tableLocations[scheme]
+	if remote || table {
+		return fmt.Errorf("the %s outputs are registered already", scheme)
+	}
+
+	tableLocations[scheme] = func(location string, options tableOptions) (tableOutput, error) {
+		backend := factory()
+		if err := backend.Open(location, OutputBackendOptions{CrawlID: options.CrawlID, Mode: options.Table, Replace: options.Replace}); err != nil {
+			return nil, err
+		}
+		return &backendOutput{backend: backend}, nil
+	}
+	return nil
+}
+
+// backendOutput the table output of a registered backend
+type backendOutput struct {
+	backend OutputBackend
+}
+
+func (o *backendOutput) InsertRows(header []string, rows [][]string) error {
+	return o.backend.WriteRows(header, rows)
+}
+
+func (o *backendOutput) Close() error {
+	return o.backend.Close()
+}
+
+func (o *backendOutput) Abort(err error) error {
+	if a, ok := o.backend.(OutputBackendAborter); ok {
+		return a.Abort(err)
+	}
+	return o.backend.Close()
+}
+
+// reportBackendProgress notifies the backend of the current output of the progress of the download, if it's
+// a backend notified of it
+func (d *Downloader) reportBackendProgress() {
+	output, ok := d.outputTable.(*backendOutput)
+	if !ok {
+		return
+	}
+	if p, ok := output.backend.(OutputBackendProgress); ok {
+		p.Progress(BackendProgress{DoneElements: d.DoneElements, TotalElements: d.TotalElements, Rows: d.stats.rows})
+	}
+}
@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// memoryBackend an output backend keeping the rows in memory
+type memoryBackend struct {
+	location string
+	options  OutputBackendOptions
+	header   []string
+	rows     [][]string
+	progress []BackendProgress
+	closed   bool
+}
+
+func (b *memoryBackend) Open(location string, options OutputBackendOptions) error {
+	b.location, b.options = location, options
+	return nil
+}
+
+func (b *memoryBackend) WriteRows(header []string, rows [][]string) error {
+	b.header = header
+	b.rows = append(b.rows, rows...)
+	return nil
+}
+
+func (b *memoryBackend) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *memoryBackend) Progress(progress BackendProgress) {
+	b.progress = append(b.progress, progress)
+}
+
+var (
+	memoryBackends   []*memoryBackend
+	registerBackends sync.Once
+)
+
+func TestOutputBackend(t *testing.T) {
+	registerBackends.Do(func() {
+		if err := RegisterOutputBackend("memory", func() OutputBackend {
+			backend := &memoryBackend{}
+			memoryBackends = append(memoryBackends, backend)
+			return backend
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	memoryBackends = nil
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: "memory://exports/pages"}
+	if err := New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(memoryBackends) != 1 {
+		t.Fatalf("expected a backend to be opened, got %d", len(memoryBackends))
+	}
+	backend := memoryBackends[0]
+	if backend.location != "memory://exports/pages" || backend.options.CrawlID != 12345 || backend.options.Mode != "pages" {
+		t.Errorf("unexpected location %s and options %+v", backend.location, backend.options)
+	}
+	if len(backend.rows) != 2 || backend.rows[1][1] != "http://example.com/b" || len(backend.header) != 2 || !backend.closed {
+		t.Errorf("unexpected rows %q with header %q, closed: %v", backend.rows, backend.header, backend.closed)
+	}
+	if n := len(backend.progress); n == 0 || backend.progress[n-1].DoneElements != 2 || backend.progress[n-1].Rows != 2 {
+		t.Errorf("unexpected progress %+v", backend.progress)
+	}
+}
+
+func TestRegisterOutputBackend(t *testing.T) {
+	factory := func() OutputBackend { return &memoryBackend{} }
+	for _, scheme := range []string{"postgres", "s3", "bq", "kafka", "", "1kafka", "kafka/topic"} {
+		if err := RegisterOutputBackend(scheme, factory); err == nil {
+			t.Errorf("expected the %q scheme to be refused", scheme)
+		}
+	}
+	if err := RegisterOutputBackend("blob", nil); err == nil {
+		t.Error("expected a missing factory to be refused")
+	}
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minBandwidthBurst the smallest burst of a BandwidthLimiter, so reads are not throttled byte by byte
+	minBandwidthBurst = 32 * 1024
+)
+
+// bandwidthUnits the multiples of the byte accepted by ParseBandwidth and ParseSize, by suffix
+var bandwidthUnits = map[string]float64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+}
+
+// BandwidthLimiter is a token bucket limiting the bytes read from Audisto API responses, per second.
+// It's shared by parallel requests, so the limit applies to all of them collectively.
+type BandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond float64
+	burst          float64
+	tokens         float64
+	last           time.Time
+}
+
+// NewBandwidthLimiter makes a BandwidthLimiter allowing the given number of bytes per second.
+// Up to a second of bandwidth can be read at once.
+func NewBandwidthLimiter(bytesPerSecond int64) (*BandwidthLimiter, error) {
+	if bytesPerSecond < 1 {
+		return nil, fmt.Errorf("bandwidth limit has to be at least one byte per second")
+	}
+	burst := float64(bytesPerSecond)
+	if burst < minBandwidthBurst {
+		burst = minBandwidthBurst
+	}
+	return &BandwidthLimiter{bytesPerSecond: float64(bytesPerSecond), burst: burst, tokens: burst, last: time.Now()}, nil
+}
+
+// WaitN blocks until n more bytes can be read
+func (l *BandwidthLimiter) WaitN(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	// refill the bucket with the bytes earned since the last read
+	l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSecond
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// take the bytes, possibly in advance: parallel reads queue up by driving the bucket negative
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.bytesPerSecond * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// throttledReader reads at most the bandwidth of its limiter
+type throttledReader struct {
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	// small reads keep the throughput smooth
+	if len(p) > minBandwidthBurst {
+		p = p[:minBandwidthBurst]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.limiter.WaitN(n)
+	}
+	return n, err
+}
+
+// ParseBandwidth parses a bandwidth in the form of "10MB/s", "512KB/s" or "1.5M", in bytes per second.
+// Units are multiples of 1024, a number alone is a number of bytes per second.
+func ParseBandwidth(bandwidth string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(bandwidth))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "/s"), "ps")
+
+	bytes, err := parseBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q: expected e.g. 10MB/s or 512KB/s", bandwidth)
+	}
+	return bytes, nil
+}
+
+// parseBytes parses a number of bytes followed by an optional unit of bandwidthUnits, e.g. "1.5MB"
+func parseBytes(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	i := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(value)
+	}
+	number, err := strconv.ParseFloat(value[:i], 64)
+	unit, ok := bandwidthUnits[strings.TrimSpace(value[i:])]
+	if err != nil || !ok || number*unit < 1 {
+		return 0, fmt.Errorf("invalid number of bytes %q", value)
+	}
+	return int64(number * unit), nil
+}
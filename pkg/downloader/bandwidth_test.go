@@ -0,0 +1,46 @@
+package downloader
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	for bandwidth, expected := range map[string]int64{
+		"10MB/s":  10 << 20,
+		"512KB/s": 512 << 10,
+		"1.5m":    3 << 19,
+		"2048":    2048,
+		"1 GB/s":  1 << 30,
+	} {
+		if value, err := ParseBandwidth(bandwidth); err != nil || value != expected {
+			t.Errorf("%q: expected %d, got %d (%v)", bandwidth, expected, value, err)
+		}
+	}
+	for _, invalid := range []string{"", "fast", "10TB/s", "0MB/s", "MB/s"} {
+		if _, err := ParseBandwidth(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	limiter, err := NewBandwidthLimiter(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first second of bandwidth is read at once, the next half second is throttled
+	start := time.Now()
+	reader := &throttledReader{reader: bytes.NewReader(make([]byte, 3<<19)), limiter: limiter}
+	n, err := io.Copy(ioutil.Discard, reader)
+	if err != nil || n != 3<<19 {
+		t.Fatalf("expected %d bytes, got %d (%v)", 3<<19, n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("reading 1.5MB at 1MB/s should take about 0.5s, took %v", elapsed)
+	}
+}
@@ -0,0 +1,114 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Budget caps the API calls made and the bytes downloaded by a run, e.g. to stay within the monthly quota of
+// an API plan. A budget is shared by the downloads it's set to (the modes of --mode=all, several crawls...),
+// retries and the requests of Setup() included. Once exhausted, the downloads stop as if cancelled: the chunks
+// being downloaded are written and the resume state persisted, a BudgetExhaustedError being returned.
+type Budget struct {
+	maxCalls int64 // 0 for no limit
+	maxBytes int64 // 0 for no limit
+	calls    int64 // updated with atomic operations, downloads are run in parallel
+	bytes    int64
+
+	mu        sync.Mutex
+	exhausted *BudgetExhaustedError
+}
+
+// NewBudget makes a Budget of the given API calls and bytes downloaded, 0 for no limit
+func NewBudget(maxAPICalls int64, maxBytes int64) (*Budget, error) {
+	if maxAPICalls < 0 || maxBytes < 0 {
+		return nil, fmt.Errorf("the API calls and bytes of a budget can't be negative")
+	}
+	return &Budget{maxCalls: maxAPICalls, maxBytes: maxBytes}, nil
+}
+
+// SetBudget caps the API calls and the bytes of the download, nil for no cap. It has to be called before Setup()
+func (d *Downloader) SetBudget(budget *Budget) {
+	d.budget = budget
+	d.counters.budget = budget
+}
+
+// spendCall counts an API call about to be made, a BudgetExhaustedError being returned instead once the
+// calls are exhausted: the call isn't made
+func (b *Budget) spendCall() error {
+	// exhausted already, e.g. by another download of the budget
+	if err := b.exhaustion(); err != nil {
+		return err
+	}
+	if b.maxCalls > 0 && atomic.AddInt64(&b.calls, 1) > b.maxCalls {
+		atomic.AddInt64(&b.calls, -1)
+		return b.exhaust(&BudgetExhaustedError{Budget: "API calls", Limit: b.maxCalls})
+	}
+	return nil
+}
+
+// spendBytes counts bytes downloaded, and returns true once the bytes are exhausted
+func (b *Budget) spendBytes(n int) bool {
+	if b.maxBytes == 0 || atomic.AddInt64(&b.bytes, int64(n)) < b.maxBytes {
+		return false
+	}
+	b.exhaust(&BudgetExhaustedError{Budget: "bytes", Limit: b.maxBytes})
+	return true
+}
+
+// exhaust records the first limit of the budget reached, returned for every download of the budget
+func (b *Budget) exhaust(err *BudgetExhaustedError) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exhausted == nil {
+		b.exhausted = err
+	}
+	return b.exhausted
+}
+
+// exhaustion returns the error of the exhausted budget, nil while it's not exhausted (or there's no budget)
+func (b *Budget) exhaustion() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exhausted == nil {
+		return nil
+	}
+	return b.exhausted
+}
+
+// withBudget returns the context of Run(), cancelled once the budget of the download is exhausted
+func (d *Downloader) withBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	d.counters.stop = cancel
+	return ctx, cancel
+}
+
+// spendCall counts an API call of the download, a BudgetExhaustedError being returned instead once the budget
+// is exhausted, the download being stopped. It's safe to be called from parallel requests, and on nil counters.
+func (c *requestCounters) spendCall() error {
+	if c == nil {
+		return nil
+	}
+	atomic.AddInt64(&c.calls, 1)
+	if c.budget == nil {
+		return nil
+	}
+	if err := c.budget.spendCall(); err != nil {
+		atomic.AddInt64(&c.calls, -1)
+		c.stopRun()
+		return err
+	}
+	return nil
+}
+
+// stopRun stops the download once its budget is exhausted, as if its context was cancelled
+func (c *requestCounters) stopRun() {
+	if c.stop != nil {
+		c.stop()
+	}
+}
@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// serveCountedPages serves 10 pages in chunks of any size, counting the requests
+func serveCountedPages(requests *int64) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":10,"page":0,"size":1}}`))
+			return
+		}
+		var chunk, size int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Sscan(r.URL.Query().Get("chunk_size"), &size)
+		fmt.Fprint(w, "id\turl\n")
+		for id := chunk * size; id < (chunk+1)*size && id < 10; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", id, id)
+		}
+	})
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	var requests int64
+	defer serveCountedPages(&requests)()
+	dir, err := ioutil.TempDir("", "budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	budget, err := NewBudget(5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 1, Budget: budget}
+	download := New(options)
+	err = download.Run(context.Background())
+	if exhausted, ok := err.(*BudgetExhaustedError); !ok || exhausted.Limit != 5 {
+		t.Fatalf("expected the budget to stop the download, got %v", err)
+	}
+	if requests > 5 {
+		t.Errorf("expected at most 5 API calls, %d were made", requests)
+	}
+	if calls := download.Summary(err).APICalls; calls != requests {
+		t.Errorf("expected %d API calls in the summary, got %d", requests, calls)
+	}
+
+	// the budget is shared: another download stops right away
+	if err = New(options).Run(context.Background()); !IsBudgetExhausted(err) {
+		t.Errorf("expected the exhausted budget to stop the next download, got %v", err)
+	}
+
+	// the download is resumed without budget
+	options.Budget = nil
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "id\turl\n"
+	for id := 0; id < 10; id++ {
+		expected += fmt.Sprintf("%d\thttp://example.com/%d\n", id, id)
+	}
+	if string(data) != expected {
+		t.Errorf("expected the download to be resumed, got %q", data)
+	}
+}
+
+func TestBudgetBytes(t *testing.T) {
+	var requests int64
+	defer serveCountedPages(&requests)()
+	dir, err := ioutil.TempDir("", "budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	budget, err := NewBudget(0, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 1, Budget: budget}
+	err = New(options).Run(context.Background())
+	if exhausted, ok := err.(*BudgetExhaustedError); !ok || exhausted.Budget != "bytes" {
+		t.Fatalf("expected the bytes budget to stop the download, got %v", err)
+	}
+	if _, err = NewBudget(-1, 0); err == nil {
+		t.Error("a negative budget should be rejected")
+	}
+}
@@ -0,0 +1,117 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ChecksumSuffix the suffix of the sidecar file holding the SHA-256 of the output
+	ChecksumSuffix = ".sha256"
+)
+
+// SetChecksum when set to true, every chunk is verified against the SHA-256 digest sent by the server
+// if any, and the SHA-256 of the output is written to a [OUTPUT].sha256 sidecar once the download completes.
+// It has to be called before Setup()
+func (d *Downloader) SetChecksum(checksum bool) {
+	d.checksum = checksum
+}
+
+// chunkDigest returns the hex SHA-256 digest of a response body sent by the server as
+// a "Digest: SHA-256=[base64]" header (RFC 3230), "" if there's none
+func chunkDigest(header http.Header) string {
+	for _, value := range header["Digest"] {
+		for _, digest := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(digest), "=", 2)
+			if len(parts) != 2 || !strings.EqualFold(parts[0], "sha-256") {
+				continue
+			}
+			if sum, err := base64.StdEncoding.DecodeString(parts[1]); err == nil {
+				return hex.EncodeToString(sum)
+			}
+		}
+	}
+	return ""
+}
+
+// verifyChunk computes the SHA-256 of a chunk, and compares it to the one sent by the server if any
+func verifyChunk(chunk fetchedChunk) (string, error) {
+	sum := sha256.Sum256(chunk.body)
+	checksum := hex.EncodeToString(sum[:])
+	if chunk.digest != "" && chunk.digest != checksum {
+		return checksum, fmt.Errorf("chunk %d is corrupted: its SHA-256 is %s, the server sent %s", chunk.start/chunk.size, checksum, chunk.digest)
+	}
+	return checksum, nil
+}
+
+// hashedOutput computes the SHA-256 of a remote output while it's being written,
+// remote outputs can't be read back once uploaded
+type hashedOutput struct {
+	io.WriteCloser
+	hash hash.Hash
+}
+
+func newHashedOutput(output io.WriteCloser) *hashedOutput {
+	return &hashedOutput{WriteCloser: output, hash: sha256.New()}
+}
+
+func (o *hashedOutput) Write(p []byte) (int, error) {
+	n, err := o.WriteCloser.Write(p)
+	o.hash.Write(p[:n])
+	return n, err
+}
+
+// Abort aborts the underlying output when supported, it's closed otherwise
+func (o *hashedOutput) Abort(err error) error {
+	if a, ok := o.WriteCloser.(aborter); ok {
+		return a.Abort(err)
+	}
+	return o.WriteCloser.Close()
+}
+
+// fileChecksum computes the SHA-256 of a local file.
+// Resumed downloads were written by several runs, the file itself is hashed.
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeChecksum writes the SHA-256 of an output to its .sha256 sidecar, in the sha256sum format,
+// so it can be checked with `sha256sum -c`. The sidecar of a remote output is uploaded along with it.
+func writeChecksum(output string, checksum string) error {
+	line := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(output))
+
+	if !IsRemoteOutput(output) {
+		return ioutil.WriteFile(output+ChecksumSuffix, []byte(line), 0644)
+	}
+
+	sidecar, err := openRemoteOutput(output + ChecksumSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(sidecar, line); err != nil {
+		if a, ok := sidecar.(aborter); ok {
+			a.Abort(err)
+		}
+		return err
+	}
+	return sidecar.Close()
+}
@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("id\n1\n"))
+	header := http.Header{"Digest": []string{"MD5=abc, SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])}}
+	if digest := chunkDigest(header); digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected digest %q", digest)
+	}
+	if digest := chunkDigest(http.Header{}); digest != "" {
+		t.Errorf("expected no digest, got %q", digest)
+	}
+}
+
+func TestVerifyChunk(t *testing.T) {
+	chunk := fetchedChunk{body: []byte("id\n1\n"), size: 10}
+	checksum, err := verifyChunk(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk.digest = checksum
+	if _, err = verifyChunk(chunk); err != nil {
+		t.Errorf("a matching digest should be accepted: %v", err)
+	}
+
+	chunk.body = []byte("id\n2\n")
+	if _, err = verifyChunk(chunk); err == nil {
+		t.Errorf("a corrupted chunk should be rejected")
+	}
+}
+
+func TestWriteChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	if err = ioutil.WriteFile(output, []byte("id\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileChecksum(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeChecksum(output, checksum); err != nil {
+		t.Fatal(err)
+	}
+
+	sidecar, err := ioutil.ReadFile(output + ChecksumSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sidecar) != checksum+"  crawl.tsv\n" {
+		t.Errorf("unexpected sidecar content %q", sidecar)
+	}
+}
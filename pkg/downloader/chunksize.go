@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AutoChunkSize the chunk size value enabling the adaptive chunk size
+	AutoChunkSize = "auto"
+
+	// AutoChunkMinSize the smallest chunk size of the adaptive chunk size
+	AutoChunkMinSize = 128
+	// AutoChunkStartSize the chunk size the adaptive chunk size starts with
+	AutoChunkStartSize = 512
+	// AutoChunkMaxSize the largest chunk size of the adaptive chunk size, a power of two like the others
+	AutoChunkMaxSize = 8192
+
+	// AutoChunkMaxLatency chunks taking longer than that are shrunk, they risk server timeouts
+	AutoChunkMaxLatency = 30 * time.Second
+
+	// autoChunkSmoothing the weight of the last measure in the throughput average of a chunk size
+	autoChunkSmoothing = 0.5
+	// autoChunkTolerance a larger chunk size is kept if its throughput is at least that ratio of the smaller one
+	autoChunkTolerance = 0.9
+)
+
+// ParseChunkSize parses a chunk size, a number of elements up to DefaultChunkSize or "auto".
+// An empty value is the API default chunk size (0).
+func ParseChunkSize(value string) (size uint64, auto bool, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == AutoChunkSize {
+		return 0, true, nil
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	size, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("chunk-size has to be a number of elements or %q", AutoChunkSize)
+	}
+	if size > DefaultChunkSize {
+		return 0, false, fmt.Errorf("chunk-size can't be greater than %d", DefaultChunkSize)
+	}
+	return size, false, nil
+}
+
+// SetAutoChunkSize when set to true, the chunk size is tuned while downloading, from the latency and
+// the errors of the chunks: it starts small, and grows as long as it improves the throughput without
+// approaching the server timeouts. It has to be called before Setup()
+func (d *Downloader) SetAutoChunkSize(auto bool) {
+	d.chunkSizeTuner = nil
+	if auto {
+		d.chunkSizeTuner = newChunkSizeTuner()
+	}
+}
+
+// chunkSizeTuner tunes the chunk size from the measured throughput of every size.
+// Sizes are powers of two, so every smaller size divides the elements downloaded so far:
+// a size change never requests rows again.
+type chunkSizeTuner struct {
+	size uint64
+	// throughputs the average elements per second of every size tried so far
+	throughputs map[uint64]float64
+	// ceiling the size chunks failed or were too slow with, not tried again
+	ceiling uint64
+}
+
+func newChunkSizeTuner() *chunkSizeTuner {
+	return &chunkSizeTuner{size: AutoChunkStartSize, throughputs: map[uint64]float64{}, ceiling: AutoChunkMaxSize * 2}
+}
+
+// observe records the chunks of the given size fetched at once, and how long it took.
+// Failed or slow chunks shrink the size, fast ones grow it while the throughput improves.
+func (t *chunkSizeTuner) observe(size uint64, chunks int, elapsed time.Duration, failed bool) {
+	// a larger size waiting to divide the downloaded elements, or the last chunk cut to the remaining
+	// elements: the chunks are not representative of the current size
+	if size != t.size && !failed {
+		return
+	}
+	if failed || elapsed > AutoChunkMaxLatency {
+		t.ceiling = minUint64(t.ceiling, size)
+		t.shrink()
+		return
+	}
+	if chunks == 0 || elapsed <= 0 {
+		return
+	}
+
+	throughput := float64(uint64(chunks)*size) / elapsed.Seconds()
+	if previous, ok := t.throughputs[size]; ok {
+		throughput = autoChunkSmoothing*throughput + (1-autoChunkSmoothing)*previous
+	}
+	t.throughputs[size] = throughput
+
+	// larger chunks are slower per element than smaller ones: go back
+	if smaller, ok := t.throughputs[size/2]; ok && throughput < smaller*autoChunkTolerance {
+		t.ceiling = minUint64(t.ceiling, size)
+		t.shrink()
+		return
+	}
+
+	// grow while far enough from the timeouts, unless the larger size was worse already
+	larger := size * 2
+	if larger <= AutoChunkMaxSize && larger < t.ceiling && elapsed < AutoChunkMaxLatency/2 {
+		if known, ok := t.throughputs[larger]; !ok || known >= throughput*autoChunkTolerance {
+			t.size = larger
+		}
+	}
+}
+
+// shrink halves the size, it returns false once the size can't be reduced anymore
+func (t *chunkSizeTuner) shrink() bool {
+	if t.size <= AutoChunkMinSize {
+		return false
+	}
+	t.size /= 2
+	return true
+}
+
+// next returns the size of the next chunks, given the elements downloaded so far.
+// A larger size is only used once it divides the downloaded elements, the current size is kept until then.
+func (t *chunkSizeTuner) next(current uint64, done uint64) uint64 {
+	if t.size > current && done%t.size != 0 {
+		return current
+	}
+	return t.size
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseChunkSize(t *testing.T) {
+	if size, auto, err := ParseChunkSize("Auto"); err != nil || !auto || size != 0 {
+		t.Errorf("auto should enable the adaptive chunk size, got %d, %v (%v)", size, auto, err)
+	}
+	if size, auto, err := ParseChunkSize("5000"); err != nil || auto || size != 5000 {
+		t.Errorf("expected a 5000 chunk size, got %d, %v (%v)", size, auto, err)
+	}
+	for _, invalid := range []string{"big", "-1", "20000"} {
+		if _, _, err := ParseChunkSize(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+}
+
+func TestChunkSizeTuner(t *testing.T) {
+	tuner := newChunkSizeTuner()
+
+	// fast chunks grow the size, up to the max size
+	for i := 0; i < 10; i++ {
+		tuner.observe(tuner.size, 1, time.Second, false)
+	}
+	if tuner.size != AutoChunkMaxSize {
+		t.Errorf("expected the size to grow to %d, got %d", AutoChunkMaxSize, tuner.size)
+	}
+
+	// a failed chunk shrinks the size, which doesn't grow back to the failed size
+	tuner.observe(tuner.size, 1, time.Second, true)
+	if tuner.size != AutoChunkMaxSize/2 {
+		t.Errorf("expected the size to shrink to %d, got %d", AutoChunkMaxSize/2, tuner.size)
+	}
+	tuner.observe(tuner.size, 1, time.Second, false)
+	if tuner.size != AutoChunkMaxSize/2 {
+		t.Errorf("the size should not grow back to a failed size, got %d", tuner.size)
+	}
+
+	// a larger size is only used once it divides the downloaded elements
+	tuner = newChunkSizeTuner()
+	tuner.observe(tuner.size, 1, time.Second, false)
+	if size := tuner.next(AutoChunkStartSize, AutoChunkStartSize); size != AutoChunkStartSize {
+		t.Errorf("the size should not change before it divides the downloaded elements, got %d", size)
+	}
+	if size := tuner.next(AutoChunkStartSize, 2*AutoChunkStartSize); size != 2*AutoChunkStartSize {
+		t.Errorf("expected the size to grow to %d, got %d", 2*AutoChunkStartSize, size)
+	}
+
+	// a larger size with a lower throughput is abandoned
+	tuner.observe(tuner.size, 1, 10*time.Second, false)
+	if tuner.size != AutoChunkStartSize {
+		t.Errorf("expected the size to shrink back to %d, got %d", AutoChunkStartSize, tuner.size)
+	}
+}
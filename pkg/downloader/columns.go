@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetColumns makes the downloader write only the given columns, in the given order, instead of every column.
+// Columns are matched case-insensitively against the header of the chunks.
+// It has to be called before Setup()
+func (d *Downloader) SetColumns(columns []string) error {
+	seen := map[string]bool{}
+	d.columns = nil
+	for _, column := range columns {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "" {
+			return fmt.Errorf("empty column name")
+		}
+		if seen[column] {
+			return fmt.Errorf("column %q is selected twice", column)
+		}
+		seen[column] = true
+		d.columns = append(d.columns, column)
+	}
+	return nil
+}
+
+// ParseColumns splits a comma separated list of columns, e.g. "status_code,url,depth"
+func ParseColumns(columns string) []string {
+	if strings.TrimSpace(columns) == "" {
+		return nil
+	}
+	return strings.Split(columns, ",")
+}
+
+// columnsProjection maps the selected columns to their position in a chunk header
+type columnsProjection []int
+
+// newColumnsProjection finds the selected columns in a chunk header, nil if every column is selected
+func newColumnsProjection(header []string, columns []string) (columnsProjection, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	projection := make(columnsProjection, len(columns))
+	for i, column := range columns {
+		position, ok := positions[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, the available columns are: %s", column, strings.Join(header, ", "))
+		}
+		projection[i] = position
+	}
+	return projection, nil
+}
+
+// apply returns the selected fields of a row, missing fields are left empty
+func (p columnsProjection) apply(fields []string) []string {
+	if p == nil {
+		return fields
+	}
+	projected := make([]string, len(p))
+	for i, position := range p {
+		if position < len(fields) {
+			projected[i] = fields[position]
+		}
+	}
+	return projected
+}
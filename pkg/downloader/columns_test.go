@@ -0,0 +1,42 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnsProjection(t *testing.T) {
+	header := []string{"id", "URL", "status_code", "depth"}
+	projection, err := newColumnsProjection(header, []string{"status_code", "url"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := projection.apply(header); !reflect.DeepEqual(fields, []string{"status_code", "URL"}) {
+		t.Errorf("unexpected projected header %v", fields)
+	}
+	if fields := projection.apply([]string{"1", "http://example.com/"}); !reflect.DeepEqual(fields, []string{"", "http://example.com/"}) {
+		t.Errorf("missing fields should be left empty, got %v", fields)
+	}
+
+	if _, err = newColumnsProjection(header, []string{"title"}); err == nil {
+		t.Errorf("unknown columns should be rejected")
+	}
+
+	projection, _ = newColumnsProjection(header, nil)
+	if fields := projection.apply(header); !reflect.DeepEqual(fields, header) {
+		t.Errorf("every column should be kept without a selection, got %v", fields)
+	}
+}
+
+func TestSetColumns(t *testing.T) {
+	d := New(Options{})
+	if err := d.SetColumns(ParseColumns(" Status_Code, url")); err != nil || !reflect.DeepEqual(d.columns, []string{"status_code", "url"}) {
+		t.Errorf("unexpected columns %v (%v)", d.columns, err)
+	}
+	if err := d.SetColumns(ParseColumns("url,url")); err == nil {
+		t.Errorf("duplicated columns should be rejected")
+	}
+	if err := d.SetColumns(ParseColumns("url,")); err == nil {
+		t.Errorf("empty columns should be rejected")
+	}
+}
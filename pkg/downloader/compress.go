@@ -0,0 +1,167 @@
+package downloader
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// GzipCompression compresses the output with gzip, the output filename gets a ".gz" extension
+	GzipCompression = "gzip"
+
+	// ZstdCompression compresses the output with Zstandard, the output filename gets a ".zst" extension
+	ZstdCompression = "zstd"
+)
+
+// compressor compresses the output stream
+type compressor interface {
+	io.WriteCloser
+	// Checkpoint ends the current compressed member/frame, the output written so far can be
+	// decompressed on its own. A resumed download appends new members right after a checkpoint.
+	Checkpoint() error
+}
+
+// newCompressor returns a compressor writing to w, nil if no compression is requested.
+// level 0 means the default level of the compression.
+func newCompressor(compression string, level int, w io.Writer) (compressor, error) {
+	if err := validateCompressionLevel(compression, level); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case "":
+		return nil, nil
+	case GzipCompression:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gz, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return &gzipCompressor{w: w, gz: gz}, nil
+	case ZstdCompression:
+		options := []zstd.EOption{}
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		enc, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdCompressor{w: w, enc: enc}, nil
+	}
+	return nil, fmt.Errorf("compression not supported: %s", compression)
+}
+
+// validateCompressionLevel checks the level is in the range of the given compression, 0 is always valid
+func validateCompressionLevel(compression string, level int) error {
+	if level == 0 {
+		return nil
+	}
+	switch compression {
+	case GzipCompression:
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			return fmt.Errorf("gzip compression level has to be between %d and %d", gzip.BestSpeed, gzip.BestCompression)
+		}
+	case ZstdCompression:
+		if level < 1 || level > 22 {
+			return fmt.Errorf("zstd compression level has to be between 1 and 22")
+		}
+	case "":
+		return fmt.Errorf("a compression level requires a compression")
+	}
+	return nil
+}
+
+// IsValidCompression checks if the given compression is supported, "" meaning no compression
+func IsValidCompression(compression string) bool {
+	switch compression {
+	case "", GzipCompression, ZstdCompression:
+		return true
+	}
+	return false
+}
+
+// compressionExtension the file extension of a compressed output
+func compressionExtension(compression string) string {
+	switch compression {
+	case GzipCompression:
+		return ".gz"
+	case ZstdCompression:
+		return ".zst"
+	}
+	return ""
+}
+
+// gzipCompressor writes every checkpoint as a separate gzip member.
+// Concatenated gzip members are a valid gzip file, as per RFC 1952.
+type gzipCompressor struct {
+	w  io.Writer
+	gz *gzip.Writer
+}
+
+func (c *gzipCompressor) Write(p []byte) (int, error) {
+	return c.gz.Write(p)
+}
+
+func (c *gzipCompressor) Checkpoint() error {
+	if err := c.gz.Close(); err != nil {
+		return err
+	}
+	c.gz.Reset(c.w)
+	return nil
+}
+
+func (c *gzipCompressor) Close() error {
+	return c.gz.Close()
+}
+
+// zstdCompressor writes every checkpoint as a separate Zstandard frame.
+// Concatenated frames are a valid Zstandard stream, as per RFC 8878.
+type zstdCompressor struct {
+	w   io.Writer
+	enc *zstd.Encoder
+}
+
+func (c *zstdCompressor) Write(p []byte) (int, error) {
+	return c.enc.Write(p)
+}
+
+func (c *zstdCompressor) Checkpoint() error {
+	if err := c.enc.Close(); err != nil {
+		return err
+	}
+	c.enc.Reset(c.w)
+	return nil
+}
+
+func (c *zstdCompressor) Close() error {
+	return c.enc.Close()
+}
+
+// decompressedReader returns a reader of r, decompressing it if it's gzip or zstd compressed.
+// The byte order mark of an output written with --encoding=utf-8-bom is skipped.
+func decompressedReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(4)
+	if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return withoutBOM(gz), nil
+	}
+	if len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd {
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return withoutBOM(zr), nil
+	}
+	return withoutBOM(buffered), nil
+}
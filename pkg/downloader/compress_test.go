@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGzipCompressorCheckpoints(t *testing.T) {
+	testCompressorCheckpoints(t, GzipCompression)
+}
+
+func TestZstdCompressorCheckpoints(t *testing.T) {
+	testCompressorCheckpoints(t, ZstdCompression)
+}
+
+func testCompressorCheckpoints(t *testing.T, compression string) {
+	var buf bytes.Buffer
+	c, err := newCompressor(compression, 0, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Write([]byte("header\nrow1\n"))
+	c.Checkpoint()
+	confirmed := buf.Len()
+
+	// whatever comes after a checkpoint can be dropped, the output stays valid
+	c.Write([]byte("row2\n"))
+	buf.Truncate(confirmed)
+
+	// a resumed download appends new members right after the checkpoint
+	resumed, _ := newCompressor(compression, 0, &buf)
+	resumed.Write([]byte("row2\nrow3\n"))
+	resumed.Close()
+
+	reader, err := decompressedReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "header\nrow1\nrow2\nrow3\n" {
+		t.Errorf("unexpected %s decompressed output: %q", compression, content)
+	}
+}
+
+func TestDecompressedReaderPlainText(t *testing.T) {
+	reader, err := decompressedReader(bytes.NewBufferString("12345\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(reader)
+	if string(content) != "12345\n" {
+		t.Errorf("plain text should be read as is, got %q", content)
+	}
+}
+
+func TestValidateCompressionLevel(t *testing.T) {
+	if err := validateCompressionLevel(ZstdCompression, 19); err != nil {
+		t.Errorf("zstd level 19 should be valid: %v", err)
+	}
+	if err := validateCompressionLevel(GzipCompression, 19); err == nil {
+		t.Errorf("gzip level 19 should not be valid")
+	}
+	if err := validateCompressionLevel("", 3); err == nil {
+		t.Errorf("a level without compression should not be valid")
+	}
+}
@@ -0,0 +1,252 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Crawl a crawl of the account, as listed by Audisto API
+type Crawl struct {
+	ID        uint64 `json:"id"`
+	Domain    string `json:"domain"`
+	StartedAt string `json:"started_at"`
+	Status    string `json:"status"`
+	PageCount uint64 `json:"page_count"`
+}
+
+// crawlsList is used to unmarshal the json listing the crawls of the account
+type crawlsList struct {
+	Crawls []Crawl `json:"crawls"`
+}
+
+// NewAccountClient make a new Audisto API Client for requests that are not about a given crawl,
+// e.g. listing the crawls of the account
+func NewAccountClient(username string, password string) (*AudistoAPIClient, error) {
+	return newAccountClient(username, password, "")
+}
+
+// NewTokenAccountClient make a new Audisto API Client authenticated by an API token,
+// for requests that are not about a given crawl
+func NewTokenAccountClient(token string) (*AudistoAPIClient, error) {
+	return newAccountClient("", "", token)
+}
+
+func newAccountClient(username string, password string, token string) (*AudistoAPIClient, error) {
+	client := &AudistoAPIClient{
+		Username:    strings.TrimSpace(username),
+		Password:    strings.TrimSpace(password),
+		Token:       strings.TrimSpace(token),
+		RetryPolicy: DefaultRetryPolicy(),
+	}
+	if err := client.credentialsError(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// GetCrawlsURL returns the url listing the crawls of the account
+// e.g. username:password@api.audisto.com/2.0/crawls/?output=json
+func (api *AudistoAPIClient) GetCrawlsURL() string {
+	query := url.Values{}
+	query.Add("output", "json")
+	return fmt.Sprintf("%s/?%s", api.GetBaseURL(), query.Encode())
+}
+
+// GetCrawls asks the server the crawls of the account
+func (api *AudistoAPIClient) GetCrawls() ([]Crawl, error) {
+	request, err := http.NewRequest(api.GetRequestMethod(), api.GetCrawlsURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, statusCode, header, err := api.fetchWithHeader(request)
+	if err != nil {
+		return nil, err
+	}
+	if err = statusCodeError(statusCode, header, 0); err != nil {
+		return nil, err
+	}
+
+	var list crawlsList
+	if err = json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("unexpected crawls list: %v", err)
+	}
+	return list.Crawls, nil
+}
+
+// statusCodeError returns the error matching a response status code, nil for successful responses. The refused
+// credentials, the crawls the account can't access and the exceeded quota get errors of their own, see
+// IsCredentialsError, IsPermissionDenied and IsQuotaExceeded; crawlID is the crawl requested, 0 for none.
+func statusCodeError(statusCode int, header http.Header, crawlID uint64) error {
+	if statusCode < 400 {
+		return nil
+	}
+	switch statusCode {
+	case http.StatusUnauthorized:
+		message := "Wrong credentials: check the username and password, or the API token, of the account"
+		return &CredentialsError{APIError: APIError{StatusCode: statusCode, Message: message}}
+	case http.StatusForbidden:
+		message := "Access denied: the account can't access Audisto API, does its plan include it?"
+		if crawlID != 0 {
+			message = fmt.Sprintf("Access denied to crawl %d: the account can't access it, correct crawl ID? "+
+				"A crawl of another account has to be shared with this one", crawlID)
+		}
+		return &PermissionError{APIError: APIError{StatusCode: statusCode, Message: message}, CrawlID: crawlID}
+	case http.StatusPaymentRequired:
+		resetAt := quotaResetAt(header)
+		message := "API quota of the account exceeded, nothing more can be downloaded until it resets"
+		if !resetAt.IsZero() {
+			message = fmt.Sprintf("API quota of the account exceeded, it resets at %s: resume the download then",
+				resetAt.Local().Format(time.RFC1123))
+		}
+		return &QuotaExceededError{APIError: APIError{StatusCode: statusCode, Message: message}, ResetAt: resetAt}
+	}
+	if errorString, ok := StatusCodesErrors[statusCode]; ok {
+		return &APIError{StatusCode: statusCode, Message: errorString}
+	}
+	if statusCode < 500 {
+		return &APIError{StatusCode: statusCode, Message: fmt.Sprintf("Unknown error occurred (code %v)", statusCode)}
+	}
+	return &APIError{StatusCode: statusCode, Message: fmt.Sprintf("Error while requesting Audisto API: %v, server error", statusCode)}
+}
+
+// quotaResetAt returns when the exceeded quota resets, as announced by the Retry-After or the X-RateLimit-Reset
+// (a Unix time or an HTTP date) header of the response, zero if neither is
+func quotaResetAt(header http.Header) time.Time {
+	if wait, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+		return time.Now().Add(wait).Truncate(time.Second)
+	}
+	reset := header.Get("X-RateLimit-Reset")
+	if seconds, err := strconv.ParseInt(reset, 10, 64); err == nil && seconds > 0 {
+		return time.Unix(seconds, 0)
+	}
+	if date, err := http.ParseTime(reset); err == nil {
+		return date
+	}
+	return time.Time{}
+}
+
+const (
+	// CrawlInfoSampleSize the number of elements downloaded to estimate the download size
+	CrawlInfoSampleSize = 100
+)
+
+// CrawlInfo the metadata of a crawl, and what downloading it would take
+type CrawlInfo struct {
+	Crawl
+	// Settings the crawl settings, as returned by Audisto API
+	Settings map[string]interface{} `json:"settings"`
+
+	TotalPages uint64 `json:"total_pages"`
+	TotalLinks uint64 `json:"total_links"`
+
+	// estimated sizes in bytes of the pages and links downloads, extrapolated from a sample
+	EstimatedPagesSize uint64 `json:"estimated_pages_size"`
+	EstimatedLinksSize uint64 `json:"estimated_links_size"`
+}
+
+// crawlMetadata is used to unmarshal the json describing a crawl
+type crawlMetadata struct {
+	Crawl struct {
+		Crawl
+		Settings map[string]interface{} `json:"settings"`
+	} `json:"crawl"`
+}
+
+// GetCrawlURL returns the url describing the client crawl
+// e.g. username:password@api.audisto.com/2.0/crawls/123456?output=json
+func (api *AudistoAPIClient) GetCrawlURL() string {
+	query := url.Values{}
+	query.Add("output", "json")
+	return fmt.Sprintf("%s/%v?%s", api.GetBaseURL(), api.CrawlID, query.Encode())
+}
+
+// GetCrawl asks the server the metadata of the client crawl, e.g. its domain
+func (api *AudistoAPIClient) GetCrawl() (*Crawl, error) {
+	metadata, err := api.getCrawlMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.Crawl.Crawl, nil
+}
+
+// GetCrawlInfo asks the server the metadata and the number of elements of the client crawl,
+// and estimates the size of the pages and links downloads (with details, unless the client is set otherwise)
+func (api *AudistoAPIClient) GetCrawlInfo() (*CrawlInfo, error) {
+	metadata, err := api.getCrawlMetadata()
+	if err != nil {
+		return nil, err
+	}
+	info := &CrawlInfo{Crawl: metadata.Crawl.Crawl, Settings: metadata.Crawl.Settings}
+
+	info.TotalPages, info.EstimatedPagesSize, err = api.estimateDownload("pages")
+	if err != nil {
+		return nil, err
+	}
+	info.TotalLinks, info.EstimatedLinksSize, err = api.estimateDownload("links")
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// getCrawlMetadata asks the server the metadata and the settings of the client crawl
+func (api *AudistoAPIClient) getCrawlMetadata() (*crawlMetadata, error) {
+	if err := api.IsValid(); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(api.GetRequestMethod(), api.GetCrawlURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, statusCode, header, err := api.fetchWithHeader(request)
+	if err != nil {
+		return nil, err
+	}
+	if err = statusCodeError(statusCode, header, api.CrawlID); err != nil {
+		return nil, err
+	}
+
+	var metadata crawlMetadata
+	if err = json.Unmarshal(body, &metadata); err != nil {
+		return nil, fmt.Errorf("unexpected crawl metadata: %v", err)
+	}
+	return &metadata, nil
+}
+
+// estimateDownload returns the total number of elements of the given mode, and the estimated download size,
+// extrapolated from the size of the first elements
+func (api *AudistoAPIClient) estimateDownload(mode string) (total uint64, size uint64, err error) {
+	client := *api
+	client.Mode = mode
+	client.Filter = ""
+
+	total, err = client.GetTotalElements()
+	if err != nil || total == 0 {
+		return total, 0, err
+	}
+
+	sample, statusCode, responseHeader, err := client.fetchChunk(0, CrawlInfoSampleSize)
+	if err != nil {
+		return total, 0, err
+	}
+	if err = statusCodeError(statusCode, responseHeader, client.CrawlID); err != nil {
+		return total, 0, err
+	}
+
+	// the first line being the header, it's counted once
+	header := bytes.IndexByte(sample, '\n') + 1
+	rows := uint64(bytes.Count(sample[header:], []byte("\n")))
+	if rows == 0 {
+		return total, uint64(len(sample)), nil
+	}
+	rowSize := float64(len(sample)-header) / float64(rows)
+	return total, uint64(header) + uint64(rowSize*float64(total)), nil
+}
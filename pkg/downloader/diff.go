@@ -0,0 +1,305 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// DiffColumn the first column of a diff output, telling how the row differs from the baseline
+	DiffColumn = "diff"
+
+	// DiffAdded a row missing from the baseline
+	DiffAdded = "added"
+	// DiffChanged a row of the baseline having different values
+	DiffChanged = "changed"
+	// DiffRemoved a row of the baseline that is not downloaded anymore, written with the values of the baseline
+	DiffRemoved = "removed"
+)
+
+// DiffKinds the kinds of differences, in the order they're listed
+var DiffKinds = []string{DiffAdded, DiffChanged, DiffRemoved}
+
+// DiffFilename returns the file of the rows of a kind of difference, of a diff output split into a file per kind,
+// e.g. pages.tsv -> pages.added.tsv
+func DiffFilename(output string, kind string) string {
+	return infixedFilename(output, "."+kind)
+}
+
+// diffBaseline the rows of a previous export, by key
+type diffBaseline struct {
+	filename string
+	key      []string            // the key columns, lower-cased
+	split    bool                // write a file per kind of difference instead of a diff column
+	header   []string            // the header of the baseline
+	keys     []string            // the keys of the rows, in the order of the baseline
+	rows     map[string][]string // the rows, by key
+	seen     map[string]bool     // the keys of the rows downloaded so far
+	columns  []string            // the header of the downloaded rows, nil until the first chunk
+}
+
+// SetDiff makes the downloader write only the rows differing from a previous export of the crawl, the baseline:
+// the rows added, changed or removed since, matched by the key columns (url if none). The rows are written
+// with a first diff column telling how they differ, or to a file per kind of difference when split,
+// e.g. pages.added.tsv, pages.changed.tsv and pages.removed.tsv. The removed rows are written last.
+// The baseline is a tsv or csv export, compressed or not, it's read by Setup(). It has to be called before Setup()
+func (d *Downloader) SetDiff(baseline string, key []string, split bool) error {
+	baseline = strings.TrimSpace(baseline)
+	if baseline == "" {
+		d.diff = nil
+		return nil
+	}
+	diff := &diffBaseline{filename: baseline, split: split}
+	for _, column := range key {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "" {
+			return fmt.Errorf("empty diff key column name")
+		}
+		diff.key = append(diff.key, column)
+	}
+	if len(diff.key) == 0 {
+		diff.key = []string{"url"}
+	}
+	d.diff = diff
+	return nil
+}
+
+// prepareDiff reads the baseline of a diff, then removes the files of a previous split diff
+func (d *Downloader) prepareDiff() error {
+	if err := d.diff.load(d.formatOptions()); err != nil {
+		return err
+	}
+	d.appendLog(INFO, fmt.Sprintf("Diffing against the %d rows of %s", len(d.diff.keys), d.diff.filename))
+	if !d.diff.split {
+		return nil
+	}
+	for _, kind := range DiffKinds {
+		filename := DiffFilename(d.origOutputFilename, kind)
+		os.Remove(filename)
+		os.Remove(filename + ChecksumSuffix)
+	}
+	d.partitions = map[string]*partition{}
+	return nil
+}
+
+// load reads the rows of the baseline, csv files being read with the given delimiter
+func (b *diffBaseline) load(options FormatOptions) error {
+	file, err := os.Open(b.filename)
+	if err != nil {
+		return fmt.Errorf("cannot read the diff baseline: %v", err)
+	}
+	defer file.Close()
+	reader, err := decompressedReader(file)
+	if err != nil {
+		return fmt.Errorf("cannot read the diff baseline %s: %v", b.filename, err)
+	}
+
+	format := TSVOutputFormat
+	name := strings.ToLower(b.filename)
+	for _, compression := range []string{GzipCompression, ZstdCompression} {
+		name = strings.TrimSuffix(name, compressionExtension(compression))
+	}
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		format = CSVOutputFormat
+	case strings.HasSuffix(name, ".json"), strings.HasSuffix(name, ".sqlite"), strings.HasSuffix(name, ".parquet"):
+		return fmt.Errorf("the diff baseline %s has to be a tsv or csv export", b.filename)
+	}
+	next := newRowReader(format, reader, options.Delimiter)
+
+	if b.header, err = next(); err != nil {
+		return fmt.Errorf("cannot read the header of the diff baseline %s: %v", b.filename, err)
+	}
+	nullable := options.nullColumns(b.header)
+	key, err := columnPositions(b.header, b.key)
+	if err != nil {
+		return fmt.Errorf("cannot diff against %s: %v", b.filename, err)
+	}
+
+	b.rows, b.seen = map[string][]string{}, map[string]bool{}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read the diff baseline %s: %v", b.filename, err)
+		}
+		row = withoutNulls(row, nullable, options.NullAs)
+		k := rowKey(row, key)
+		// the first row of a key is kept, keys are expected to be unique
+		if _, ok := b.rows[k]; !ok {
+			b.keys = append(b.keys, k)
+			b.rows[k] = row
+		}
+	}
+}
+
+// columnPositions finds the columns in a header, case-insensitively
+func columnPositions(header []string, columns []string) ([]int, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		position, ok := positions[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown key column %q, the columns are: %s", column, strings.Join(header, ", "))
+		}
+		indexes[i] = position
+	}
+	return indexes, nil
+}
+
+// rowKey returns the key of a row, the values of the key columns
+func rowKey(row []string, key []int) string {
+	values := make([]string, len(key))
+	for i, position := range key {
+		if position < len(row) {
+			values[i] = row[position]
+		}
+	}
+	return strings.Join(values, "\t")
+}
+
+// diffRowWriter writes the rows of a chunk differing from the baseline, with their kind of difference
+type diffRowWriter struct {
+	d        *Downloader
+	baseline *diffBaseline
+	header   []string
+	key      []int    // the positions of the key columns in the rows
+	common   [][2]int // the positions of the columns of both the rows and the baseline, in the rows then in the baseline
+	output   RowWriter
+	writers  map[*partition]RowWriter // the RowWriters of the chunk, by kind of difference, when split
+}
+
+func (d *Downloader) newDiffRowWriter(header []string) (RowWriter, error) {
+	key, err := columnPositions(header, d.diff.key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot diff the download: %v", err)
+	}
+	w := &diffRowWriter{d: d, baseline: d.diff, header: header, key: key}
+	baselineColumns := make(map[string]int, len(d.diff.header))
+	for i, name := range d.diff.header {
+		baselineColumns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for i, name := range header {
+		if j, ok := baselineColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			w.common = append(w.common, [2]int{i, j})
+		}
+	}
+	d.diff.columns = header
+
+	if d.diff.split {
+		w.writers = map[*partition]RowWriter{}
+		return w, nil
+	}
+	if w.output, err = d.newOutputWriter(append([]string{DiffColumn}, header...)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// WriteHeader writes the header of the output, the split files get theirs when written to
+func (w *diffRowWriter) WriteHeader() error {
+	if w.output == nil {
+		return nil
+	}
+	return w.output.WriteHeader()
+}
+
+// WriteRow writes the row unless it's unchanged
+func (w *diffRowWriter) WriteRow(fields []string) error {
+	k := rowKey(fields, w.key)
+	w.baseline.seen[k] = true
+	previous, ok := w.baseline.rows[k]
+	if !ok {
+		return w.write(DiffAdded, fields)
+	}
+	for _, positions := range w.common {
+		if fieldAt(fields, positions[0]) != fieldAt(previous, positions[1]) {
+			return w.write(DiffChanged, fields)
+		}
+	}
+	return nil
+}
+
+// writeRemoved writes the rows of the baseline that were not downloaded, in the columns of the download
+func (w *diffRowWriter) writeRemoved() error {
+	for _, k := range w.baseline.keys {
+		if w.baseline.seen[k] {
+			continue
+		}
+		previous := w.baseline.rows[k]
+		fields := make([]string, len(w.header))
+		for _, positions := range w.common {
+			fields[positions[0]] = fieldAt(previous, positions[1])
+		}
+		if err := w.write(DiffRemoved, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *diffRowWriter) write(kind string, fields []string) error {
+	if w.output != nil {
+		return w.output.WriteRow(append([]string{kind}, fields...))
+	}
+	p, ok := w.d.partitions[kind]
+	if !ok {
+		var err error
+		if p, err = w.d.openPartitionFile(kind, DiffFilename(w.d.origOutputFilename, kind)); err != nil {
+			return err
+		}
+	}
+	writer, err := w.d.partitionWriter(w.writers, p, w.header)
+	if err != nil {
+		return err
+	}
+	return writer.WriteRow(fields)
+}
+
+func (w *diffRowWriter) Flush() error {
+	if w.output != nil {
+		return w.output.Flush()
+	}
+	return flushPartitionWriters(w.writers)
+}
+
+// fieldAt returns a field of a row, "" if the row is shorter
+func fieldAt(fields []string, position int) string {
+	if position < len(fields) {
+		return fields[position]
+	}
+	return ""
+}
+
+// writeRemovedRows writes the rows of the baseline missing from the completed download
+func (d *Downloader) writeRemovedRows() error {
+	if d.diff == nil {
+		return nil
+	}
+	// without any downloaded row, the removed rows are written in the columns of the baseline
+	header := d.diff.columns
+	if header == nil {
+		header = d.diff.header
+	}
+	writer, err := d.newDiffRowWriter(header)
+	if err != nil {
+		return err
+	}
+	if err = d.writeHeader(writer); err != nil {
+		return err
+	}
+	if err = writer.(*diffRowWriter).writeRemoved(); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return d.flushOutput()
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffFilename(t *testing.T) {
+	names := map[string]string{
+		"pages.tsv":            "pages.added.tsv",
+		"exports/pages.csv.gz": "exports/pages.added.csv.gz",
+	}
+	for output, expected := range names {
+		if name := DiffFilename(output, DiffAdded); name != expected {
+			t.Errorf("expected %q as the added rows of %q, got %q", expected, output, name)
+		}
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a is unchanged, b changed, c removed; the depth column is not downloaded anymore
+	baseline := filepath.Join(dir, "previous.tsv")
+	ioutil.WriteFile(baseline, []byte("url\tid\tdepth\nhttp://example.com/a\t1\t0\nhttp://example.com/b\t3\t1\nhttp://example.com/c\t4\t1\n"), 0644)
+
+	output := filepath.Join(dir, "diff.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, DiffBaseline: baseline}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "diff\tid\turl\nchanged\t2\thttp://example.com/b\nremoved\t4\thttp://example.com/c\n" {
+		t.Errorf("unexpected diff %q", written)
+	}
+
+	// matched by id, every row differs
+	options.DiffKey, options.DiffSplit = []string{"id"}, true
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		DiffAdded:   "id\turl\n2\thttp://example.com/b\n",
+		DiffRemoved: "id\turl\n3\thttp://example.com/b\n4\thttp://example.com/c\n",
+	}
+	for kind, expected := range files {
+		written, err := ioutil.ReadFile(DiffFilename(output, kind))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != expected {
+			t.Errorf("unexpected %s rows %q", kind, written)
+		}
+	}
+	if fExists(DiffFilename(output, DiffChanged)) == nil {
+		t.Error("no row changed, the file of the changed rows should not be written")
+	}
+
+	options.DiffKey = []string{"title"}
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("a key column missing from the baseline should be refused")
+	}
+}
@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// CompressionRatioEstimate how many times smaller than the estimated download a compressed output is
+// expected to be, for the disk space check
+const CompressionRatioEstimate = 5
+
+// SetDiskSpaceCheck when check is set to true, Run() estimates the size of the download left before starting
+// (see Estimate), and fails with a DiskSpaceError if the disk of a local output has less space free.
+// With force, a warning is logged instead and the download is started anyway.
+// It has to be called before Setup()
+func (d *Downloader) SetDiskSpaceCheck(check bool, force bool) {
+	d.diskSpaceCheck, d.forceDiskSpace = check, force
+}
+
+// checkDiskSpace compares the estimated size of the download left with the free space of the disk of the output.
+// Remote outputs, databases, pipes and the pages of a targets file are not checked.
+func (d *Downloader) checkDiskSpace() error {
+	if !d.diskSpaceCheck || d.OutputFilename == "" || !d.isResumableOutput() || d.isInTargetsMode() ||
+		IsTableOutputLocation(d.OutputFilename) {
+		return nil
+	}
+	dir := filepath.Dir(d.origOutputFilename)
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		d.appendLog(WARNING, fmt.Sprintf("Cannot check the free disk space of %s: %v", dir, err))
+		return nil
+	}
+
+	estimate, err := d.Estimate()
+	if err != nil {
+		return err
+	}
+	needed := estimate.Bytes
+	if d.DoneElements >= estimate.TotalElements {
+		needed = 0
+	} else if d.DoneElements > 0 {
+		// a resumed download only needs the space of the elements left
+		needed = uint64(float64(needed) * float64(estimate.TotalElements-d.DoneElements) / float64(estimate.TotalElements))
+	}
+	// the sorted runs aren't compressed
+	if err := d.checkTempDiskSpace(needed); err != nil {
+		return err
+	}
+	if d.Compression != "" {
+		needed /= CompressionRatioEstimate
+	}
+	if needed <= free {
+		return nil
+	}
+
+	err = &DiskSpaceError{Dir: dir, Needed: needed, Free: free}
+	if !d.forceDiskSpace {
+		return err
+	}
+	d.appendLog(WARNING, err.Error()+", downloading anyway")
+	return nil
+}
@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDiskSpaceCheck(t *testing.T) {
+	// far more rows than any disk can hold
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":1000000000000000,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+	dir, err := ioutil.TempDir("", "diskspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages",
+		Output: filepath.Join(dir, "crawl.tsv"), DiskSpaceCheck: true}
+	err = New(options).Run(context.Background())
+	if _, ok := err.(*DiskSpaceError); !ok {
+		t.Fatalf("expected a disk space error, got %v", err)
+	}
+	if !IsDiskFull(err) {
+		t.Error("a disk space error should be a disk full error")
+	}
+}
+
+func TestIsDiskFull(t *testing.T) {
+	for _, err := range []error{
+		syscall.ENOSPC,
+		&os.PathError{Op: "write", Path: "crawl.tsv", Err: syscall.ENOSPC},
+		errors.New("cannot write the output: write crawl.tsv: " + syscall.ENOSPC.Error()),
+		&DiskFullError{Err: syscall.ENOSPC},
+	} {
+		if !IsDiskFull(err) {
+			t.Errorf("%v should be a disk full error", err)
+		}
+	}
+	for _, err := range []error{nil, syscall.EACCES, &os.PathError{Op: "open", Path: "crawl.tsv", Err: syscall.ENOENT}} {
+		if IsDiskFull(err) {
+			t.Errorf("%v should not be a disk full error", err)
+		}
+	}
+}
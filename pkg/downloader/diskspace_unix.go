@@ -0,0 +1,16 @@
+// +build !windows
+
+package downloader
+
+import (
+	"syscall"
+)
+
+// freeDiskSpace returns the bytes available to the user on the disk of the directory
+func freeDiskSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
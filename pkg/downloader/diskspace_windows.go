@@ -0,0 +1,20 @@
+// +build windows
+
+package downloader
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeDiskSpace returns the bytes available to the user on the disk of the directory
+func freeDiskSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err = windows.GetDiskFreeSpaceEx(path, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
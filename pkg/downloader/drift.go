@@ -0,0 +1,225 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// driftCheck detects the total elements changing while the chunks are paged through by their offset, e.g. once
+// the crawl is recalculated: the rows shift between the chunks, some being written twice or skipped. The ids of
+// the rows written are kept to page through the chunks by keyset once drifted, see SetDriftCheck.
+type driftCheck struct {
+	mu       sync.Mutex
+	column   int      // the position of the id column in the rows, -1 until bound
+	start    uint64   // the element of the first id kept
+	ids      []string // the ids of the last rows written, from start
+	total    uint64   // the total elements announced by the API, before the limit
+	drifts   int      // the times the total elements changed
+	keyset   bool     // the chunks are paged through by the id of the row preceding them
+	keysetOK bool     // the order pages by id, the chunks can be paged through by keyset
+}
+
+// SetDriftCheck when set to true, the total elements are requested again before every batch of chunks paged
+// through by their offset is written. Once the total changed, the batch is dropped with a warning: the chunks
+// following are requested by keyset, after the id of the last row written, when the rows are ordered by id
+// (the default order), the rows written being consistent; they're requested again by their offset otherwise,
+// rows around the drift may be duplicated or missing then. It costs an API call per batch of chunks.
+// The chunks paged through by the cursors of the API are not checked, they don't shift.
+// It has to be called before Setup()
+func (d *Downloader) SetDriftCheck(enabled bool) {
+	if enabled {
+		d.drift = &driftCheck{column: -1}
+	} else {
+		d.drift = nil
+	}
+}
+
+// keysetOrder checks if an order pages by id, the default order included
+func keysetOrder(order string) bool {
+	key := strings.ToLower(strings.TrimSpace(strings.Split(order, ",")[0]))
+	return key == "" || key == "id" || key == "id:asc"
+}
+
+// bind finds the id column in a chunk header
+func (c *driftCheck) bind(header []string) {
+	c.column = -1
+	for i, name := range header {
+		if strings.ToLower(strings.TrimSpace(name)) == "id" {
+			c.column = i
+			return
+		}
+	}
+}
+
+// id returns the id of a row, "" without drift check
+func (c *driftCheck) id(fields []string) string {
+	if c == nil || c.column < 0 || c.column >= len(fields) {
+		return ""
+	}
+	return fields[c.column]
+}
+
+// observe records the id of the row written as the given element, the ids of the last window rows being kept
+func (c *driftCheck) observe(element uint64, id string, window uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id == "" || element != c.start+uint64(len(c.ids)) {
+		c.start, c.ids = element, c.ids[:0]
+		if id == "" {
+			return
+		}
+	}
+	c.ids = append(c.ids, id)
+	if window > 0 && uint64(len(c.ids)) > 2*window {
+		c.start += uint64(len(c.ids)) - window
+		c.ids = append(c.ids[:0], c.ids[uint64(len(c.ids))-window:]...)
+	}
+}
+
+// after returns the id of the row preceding the given element, false if it's not known
+func (c *driftCheck) after(element uint64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element == 0 || element <= c.start || element > c.start+uint64(len(c.ids)) {
+		return "", false
+	}
+	return c.ids[element-c.start-1], true
+}
+
+// lastID returns the id of the last row written, "" if it's not known
+func (c *driftCheck) lastID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.ids) == 0 {
+		return ""
+	}
+	return c.ids[len(c.ids)-1]
+}
+
+// keysetPagination requests a chunk by the id of the row preceding it, the rows being ordered by id: the chunks
+// stay consistent while the crawl is updated. The chunks whose preceding row isn't known are requested by their
+// offset. It's shared by the copies of the client.
+type keysetPagination struct {
+	drift *driftCheck
+}
+
+func (p *keysetPagination) setParams(params url.Values, number uint64, size uint64) {
+	after, ok := p.drift.after(number * size)
+	if !ok {
+		offsetPagination{}.setParams(params, number, size)
+		return
+	}
+	params.Set("filter", joinFilter(params.Get("filter"), "id:gt:"+after))
+	params.Add("chunk", "0")
+	params.Add("chunk_size", strconv.FormatUint(size, 10))
+}
+
+func (p *keysetPagination) observe(number uint64, size uint64, header http.Header) {}
+
+func (p *keysetPagination) sequential() bool {
+	// a chunk's preceding row is known once the previous chunk is written
+	return true
+}
+
+func (p *keysetPagination) reset() {}
+
+// joinFilter adds a condition to a filter
+func joinFilter(filter string, condition string) string {
+	if filter == "" {
+		return condition
+	}
+	return filter + "," + condition
+}
+
+// checksDrift checks if the total elements are requested again before writing the next chunks: chunks paged
+// through by offset, or by keyset once drifted
+func (d *Downloader) checksDrift() bool {
+	if d.drift == nil || d.isInTargetsMode() {
+		return false
+	}
+	return d.drift.keyset || !d.client.sequentialChunks()
+}
+
+// checkDrift requests the total elements again before the fetched chunks are written. It returns false once the
+// total changed, the chunks being dropped to be requested again, by keyset when possible.
+func (d *Downloader) checkDrift(chunks []fetchedChunk) (bool, error) {
+	client := *d.client
+	done := d.CurrentTarget.DoneElements
+	after := ""
+	if d.drift.keyset {
+		// the elements remaining after the last row written, the rows written being consistent
+		if after = d.drift.lastID(); after == "" {
+			return true, nil
+		}
+		client.Filter = joinFilter(client.Filter, "id:gt:"+after)
+	}
+	total, err := client.GetTotalElements()
+	if err != nil {
+		return false, err
+	}
+	if d.drift.keyset {
+		total += done
+	}
+	if d.drift.total == 0 {
+		// resumed or paged by keyset from now on, the total is taken as is
+		d.drift.total = total
+		d.setDriftedTotal(total)
+		return true, nil
+	}
+	if total == d.drift.total {
+		return true, nil
+	}
+
+	closeChunks(chunks)
+	d.drift.drifts++
+	previous := d.drift.total
+	d.drift.total = total
+	d.setDriftedTotal(total)
+	if d.drift.keyset {
+		d.appendLog(WARNING, fmt.Sprintf("The total elements changed from %d to %d while downloading", previous, total))
+		return false, nil
+	}
+	if last := d.drift.lastID(); d.drift.keysetOK && (last != "" || done == 0) {
+		d.pageByKeyset()
+		// the elements remaining after the last row written are requested along with the next chunks
+		d.drift.total = 0
+		d.appendLog(WARNING, fmt.Sprintf("The total elements changed from %d to %d while downloading: the next chunks are "+
+			"requested by the id of the last row written", previous, total))
+		return false, nil
+	}
+	d.appendLog(WARNING, fmt.Sprintf("The total elements changed from %d to %d while downloading: the rows are not ordered "+
+		"by id, rows around element %d may be duplicated or missing", previous, total, done))
+	return false, nil
+}
+
+// setDriftedTotal sets the total elements once requested again
+func (d *Downloader) setDriftedTotal(total uint64) {
+	d.TotalElements = d.limitedTotal(total)
+	d.CurrentTarget.TotalElements = d.TotalElements
+}
+
+// pageByKeyset requests the next chunks by the id of the row preceding them
+func (d *Downloader) pageByKeyset() {
+	d.drift.keyset = true
+	d.client.pagination = &keysetPagination{drift: d.drift}
+}
+
+// resumeKeyset resumes a download paged by keyset after the id of the last row written, whether the drift is
+// checked or not: the rows already written were requested by keyset
+func (d *Downloader) resumeKeyset() {
+	if d.KeysetAfter == "" || d.CurrentTarget.DoneElements == 0 {
+		return
+	}
+	if d.drift == nil {
+		d.drift = &driftCheck{column: -1, keysetOK: true}
+	}
+	d.drift.observe(d.CurrentTarget.DoneElements-1, d.KeysetAfter, 0)
+	d.pageByKeyset()
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKeysetOrder(t *testing.T) {
+	for order, expected := range map[string]bool{"": true, "id": true, "id:asc,url": true, "id:desc": false, "url": false} {
+		if keysetOrder(order) != expected {
+			t.Errorf("%q: expected %v", order, expected)
+		}
+	}
+}
+
+func TestDriftIDs(t *testing.T) {
+	drift := &driftCheck{column: -1}
+	for element := uint64(0); element < 6; element++ {
+		drift.observe(element, fmt.Sprint(element*10), 2)
+	}
+	if id, ok := drift.after(6); !ok || id != "50" {
+		t.Errorf("expected the id of the last row, got %q", id)
+	}
+	if id, ok := drift.after(5); !ok || id != "40" {
+		t.Errorf("expected the id of the row before the last one, got %q", id)
+	}
+	if _, ok := drift.after(1); ok {
+		t.Error("expected the ids of the last rows only to be kept")
+	}
+	// a gap in the elements written forgets the ids before it
+	drift.observe(10, "100", 2)
+	if _, ok := drift.after(6); ok {
+		t.Error("expected the ids before a gap to be forgotten")
+	}
+}
+
+func TestDriftCheck(t *testing.T) {
+	var mu sync.Mutex
+	ids := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}
+	recalculated := false
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		var chunk, size int
+		fmt.Sscan(query.Get("chunk"), &chunk)
+		fmt.Sscan(query.Get("chunk_size"), &size)
+		// the crawl is recalculated once the second chunk is requested: the first one is shifted
+		if query.Get("output") != "json" && chunk == 1 && !recalculated {
+			ids, recalculated = append([]int{ids[0]}, ids[2:]...), true
+		}
+		after := -1
+		if filter := query.Get("filter"); strings.HasPrefix(filter, "id:gt:") {
+			fmt.Sscan(strings.TrimPrefix(filter, "id:gt:"), &after)
+		}
+		var rows []int
+		for _, id := range ids {
+			if id > after {
+				rows = append(rows, id)
+			}
+		}
+		if query.Get("output") == "json" {
+			fmt.Fprintf(w, `{"chunk":{"total":%d,"page":0,"size":1}}`, len(rows))
+			return
+		}
+		fmt.Fprint(w, "id\turl\n")
+		for i := chunk * size; i < (chunk+1)*size && i < len(rows); i++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", rows[i], rows[i])
+		}
+	})()
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+		DriftCheck: true}
+	download := New(options)
+	if err = download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the row removed was written already, none is skipped nor written twice
+	expected := "id\turl\n"
+	for id := 0; id < 100; id += 10 {
+		expected += fmt.Sprintf("%d\thttp://example.com/%d\n", id, id)
+	}
+	if string(data) != expected {
+		t.Errorf("expected every row once, got %q", data)
+	}
+	if drifts := download.Summary(nil).Drifts; drifts != 1 {
+		t.Errorf("expected 1 drift, got %d", drifts)
+	}
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DuplicatesSuffix the suffix of the report of the URLs found more than once, e.g. crawl.tsv.duplicates.tsv
+const DuplicatesSuffix = ".duplicates.tsv"
+
+// duplicateURLs counts the occurrences of the URLs of the pages downloaded. The URLs are counted by their
+// 64-bit fingerprint instead of being held, only the ones found more than once are kept along with their
+// count: a few bytes a page, whatever the length of the URLs.
+type duplicateURLs struct {
+	column int               // the position of the url column in the rows, -1 until bound
+	counts map[uint64]uint32 // the occurrences of every URL, by fingerprint
+	urls   map[uint64]string // the URLs found more than once, by fingerprint
+}
+
+func newDuplicateURLs() *duplicateURLs {
+	return &duplicateURLs{column: -1, counts: map[uint64]uint32{}, urls: map[uint64]string{}}
+}
+
+// SetReportDuplicates when set to true, the URLs of the pages are counted while downloading, and the ones found
+// more than once are listed with their count in [OUTPUT].duplicates.tsv once completed, without reading the
+// output again. It only applies to the pages mode, the download starts again.
+// It has to be called before Setup()
+func (d *Downloader) SetReportDuplicates(report bool) {
+	if report {
+		d.duplicates = newDuplicateURLs()
+	} else {
+		d.duplicates = nil
+	}
+}
+
+// fingerprint the 64-bit FNV-1a hash of a URL
+func fingerprint(url string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(url); i++ {
+		hash ^= uint64(url[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// bind finds the url column in a chunk header
+func (u *duplicateURLs) bind(header []string) error {
+	for i, name := range header {
+		if strings.ToLower(strings.TrimSpace(name)) == "url" {
+			u.column = i
+			return nil
+		}
+	}
+	return fmt.Errorf("no url column to report the duplicated URLs, the available columns are: %s", strings.Join(header, ", "))
+}
+
+// url returns the URL of a row, "" if it has none
+func (u *duplicateURLs) url(fields []string) string {
+	if u.column < 0 || u.column >= len(fields) {
+		return ""
+	}
+	return fields[u.column]
+}
+
+// add counts an occurrence of the URL
+func (u *duplicateURLs) add(url string) {
+	if url == "" {
+		return
+	}
+	key := fingerprint(url)
+	u.counts[key]++
+	if u.counts[key] == 2 {
+		u.urls[key] = url
+	}
+}
+
+// duplicatesFilename returns the report of the URLs found more than once
+func (d *Downloader) duplicatesFilename() string {
+	return d.origOutputFilename + DuplicatesSuffix
+}
+
+// writeDuplicates writes the report of the URLs found more than once by the completed download, the most
+// duplicated first, with a header only if none was
+func (d *Downloader) writeDuplicates() error {
+	if d.duplicates == nil {
+		return nil
+	}
+	type duplicate struct {
+		url   string
+		count uint32
+	}
+	duplicates := make([]duplicate, 0, len(d.duplicates.urls))
+	for key, url := range d.duplicates.urls {
+		duplicates = append(duplicates, duplicate{url: url, count: d.duplicates.counts[key]})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].count != duplicates[j].count {
+			return duplicates[i].count > duplicates[j].count
+		}
+		return duplicates[i].url < duplicates[j].url
+	})
+
+	file, err := os.Create(d.duplicatesFilename())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprint(w, "url\tcount\n")
+	for _, duplicate := range duplicates {
+		fmt.Fprintf(w, "%s\t%d\n", duplicate.url, duplicate.count)
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	d.appendLog(INFO, fmt.Sprintf("Found %d duplicated URLs, listed in %s", len(duplicates), d.duplicatesFilename()))
+	return nil
+}
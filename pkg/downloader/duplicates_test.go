@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportDuplicates(t *testing.T) {
+	urls := []string{"http://example.com/a", "http://example.com/b", "http://example.com/a", "http://example.com/c",
+		"http://example.com/b", "http://example.com/a"}
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			fmt.Fprintf(w, `{"chunk":{"total":%d,"page":0,"size":2}}`, len(urls))
+			return
+		}
+		var chunk int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Fprint(w, "id\turl\n")
+		for id := chunk * 2; id < chunk*2+2 && id < len(urls); id++ {
+			fmt.Fprintf(w, "%d\t%s\n", id, urls[id])
+		}
+	})()
+	dir, err := ioutil.TempDir("", "duplicates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the URLs are counted whether they're written or not
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+		Columns: []string{"id"}, ReportDuplicates: true}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report, err := ioutil.ReadFile(output + DuplicatesSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "url\tcount\nhttp://example.com/a\t3\nhttp://example.com/b\t2\n"; string(report) != expected {
+		t.Errorf("unexpected report %q", report)
+	}
+
+	options.Mode = "links"
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected the duplicates of the links to be refused")
+	}
+}
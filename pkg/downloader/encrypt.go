@@ -0,0 +1,184 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	// AgeEncryption encrypts the output with age, the output filename gets a ".age" extension
+	AgeEncryption = "age"
+
+	// GPGEncryption encrypts the output with OpenPGP, the output filename gets a ".gpg" extension
+	GPGEncryption = "gpg"
+)
+
+// outputEncryption the recipients the output is encrypted for, with age or OpenPGP
+type outputEncryption struct {
+	kind       string // AgeEncryption or GPGEncryption
+	recipients []age.Recipient
+	keys       openpgp.EntityList
+}
+
+// parseEncryption parses the recipients of an output encryption: age:<recipient> for an age recipient
+// (age1..., an SSH public key or a recipients file), gpg:<key file> for the exported public key of a GPG
+// recipient. Several recipients are separated by commas.
+func parseEncryption(encrypt string) (*outputEncryption, error) {
+	i := strings.Index(encrypt, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid encryption %q: expected age:<recipient> or gpg:<public key file>", encrypt)
+	}
+	e := &outputEncryption{kind: strings.ToLower(strings.TrimSpace(encrypt[:i]))}
+	for _, recipient := range strings.Split(encrypt[i+1:], ",") {
+		if recipient = strings.TrimSpace(recipient); recipient == "" {
+			continue
+		}
+		var err error
+		switch e.kind {
+		case AgeEncryption:
+			err = e.addAgeRecipient(recipient)
+		case GPGEncryption:
+			err = e.addGPGKey(recipient)
+		default:
+			return nil, fmt.Errorf("encryption not supported: %s, use age or gpg", e.kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(e.recipients) == 0 && len(e.keys) == 0 {
+		return nil, fmt.Errorf("invalid encryption %q: no recipient", encrypt)
+	}
+	return e, nil
+}
+
+// addAgeRecipient adds an age1... recipient, an SSH public key, or the recipients of a file
+func (e *outputEncryption) addAgeRecipient(recipient string) error {
+	switch {
+	case strings.HasPrefix(recipient, "age1"):
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid age recipient %s: %v", recipient, err)
+		}
+		e.recipients = append(e.recipients, r)
+	case strings.HasPrefix(recipient, "ssh-"):
+		r, err := agessh.ParseRecipient(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid SSH recipient %s: %v", recipient, err)
+		}
+		e.recipients = append(e.recipients, r)
+	default:
+		file, err := os.Open(recipient)
+		if err != nil {
+			return fmt.Errorf("cannot read the age recipients: %v", err)
+		}
+		defer file.Close()
+		recipients, err := age.ParseRecipients(file)
+		if err != nil {
+			return fmt.Errorf("invalid age recipients file %s: %v", recipient, err)
+		}
+		e.recipients = append(e.recipients, recipients...)
+	}
+	return nil
+}
+
+// addGPGKey adds the public keys of a file, armored (gpg --export --armor) or not
+func (e *outputEncryption) addGPGKey(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read the GPG public key: %v", err)
+	}
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil || len(keys) == 0 {
+		return fmt.Errorf("invalid GPG public key %s: export it with gpg --export --armor <recipient>", filename)
+	}
+	e.keys = append(e.keys, keys...)
+	return nil
+}
+
+// extension the file extension of the encrypted output
+func (e *outputEncryption) extension() string {
+	return "." + e.kind
+}
+
+// encryptionExtensions the file extensions of the encrypted outputs
+var encryptionExtensions = []string{"." + AgeEncryption, "." + GPGEncryption}
+
+// encryptionExtension returns the encryption extension of the output, "" if it has none
+func encryptionExtension(output string) string {
+	for _, ext := range encryptionExtensions {
+		if strings.HasSuffix(strings.ToLower(output), ext) {
+			return output[len(output)-len(ext):]
+		}
+	}
+	return ""
+}
+
+// encryptedStream encrypts the data written to the stream
+type encryptedStream struct {
+	encrypter io.WriteCloser
+	stream    io.WriteCloser
+}
+
+// encrypt returns the stream encrypting the data for the recipients, then writing it to the stream
+func (e *outputEncryption) encrypt(stream io.WriteCloser) (*encryptedStream, error) {
+	var encrypter io.WriteCloser
+	var err error
+	if e.kind == AgeEncryption {
+		encrypter, err = age.Encrypt(stream, e.recipients...)
+	} else {
+		encrypter, err = openpgp.Encrypt(stream, e.keys, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt the output: %v", err)
+	}
+	return &encryptedStream{encrypter: encrypter, stream: stream}, nil
+}
+
+func (s *encryptedStream) Write(p []byte) (int, error) {
+	return s.encrypter.Write(p)
+}
+
+// Close writes the end of the encrypted data, then closes the stream
+func (s *encryptedStream) Close() error {
+	if err := s.encrypter.Close(); err != nil {
+		s.stream.Close()
+		return err
+	}
+	return s.stream.Close()
+}
+
+// Abort aborts the underlying stream when supported, it's closed otherwise
+func (s *encryptedStream) Abort(err error) error {
+	if a, ok := s.stream.(aborter); ok {
+		return a.Abort(err)
+	}
+	return s.stream.Close()
+}
+
+// SetEncryption encrypts the output for the recipients, before it's written to the disk or uploaded:
+// age:<recipient> for age (age1..., an SSH public key or a recipients file), gpg:<key file> for OpenPGP.
+// "" for no encryption (default). The output is compressed before being encrypted.
+func (d *Downloader) SetEncryption(encrypt string) error {
+	if encrypt = strings.TrimSpace(encrypt); encrypt == "" {
+		d.encryption = nil
+		return nil
+	}
+	e, err := parseEncryption(encrypt)
+	if err != nil {
+		return err
+	}
+	d.encryption = e
+	return nil
+}
@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const encryptedRows = "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n2\thttp://example.com/2\n"
+
+func TestAgeEncryptedOutput(t *testing.T) {
+	failing := int32(0)
+	defer serveFailingChunk(&failing)()
+	dir, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 1, Encrypt: "age:" + identity.Recipient().String()}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "crawl.tsv.age"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decrypted, err := age.Decrypt(file, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != encryptedRows {
+		t.Errorf("unexpected decrypted output %q", data)
+	}
+}
+
+func TestGPGEncryptedOutput(t *testing.T) {
+	failing := int32(0)
+	defer serveFailingChunk(&failing)()
+	dir, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("Partner", "", "partner@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys exported by gpg prefer SHA-256
+	for _, id := range entity.Identities {
+		id.SelfSignature.PreferredHash = []uint8{8}
+		if err = id.SelfSignature.SignUserId(id.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err := os.Create(filepath.Join(dir, "partner.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := armor.Encode(key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.Serialize(armored); err != nil {
+		t.Fatal(err)
+	}
+	armored.Close()
+	key.Close()
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 1, Compression: GzipCompression, Encrypt: "gpg:" + key.Name()}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output is compressed, then encrypted
+	file, err := os.Open(filepath.Join(dir, "crawl.tsv.gz.gpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	message, err := openpgp.ReadMessage(file, openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := gzip.NewReader(message.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != encryptedRows {
+		t.Errorf("unexpected decrypted output %q", data)
+	}
+}
+
+func TestParseEncryption(t *testing.T) {
+	for _, encrypt := range []string{"age1qyqszqgpqyqszqgpqyqszqgpqyqszqgp", "rot13:age1qyqszqgpqyqszqgpqyqszqgpqyqszqgp", "age:", "age:missing.txt", "gpg:missing.asc"} {
+		if _, err := parseEncryption(encrypt); err == nil {
+			t.Errorf("expected %q to be invalid", encrypt)
+		}
+	}
+}
+
+func TestEncryptedFilenames(t *testing.T) {
+	if part := PartFilename("crawl.tsv.gz.age", 1); part != "crawl.part0001.tsv.gz.age" {
+		t.Errorf("unexpected part %s", part)
+	}
+}
@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// EnrichSourcePrefix the prefix of the columns of the source page joined onto a link, e.g. source_title
+	EnrichSourcePrefix = "source_"
+	// EnrichTargetPrefix the prefix of the columns of the target page joined onto a link, e.g. target_title
+	EnrichTargetPrefix = "target_"
+)
+
+// EnrichedPageColumns the columns of the pages joined onto the links, for their source and target page
+var EnrichedPageColumns = []string{"status_code", "title", "depth"}
+
+// pagesIndex the values of the EnrichedPageColumns of the pages of the crawl, by page ID
+type pagesIndex struct {
+	pages   map[string][]string
+	columns int // the columns of the links, before their pages
+	source  int // the position of the source page ID in the header of the links
+	target  int // the position of the target page ID in the header of the links
+}
+
+// SetEnrichPages when set to true, the pages of the crawl are downloaded before the links, and the status code,
+// title and depth of the source and target page of every link are added to it, as the source_status_code,
+// source_title, source_depth, target_status_code, target_title and target_depth columns. The pages are held
+// in memory while the links are downloaded. It only applies to the links mode.
+// It has to be called before Setup()
+func (d *Downloader) SetEnrichPages(enrich bool) {
+	d.enrichPages = enrich
+}
+
+// loadPagesIndex downloads the pages of the crawl the links are enriched with, unless already loaded
+func (d *Downloader) loadPagesIndex() error {
+	if !d.enrichPages || d.pagesIndex != nil {
+		return nil
+	}
+	d.appendLog(INFO, "Downloading the pages the links are enriched with...")
+
+	// the filter and the order of the links don't apply to the pages
+	client := *d.client
+	client.Mode, client.Filter, client.Order = "pages", "", ""
+	total, err := client.GetTotalElements()
+	if err != nil {
+		return fmt.Errorf("cannot download the pages to enrich the links with: %v", err)
+	}
+
+	index := &pagesIndex{pages: make(map[string][]string, total)}
+	size := client.ChunkSize
+	for number := uint64(0); number*size < total; number++ {
+		if d.stopped() {
+			return ErrStopped
+		}
+		body, statusCode, header, err := client.fetchChunk(number, size)
+		if err == nil {
+			err = statusCodeError(statusCode, header, client.CrawlID)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot download the pages to enrich the links with: %v", err)
+		}
+		if err = index.add(string(body)); err != nil {
+			return err
+		}
+	}
+	d.pagesIndex = index
+	d.appendLog(INFO, fmt.Sprintf("%d pages downloaded, enriching the links", len(index.pages)))
+	return nil
+}
+
+// add adds the pages of a chunk to the index
+func (p *pagesIndex) add(chunk string) error {
+	lines := strings.Split(strings.TrimRight(chunk, "\n"), "\n")
+	header := strings.Split(lines[0], "\t")
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	id, ok := positions["id"]
+	if !ok {
+		return fmt.Errorf("cannot enrich the links, the pages have no id column")
+	}
+	columns := make([]int, len(EnrichedPageColumns))
+	for i, column := range EnrichedPageColumns {
+		if columns[i], ok = positions[column]; !ok {
+			columns[i] = -1
+		}
+	}
+
+	for _, line := range lines[1:] {
+		// a header repeated within the chunk is not a page
+		if line == lines[0] {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		values := make([]string, len(columns))
+		for i, position := range columns {
+			if position >= 0 {
+				values[i] = fieldAt(fields, position)
+			}
+		}
+		p.pages[fieldAt(fields, id)] = values
+	}
+	return nil
+}
+
+// enrichHeader returns the header of the links along with the columns of their pages,
+// the source and target page IDs being found in it
+func (d *Downloader) enrichHeader(header []string) ([]string, error) {
+	if d.pagesIndex == nil {
+		return header, nil
+	}
+	positions, err := columnPositions(header, []string{EnrichSourcePrefix + "page", EnrichTargetPrefix + "page"})
+	if err != nil {
+		return nil, fmt.Errorf("cannot enrich the links: %v", err)
+	}
+	d.pagesIndex.columns, d.pagesIndex.source, d.pagesIndex.target = len(header), positions[0], positions[1]
+
+	enriched := append([]string{}, header...)
+	for _, prefix := range []string{EnrichSourcePrefix, EnrichTargetPrefix} {
+		for _, column := range EnrichedPageColumns {
+			enriched = append(enriched, prefix+column)
+		}
+	}
+	return enriched, nil
+}
+
+// enrichRow returns the fields of a link along with the values of its source and target page,
+// empty for a page that's not in the crawl
+func (d *Downloader) enrichRow(fields []string) []string {
+	if d.pagesIndex == nil {
+		return fields
+	}
+	// the values of the pages line up with their columns, even after a short row
+	for len(fields) < d.pagesIndex.columns {
+		fields = append(fields, "")
+	}
+	for _, position := range []int{d.pagesIndex.source, d.pagesIndex.target} {
+		values := d.pagesIndex.pages[fieldAt(fields, position)]
+		if values == nil {
+			values = make([]string, len(EnrichedPageColumns))
+		}
+		fields = append(fields, values...)
+	}
+	return fields
+}
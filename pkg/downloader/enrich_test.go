@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveLinksAndPages serves 3 links between 2 pages, the last one to a page that's not in the crawl,
+// in chunks of 2 elements
+func serveLinksAndPages() func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		links := strings.HasSuffix(r.URL.Path, "/links")
+		if query.Get("output") == "json" {
+			if links {
+				w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			} else {
+				w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			}
+			return
+		}
+		switch {
+		case links && query.Get("chunk") == "0":
+			w.Write([]byte("id\tsource_page\ttarget_page\tanchor_text\n1\t10\t20\thome\n2\t20\t10\tback\n"))
+		case links:
+			w.Write([]byte("id\tsource_page\ttarget_page\tanchor_text\n3\t20\t30\tgone\n"))
+		default:
+			w.Write([]byte("id\turl\tstatus_code\ttitle\tdepth\n10\thttp://example.com/\t200\tHome\t0\n20\thttp://example.com/a\t301\tA\t1\n"))
+		}
+	})
+}
+
+func TestEnrichPages(t *testing.T) {
+	defer serveLinksAndPages()()
+	dir, err := ioutil.TempDir("", "enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "links.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "links", Output: output,
+		ChunkSize: 2, EnrichPages: true}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "id\tsource_page\ttarget_page\tanchor_text\tsource_status_code\tsource_title\tsource_depth\ttarget_status_code\ttarget_title\ttarget_depth\n" +
+		"1\t10\t20\thome\t200\tHome\t0\t301\tA\t1\n" +
+		"2\t20\t10\tback\t301\tA\t1\t200\tHome\t0\n" +
+		"3\t20\t30\tgone\t301\tA\t1\t\t\t\n"
+	if string(written) != expected {
+		t.Errorf("unexpected enriched links %q", written)
+	}
+}
+
+func TestEnrichPagesOnlyLinks(t *testing.T) {
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", EnrichPages: true})
+	if err := d.Prepare(); err == nil {
+		t.Error("only the links should be enriched with their pages")
+	}
+}
@@ -1,10 +1,299 @@
 package downloader
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrStopped is returned when the download is stopped before completion, with Stop or by cancelling
+// the context of Run(). The download can be resumed, up to the last written chunk.
+var ErrStopped = errors.New("Downloader stopped")
+
 // StatusCodesErrors ..
 var StatusCodesErrors = map[int]string{
 	401: "Wrong credentials",
+	402: "API quota exceeded",
 	403: "Access denied. Wrong credentials?",
 	404: "Not found. Correct crawl ID?",
-	429: "Error while getting total number of elements: 429, multiple requests",
+	414: "Request too long, the filter is longer than the API accepts",
+	429: "Error while getting total number of elements: 429, too many requests",
 	504: "Error while getting total number of elements: 504, server timeout",
 }
+
+// UploadError is returned when writing to a remote output fails (e.g. S3, GCS, Azure Blob),
+// as opposed to errors while downloading from Audisto API.
+type UploadError struct {
+	Output string
+	Err    error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("upload to %s failed: %v", e.Output, e.Err)
+}
+
+// APIError is returned when Audisto API answers with an error status code, once retries are exhausted
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// NetworkError is returned when Audisto API can't be reached, once retries are exhausted
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return e.Err.Error()
+}
+
+// CredentialsError is returned when Audisto API refuses the credentials (401): the username and password, or
+// the API token, are wrong
+type CredentialsError struct {
+	APIError
+}
+
+// PermissionError is returned when Audisto API denies the access (403): the credentials are right, but the
+// account can't access the crawl, e.g. it belongs to another account or the plan doesn't include the API
+type PermissionError struct {
+	APIError
+	CrawlID uint64 // the crawl requested, 0 for a request of the account, e.g. the list of crawls
+}
+
+// QuotaExceededError is returned when the API quota of the account is exceeded (402). Nothing more can be
+// downloaded until it resets; the chunks written are kept, the download can be resumed then.
+type QuotaExceededError struct {
+	APIError
+	ResetAt time.Time // when the quota resets, as announced by the API, zero if unknown
+}
+
+// IsAuthError checks if the error is Audisto API refusing the credentials or denying the access
+func IsAuthError(err error) bool {
+	switch e := err.(type) {
+	case *CredentialsError, *PermissionError:
+		return true
+	case *APIError:
+		return e.StatusCode == 401 || e.StatusCode == 403
+	}
+	return false
+}
+
+// IsCredentialsError checks if the error is Audisto API refusing the credentials
+func IsCredentialsError(err error) bool {
+	_, ok := err.(*CredentialsError)
+	return ok
+}
+
+// IsPermissionDenied checks if the error is Audisto API denying the access to the crawl
+func IsPermissionDenied(err error) bool {
+	_, ok := err.(*PermissionError)
+	return ok
+}
+
+// IsQuotaExceeded checks if the error is the API quota of the account being exceeded
+func IsQuotaExceeded(err error) bool {
+	_, ok := err.(*QuotaExceededError)
+	return ok
+}
+
+// IsNetworkError checks if the error is Audisto API being unreachable or unavailable (too many requests,
+// server errors), after every retry
+func IsNetworkError(err error) bool {
+	if _, ok := err.(*NetworkError); ok {
+		return true
+	}
+	apiErr, ok := err.(*APIError)
+	return ok && (apiErr.StatusCode == 429 || apiErr.StatusCode >= 500)
+}
+
+// JobTimeoutError is returned by Run() when the download doesn't complete within the job timeout.
+// The chunks being downloaded are written and the resume state persisted, the download can be resumed.
+type JobTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *JobTimeoutError) Error() string {
+	return fmt.Sprintf("the download did not complete within %v, it stopped once the chunks being downloaded were written", e.Timeout)
+}
+
+// IsJobTimeout checks if the error is the download not completing within the job timeout
+func IsJobTimeout(err error) bool {
+	_, ok := err.(*JobTimeoutError)
+	return ok
+}
+
+// BudgetExhaustedError is returned by Run() when the API calls or the bytes of its budget are exhausted, see
+// Budget. The chunks being downloaded are written and the resume state persisted, the download can be resumed.
+type BudgetExhaustedError struct {
+	Budget string // "API calls" or "bytes"
+	Limit  int64
+}
+
+func (e *BudgetExhaustedError) Error() string {
+	return fmt.Sprintf("the budget of %d %s of the run is exhausted, the download stopped once the chunks being downloaded were written", e.Limit, e.Budget)
+}
+
+// IsBudgetExhausted checks if the error is the budget of the download being exhausted
+func IsBudgetExhausted(err error) bool {
+	_, ok := err.(*BudgetExhaustedError)
+	return ok
+}
+
+// CrawlNotFinishedError is returned by Run() when the crawl waited for is still in progress once the maximum
+// wait elapses, see SetWaitForCrawl. Nothing is downloaded.
+type CrawlNotFinishedError struct {
+	CrawlID uint64
+	Status  string
+	Waited  time.Duration
+}
+
+func (e *CrawlNotFinishedError) Error() string {
+	return fmt.Sprintf("crawl %d is still %s after waiting %v, nothing was downloaded", e.CrawlID, e.Status, e.Waited)
+}
+
+// IsCrawlNotFinished checks if the error is the crawl waited for not finishing in time
+func IsCrawlNotFinished(err error) bool {
+	_, ok := err.(*CrawlNotFinishedError)
+	return ok
+}
+
+// TruncatedChunkError is returned when a chunk is still short of rows once requested again as many times as
+// the retry policy allows. The rows received are written and the resume state persisted: resuming the download
+// requests the rows missing again.
+type TruncatedChunkError struct {
+	Chunk    uint64 // the number of the chunk
+	Received uint64 // the rows of the chunk received
+	Expected uint64 // the rows of the chunk, as per the size of the chunks and the total elements
+}
+
+func (e *TruncatedChunkError) Error() string {
+	return fmt.Sprintf("chunk %d is truncated, %d of %d rows were received after every retry", e.Chunk, e.Received, e.Expected)
+}
+
+// ShortExportError is returned by Run() when the download completed with less rows than the total elements
+// announced by the API, e.g. a download resumed from a short chunk written by a previous version. The output is
+// not completed, it has to be downloaded again from the start.
+type ShortExportError struct {
+	Received uint64
+	Total    uint64
+}
+
+func (e *ShortExportError) Error() string {
+	return fmt.Sprintf("the export is short, %d of %d elements were received: pass '--no-resume' to download it again", e.Received, e.Total)
+}
+
+// IsTruncated checks if the error is a truncated chunk or a short export
+func IsTruncated(err error) bool {
+	switch err.(type) {
+	case *TruncatedChunkError, *ShortExportError:
+		return true
+	}
+	return false
+}
+
+// OutputLockedError is returned by Run() when the output is locked by another download writing it, see
+// SetWaitForLock. Nothing is downloaded.
+type OutputLockedError struct {
+	Output string
+	PID    int // the process ID of the download holding the lock, 0 if unknown
+}
+
+func (e *OutputLockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is being written by another download", e.Output)
+	}
+	return fmt.Sprintf("%s is being written by another download (process %d)", e.Output, e.PID)
+}
+
+// IsOutputLocked checks if the error is the output being written by another download
+func IsOutputLocked(err error) bool {
+	_, ok := err.(*OutputLockedError)
+	return ok
+}
+
+// DiskSpaceError is returned by Run() when the disk of the output has less space free than the estimated
+// size of the download left, see SetDiskSpaceCheck. Nothing is downloaded.
+type DiskSpaceError struct {
+	Dir    string // the directory of the output
+	Needed uint64 // the estimated bytes of the download left
+	Free   uint64 // the bytes available on the disk
+}
+
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space in %s: the download needs ~%.1f MB, %.1f MB are free", e.Dir,
+		float64(e.Needed)/(1<<20), float64(e.Free)/(1<<20))
+}
+
+// DiskFullError is returned when the disk runs out of space while writing the output. The output and its resume
+// state are kept as of the last chunk written whole: once some space is freed, the download can be resumed.
+type DiskFullError struct {
+	Err error
+}
+
+func (e *DiskFullError) Error() string {
+	return fmt.Sprintf("%v; the download stopped at the last chunk written, free some disk space to resume it", e.Err)
+}
+
+// IsDiskFull checks if the error is running out of disk space, before (see DiskSpaceError) or while writing
+// the output. Errors of the outputs are reported with their message only once wrapped.
+func IsDiskFull(err error) bool {
+	switch e := err.(type) {
+	case *DiskSpaceError, *DiskFullError:
+		return true
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	if err == nil || err == syscall.ENOSPC {
+		return err != nil
+	}
+	return strings.Contains(err.Error(), syscall.ENOSPC.Error())
+}
+
+// PostProcessError is returned by Run() when the post-process command of a completed output failed, see
+// SetPostProcess. The output is complete.
+type PostProcessError struct {
+	Output string
+	Err    error
+}
+
+func (e *PostProcessError) Error() string {
+	return fmt.Sprintf("the post-process command of %s failed: %v; the file is complete", e.Output, e.Err)
+}
+
+// IsPostProcessFailed checks if the error is a post-process command failing
+func IsPostProcessFailed(err error) bool {
+	_, ok := err.(*PostProcessError)
+	return ok
+}
+
+// FixtureNotFoundError is returned when replaying the fixtures of a download, see SetReplay, for a request
+// that was not recorded. It's not retried.
+type FixtureNotFoundError struct {
+	Dir string
+	URL string // the request, without its host
+}
+
+func (e *FixtureNotFoundError) Error() string {
+	return fmt.Sprintf("no fixture of %s in %s: record it with --record first", e.URL, e.Dir)
+}
+
+// IsFixtureNotFound checks if the error is a request missing from the fixtures replayed, as returned by the client
+func IsFixtureNotFound(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	_, ok := err.(*FixtureNotFoundError)
+	return ok
+}
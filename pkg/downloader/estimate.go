@@ -0,0 +1,99 @@
+package downloader
+
+import (
+	"strings"
+	"time"
+)
+
+// DownloadEstimate the estimate of a download, made from the first elements without downloading it
+type DownloadEstimate struct {
+	Mode          string        `json:"mode"`
+	TotalElements uint64        `json:"totalElements"`
+	Columns       []string      `json:"columns"`
+	Bytes         uint64        `json:"estimatedBytes"`
+	ChunkSize     uint64        `json:"chunkSize"`
+	Chunks        uint64        `json:"chunks"`
+	Concurrency   int           `json:"concurrency"`
+	Duration      time.Duration `json:"estimatedDuration"`
+}
+
+// SetDryRun when set to true, Setup() only checks the parameters and connects the client:
+// nothing is written, the download is estimated with Estimate() instead of being started.
+// It has to be called before Setup()
+func (d *Downloader) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
+// Estimate estimates the download at the configured chunk size and concurrency: the total number of elements,
+// the approximate size and duration. The size and request latencies are measured on the first
+// CrawlInfoSampleSize elements. It has to be called after Setup()
+func (d *Downloader) Estimate() (DownloadEstimate, error) {
+	estimate := DownloadEstimate{Mode: d.client.Mode, ChunkSize: d.client.ChunkSize, Concurrency: d.concurrency}
+
+	start := time.Now()
+	total, err := d.totalElements()
+	if err != nil {
+		return estimate, err
+	}
+	// the total elements request is about as small as a request can be: it's taken as the latency
+	latency := time.Since(start)
+	total = d.limitedTotal(total)
+	estimate.TotalElements = total
+	estimate.Chunks = (total + estimate.ChunkSize - 1) / estimate.ChunkSize
+	if total == 0 {
+		return estimate, nil
+	}
+
+	start = time.Now()
+	sample, statusCode, responseHeader, err := d.client.fetchChunk(0, CrawlInfoSampleSize)
+	if err != nil {
+		return estimate, err
+	}
+	if err = statusCodeError(statusCode, responseHeader, d.client.CrawlID); err != nil {
+		return estimate, err
+	}
+	sampleDuration := time.Since(start)
+
+	lines := strings.Split(strings.TrimRight(string(sample), "\n"), "\n")
+	header := strings.Split(lines[0], "\t")
+	projection, err := newColumnsProjection(header, d.columns)
+	if err != nil {
+		return estimate, err
+	}
+	d.bindAnnotations()
+	estimate.Columns = d.annotations.header(projection.apply(header))
+
+	rows := lines[1:]
+	if len(rows) == 0 {
+		return estimate, nil
+	}
+	var rowsSize int
+	for _, row := range rows {
+		rowsSize += len(strings.Join(d.annotations.row(projection.apply(strings.Split(row, "\t"))), "\t")) + 1
+	}
+	rowSize := float64(rowsSize) / float64(len(rows))
+	estimate.Bytes = uint64(len(strings.Join(estimate.Columns, "\t"))+1) + uint64(rowSize*float64(total))
+
+	// a chunk takes the latency, plus the time per element measured on the sample
+	perElement := time.Duration(0)
+	if sampleDuration > latency {
+		perElement = (sampleDuration - latency) / time.Duration(len(rows))
+	}
+	chunkDuration := latency + perElement*time.Duration(minUint64(estimate.ChunkSize, total))
+	rounds := (estimate.Chunks + uint64(d.concurrency) - 1) / uint64(d.concurrency)
+	estimate.Duration = chunkDuration * time.Duration(rounds)
+
+	// the rate and bandwidth limits may slow the download down even more
+	if d.rateLimiter != nil {
+		if limited := d.rateLimiter.interval * time.Duration(estimate.Chunks); limited > estimate.Duration {
+			estimate.Duration = limited
+		}
+	}
+	if d.bandwidthLimiter != nil {
+		rowsBytes := uint64(float64(len(sample)) / float64(len(rows)) * float64(total))
+		if limited := time.Duration(float64(rowsBytes) / d.bandwidthLimiter.bytesPerSecond * float64(time.Second)); limited > estimate.Duration {
+			estimate.Duration = limited
+		}
+	}
+	return estimate, nil
+}
@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":1000,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	}))
+	defer server.Close()
+
+	d := New(Options{})
+	d.SetDryRun(true)
+	if err := d.SetColumns([]string{"url"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetConcurrency(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Setup("user", "pass", 12345, "pages", false, 0, 100, "crawl.tsv", "", false, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	d.client.httpClient.Transport = serverTransport{server}
+
+	estimate, err := d.Estimate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.TotalElements != 1000 || estimate.Chunks != 10 || estimate.Concurrency != 2 {
+		t.Errorf("expected 1000 elements in 10 chunks, 2 in parallel, got %+v", estimate)
+	}
+	if !reflect.DeepEqual(estimate.Columns, []string{"url"}) {
+		t.Errorf("expected the url column only, got %v", estimate.Columns)
+	}
+	// 4 bytes of header, then 1000 rows of 21 bytes each
+	if estimate.Bytes != 4+21*1000 {
+		t.Errorf("unexpected estimated size %d", estimate.Bytes)
+	}
+	if fExists("crawl.tsv") == nil {
+		t.Errorf("a dry run should not write the output")
+	}
+}
@@ -0,0 +1,243 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// FailedChunksSuffix the suffix of the manifest of the chunks skipped by a download, see SetSkipFailedChunks
+const FailedChunksSuffix = ".failed.json"
+
+// FailedChunk the elements of a chunk that failed after every retry, and were skipped
+type FailedChunk struct {
+	Start uint64 `json:"start"` // the first element skipped
+	End   uint64 `json:"end"`   // the element following the last one skipped
+	Size  uint64 `json:"size"`  // the size of the chunk
+	Error string `json:"error"`
+}
+
+// FailedChunksManifest the chunks skipped by a download, along with the settings to download them again,
+// see RetryFailedChunks
+type FailedChunksManifest struct {
+	Output  string `json:"output"`  // the output the rows of the chunks are missing from
+	Retries int    `json:"retries"` // the retries so far, the nth one writes the rows to [OUTPUT].retryN
+
+	CrawlID          uint64   `json:"crawlID"`
+	Mode             string   `json:"mode"`
+	Filter           string   `json:"filter,omitempty"`
+	Order            string   `json:"order,omitempty"`
+	NoDetails        bool     `json:"noDetails,omitempty"`
+	Columns          []string `json:"columns,omitempty"`
+	Where            string   `json:"where,omitempty"`
+	URLsFile         string   `json:"urlsFile,omitempty"`
+	Transforms       []string `json:"transforms,omitempty"`
+	Sample           string   `json:"sample,omitempty"`
+	EnrichPages      bool     `json:"enrichPages,omitempty"`
+	AddColumns       []string `json:"addColumns,omitempty"`
+	NoHeader         bool     `json:"noHeader,omitempty"`
+	OutputFormat     string   `json:"outputFormat,omitempty"`
+	Delimiter        string   `json:"delimiter,omitempty"`
+	LineEnding       string   `json:"lineEnding,omitempty"`
+	Encoding         string   `json:"encoding,omitempty"`
+	Sanitize         string   `json:"sanitize,omitempty"`
+	Nulls            bool     `json:"nulls,omitempty"`
+	NullAs           string   `json:"nullAs,omitempty"`
+	Compression      string   `json:"compression,omitempty"`
+	CompressionLevel int      `json:"compressionLevel,omitempty"`
+	Pagination       string   `json:"pagination,omitempty"`
+	APIVersion       string   `json:"apiVersion,omitempty"`
+
+	Chunks []FailedChunk `json:"chunks"`
+}
+
+// chunksRetry the failed chunks of a manifest being downloaded again, see RetryFailedChunks
+type chunksRetry struct {
+	manifest FailedChunksManifest
+	filename string // rewritten with the chunks failing again, removed once every chunk is downloaded
+}
+
+// SkippedChunksError is returned once a download skipping its failed chunks completes without them,
+// see SetSkipFailedChunks. The output is complete but for their rows, listed in the manifest.
+type SkippedChunksError struct {
+	Manifest string // the manifest of the chunks, to retry them with RetryFailedChunks
+	Chunks   []FailedChunk
+}
+
+func (e *SkippedChunksError) Error() string {
+	elements := uint64(0)
+	for _, chunk := range e.Chunks {
+		elements += chunk.End - chunk.Start
+	}
+	return fmt.Sprintf("%d chunks failed and were skipped, %d elements are missing: see %s", len(e.Chunks), elements, e.Manifest)
+}
+
+// IsSkippedChunks checks if the error is a download completed without the chunks that failed
+func IsSkippedChunks(err error) bool {
+	_, ok := err.(*SkippedChunksError)
+	return ok
+}
+
+// SetSkipFailedChunks when set to true, a chunk still failing after every retry (network errors, server errors)
+// is skipped instead of failing the download, which goes on with the next chunks. The chunks skipped are listed
+// in [OUTPUT].failed.json once the download completes, a SkippedChunksError being returned: RetryFailedChunks
+// downloads them later. Only downloads of local files skip their failed chunks, but with targets or a diff.
+// It has to be called before Setup()
+func (d *Downloader) SetSkipFailedChunks(skip bool) {
+	d.skipFailedChunks = skip
+}
+
+// skipChunk skips the elements of the current target up to end, the chunk having failed as per err.
+// It returns false if the chunk can't be skipped, the download failing then.
+func (d *Downloader) skipChunk(end uint64, size uint64, err error) bool {
+	if !d.skipFailedChunks || d.stopped() {
+		return false
+	}
+	if end > d.CurrentTarget.TotalElements {
+		end = d.CurrentTarget.TotalElements
+	}
+	start := d.CurrentTarget.DoneElements
+	if end <= start {
+		return false
+	}
+	d.counters.countError()
+	d.appendLog(WARNING, fmt.Sprintf("Skipping the elements %d to %d: %v", start, end-1, err))
+	d.FailedChunks = append(d.FailedChunks, FailedChunk{Start: start, End: end, Size: size, Error: err.Error()})
+
+	d.DoneElements += end - start
+	d.CurrentTarget.DoneElements = end
+	d.confirmChunk(fetchedChunk{start: end - 1 - (end-1)%size, size: size})
+	d.PersistConfig()
+	return true
+}
+
+// skippableStatusCode checks if a chunk failing with the status code after every retry can be skipped:
+// server errors are, failed credentials or a missing crawl fail every chunk
+func skippableStatusCode(statusCode int) bool {
+	return statusCode >= 500
+}
+
+// failedChunksFilename returns the manifest of the chunks skipped by the download
+func (d *Downloader) failedChunksFilename() string {
+	if d.retry != nil {
+		return d.retry.filename
+	}
+	return d.origOutputFilename + FailedChunksSuffix
+}
+
+// writeFailedChunks writes the manifest of the chunks skipped by the completed download, or removes a previous one
+// if none was. A SkippedChunksError is returned for the chunks skipped.
+func (d *Downloader) writeFailedChunks() error {
+	if !d.skipFailedChunks {
+		return nil
+	}
+	filename := d.failedChunksFilename()
+	if len(d.FailedChunks) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var manifest FailedChunksManifest
+	if d.retry != nil {
+		manifest = d.retry.manifest
+		manifest.Retries++
+	} else {
+		o := d.options
+		manifest = FailedChunksManifest{Output: d.origOutputFilename, CrawlID: o.CrawlID, Mode: o.Mode, Filter: o.Filter,
+			Order: o.Order, NoDetails: o.NoDetails, Columns: o.Columns, Where: o.Where, Transforms: o.Transforms,
+			EnrichPages: o.EnrichPages, NoHeader: o.NoHeader, OutputFormat: o.OutputFormat, Delimiter: o.Delimiter,
+			LineEnding: o.LineEnding, Compression: o.Compression, CompressionLevel: o.CompressionLevel, AddColumns: o.AddColumns,
+			URLsFile: o.URLsFile, Sample: o.Sample, Encoding: o.Encoding, Sanitize: o.Sanitize, Nulls: o.Nulls, NullAs: o.NullAs,
+			Pagination: o.Pagination, APIVersion: o.APIVersion}
+	}
+	manifest.Chunks = d.FailedChunks
+	data, err := json.MarshalIndent(manifest, "", "	")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filename, data, 0644); err != nil {
+		return err
+	}
+	return &SkippedChunksError{Manifest: filename, Chunks: d.FailedChunks}
+}
+
+// ReadFailedChunksManifest reads the manifest of the chunks skipped by a download
+func ReadFailedChunksManifest(filename string) (*FailedChunksManifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var manifest FailedChunksManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid failed chunks manifest %s: %v", filename, err)
+	}
+	return &manifest, nil
+}
+
+// RetryFilename returns the file the rows of the nth retry of the failed chunks of an output are written to,
+// e.g. crawl.tsv -> crawl.retry1.tsv
+func RetryFilename(output string, retry int) string {
+	return infixedFilename(output, fmt.Sprintf(".retry%d", retry))
+}
+
+// RetryFailedChunks downloads the chunks listed in a manifest written by a download skipping its failed chunks,
+// with the settings of that download: the options only set the credentials, the network and the notifications.
+// Their rows are written to RetryFilename(output, retries+1), in the format of the output. The chunks failing
+// again are kept in the manifest, a SkippedChunksError being returned, the manifest is removed otherwise.
+func RetryFailedChunks(ctx context.Context, manifestFilename string, options Options) error {
+	manifest, err := ReadFailedChunksManifest(manifestFilename)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Chunks) == 0 {
+		return fmt.Errorf("no failed chunks to retry in %s", manifestFilename)
+	}
+
+	options.CrawlID, options.Mode, options.Filter, options.Order = manifest.CrawlID, manifest.Mode, manifest.Filter, manifest.Order
+	options.NoDetails, options.Columns, options.Where, options.Transforms = manifest.NoDetails, manifest.Columns, manifest.Where, manifest.Transforms
+	options.EnrichPages, options.NoHeader, options.AddColumns = manifest.EnrichPages, manifest.NoHeader, manifest.AddColumns
+	options.OutputFormat, options.Delimiter, options.LineEnding = manifest.OutputFormat, manifest.Delimiter, manifest.LineEnding
+	options.Compression, options.CompressionLevel = manifest.Compression, manifest.CompressionLevel
+	options.URLsFile, options.Sample, options.Encoding, options.Sanitize = manifest.URLsFile, manifest.Sample, manifest.Encoding, manifest.Sanitize
+	options.Nulls, options.NullAs, options.Pagination, options.APIVersion = manifest.Nulls, manifest.NullAs, manifest.Pagination, manifest.APIVersion
+	options.Output = RetryFilename(manifest.Output, manifest.Retries+1)
+	options.Targets, options.DiffBaseline, options.SortBy, options.PartitionBy = "", "", "", ""
+	options.SplitRows, options.SplitSize, options.NoResume, options.MustResume = 0, 0, true, false
+	// the chunks are requested as they were, the crawl being downloaded already
+	options.ChunkSize, options.AutoChunkSize, options.DiskSpaceCheck, options.WaitForCrawl = 0, false, false, false
+	options.SkipFailedChunks = true
+
+	d := New(options)
+	d.retry = &chunksRetry{manifest: *manifest, filename: manifestFilename}
+	return d.Run(ctx)
+}
+
+// retryFailedChunks downloads the chunks failed by a previous download, instead of the whole target
+func (d *Downloader) retryFailedChunks() error {
+	d.TotalElements = 0
+	chunks := d.retry.manifest.Chunks
+	for _, chunk := range chunks {
+		d.TotalElements += chunk.End - chunk.Start
+	}
+	d.startReporting()
+	if err := d.loadPagesIndex(); err != nil {
+		return err
+	}
+	d.appendLog(INFO, fmt.Sprintf("Retrying %d failed chunks, %d elements", len(chunks), d.TotalElements))
+
+	for _, chunk := range chunks {
+		if d.stopped() {
+			return ErrStopped
+		}
+		d.client.SetChunkSize(chunk.Size)
+		d.CurrentTarget = currentTarget{DoneElements: chunk.Start, TotalElements: chunk.End}
+		if err := d.downloadTarget(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveFailingChunk serves 3 pages in chunks of 1, the chunk 1 failing with a server error while failing is set
+func serveFailingChunk(failing *int32) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := r.URL.Query().Get("chunk")
+		if chunk == "1" && atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "id\turl\n%s\thttp://example.com/%s\n", chunk, chunk)
+	})
+}
+
+func TestSkipFailedChunks(t *testing.T) {
+	failing := int32(1)
+	defer serveFailingChunk(&failing)()
+	dir, err := ioutil.TempDir("", "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 1,
+		RetryPolicy: &RetryPolicy{MaxRetries: 0, Backoff: time.Millisecond}, SkipFailedChunks: true,
+		Encoding: EncodingUTF8BOM, Pagination: PaginationOffset}
+	err = New(options).Run(context.Background())
+	skipped, ok := err.(*SkippedChunksError)
+	if !ok {
+		t.Fatalf("expected the failed chunk to be skipped, got %v", err)
+	}
+	if len(skipped.Chunks) != 1 || skipped.Chunks[0].Start != 1 || skipped.Chunks[0].End != 2 {
+		t.Errorf("expected the elements 1 to 2 to be skipped, got %+v", skipped.Chunks)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\ufeffid\turl\n0\thttp://example.com/0\n2\thttp://example.com/2\n" {
+		t.Errorf("unexpected output %q", data)
+	}
+
+	// the chunk keeps failing, it's kept in the manifest
+	manifest := output + FailedChunksSuffix
+	retryOptions := Options{Username: "user", Password: "pass", RetryPolicy: options.RetryPolicy}
+	if err = RetryFailedChunks(context.Background(), manifest, retryOptions); !IsSkippedChunks(err) {
+		t.Fatalf("expected the chunk to fail again, got %v", err)
+	}
+	retried, err := ReadFailedChunksManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Retries != 1 || len(retried.Chunks) != 1 {
+		t.Errorf("expected the chunk to be retried once, got %+v", retried)
+	}
+	if retried.Encoding != EncodingUTF8BOM || retried.Pagination != PaginationOffset {
+		t.Errorf("expected the settings of the download to be kept, got %+v", retried)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if err = RetryFailedChunks(context.Background(), manifest, retryOptions); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(RetryFilename(output, 2)); err != nil {
+		t.Fatal(err)
+	}
+	// the retried rows are written with the settings of the download
+	if string(data) != "\ufeffid\turl\n1\thttp://example.com/1\n" {
+		t.Errorf("unexpected retried rows %q", data)
+	}
+	if fExists(manifest) == nil {
+		t.Error("the manifest should be removed once every chunk is downloaded")
+	}
+}
+
+func TestFailedChunkWithoutSkip(t *testing.T) {
+	failing := int32(1)
+	defer serveFailingChunk(&failing)()
+	dir, err := ioutil.TempDir("", "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 1, RetryPolicy: &RetryPolicy{MaxRetries: 0, Backoff: time.Millisecond}}
+	if err = New(options).Run(context.Background()); err == nil || IsSkippedChunks(err) {
+		t.Errorf("expected the download to fail, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filters are validated client-side before the download starts, following the API grammar:
+//
+//	filter    = condition { "," condition }      all the conditions have to match
+//	condition = field ":" [ operator ":" ] value  the operator defaults to "eq"
+//
+// e.g. "status_code:200,depth:le:3"
+
+// filterOperators the operators of a filter condition, by the kind of value they apply to
+var filterOperators = map[string][]string{
+	"number": {"eq", "ne", "gt", "ge", "lt", "le"},
+	"string": {"eq", "ne", "contains", "prefix", "suffix"},
+	"bool":   {"eq", "ne"},
+}
+
+// filterFields the fields a download can be filtered by, with the kind of their values, by mode: the columns
+// of the export, see Schema
+var filterFields = schemaKinds(exportSchema)
+
+// FilterError a precise description of what's wrong in a filter, before any request is made
+type FilterError struct {
+	Filter    string
+	Condition string // the faulty condition
+	Position  int    // the position of the faulty condition, starting at 1
+	Reason    string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("invalid filter %q: condition %d %q: %s", e.Filter, e.Position, e.Condition, e.Reason)
+}
+
+// ValidateFilter checks a filter against the API grammar and the fields of the mode ("pages" if empty)
+func ValidateFilter(mode string, filter string) error {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil
+	}
+	if mode == "" {
+		mode = "pages"
+	}
+	fields, ok := filterFields[mode]
+	if !ok {
+		return fmt.Errorf("mode has to be 'pages', 'links' or 'hints'")
+	}
+
+	for i, condition := range strings.Split(filter, ",") {
+		fail := func(format string, a ...interface{}) error {
+			return &FilterError{Filter: filter, Condition: condition, Position: i + 1, Reason: fmt.Sprintf(format, a...)}
+		}
+
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			return fail("empty condition, remove the extra ','")
+		}
+
+		parts := strings.SplitN(condition, ":", 3)
+		if len(parts) < 2 {
+			return fail("expected field:value or field:operator:value")
+		}
+
+		field, operator, value := strings.ToLower(parts[0]), "eq", parts[1]
+		if len(parts) == 3 {
+			operator, value = strings.ToLower(parts[1]), parts[2]
+		}
+
+		kind, ok := fields[field]
+		if !ok {
+			if suggestion := closestField(field, fields); suggestion != "" {
+				return fail("unknown field %q for mode %s, did you mean %q?", field, mode, suggestion)
+			}
+			return fail("unknown field %q for mode %s", field, mode)
+		}
+
+		if !containsString(filterOperators[kind], operator) {
+			return fail("operator %q can't be used with %s, use one of %s", operator, field, strings.Join(filterOperators[kind], ", "))
+		}
+
+		if value == "" {
+			return fail("missing value for %s", field)
+		}
+		switch kind {
+		case "number":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fail("%s expects a number, got %q", field, value)
+			}
+		case "bool":
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fail("%s expects true or false, got %q", field, value)
+			}
+		}
+	}
+	return nil
+}
+
+// closestField returns the field name the closest to a misspelled one, "" if none is close enough
+func closestField(field string, fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	closest, best := "", 3 // more than 2 edits is not a typo anymore
+	for _, name := range names {
+		if distance := editDistance(field, name); distance < best {
+			closest, best = name, distance
+		}
+	}
+	return closest
+}
+
+// editDistance the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
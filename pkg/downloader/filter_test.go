@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFilter(t *testing.T) {
+	for _, filter := range []string{"", "status_code:200", "status_code:200, depth:le:3", "url:contains:/blog/", "indexable:true"} {
+		if err := ValidateFilter("pages", filter); err != nil {
+			t.Errorf("%q should be valid: %v", filter, err)
+		}
+	}
+	if err := ValidateFilter("links", "target_page:123"); err != nil {
+		t.Errorf("target page filters should be valid for links: %v", err)
+	}
+	if err := ValidateFilter(HintsMode, "severity:error,category:content"); err != nil {
+		t.Errorf("severity and category filters should be valid for hints: %v", err)
+	}
+	if err := ValidateFilter(HintsMode, "anchor_text:home"); err == nil {
+		t.Error("the fields of the links should be refused for hints")
+	}
+
+	for filter, reason := range map[string]string{
+		"stauts_code:200":        `did you mean "status_code"?`,
+		"status_code":            "expected field:value",
+		"status_code:200,":       "empty condition",
+		"status_code:contains:2": `operator "contains" can't be used with status_code`,
+		"depth:three":            "expects a number",
+		"anchor_text:home":       "unknown field",
+	} {
+		err := ValidateFilter("pages", filter)
+		if err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("%q: expected an error about %q, got %v", filter, reason, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	if d := editDistance("stauts", "status"); d != 2 {
+		t.Errorf("expected 2 edits, got %d", d)
+	}
+}
@@ -0,0 +1,191 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxFilterLength the longest filter the API accepts, once escaped in the query of the requests. A longer filter
+// is split: the conditions fitting are sent to the API, the others are matched client-side.
+const MaxFilterLength = 2000
+
+// filterCondition a condition of a filter matched client-side, see splitFilter
+type filterCondition struct {
+	field    string
+	operator string
+	value    string
+	kind     string // number, string or bool, as per the fields of the mode
+	column   int    // the position of the field in the rows, -1 until bound
+	number   float64
+	boolean  bool
+}
+
+// localFilter the conditions of a filter too long for the API, matched client-side. The conditions of a filter
+// being ANDed, the rows of the request narrowed by the other conditions matching them are the rows of the filter.
+type localFilter struct {
+	conditions []*filterCondition
+}
+
+// splitFilter keeps the conditions of the filter fitting in the given length server-side, in order, the other
+// ones being matched client-side. A filter fitting already is left as is.
+func (d *Downloader) splitFilter(limit int) error {
+	if d.requestedFilter == "" {
+		d.requestedFilter = d.client.Filter
+	}
+	if len(url.QueryEscape(d.requestedFilter)) <= limit {
+		return nil
+	}
+
+	var server []string
+	local := &localFilter{}
+	length := 0
+	for _, condition := range strings.Split(d.requestedFilter, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+		// the commas separating the conditions are escaped too
+		escaped := len(url.QueryEscape(condition))
+		if len(server) > 0 {
+			escaped += len(url.QueryEscape(","))
+		}
+		if length+escaped <= limit {
+			server = append(server, condition)
+			length += escaped
+			continue
+		}
+		parsed, err := parseFilterCondition(d.client.Mode, condition)
+		if err != nil {
+			return fmt.Errorf("the filter is too long for the API and can't be matched client-side: %v", err)
+		}
+		local.conditions = append(local.conditions, parsed)
+	}
+	d.client.Filter = strings.Join(server, ",")
+	d.localFilter = local
+	d.FilterLength = limit
+	d.appendLog(WARNING, fmt.Sprintf("The filter is longer than the API accepts, %d of its conditions are matched client-side",
+		len(local.conditions)))
+	return nil
+}
+
+// totalElements asks the API the total number of elements, splitting the filter further while the API rejects
+// it as too long
+func (d *Downloader) totalElements() (uint64, error) {
+	for {
+		total, err := d.client.GetTotalElements()
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusRequestURITooLong && d.client.Filter != "" {
+			if err = d.splitFilter(len(url.QueryEscape(d.client.Filter)) / 2); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		return total, err
+	}
+}
+
+// parseFilterCondition parses a condition of a filter, field:[operator:]value, to be matched client-side
+func parseFilterCondition(mode string, condition string) (*filterCondition, error) {
+	parts := strings.SplitN(condition, ":", 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("condition %q: expected field:value or field:operator:value", condition)
+	}
+	parsed := &filterCondition{field: strings.ToLower(parts[0]), operator: "eq", value: parts[1], kind: "string", column: -1}
+	if len(parts) == 3 {
+		parsed.operator, parsed.value = strings.ToLower(parts[1]), parts[2]
+	}
+	if kind, ok := filterFields[mode][parsed.field]; ok {
+		parsed.kind = kind
+	}
+	if !containsString(filterOperators[parsed.kind], parsed.operator) {
+		return nil, fmt.Errorf("condition %q: operator %q can't be used with %s", condition, parsed.operator, parsed.field)
+	}
+	var err error
+	switch parsed.kind {
+	case "number":
+		parsed.number, err = strconv.ParseFloat(parsed.value, 64)
+	case "bool":
+		parsed.boolean, err = strconv.ParseBool(parsed.value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %s expects a %s, got %q", condition, parsed.field, parsed.kind, parsed.value)
+	}
+	return parsed, nil
+}
+
+// bind finds the fields of the conditions in a chunk header
+func (f *localFilter) bind(header []string) error {
+	for _, condition := range f.conditions {
+		condition.column = -1
+		for i, name := range header {
+			if strings.ToLower(strings.TrimSpace(name)) == condition.field {
+				condition.column = i
+				break
+			}
+		}
+		if condition.column < 0 {
+			return fmt.Errorf("no %s column to match the filter client-side, the available columns are: %s",
+				condition.field, strings.Join(header, ", "))
+		}
+	}
+	return nil
+}
+
+// match reports whether a row matches every condition, every row matches without conditions
+func (f *localFilter) match(fields []string) bool {
+	if f == nil {
+		return true
+	}
+	for _, condition := range f.conditions {
+		if !condition.match(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *filterCondition) match(fields []string) bool {
+	if c.column < 0 || c.column >= len(fields) {
+		return false
+	}
+	value := fields[c.column]
+	switch c.kind {
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		switch c.operator {
+		case "ne":
+			return number != c.number
+		case "gt":
+			return number > c.number
+		case "ge":
+			return number >= c.number
+		case "lt":
+			return number < c.number
+		case "le":
+			return number <= c.number
+		}
+		return number == c.number
+	case "bool":
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return false
+		}
+		return (boolean == c.boolean) == (c.operator == "eq")
+	}
+	switch c.operator {
+	case "ne":
+		return value != c.value
+	case "contains":
+		return strings.Contains(value, c.value)
+	case "prefix":
+		return strings.HasPrefix(value, c.value)
+	case "suffix":
+		return strings.HasSuffix(value, c.value)
+	}
+	return value == c.value
+}
@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitFilter(t *testing.T) {
+	d := &Downloader{client: &AudistoAPIClient{Mode: "pages", Filter: "status_code:200,depth:le:3,title:contains:blog,indexable:true"}}
+	if err := d.splitFilter(MaxFilterLength); err != nil || d.localFilter != nil {
+		t.Fatalf("expected a short filter to be left as is, got %v", err)
+	}
+	if err := d.splitFilter(len("status_code%3A200%2Cdepth%3Ale%3A3")); err != nil {
+		t.Fatal(err)
+	}
+	if d.client.Filter != "status_code:200,depth:le:3" {
+		t.Errorf("expected the first conditions to be sent to the API, got %q", d.client.Filter)
+	}
+	if err := d.localFilter.bind([]string{"url", "title", "indexable"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fields []string
+		match  bool
+	}{
+		{[]string{"http://example.com/", "The blog", "true"}, true},
+		{[]string{"http://example.com/", "The shop", "true"}, false},
+		{[]string{"http://example.com/", "The blog", "false"}, false},
+		{[]string{"http://example.com/", "The blog", ""}, false},
+	}
+	for _, test := range tests {
+		if match := d.localFilter.match(test.fields); match != test.match {
+			t.Errorf("%v: expected %v, got %v", test.fields, test.match, match)
+		}
+	}
+
+	if err := d.localFilter.bind([]string{"url"}); err == nil {
+		t.Error("a condition without its column should be rejected")
+	}
+	if _, err := parseFilterCondition("pages", "depth:gt:deep"); err == nil {
+		t.Error("a number condition without a number should be rejected")
+	}
+}
+
+func TestFilterTooLong(t *testing.T) {
+	var filters []string
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("filter")
+		filters = append(filters, filter)
+		// the API rejects the filters longer than 2 conditions
+		if strings.Count(filter, ",") > 1 {
+			w.WriteHeader(http.StatusRequestURITooLong)
+			return
+		}
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":1}}`))
+			return
+		}
+		fmt.Fprint(w, "id\turl\tdepth\n")
+		for id := 0; id < 4; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\t%d\n", id, id, id)
+		}
+	})()
+	dir, err := ioutil.TempDir("", "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		Filter: "status_code:200,depth:le:2,url:ne:http://example.com/0,url:ne:http://example.com/2"}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the conditions sent to the API are not applied by the test server, the ones left to the client are
+	if expected := "id\turl\tdepth\n1\thttp://example.com/1\t1\n3\thttp://example.com/3\t3\n"; string(data) != expected {
+		t.Errorf("expected the rows of the whole filter, got %q", data)
+	}
+	if last := filters[len(filters)-1]; strings.Count(last, ",") > 1 {
+		t.Errorf("expected the filter to be split, got %q", last)
+	}
+}
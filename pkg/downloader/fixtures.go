@@ -0,0 +1,197 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixtures the directory the responses of the API are recorded to or replayed from
+type fixtures struct {
+	dir    string
+	replay bool // the requests are answered from the fixtures, instead of recorded
+}
+
+// fixture the recorded response of a request, its body being stored next to it
+type fixture struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"` // the path and the query of the request, without its host
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+}
+
+// SetRecord records the responses of the API to the fixtures of the given directory, created if needed, so the
+// download can be run again offline with SetReplay. "" for no recording. It has to be called before Setup()
+func (d *Downloader) SetRecord(dir string) error {
+	return d.setFixtures(dir, false)
+}
+
+// SetReplay answers the requests from the fixtures recorded to the given directory by SetRecord, nothing being
+// sent to the API whatever the credentials; a request not recorded fails with a FixtureNotFoundError, without
+// retries. "" to request the API. It has to be called before Setup()
+func (d *Downloader) SetReplay(dir string) error {
+	return d.setFixtures(dir, true)
+}
+
+func (d *Downloader) setFixtures(dir string, replay bool) error {
+	if dir = strings.TrimSpace(dir); dir == "" {
+		return nil
+	}
+	if d.fixtures != nil && d.fixtures.replay != replay {
+		return fmt.Errorf("the responses of the API can't be recorded and replayed at once")
+	}
+	if replay {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("cannot replay the fixtures of %s: no such directory", dir)
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot record the fixtures to %s: %v", dir, err)
+	}
+	d.fixtures = &fixtures{dir: dir, replay: replay}
+	return nil
+}
+
+// setFixtures records or replays the responses of the client, its transport being set already
+func (api *AudistoAPIClient) setFixtures(f *fixtures) {
+	var next http.RoundTripper
+	if !f.replay {
+		next = api.httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+	}
+	api.httpClient.Transport = &fixturesTransport{fixtures: f, next: next}
+}
+
+// fixtureKey returns the name of the fixture of a request, the same whatever the host and the credentials
+// of the request: its method, path and query params are hashed
+func fixtureKey(request *http.Request) (string, string) {
+	target := request.URL.Path
+	if query := request.URL.Query(); len(query) > 0 {
+		// the params are sorted by Encode
+		target += "?" + query.Encode()
+	}
+	sum := sha256.Sum256([]byte(request.Method + " " + target))
+	return hex.EncodeToString(sum[:8]), target
+}
+
+// fixturesTransport answers the requests from the fixtures, or records the responses of next to them
+type fixturesTransport struct {
+	fixtures *fixtures
+	next     http.RoundTripper // nil when replaying
+}
+
+func (t *fixturesTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	key, target := fixtureKey(request)
+	metadata := filepath.Join(t.fixtures.dir, key+".json")
+	body := filepath.Join(t.fixtures.dir, key+".body")
+
+	if t.fixtures.replay {
+		if request.Body != nil {
+			request.Body.Close()
+		}
+		return replayFixture(request, metadata, body, &FixtureNotFoundError{Dir: t.fixtures.dir, URL: target})
+	}
+
+	response, err := t.next.RoundTrip(request)
+	// the responses retried are not recorded, a replay would retry them forever
+	if err != nil || isTransientStatusCode(response.StatusCode) {
+		return response, err
+	}
+	file, err := ioutil.TempFile(t.fixtures.dir, key+".*.partial")
+	if err != nil {
+		response.Body.Close()
+		return nil, fmt.Errorf("cannot record the fixture of %s: %v", target, err)
+	}
+	header := response.Header.Clone()
+	header.Del("Set-Cookie")
+	recorded := fixture{Method: request.Method, URL: target, StatusCode: response.StatusCode, Header: header}
+	response.Body = &recordedBody{ReadCloser: response.Body, file: file, body: body, metadata: metadata, fixture: recorded}
+	return response, nil
+}
+
+// replayFixture returns the response recorded for the request, notFound if there's none
+func replayFixture(request *http.Request, metadata string, body string, notFound error) (*http.Response, error) {
+	data, err := ioutil.ReadFile(metadata)
+	if os.IsNotExist(err) {
+		return nil, notFound
+	} else if err != nil {
+		return nil, err
+	}
+	var recorded fixture
+	if err = json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %v", metadata, err)
+	}
+	if data, err = ioutil.ReadFile(body); err != nil {
+		return nil, fmt.Errorf("cannot read the fixture %s: %v", body, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       request,
+	}, nil
+}
+
+// recordedBody copies the body of a response to its fixture while it's read. A body closed before its end, e.g.
+// the last chunk of a limited download, is read to its end first: the fixture is kept once complete only.
+type recordedBody struct {
+	io.ReadCloser
+	file     *os.File
+	body     string // the file the body is renamed to, once read
+	metadata string
+	fixture  fixture
+	complete bool
+	err      error // the error writing the fixture, it doesn't fail the download
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.file.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *recordedBody) Close() error {
+	if b.file == nil {
+		return b.ReadCloser.Close()
+	}
+	if !b.complete && b.err == nil {
+		_, b.err = io.Copy(b.file, b.ReadCloser)
+		b.complete = b.err == nil
+	}
+	err := b.ReadCloser.Close()
+	partial := b.file.Name()
+	closeErr := b.file.Close()
+	b.file = nil
+	if !b.complete || b.err != nil || closeErr != nil {
+		os.Remove(partial)
+		return err
+	}
+	// the metadata is written last, a fixture without it is not replayed
+	if os.Rename(partial, b.body) == nil {
+		if data, jsonErr := json.MarshalIndent(b.fixture, "", "  "); jsonErr == nil {
+			ioutil.WriteFile(b.metadata, data, 0644)
+		}
+	} else {
+		os.Remove(partial)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	stopServer := serveAPI(nil)
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := filepath.Join(dir, "fixtures")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "recorded.tsv"), Record: fixtures}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stopServer()
+	recorded, err := ioutil.ReadFile(options.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the API is down, the download is replayed whatever the credentials
+	options = Options{Username: "demo", Password: "demo", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "replayed.tsv"), Replay: fixtures}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if replayed, _ := ioutil.ReadFile(options.Output); string(replayed) != string(recorded) {
+		t.Errorf("expected the replayed output %q to be the recorded one %q", replayed, recorded)
+	}
+
+	// another crawl was not recorded
+	options.CrawlID, options.NoResume = 54321, true
+	if err = New(options).Run(context.Background()); !IsFixtureNotFound(err) {
+		t.Errorf("expected a request not recorded to fail the download, got %v", err)
+	}
+
+	options.Record = fixtures
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected recording and replaying at once to be rejected")
+	}
+}
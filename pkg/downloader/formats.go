@@ -0,0 +1,291 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// TSVOutputFormat writes rows as they are received from Audisto API (default)
+	TSVOutputFormat = "tsv"
+
+	// JSONOutputFormat writes every row as a JSON object, one object per line (newline-delimited JSON)
+	JSONOutputFormat = "json"
+
+	// CSVOutputFormat writes rows as comma (or a custom delimiter) separated values, quoted as per RFC 4180
+	CSVOutputFormat = "csv"
+
+	// DefaultCSVDelimiter the delimiter used for the csv output format if NOT explicitly set
+	DefaultCSVDelimiter = ','
+
+	// LineEndingLF ends the rows with a line feed (default)
+	LineEndingLF = "lf"
+
+	// LineEndingCRLF ends the rows with a carriage return and a line feed, as expected by Excel on Windows
+	LineEndingCRLF = "crlf"
+)
+
+// RowWriter writes the header and the rows of a downloaded chunk in a given output format.
+// A RowWriter is created for every processed chunk, with the header of that chunk.
+type RowWriter interface {
+	// WriteHeader is only called for the first chunk of the output file
+	WriteHeader() error
+	WriteRow(fields []string) error
+	// Flush is called once all the rows of the chunk are written
+	Flush() error
+}
+
+// FormatOptions holds the settings passed to every RowWriterFactory
+type FormatOptions struct {
+	// Delimiter separating fields, used for delimited formats such as csv
+	Delimiter rune
+	// CRLF ends the rows with \r\n instead of \n
+	CRLF bool
+	// Nulls writes the empty values of the number and bool columns as NullAs, null in json
+	Nulls bool
+	// NullAs the representation of the nulls of delimited formats, e.g. \N
+	NullAs string
+}
+
+// newline returns the end of the rows of the options
+func (o FormatOptions) newline() string {
+	if o.CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// RowWriterFactory creates a RowWriter writing to w.
+// header is the header line of the chunk being processed, already split into fields.
+type RowWriterFactory func(w io.Writer, header []string, options FormatOptions) RowWriter
+
+// outputFormats the registry of the known output formats
+var outputFormats = map[string]RowWriterFactory{}
+
+func init() {
+	RegisterOutputFormat(TSVOutputFormat, newTSVRowWriter)
+	RegisterOutputFormat(JSONOutputFormat, newJSONRowWriter)
+	RegisterOutputFormat(CSVOutputFormat, newCSVRowWriter)
+}
+
+// RegisterOutputFormat makes an output format available by name to the downloader.
+// Registering a name twice replaces the previous factory.
+func RegisterOutputFormat(name string, factory RowWriterFactory) {
+	outputFormats[strings.ToLower(name)] = factory
+}
+
+// OutputFormats returns the names of the registered output formats, sorted
+func OutputFormats() []string {
+	names := make([]string, 0, len(outputFormats)+len(tableFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	for name := range tableFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRowWriter returns a RowWriter for the given format, writing to w.
+func newRowWriter(format string, w io.Writer, header []string, options FormatOptions) (RowWriter, error) {
+	factory, ok := outputFormats[normalizeOutputFormat(format)]
+	if !ok {
+		return nil, fmt.Errorf("output format not supported: %s", format)
+	}
+	return factory(w, header, options), nil
+}
+
+// tsvRowWriter writes fields joined by tabs, the same way Audisto API sends them.
+type tsvRowWriter struct {
+	w        io.Writer
+	header   []string
+	newline  string
+	nullable []bool // the columns the empty values of which are written as nullAs, nil for none
+	nullAs   string
+}
+
+func newTSVRowWriter(w io.Writer, header []string, options FormatOptions) RowWriter {
+	return &tsvRowWriter{w: w, header: header, newline: options.newline(), nullable: options.nullColumns(header), nullAs: options.NullAs}
+}
+
+func (tw *tsvRowWriter) WriteHeader() error {
+	_, err := io.WriteString(tw.w, strings.Join(tw.header, "\t")+tw.newline)
+	return err
+}
+
+func (tw *tsvRowWriter) WriteRow(fields []string) error {
+	fields = withNulls(fields, tw.nullable, tw.nullAs)
+	_, err := io.WriteString(tw.w, strings.Join(fields, "\t")+tw.newline)
+	return err
+}
+
+func (tw *tsvRowWriter) Flush() error {
+	return nil
+}
+
+// jsonRowWriter writes every row as a JSON object, keys are the header fields.
+// Keys keep the order of the header, that's why the object is built by hand
+// instead of marshaling a map.
+type jsonRowWriter struct {
+	w        io.Writer
+	header   []string
+	newline  string
+	nullable []bool // the columns the empty values of which are written as null, nil for none
+}
+
+func newJSONRowWriter(w io.Writer, header []string, options FormatOptions) RowWriter {
+	return &jsonRowWriter{w: w, header: header, newline: options.newline(), nullable: options.nullColumns(header)}
+}
+
+// WriteHeader does nothing, the header is part of every JSON object.
+func (jw *jsonRowWriter) WriteHeader() error {
+	return nil
+}
+
+func (jw *jsonRowWriter) WriteRow(fields []string) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range jw.header {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// missing trailing fields are written as empty strings
+		value := ""
+		if i < len(fields) {
+			value = fields[i]
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		if value == "" && jw.nullable != nil && jw.nullable[i] {
+			buf.WriteString("null")
+			continue
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	buf.WriteString(jw.newline)
+	_, err := jw.w.Write(buf.Bytes())
+	return err
+}
+
+func (jw *jsonRowWriter) Flush() error {
+	return nil
+}
+
+// csvRowWriter writes rows using encoding/csv, which quotes fields as per RFC 4180
+type csvRowWriter struct {
+	w        *csv.Writer
+	header   []string
+	nullable []bool // the columns the empty values of which are written as nullAs, nil for none
+	nullAs   string
+}
+
+func newCSVRowWriter(w io.Writer, header []string, options FormatOptions) RowWriter {
+	writer := csv.NewWriter(w)
+	if options.Delimiter != 0 {
+		writer.Comma = options.Delimiter
+	}
+	writer.UseCRLF = options.CRLF
+	return &csvRowWriter{w: writer, header: header, nullable: options.nullColumns(header), nullAs: options.NullAs}
+}
+
+func (cw *csvRowWriter) WriteHeader() error {
+	return cw.w.Write(cw.header)
+}
+
+func (cw *csvRowWriter) WriteRow(fields []string) error {
+	return cw.w.Write(withNulls(fields, cw.nullable, cw.nullAs))
+}
+
+func (cw *csvRowWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// newRowReader returns a function reading the rows of a tsv or csv export one at a time, io.EOF once read.
+// csv fields are separated by the given delimiter, the default one if 0.
+func newRowReader(format string, r io.Reader, delimiter rune) func() ([]string, error) {
+	if format == CSVOutputFormat {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		if delimiter != 0 {
+			reader.Comma = delimiter
+		}
+		return reader.Read
+	}
+	// rows are read as they're written, without limiting their length
+	lines := bufio.NewReader(r)
+	return func() ([]string, error) {
+		line, err := lines.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.TrimRight(line, "\r\n"), "\t"), nil
+	}
+}
+
+// parseLineEnding validates a user given line ending, lf (default) or crlf. It returns whether the rows end
+// with \r\n.
+func parseLineEnding(lineEnding string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(lineEnding)) {
+	case "", LineEndingLF:
+		return false, nil
+	case LineEndingCRLF:
+		return true, nil
+	}
+	return false, fmt.Errorf("line ending has to be '%s' or '%s': %q", LineEndingLF, LineEndingCRLF, lineEnding)
+}
+
+// IsValidOutputFormat checks if the given output format is supported
+func IsValidOutputFormat(format string) bool {
+	_, ok := outputFormats[normalizeOutputFormat(format)]
+	return ok || isTableFormat(format)
+}
+
+// normalizeOutputFormat returns the output format, defaulting to TSVOutputFormat when empty
+func normalizeOutputFormat(format string) string {
+	if format == "" {
+		return TSVOutputFormat
+	}
+	return format
+}
+
+// parseDelimiter validates a user given delimiter. The delimiter has to be a single
+// character, and it can't be a quote, a carriage return or a new line.
+func parseDelimiter(delimiter string) (rune, error) {
+	if delimiter == "" {
+		return DefaultCSVDelimiter, nil
+	}
+	// allow passing a tab as an escaped sequence, typing a literal tab is not handy
+	if delimiter == `\t` {
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == utf8.RuneError {
+		return 0, fmt.Errorf("delimiter has to be a single character: %q", delimiter)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("delimiter not allowed: %q", delimiter)
+	}
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestJSONRowWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newRowWriter(JSONOutputFormat, &buf, []string{"url", "status_code", "title"}, FormatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer.WriteHeader()
+	writer.WriteRow([]string{"https://example.com/", "200", `a "quoted" title`})
+	writer.WriteRow([]string{"https://example.com/missing", "404"})
+
+	expected := `{"url":"https://example.com/","status_code":"200","title":"a \"quoted\" title"}` + "\n" +
+		`{"url":"https://example.com/missing","status_code":"404","title":""}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected json output:\n%s", buf.String())
+	}
+}
+
+func TestTSVRowWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newRowWriter(TSVOutputFormat, &buf, []string{"url", "status_code"}, FormatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer.WriteHeader()
+	writer.WriteRow([]string{"https://example.com/", "200"})
+
+	if buf.String() != "url\tstatus_code\nhttps://example.com/\t200\n" {
+		t.Errorf("unexpected tsv output:\n%s", buf.String())
+	}
+}
+
+func TestCSVRowWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newRowWriter(CSVOutputFormat, &buf, []string{"url", "title"}, FormatOptions{Delimiter: ';'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer.WriteHeader()
+	writer.WriteRow([]string{"https://example.com/", `semi;colon "quoted"`})
+	writer.Flush()
+
+	if buf.String() != "url;title\nhttps://example.com/;\"semi;colon \"\"quoted\"\"\"\n" {
+		t.Errorf("unexpected csv output:\n%s", buf.String())
+	}
+}
+
+func TestCRLFRowWriters(t *testing.T) {
+	expected := map[string]string{
+		TSVOutputFormat:  "url\tstatus_code\r\nhttps://example.com/\t200\r\n",
+		CSVOutputFormat:  "url,status_code\r\nhttps://example.com/,200\r\n",
+		JSONOutputFormat: `{"url":"https://example.com/","status_code":"200"}` + "\r\n",
+	}
+	for format, output := range expected {
+		var buf bytes.Buffer
+		writer, err := newRowWriter(format, &buf, []string{"url", "status_code"}, FormatOptions{CRLF: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.WriteHeader()
+		writer.WriteRow([]string{"https://example.com/", "200"})
+		writer.Flush()
+		if buf.String() != output {
+			t.Errorf("unexpected %s output with crlf:\n%q", format, buf.String())
+		}
+
+		// the rows written are read back without their \r
+		if format != JSONOutputFormat {
+			next := newRowReader(format, &buf, 0)
+			if row, err := next(); err != nil || row[1] != "status_code" {
+				t.Errorf("unexpected %s header read back: %q (%v)", format, row, err)
+			}
+		}
+	}
+}
+
+func TestParseLineEnding(t *testing.T) {
+	for lineEnding, crlf := range map[string]bool{"": false, "lf": false, "crlf": true, "CRLF": true} {
+		if parsed, err := parseLineEnding(lineEnding); err != nil || parsed != crlf {
+			t.Errorf("line ending %q should be parsed as crlf=%v, got %v (%v)", lineEnding, crlf, parsed, err)
+		}
+	}
+	if _, err := parseLineEnding("cr"); err == nil {
+		t.Errorf("line ending cr should not be valid")
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	for delimiter, expected := range map[string]rune{"": ',', ";": ';', `\t`: '\t', "|": '|'} {
+		r, err := parseDelimiter(delimiter)
+		if err != nil || r != expected {
+			t.Errorf("delimiter %q should be parsed as %q, got %q (%v)", delimiter, expected, r, err)
+		}
+	}
+	for _, delimiter := range []string{"\"", "\n", ",,"} {
+		if _, err := parseDelimiter(delimiter); err == nil {
+			t.Errorf("delimiter %q should not be valid", delimiter)
+		}
+	}
+}
+
+func TestIsValidOutputFormat(t *testing.T) {
+	if !IsValidOutputFormat("json") || !IsValidOutputFormat("tsv") || !IsValidOutputFormat("csv") || !IsValidOutputFormat("") {
+		t.Errorf("json, tsv, csv and empty output formats should be valid")
+	}
+	if IsValidOutputFormat("xml") {
+		t.Errorf("xml output format should not be valid")
+	}
+}
@@ -0,0 +1,35 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetNoHeader when set to true, the header row is not written to the output, only the rows are.
+// It has to be called before Setup()
+func (d *Downloader) SetNoHeader(noHeader bool) {
+	d.noHeader = noHeader
+}
+
+// checkHeader checks the header of a chunk against the header of the first chunk of the output,
+// every chunk starting with the header. The header of the first chunk is kept for resumes.
+func (d *Downloader) checkHeader(header []string) error {
+	if len(d.Progress.Header) == 0 {
+		d.Progress.Header = header
+		return nil
+	}
+	if strings.Join(header, "\t") != strings.Join(d.Progress.Header, "\t") {
+		return fmt.Errorf("the columns sent by the API (%s) differ from the ones %q was begun with (%s): use --no-resume to create new",
+			strings.Join(header, ", "), d.OutputFilename, strings.Join(d.Progress.Header, ", "))
+	}
+	return nil
+}
+
+// writeHeader writes the header row, once per output, unless no header is requested
+func (d *Downloader) writeHeader(writer RowWriter) error {
+	if d.noHeader || d.headerWritten {
+		return nil
+	}
+	d.headerWritten = true
+	return writer.WriteHeader()
+}
@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestCheckHeader(t *testing.T) {
+	d := New(Options{})
+	if err := d.checkHeader([]string{"id", "url"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.checkHeader([]string{"id", "url"}); err != nil {
+		t.Errorf("the same header should be accepted: %v", err)
+	}
+	if err := d.checkHeader([]string{"id", "url", "depth"}); err == nil {
+		t.Errorf("a different header should be rejected")
+	}
+}
+
+func TestWriteChunkHeaderOnce(t *testing.T) {
+	var output bytes.Buffer
+	d := New(Options{})
+	d.outputWriter = bufio.NewWriter(&output)
+	d.client = &AudistoAPIClient{ChunkSize: 2}
+	d.CurrentTarget.TotalElements = 4
+
+	// the header is repeated at the start of every chunk, and sometimes within a chunk
+	chunks := []fetchedChunk{
+		{body: []byte("id\turl\n1\ta\nid\turl\n2\tb\n"), start: 0, size: 2},
+		{body: []byte("id\turl\n3\tc\n4\td\n"), start: 2, size: 2},
+	}
+	for _, chunk := range chunks {
+		if err := d.writeChunk(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expected := "id\turl\n1\ta\n2\tb\n3\tc\n4\td\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
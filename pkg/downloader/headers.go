@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// reservedHeaders the headers of the requests set by the client, they can't be set by SetHeaders
+var reservedHeaders = map[string]string{
+	"Authorization":  "set the API token or the username and password instead",
+	"Content-Length": "it's set by the client",
+	"Host":           "set the API base URL instead",
+}
+
+// ParseHeader parses a request header as "Name: value", e.g. "X-Team: seo"
+func ParseHeader(header string) (string, string, error) {
+	parts := strings.SplitN(header, ":", 2)
+	name := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || name == "" {
+		return "", "", fmt.Errorf("invalid header %q, expected Name: value", header)
+	}
+	for _, r := range name {
+		// the token characters of RFC 7230
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return "", "", fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if reason, ok := reservedHeaders[name]; ok {
+		return "", "", fmt.Errorf("the %s header can't be set, %s", name, reason)
+	}
+	return name, strings.TrimSpace(parts[1]), nil
+}
+
+// ParseHeaders parses request headers as "Name: value" each, a header given more than once having every value
+func ParseHeaders(headers []string) (http.Header, error) {
+	parsed := http.Header{}
+	for _, header := range headers {
+		name, value, err := ParseHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Add(name, value)
+	}
+	return parsed, nil
+}
+
+// SetHeaders sets the User-Agent of the requests, "" for the Go default one, and headers added to every request,
+// e.g. for a gateway routing the requests by team. They replace the default headers of the same name.
+func (api *AudistoAPIClient) SetHeaders(userAgent string, header http.Header) {
+	api.UserAgent, api.Header = userAgent, header
+}
+
+// applyHeaders sets the User-Agent and the extra headers of the client on a request
+func (api *AudistoAPIClient) applyHeaders(request *http.Request) {
+	if api.UserAgent != "" {
+		request.Header.Set("User-Agent", api.UserAgent)
+	}
+	for name, values := range api.Header {
+		request.Header[name] = values
+	}
+}
+
+// SetHeaders sets the User-Agent of the requests to the API, "" for the Go default one, and headers added
+// to every request, as "Name: value" each, e.g. "X-Team: seo".
+// It has to be called before Setup()
+func (d *Downloader) SetHeaders(userAgent string, headers []string) error {
+	parsed, err := ParseHeaders(headers)
+	if err != nil {
+		return err
+	}
+	d.userAgent, d.headers = strings.TrimSpace(userAgent), parsed
+	return nil
+}
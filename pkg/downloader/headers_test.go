@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	name, value, err := ParseHeader(" x-team :  seo ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "X-Team" || value != "seo" {
+		t.Errorf("expected X-Team: seo, got %s: %s", name, value)
+	}
+	if _, value, err = ParseHeader("X-Empty:"); err != nil || value != "" {
+		t.Errorf("expected an empty value, got %q, %v", value, err)
+	}
+	for _, header := range []string{"X-Team", ": seo", "X Team: seo", "X-Team(1): seo", "authorization: Bearer x", "Host: example.com"} {
+		if _, _, err := ParseHeader(header); err == nil {
+			t.Errorf("expected an error parsing %q", header)
+		}
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var received []http.Header
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header)
+		mu.Unlock()
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+
+	dir, err := ioutil.TempDir("", "headers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		UserAgent: "seo-exports/1.0", Headers: []string{"X-Team: seo", "X-Job: nightly", "X-Job: weekly"}}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) == 0 {
+		t.Fatal("no request received")
+	}
+	for _, header := range received {
+		if header.Get("User-Agent") != "seo-exports/1.0" || header.Get("X-Team") != "seo" {
+			t.Errorf("unexpected User-Agent %q and X-Team %q", header.Get("User-Agent"), header.Get("X-Team"))
+		}
+		if jobs := header["X-Job"]; len(jobs) != 2 || jobs[0] != "nightly" || jobs[1] != "weekly" {
+			t.Errorf("unexpected X-Job headers %q", jobs)
+		}
+	}
+
+	if err := New(Options{Headers: []string{"Authorization: Basic x"}}).Run(context.Background()); err == nil {
+		t.Error("the Authorization header should not be set")
+	}
+}
@@ -68,26 +68,25 @@ func chs(n int, c string) string {
 	return s
 }
 
-// retry operation
-func retry(attempts int, sleep int, callback func() error, d *Downloader) (err error) {
-	for i := 0; ; i++ {
-		err = callback()
-		if err == nil {
-			return nil
-		}
-
-		if i >= (attempts - 1) {
-			break
-		}
-
-		errorCount++
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
 
-		// pause before retrying
-		time.Sleep(time.Duration(sleep) * time.Second)
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
 
-		if d != nil {
-			d.debug("Something failed, retrying;")
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
-	return fmt.Errorf("Abandoned after %d attempts, last error: %s", attempts, err)
+	return false
 }
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LockSuffix the suffix of the lock file of a local output, held while the output and its resume state are written
+	LockSuffix = ".lock"
+
+	// lockPollInterval how often a locked output is checked while waiting for it, see SetWaitForLock
+	lockPollInterval = time.Second
+)
+
+// SetWaitForLock when set to true, a download of an output locked by another download waits for it to be
+// unlocked, instead of failing with an OutputLockedError. It has to be called before Setup()
+func (d *Downloader) SetWaitForLock(wait bool) {
+	d.waitForLock = wait
+}
+
+// isLockedOutput checks if the output is locked while written: local files only, remote outputs, databases,
+// pipes and stdout aren't
+func (d *Downloader) isLockedOutput() bool {
+	return d.origOutputFilename != "" && !d.pipe && !IsRemoteOutput(d.origOutputFilename) &&
+		!IsTableOutputLocation(d.origOutputFilename)
+}
+
+// lockOutput takes the advisory lock of the output, [OUTPUT].lock, before its resume state is read: two downloads
+// of the same output would interleave their rows. The lock is held by the process, it's released once the
+// download is done or the process exits, whatever the lock file left over.
+func (d *Downloader) lockOutput() error {
+	if !d.isLockedOutput() || d.outputLock != nil {
+		return nil
+	}
+	filename := d.origOutputFilename + LockSuffix
+	waiting := false
+	for {
+		file, err := openLockFile(filename)
+		if err != nil {
+			return fmt.Errorf("cannot lock %s: %v", d.origOutputFilename, err)
+		}
+		if file != nil {
+			// the process holding the lock is written to it, for the error of the next downloads
+			file.Truncate(0)
+			file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			d.outputLock = file
+			return nil
+		}
+
+		err = &OutputLockedError{Output: d.origOutputFilename, PID: lockHolder(filename)}
+		if !d.waitForLock {
+			return err
+		}
+		if !waiting {
+			d.appendLog(INFO, fmt.Sprintf("%v, waiting for it to finish...", err))
+			waiting = true
+		}
+		ctx := d.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// openLockFile opens and locks the lock file, nil being returned when another process holds its lock. The lock is
+// taken again if the file was removed meanwhile by the process releasing it, see releaseLockFile.
+func openLockFile(filename string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := tryLockFile(file)
+		if err != nil || !ok {
+			file.Close()
+			return nil, err
+		}
+		locked, lockedErr := file.Stat()
+		current, currentErr := os.Stat(filename)
+		if lockedErr == nil && currentErr == nil && os.SameFile(locked, current) {
+			return file, nil
+		}
+		file.Close()
+	}
+}
+
+// lockHolder returns the process ID written to a lock file, 0 if unknown
+func lockHolder(filename string) int {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// unlockOutput releases the lock of the output and removes its lock file, if locked
+func (d *Downloader) unlockOutput() {
+	if d.outputLock == nil {
+		return
+	}
+	releaseLockFile(d.outputLock)
+	d.outputLock = nil
+}
@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockedOutput(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// another download holds the lock of the output
+	output := filepath.Join(dir, "crawl.tsv")
+	lock, err := openLockFile(output + LockSuffix)
+	if err != nil || lock == nil {
+		t.Fatalf("cannot lock the output: %v", err)
+	}
+	lock.WriteString("4242\n")
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output}
+	err = New(options).Run(context.Background())
+	locked, ok := err.(*OutputLockedError)
+	if !ok || locked.PID != 4242 {
+		t.Fatalf("expected the locked output to fail the download, got %v", err)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Error("nothing should be written to a locked output")
+	}
+
+	// the output is waited for until the other download is done
+	options.WaitForLock = true
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		releaseLockFile(lock)
+	}()
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(output); err != nil {
+		t.Errorf("the output should be written once unlocked: %v", err)
+	}
+	if _, err = os.Stat(output + LockSuffix); !os.IsNotExist(err) {
+		t.Error("the lock file should be removed once the download is done")
+	}
+}
@@ -0,0 +1,24 @@
+// +build !windows
+
+package downloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes the exclusive advisory lock of the file, ok is false when another process holds it
+func tryLockFile(file *os.File) (ok bool, err error) {
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// releaseLockFile removes the lock file, then releases its lock: a process waiting for it locks a file
+// no longer in place, and tries again
+func releaseLockFile(file *os.File) {
+	os.Remove(file.Name())
+	file.Close()
+}
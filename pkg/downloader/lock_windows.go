@@ -0,0 +1,26 @@
+// +build windows
+
+package downloader
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// tryLockFile takes the exclusive lock of the file, ok is false when another process holds it
+func tryLockFile(file *os.File) (ok bool, err error) {
+	err = windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// releaseLockFile releases the lock of the file, then removes it: an open file can't be removed on Windows.
+// The file is left in place when another process opened it meanwhile, it's unlocked.
+func releaseLockFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Download events, set as the "event" field of the log entries so automation can parse them
+const (
+	ChunkStartedEvent  = "chunk_started"
+	ChunkFinishedEvent = "chunk_finished"
+	RetryEvent         = "retry"
+	CompletedEvent     = "completed"
+	UnchangedEvent     = "unchanged" // the download was skipped, see SetSkipIfUnchanged
+	PausedEvent        = "paused"
+	ResumedEvent       = "resumed"
+)
+
+// discardLogger is used when no logger is explicitly set
+var discardLogger = &logrus.Logger{Out: ioutil.Discard, Formatter: new(logrus.TextFormatter), Level: logrus.PanicLevel}
+
+// SetLogger sets the structured logger download events are sent to: chunks started (debug level),
+// chunks finished (info), retries (warning), completion (info), along with the info/warning messages
+// of the progress report. Nothing is logged if NOT explicitly set.
+// It has to be called before Setup()
+func (d *Downloader) SetLogger(logger logrus.FieldLogger) {
+	d.logger = logger
+}
+
+// log returns the logger of the downloader
+func (d *Downloader) log() logrus.FieldLogger {
+	if d.logger == nil {
+		return discardLogger
+	}
+	return d.logger
+}
+
+// log returns the logger of the client
+func (api *AudistoAPIClient) log() logrus.FieldLogger {
+	if api.Logger == nil {
+		return discardLogger
+	}
+	return api.Logger
+}
+
+// logMessage sends a progress report message to the logger, with the matching level
+func (d *Downloader) logMessage(logType LogType, message string) {
+	message = strings.TrimRight(message, "\n")
+	switch logType {
+	case INFO:
+		d.log().Info(message)
+	case WARNING:
+		d.log().Warn(message)
+	default:
+		d.log().Debug(message)
+	}
+}
@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRetryEventLogged(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logs
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	client := &AudistoAPIClient{RetryPolicy: RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}, Logger: logger}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.doWithRetries(request); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON log entry, got %q", logs.String())
+	}
+	if entry["event"] != RetryEvent || entry["status"] != float64(http.StatusBadGateway) || entry["level"] != "warning" {
+		t.Errorf("unexpected retry log entry: %v", entry)
+	}
+}
+
+func TestLogMessageLevels(t *testing.T) {
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logs
+	logger.Level = logrus.WarnLevel
+
+	d := New(Options{})
+	d.SetLogger(logger)
+	d.appendLog(INFO, "Total Elements: 10\n")
+	if logs.Len() != 0 {
+		t.Errorf("info messages should be filtered out at the warning level, got %q", logs.String())
+	}
+	d.appendLog(WARNING, "Dropping 10 bytes\n")
+	if !bytes.Contains(logs.Bytes(), []byte("Dropping 10 bytes")) {
+		t.Errorf("warning messages should be logged, got %q", logs.String())
+	}
+
+	// nothing is logged without a logger
+	New(Options{}).appendLog(WARNING, "nothing")
+}
@@ -0,0 +1,8 @@
+// +build !windows
+
+package downloader
+
+// longPath returns the path of a local output, the path limits of Windows don't apply
+func longPath(name string) string {
+	return name
+}
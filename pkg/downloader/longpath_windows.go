@@ -0,0 +1,25 @@
+// +build windows
+
+package downloader
+
+import (
+	"path/filepath"
+)
+
+// maxShortPath the length from which a path is made absolute: Windows limits the paths to 260 characters
+// (MAX_PATH), the suffixes of the resumer, partial and report files included, unless they're given in their
+// extended-length form. Go only uses that form for absolute paths.
+const maxShortPath = 200
+
+// longPath returns the path of a local output that can be longer than MAX_PATH: long paths are made absolute,
+// relative ones being resolved against the working directory
+func longPath(name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil || len(abs) <= maxShortPath {
+		return name
+	}
+	return abs
+}
@@ -0,0 +1,229 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// upsertTableOutputs the table outputs upserting the rows by tableOptions.Key, by output format or URL scheme
+var upsertTableOutputs = map[string]bool{}
+
+// defaultMergeKeys the columns the rows of a mode are upserted by, unless set
+var defaultMergeKeys = map[string][]string{
+	"pages": {"url"},
+	"links": {"source_url", "target_url"},
+	"hints": {"url", "hint"},
+}
+
+// mergedOutput the rows of the existing output a download is merged into, by key
+type mergedOutput struct {
+	key     []string            // the key columns, lower-cased
+	header  []string            // the header of the existing output, nil until it's read
+	keys    []string            // the keys of the rows, in the order of the existing output
+	rows    map[string][]string // the rows, by key; nil for table outputs, upserting the rows themselves
+	seen    map[string]bool     // the keys of the rows downloaded so far
+	columns []string            // the header of the downloaded rows, nil until the first chunk
+}
+
+// SetMerge makes the downloader merge the download into an existing output, instead of replacing it: the rows
+// are upserted by the key columns (url for the pages, source_url and target_url for the links if none), the rows
+// of the output not downloaded again being kept, e.g. for a dataset rolling over the crawls of a project.
+// The existing rows of a tsv or csv file are read by Setup(), the rows downloaded replacing them as they're
+// written, the rows kept being written last. SQLite and PostgreSQL tables are upserted chunk by chunk.
+// It has to be called before Setup()
+func (d *Downloader) SetMerge(merge bool, key []string) error {
+	if !merge {
+		d.merge = nil
+		return nil
+	}
+	m := &mergedOutput{}
+	for _, column := range key {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "" {
+			return fmt.Errorf("empty append key column name")
+		}
+		m.key = append(m.key, column)
+	}
+	d.merge = m
+	return nil
+}
+
+// checkMerge checks the output can be merged into: a local tsv or csv file with a header, or a table
+// output upserting its rows
+func (d *Downloader) checkMerge() error {
+	if d.merge.key == nil {
+		d.merge.key = defaultMergeKeys[d.client.Mode]
+	}
+	if d.isTableOutput() {
+		kind := d.tableOutputKind()
+		if !upsertTableOutputs[kind] {
+			return fmt.Errorf("%s outputs can't be appended to, only tsv and csv files, sqlite and postgres tables", kind)
+		}
+		return nil
+	}
+	if d.OutputFilename == "" || d.isRemoteOutput() || d.pipe {
+		return fmt.Errorf("only local files and database tables can be appended to")
+	}
+	if format := normalizeOutputFormat(d.OutputFormat); format != TSVOutputFormat && format != CSVOutputFormat {
+		return fmt.Errorf("only tsv and csv files can be appended to, their rows are read back")
+	}
+	if d.noHeader {
+		return fmt.Errorf("an output without header can't be appended to, its rows are matched by column")
+	}
+	if d.isSplit() || d.partitionBy != "" || d.diff != nil || d.sample != nil || d.aggregation != nil || d.encryption != nil {
+		return fmt.Errorf("an appended output can't be split, partitioned, diffed, sampled, aggregated nor encrypted")
+	}
+	if d.currentTargetsFilename != "" {
+		return fmt.Errorf("a targets download can't be appended, the rows are matched by the pages or links of the crawl")
+	}
+	if d.mustResume {
+		return fmt.Errorf("an appended output can't be resumed, the rows of the output are matched while downloading")
+	}
+	return nil
+}
+
+// prepareMerge reads the rows of the existing output file, if any, before it's written again
+func (d *Downloader) prepareMerge() error {
+	if d.isTableOutput() || fExists(d.OutputFilename) != nil {
+		return nil
+	}
+	if err := d.merge.load(d.OutputFilename, normalizeOutputFormat(d.OutputFormat), d.formatOptions()); err != nil {
+		return err
+	}
+	d.appendLog(INFO, fmt.Sprintf("Merging the download into the %d rows of %s", len(d.merge.keys), d.OutputFilename))
+	return nil
+}
+
+// load reads the rows of the existing output, csv files being read with the given delimiter
+func (m *mergedOutput) load(filename string, format string, options FormatOptions) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read the output appended to: %v", err)
+	}
+	defer file.Close()
+	reader, err := decompressedReader(file)
+	if err != nil {
+		return fmt.Errorf("cannot read the output appended to %s: %v", filename, err)
+	}
+	next := newRowReader(format, reader, options.Delimiter)
+
+	m.rows, m.seen = map[string][]string{}, map[string]bool{}
+	if m.header, err = next(); err == io.EOF {
+		// an empty file, nothing to keep
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot read the header of the output appended to %s: %v", filename, err)
+	}
+	key, err := columnPositions(m.header, m.key)
+	if err != nil {
+		return fmt.Errorf("cannot append to %s: %v", filename, err)
+	}
+	nullable := options.nullColumns(m.header)
+	for {
+		row, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read the output appended to %s: %v", filename, err)
+		}
+		row = withoutNulls(row, nullable, options.NullAs)
+		k := rowKey(row, key)
+		// the last row of a key wins, as it would once upserted
+		if _, ok := m.rows[k]; !ok {
+			m.keys = append(m.keys, k)
+		}
+		m.rows[k] = row
+	}
+}
+
+// mergeRowWriter writes the rows of a chunk, replacing the rows of the existing output with the same key
+type mergeRowWriter struct {
+	merge  *mergedOutput
+	header []string
+	key    []int    // the positions of the key columns in the rows
+	common [][2]int // the positions of the columns of both the rows and the existing output, in the rows then in the output
+	output RowWriter
+}
+
+func (d *Downloader) newMergeRowWriter(header []string) (RowWriter, error) {
+	key, err := columnPositions(header, d.merge.key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot append the download: %v", err)
+	}
+	w := &mergeRowWriter{merge: d.merge, header: header, key: key}
+	existingColumns := make(map[string]int, len(d.merge.header))
+	for i, name := range d.merge.header {
+		existingColumns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for i, name := range header {
+		if j, ok := existingColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			w.common = append(w.common, [2]int{i, j})
+		}
+	}
+	d.merge.columns = header
+	if w.output, err = d.newOutputWriter(header); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *mergeRowWriter) WriteHeader() error {
+	return w.output.WriteHeader()
+}
+
+// WriteRow writes the row, the row of the existing output with its key being replaced
+func (w *mergeRowWriter) WriteRow(fields []string) error {
+	w.merge.seen[rowKey(fields, w.key)] = true
+	return w.output.WriteRow(fields)
+}
+
+func (w *mergeRowWriter) Flush() error {
+	return w.output.Flush()
+}
+
+// writeKept writes the rows of the existing output that were not downloaded, in the columns of the download
+func (w *mergeRowWriter) writeKept() error {
+	for _, k := range w.merge.keys {
+		if w.merge.seen[k] {
+			continue
+		}
+		previous := w.merge.rows[k]
+		fields := make([]string, len(w.header))
+		for _, positions := range w.common {
+			fields[positions[0]] = fieldAt(previous, positions[1])
+		}
+		if err := w.output.WriteRow(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeKeptRows writes the rows of the existing output missing from the completed download
+func (d *Downloader) writeKeptRows() error {
+	if d.merge == nil || d.merge.rows == nil || len(d.merge.keys) == 0 {
+		return nil
+	}
+	// without any downloaded row, the rows are kept in the columns of the existing output
+	header := d.merge.columns
+	if header == nil {
+		header = d.merge.header
+	}
+	writer, err := d.newMergeRowWriter(header)
+	if err != nil {
+		return err
+	}
+	if err = d.writeHeader(writer); err != nil {
+		return err
+	}
+	if err = writer.(*mergeRowWriter).writeKept(); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return d.flushOutput()
+}
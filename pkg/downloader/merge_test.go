@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunMerge(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a is downloaded again, c is kept; the depth column is not downloaded anymore
+	output := filepath.Join(dir, "dataset.tsv")
+	ioutil.WriteFile(output, []byte("url\tid\tdepth\nhttp://example.com/a\t9\t0\nhttp://example.com/c\t3\t1\n"), 0644)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, Append: true}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n3\thttp://example.com/c\n"
+	if string(written) != expected {
+		t.Errorf("unexpected merged output %q", written)
+	}
+
+	// merged again, nothing changes
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ = ioutil.ReadFile(output); string(written) != expected {
+		t.Errorf("unexpected output merged twice %q", written)
+	}
+
+	// the key has to be a column of the output
+	options.AppendKey = []string{"missing"}
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected an unknown key column to fail the download")
+	}
+}
+
+func TestSQLiteUpsert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "dataset.db")
+	header := []string{"id", "url"}
+
+	output, err := newSQLiteOutput(location, tableOptions{Table: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows(header, [][]string{{"1", "http://example.com/a"}, {"2", "http://example.com/b"}}); err != nil {
+		t.Fatal(err)
+	}
+	output.Close()
+
+	// the table exists, the rows are upserted by url
+	if output, err = newSQLiteOutput(location, tableOptions{Table: "pages", Key: []string{"url"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows(header, [][]string{{"5", "http://example.com/b"}, {"6", "http://example.com/c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count, sum int
+	if err = db.QueryRow(`SELECT COUNT(*), SUM(id) FROM pages`).Scan(&count, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || sum != 1+5+6 {
+		t.Errorf("expected the rows a, b (5) and c, got %d rows summing to %d", count, sum)
+	}
+}
@@ -0,0 +1,117 @@
+package downloader
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsNamespace the prefix of the names of the Prometheus metrics
+const MetricsNamespace = "audisto_downloader"
+
+// Metrics the Prometheus metrics of the downloads it's set on, see SetMetrics(), e.g. for a long-running
+// process downloading on a schedule. It's safe for concurrent use, a nil *Metrics records nothing.
+type Metrics struct {
+	registry   *prometheus.Registry
+	chunks     *prometheus.CounterVec // chunks downloaded and written, by mode
+	rows       *prometheus.CounterVec // rows written, by mode
+	bytes      *prometheus.CounterVec // bytes downloaded, by mode
+	retries    prometheus.Counter     // requests retried
+	throughput *prometheus.GaugeVec   // bytes per second of the last chunks downloaded, by mode
+	lastChunk  prometheus.Gauge       // unix time of the last chunk written, to alert on stalls
+	running    prometheus.Gauge       // downloads running
+	downloads  *prometheus.CounterVec // downloads finished, by status
+}
+
+// NewMetrics makes the metrics of the downloads, registered along with the Go runtime and process metrics
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		chunks: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: MetricsNamespace,
+			Name: "chunks_downloaded_total", Help: "Chunks downloaded and written."}, []string{"mode"}),
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: MetricsNamespace,
+			Name: "rows_written_total", Help: "Rows written to the outputs."}, []string{"mode"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: MetricsNamespace,
+			Name: "downloaded_bytes_total", Help: "Bytes downloaded from the API, before decompression."}, []string{"mode"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{Namespace: MetricsNamespace,
+			Name: "retries_total", Help: "Requests retried after a network error or a transient response."}),
+		throughput: prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: MetricsNamespace,
+			Name: "throughput_bytes_per_second", Help: "Download throughput of the last chunks."}, []string{"mode"}),
+		lastChunk: prometheus.NewGauge(prometheus.GaugeOpts{Namespace: MetricsNamespace,
+			Name: "last_chunk_timestamp_seconds", Help: "Unix time of the last chunk written."}),
+		running: prometheus.NewGauge(prometheus.GaugeOpts{Namespace: MetricsNamespace,
+			Name: "downloads_running", Help: "Downloads running."}),
+		downloads: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: MetricsNamespace,
+			Name: "downloads_total", Help: "Downloads finished, by status: completed, failed or stopped."}, []string{"status"}),
+	}
+	m.registry.MustRegister(m.chunks, m.rows, m.bytes, m.retries, m.throughput, m.lastChunk, m.running, m.downloads,
+		prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format, e.g. on /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SetMetrics records the progress of the download in the given metrics, nil for none.
+// It has to be called before Setup()
+func (d *Downloader) SetMetrics(metrics *Metrics) {
+	d.metrics = metrics
+}
+
+// chunkWritten records a chunk downloaded and written
+func (m *Metrics) chunkWritten(mode string, bytes int, rows int) {
+	if m == nil {
+		return
+	}
+	m.chunks.WithLabelValues(mode).Inc()
+	m.bytes.WithLabelValues(mode).Add(float64(bytes))
+	m.rows.WithLabelValues(mode).Add(float64(rows))
+	m.lastChunk.Set(float64(time.Now().Unix()))
+}
+
+// chunksFetched records the throughput of chunks requested in parallel
+func (m *Metrics) chunksFetched(mode string, chunks []fetchedChunk, elapsed time.Duration) {
+	if m == nil || len(chunks) == 0 || elapsed <= 0 {
+		return
+	}
+	bytes := 0
+	for _, chunk := range chunks {
+		bytes += chunk.received()
+	}
+	m.throughput.WithLabelValues(mode).Set(float64(bytes) / elapsed.Seconds())
+}
+
+// retry records a request retried
+func (m *Metrics) retry() {
+	if m == nil {
+		return
+	}
+	m.retries.Inc()
+}
+
+// started records a download started, finished records it finished
+func (m *Metrics) started() {
+	if m == nil {
+		return
+	}
+	m.running.Inc()
+}
+
+func (m *Metrics) finished(err error) {
+	if m == nil {
+		return
+	}
+	m.running.Dec()
+	switch err {
+	case nil:
+		m.downloads.WithLabelValues(CompletedEvent).Inc()
+	case ErrStopped:
+		m.downloads.WithLabelValues("stopped").Inc()
+	default:
+		m.downloads.WithLabelValues(FailedEvent).Inc()
+	}
+}
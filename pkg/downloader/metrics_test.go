@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	metrics := NewMetrics()
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages",
+		Output: filepath.Join(dir, "crawl.tsv"), Where: "id == 2", Metrics: metrics}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`audisto_downloader_chunks_downloaded_total{mode="pages"} 1`,
+		`audisto_downloader_rows_written_total{mode="pages"} 1`,
+		`audisto_downloader_downloaded_bytes_total{mode="pages"} 53`,
+		`audisto_downloader_downloads_total{status="completed"} 1`,
+		`audisto_downloader_downloads_running 0`,
+		`audisto_downloader_throughput_bytes_per_second{mode="pages"}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %s in the metrics:\n%s", expected, body)
+		}
+	}
+}
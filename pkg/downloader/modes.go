@@ -0,0 +1,143 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// AllModes the mode downloading every mode in a single run, into separate output files
+	AllModes = "all"
+	// HintsMode the mode exporting the hints of a crawl: a row for every check failed by a page
+	HintsMode = "hints"
+)
+
+// Modes the modes AllModes downloads, in order
+var Modes = []string{"pages", "links"}
+
+// ExportModes the modes a download can export, AllModes downloading the Modes only
+var ExportModes = []string{"pages", "links", HintsMode}
+
+// IsExportMode checks if the mode is one of the ExportModes
+func IsExportMode(mode string) bool {
+	for _, m := range ExportModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// suffixedLocations the registry of the functions appending a suffix (e.g. the mode) to database outputs,
+// by URL scheme, where the suffix is appended to the table name instead of the file name
+var suffixedLocations = map[string]func(location string, suffix string) string{}
+
+// DatedOutputFormat the format of the date appended to the output of scheduled downloads
+const DatedOutputFormat = "20060102_1504"
+
+// DatePlaceholderFormat the format of the date replacing DatePlaceholder
+const DatePlaceholderFormat = "2006-01-02"
+
+const (
+	// CrawlIDPlaceholder the placeholder of an output template replaced with the crawl ID, see ExpandOutput
+	CrawlIDPlaceholder = "{crawl_id}"
+	// ModePlaceholder the placeholder of an output template replaced with the mode
+	ModePlaceholder = "{mode}"
+	// DatePlaceholder the placeholder of an output template replaced with the date of the download
+	DatePlaceholder = "{date}"
+	// DomainPlaceholder the placeholder of an output template replaced with the domain of the crawl
+	DomainPlaceholder = "{domain}"
+	// ProfilePlaceholder the placeholder of an output template replaced with the config profile of the download
+	ProfilePlaceholder = "{profile}"
+)
+
+// OutputPlaceholders the placeholders of the output templates
+var OutputPlaceholders = []string{DatePlaceholder, CrawlIDPlaceholder, ModePlaceholder, DomainPlaceholder, ProfilePlaceholder}
+
+// unsafeFilenameChars the characters of a placeholder value replaced, so the value stays within a file name
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// outputPlaceholderPattern matches anything looking like a placeholder, known or not
+var outputPlaceholderPattern = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// ValidateOutputTemplate refuses the unknown placeholders of an output template
+func ValidateOutputTemplate(template string) error {
+	for _, placeholder := range outputPlaceholderPattern.FindAllString(template, -1) {
+		known := false
+		for _, p := range OutputPlaceholders {
+			known = known || p == placeholder
+		}
+		if !known {
+			return fmt.Errorf("unknown placeholder %s in the output, the placeholders are: %s", placeholder, strings.Join(OutputPlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+// HasPlaceholder checks if the output template has the placeholder, e.g. ModePlaceholder
+func HasPlaceholder(template string, placeholder string) bool {
+	return strings.Contains(template, placeholder)
+}
+
+// ExpandOutput replaces the placeholders of the output template with their values, by placeholder,
+// e.g. export_{crawl_id}_{mode}.tsv -> export_12345_pages.tsv. Placeholders without a value are kept.
+// The characters of the values that don't belong in a file name, e.g. the / of a domain, are replaced with _.
+func ExpandOutput(template string, values map[string]string) string {
+	for placeholder, value := range values {
+		template = strings.Replace(template, placeholder, unsafeFilenameChars.ReplaceAllString(value, "_"), -1)
+	}
+	return template
+}
+
+// DomainValue returns the domain of a crawl as it replaces DomainPlaceholder, without the scheme and
+// the trailing slash of a start URL, e.g. https://www.example.com/ -> www.example.com
+func DomainValue(domain string) string {
+	domain = strings.TrimSpace(domain)
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	return strings.Trim(domain, "/")
+}
+
+// ModeOutputFilename returns the output of a given mode when downloading all modes,
+// the mode being appended to the output name, e.g. crawl.tsv.gz -> crawl_pages.tsv.gz.
+// For database outputs, the mode is appended to the table name, which otherwise defaults to the mode.
+func ModeOutputFilename(output string, mode string, compression string) string {
+	return suffixedOutput(output, mode, compression)
+}
+
+// DatedOutputFilename returns the output of a scheduled download started at the given time,
+// the date being appended to the output name, e.g. crawl.tsv -> crawl_20181014_0300.tsv
+func DatedOutputFilename(output string, at time.Time, compression string) string {
+	return suffixedOutput(output, at.Format(DatedOutputFormat), compression)
+}
+
+// suffixedOutput appends "_" and the suffix to the output name, or to the table name of database outputs
+func suffixedOutput(output string, suffix string, compression string) string {
+	output = strings.TrimSpace(output)
+	if suffixed, ok := suffixedLocations[tableLocationScheme(output)]; ok {
+		return suffixed(output, suffix)
+	}
+	return suffixedFilename(output, "_"+suffix, compression) + compressionExtension(compression)
+}
+
+// IsDownloadCompleted checks if a previous download to the given output is completed.
+// Completed downloads can't be resumed, they have to be started again with no-resume.
+func IsDownloadCompleted(output string) bool {
+	// split and partitioned outputs have no file of their own, but their parts
+	if DownloadCompleted(output, output+resumerSuffix) || DownloadCompleted(PartFilename(output, 1), output+resumerSuffix) {
+		return true
+	}
+	return fExists(output+resumerSuffix) != nil && partitionedOutputExists(output)
+}
+
+// suffixedFilename appends a suffix to a filename, before its extension.
+// The compression extension is dropped, e.g. crawl.tsv.gz -> crawl_links.tsv
+func suffixedFilename(filename string, suffix string, compression string) string {
+	filename = strings.TrimSuffix(filename, compressionExtension(compression))
+	ext := path.Ext(filename)
+	return filename[0:len(filename)-len(ext)] + suffix + ext
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatedOutputFilename(t *testing.T) {
+	at := time.Date(2018, 10, 14, 3, 0, 0, 0, time.UTC)
+	if name := DatedOutputFilename("crawl.tsv.gz", at, GzipCompression); name != "crawl_20181014_0300.tsv.gz" {
+		t.Errorf("expected the date before the extension, got %q", name)
+	}
+	if name := DatedOutputFilename("postgres://localhost/crawls?table=pages", at, ""); name != "postgres://localhost/crawls?table=pages_20181014_0300" {
+		t.Errorf("expected the date after the table name, got %q", name)
+	}
+}
+
+func TestExpandOutput(t *testing.T) {
+	values := map[string]string{CrawlIDPlaceholder: "12345", ModePlaceholder: "links"}
+	if name := ExpandOutput("exports/{crawl_id}/export_{crawl_id}_{mode}.tsv", values); name != "exports/12345/export_12345_links.tsv" {
+		t.Errorf("unexpected output %q", name)
+	}
+	if err := ValidateOutputTemplate("export_{crawl_id}_{mode}.tsv"); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateOutputTemplate("export_{crawl}.tsv"); err == nil {
+		t.Error("an unknown placeholder should be refused")
+	}
+
+	// the values stay within the file name
+	values = map[string]string{DomainPlaceholder: DomainValue("https://www.example.com/blog/"), DatePlaceholder: "2018-10-14"}
+	if name := ExpandOutput("{domain}_{date}.tsv", values); name != "www.example.com_blog_2018-10-14.tsv" {
+		t.Errorf("unexpected output %q", name)
+	}
+}
+
+func TestModeOutputFilename(t *testing.T) {
+	for _, c := range []struct{ output, compression, expected string }{
+		{"crawl.tsv", "", "crawl_pages.tsv"},
+		{"crawl.tsv", GzipCompression, "crawl_pages.tsv.gz"},
+		{"crawl.tsv.gz", GzipCompression, "crawl_pages.tsv.gz"},
+		{"s3://bucket/crawl.csv", "", "s3://bucket/crawl_pages.csv"},
+		{"crawl", "", "crawl_pages"},
+		{"postgres://localhost/crawls?table=crawl", "", "postgres://localhost/crawls?table=crawl_pages"},
+		{"postgres://localhost/crawls", "", "postgres://localhost/crawls"},
+	} {
+		if name := ModeOutputFilename(c.output, "pages", c.compression); name != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.output, c.expected, name)
+		}
+	}
+}
+
+func TestRunHints(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/12345/hints") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":1,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\tpage\turl\thint\tseverity\n1\t7\thttp://example.com/a\tduplicate_title\twarning\n"))
+	})()
+	dir, err := ioutil.TempDir("", "hints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "hints.tsv")
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: HintsMode, Output: output,
+		Filter: "severity:warning", Columns: []string{"url", "hint"}})
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "url\thint\nhttp://example.com/a\tduplicate_title\n" {
+		t.Errorf("unexpected output %q", written)
+	}
+}
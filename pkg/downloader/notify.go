@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// NotifyTimeout the time a notification has to be delivered within
+	NotifyTimeout = 10 * time.Second
+
+	// FailedEvent the event of a failed download, completed downloads being CompletedEvent
+	FailedEvent = "failed"
+)
+
+// Notification the summary of a finished download, sent to the notifiers
+type Notification struct {
+	Event           string  `json:"event"`
+	CrawlID         uint64  `json:"crawlID"`
+	Mode            string  `json:"mode"`
+	Rows            uint64  `json:"rows"`
+	Duration        string  `json:"duration"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Output          string  `json:"output"`
+	Link            string  `json:"link,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	// Text a one line summary, the message shown by Slack incoming webhooks
+	Text string `json:"text"`
+}
+
+// Notifier delivers the notification of a finished download
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// AddNotifier adds a notifier, notified once the download completes or fails.
+// A failed notification is logged, it doesn't fail the download.
+// It has to be called before Setup()
+func (d *Downloader) AddNotifier(notifier Notifier) {
+	d.notifiers = append(d.notifiers, notifier)
+}
+
+// SetNotifyWebhook POSTs the notification as JSON to the given URL once the download completes or fails.
+// It has to be called before Setup()
+func (d *Downloader) SetNotifyWebhook(webhook string) error {
+	notifier, err := NewWebhookNotifier(webhook)
+	if err != nil {
+		return err
+	}
+	d.AddNotifier(notifier)
+	return nil
+}
+
+// notify sends the notification of the finished download to every notifier
+func (d *Downloader) notify(downloadErr error, duration time.Duration) {
+	if len(d.notifiers) == 0 {
+		return
+	}
+
+	notification := Notification{
+		Event:           CompletedEvent,
+		CrawlID:         d.client.CrawlID,
+		Mode:            d.client.Mode,
+		Rows:            d.DoneElements,
+		Duration:        duration.Round(time.Second).String(),
+		DurationSeconds: duration.Seconds(),
+		Output:          RedactOutput(d.origOutputFilename),
+		Link:            outputLink(d.origOutputFilename),
+	}
+	notification.Text = fmt.Sprintf("Crawl %d %s: %d rows downloaded to %s in %s",
+		notification.CrawlID, notification.Mode, notification.Rows, notification.Output, notification.Duration)
+	if downloadErr != nil {
+		notification.Event = FailedEvent
+		notification.Error = downloadErr.Error()
+		notification.Text = fmt.Sprintf("Crawl %d %s: download to %s failed after %d rows: %s",
+			notification.CrawlID, notification.Mode, notification.Output, notification.Rows, notification.Error)
+	}
+
+	for _, notifier := range d.notifiers {
+		if err := notifier.Notify(notification); err != nil {
+			d.log().WithFields(logrus.Fields{"event": notification.Event}).Errorf("notification failed: %v", err)
+		}
+	}
+}
+
+// outputLink returns a link to the output: its page in the AWS or Google Cloud console for S3, GCS and BigQuery
+// outputs, the URL of the blob for Azure Blob outputs, a file:// URL for local files. There's no link to database outputs.
+func outputLink(location string) string {
+	if location == "" {
+		return ""
+	}
+	scheme := ""
+	if i := strings.Index(location, "://"); i > 0 {
+		scheme = strings.ToLower(location[:i])
+	}
+	switch scheme {
+	case "":
+		if path, err := filepath.Abs(location); err == nil {
+			return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+		}
+	case "s3":
+		if u, err := url.Parse(location); err == nil {
+			return fmt.Sprintf("https://s3.console.aws.amazon.com/s3/object/%s?prefix=%s", u.Host, url.QueryEscape(strings.TrimPrefix(u.Path, "/")))
+		}
+	case "gs":
+		if u, err := url.Parse(location); err == nil {
+			return fmt.Sprintf("https://console.cloud.google.com/storage/browser/_details/%s%s", u.Host, u.EscapedPath())
+		}
+	case "azblob":
+		if u, err := url.Parse(location); err == nil {
+			if blobURL, err := azureBlobURL(u); err == nil {
+				return blobURL
+			}
+		}
+	case "bq":
+		if parsed, err := parseBigQueryLocation(location); err == nil {
+			return fmt.Sprintf("https://console.cloud.google.com/bigquery?project=%s&p=%s&d=%s&t=%s&page=table",
+				parsed.project, parsed.project, parsed.dataset, parsed.table)
+		}
+	}
+	return ""
+}
+
+// WebhookNotifier POSTs the notifications as JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier POSTing to the given http(s) URL
+func NewWebhookNotifier(webhook string) (*WebhookNotifier, error) {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook %q: expected an http(s) URL", webhook)
+	}
+	return &WebhookNotifier{URL: webhook, client: &http.Client{Timeout: NotifyTimeout}}, nil
+}
+
+// Notify POSTs the notification, any non 2xx response is an error
+func (n *WebhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	response, err := n.client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %v", RedactOutput(n.URL), err)
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: unexpected status %s", RedactOutput(n.URL), response.Status)
+	}
+	return nil
+}
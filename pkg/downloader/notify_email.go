@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSMTPPort the submission port, upgraded to TLS with STARTTLS
+	DefaultSMTPPort = 587
+	// smtpsPort the port of SMTP over implicit TLS
+	smtpsPort = 465
+)
+
+// SMTPSettings the SMTP server notification emails are sent through
+type SMTPSettings struct {
+	Host     string
+	Port     int // DefaultSMTPPort if 0
+	Username string
+	Password string
+	From     string // defaults to Username
+}
+
+// EmailNotifier mails a summary of the download to the recipients
+type EmailNotifier struct {
+	SMTP SMTPSettings
+	To   []string
+}
+
+// NewEmailNotifier returns a notifier mailing the given recipients through the SMTP server
+func NewEmailNotifier(settings SMTPSettings, to []string) (*EmailNotifier, error) {
+	if settings.Host == "" {
+		return nil, fmt.Errorf("an SMTP host is required to send notification emails")
+	}
+	if settings.Port == 0 {
+		settings.Port = DefaultSMTPPort
+	}
+	if settings.From == "" {
+		settings.From = settings.Username
+	}
+	if _, err := mail.ParseAddress(settings.From); err != nil {
+		return nil, fmt.Errorf("invalid email sender %q: %v", settings.From, err)
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no email recipient")
+	}
+	for _, recipient := range to {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			return nil, fmt.Errorf("invalid email recipient %q: %v", recipient, err)
+		}
+	}
+	return &EmailNotifier{SMTP: settings, To: to}, nil
+}
+
+// SetNotifyEmail mails a summary of the download to the recipients once it completes or fails.
+// It has to be called before Setup()
+func (d *Downloader) SetNotifyEmail(settings SMTPSettings, to []string) error {
+	notifier, err := NewEmailNotifier(settings, to)
+	if err != nil {
+		return err
+	}
+	d.AddNotifier(notifier)
+	return nil
+}
+
+// Notify sends the email. Port 465 is SMTP over TLS, other ports are upgraded with STARTTLS when the
+// server supports it; credentials are never sent without TLS, but to a local server.
+func (n *EmailNotifier) Notify(notification Notification) error {
+	address := net.JoinHostPort(n.SMTP.Host, strconv.Itoa(n.SMTP.Port))
+	conn, err := net.DialTimeout("tcp", address, NotifyTimeout)
+	if err != nil {
+		return fmt.Errorf("SMTP %s: %v", address, err)
+	}
+	if n.SMTP.Port == smtpsPort {
+		conn = tls.Client(conn, &tls.Config{ServerName: n.SMTP.Host})
+	}
+	conn.SetDeadline(time.Now().Add(NotifyTimeout))
+
+	client, err := smtp.NewClient(conn, n.SMTP.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP %s: %v", address, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && n.SMTP.Port != smtpsPort {
+		if err = client.StartTLS(&tls.Config{ServerName: n.SMTP.Host}); err != nil {
+			return fmt.Errorf("SMTP %s: %v", address, err)
+		}
+	}
+	if n.SMTP.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", n.SMTP.Username, n.SMTP.Password, n.SMTP.Host)); err != nil {
+			return fmt.Errorf("SMTP %s: %v", address, err)
+		}
+	}
+
+	if err = client.Mail(n.SMTP.From); err != nil {
+		return fmt.Errorf("SMTP %s: %v", address, err)
+	}
+	for _, recipient := range n.To {
+		if err = client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP %s: %v", address, err)
+		}
+	}
+	writer, err := client.Data()
+	if err == nil {
+		_, err = writer.Write(n.message(notification))
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("SMTP %s: %v", address, err)
+	}
+	return client.Quit()
+}
+
+// message returns the email of the notification, headers included
+func (n *EmailNotifier) message(notification Notification) []byte {
+	subject := fmt.Sprintf("Audisto download of crawl %d (%s) completed", notification.CrawlID, notification.Mode)
+	if notification.Event == FailedEvent {
+		subject = fmt.Sprintf("Audisto download of crawl %d (%s) failed", notification.CrawlID, notification.Mode)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.SMTP.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&message, "Crawl:     %d\r\n", notification.CrawlID)
+	fmt.Fprintf(&message, "Mode:      %s\r\n", notification.Mode)
+	fmt.Fprintf(&message, "Rows:      %d\r\n", notification.Rows)
+	fmt.Fprintf(&message, "Duration:  %s\r\n", notification.Duration)
+	fmt.Fprintf(&message, "Output:    %s\r\n", notification.Output)
+	if notification.Link != "" {
+		fmt.Fprintf(&message, "Link:      %s\r\n", notification.Link)
+	}
+	if notification.Error != "" {
+		fmt.Fprintf(&message, "\r\nThe download failed: %s\r\n", notification.Error)
+	}
+	return message.Bytes()
+}
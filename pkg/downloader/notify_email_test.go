@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveSMTP answers a single SMTP session, sending the received commands and message to the channel
+func serveSMTP(t *testing.T, listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	var session strings.Builder
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte("220 localhost ESMTP\r\n"))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		session.WriteString(line)
+		command := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch command {
+		case "EHLO":
+			conn.Write([]byte("250-localhost\r\n250 AUTH PLAIN\r\n"))
+		case "AUTH":
+			conn.Write([]byte("235 2.7.0 Authentication successful\r\n"))
+		case "DATA":
+			conn.Write([]byte("354 End data with <CR><LF>.<CR><LF>\r\n"))
+			for line != ".\r\n" {
+				if line, err = reader.ReadString('\n'); err != nil {
+					break
+				}
+				session.WriteString(line)
+			}
+			conn.Write([]byte("250 OK\r\n"))
+		case "QUIT":
+			conn.Write([]byte("221 Bye\r\n"))
+			received <- session.String()
+			return
+		default:
+			conn.Write([]byte("250 OK\r\n"))
+		}
+	}
+	received <- session.String()
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	notifier, err := NewEmailNotifier(SMTPSettings{Host: "smtp.example.com", Username: "exports@example.com"}, []string{"seo@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifier.SMTP.Port != DefaultSMTPPort || notifier.SMTP.From != "exports@example.com" {
+		t.Errorf("unexpected defaults %+v", notifier.SMTP)
+	}
+
+	invalid := map[string]struct {
+		settings SMTPSettings
+		to       []string
+	}{
+		"no host":           {SMTPSettings{From: "exports@example.com"}, []string{"seo@example.com"}},
+		"no sender":         {SMTPSettings{Host: "smtp.example.com"}, []string{"seo@example.com"}},
+		"no recipient":      {SMTPSettings{Host: "smtp.example.com", From: "exports@example.com"}, nil},
+		"invalid recipient": {SMTPSettings{Host: "smtp.example.com", From: "exports@example.com"}, []string{"seo"}},
+	}
+	for name, c := range invalid {
+		if _, err := NewEmailNotifier(c.settings, c.to); err == nil {
+			t.Errorf("%s should be refused", name)
+		}
+	}
+}
+
+func TestEmailNotify(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go serveSMTP(t, listener, received)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	notifier, err := NewEmailNotifier(SMTPSettings{Host: "127.0.0.1", Port: port, Username: "exports@example.com", Password: "secret"},
+		[]string{"seo@example.com", "marketing@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = notifier.Notify(Notification{Event: FailedEvent, CrawlID: 123, Mode: "pages", Rows: 42, Duration: "5s",
+		Output: "s3://bucket/crawl.tsv", Link: "https://s3.console.aws.amazon.com/s3/object/bucket?prefix=crawl.tsv", Error: "API unreachable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := <-received
+	for _, expected := range []string{
+		"AUTH PLAIN",
+		"MAIL FROM:<exports@example.com>",
+		"RCPT TO:<seo@example.com>",
+		"RCPT TO:<marketing@example.com>",
+		"Subject: Audisto download of crawl 123 (pages) failed",
+		"Rows:      42",
+		"Link:      https://s3.console.aws.amazon.com/s3/object/bucket?prefix=crawl.tsv",
+		"The download failed: API unreachable",
+	} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("the SMTP session should contain %q:\n%s", expected, session)
+		}
+	}
+}
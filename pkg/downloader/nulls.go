@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NullAsPostgres the representation of the nulls of the text COPY of PostgreSQL
+const NullAsPostgres = `\N`
+
+// columnKinds the kinds of the values of the exported columns, the columns of the enriched links included,
+// by column name: "integer", "number", "string" or "bool"
+var columnKinds = func() map[string]string {
+	kinds := map[string]string{}
+	for _, mode := range ExportModes {
+		columns, _ := Schema(mode, true)
+		for _, column := range columns {
+			kinds[column.Name] = column.Type
+		}
+	}
+	return kinds
+}()
+
+// isNullableColumn checks if the empty values of a column are nulls: the values of number and bool columns.
+// An empty value of a string column is an empty string, e.g. a page without title.
+func isNullableColumn(column string) bool {
+	kind := columnKinds[column]
+	return kind == "integer" || kind == "number" || kind == "bool"
+}
+
+// SetNullAs writes the empty values of the number and bool columns as nulls: nullAs in tsv and csv outputs,
+// e.g. \N for the COPY of PostgreSQL or NULL, null in json outputs. Table outputs store them as NULL already.
+// It has to be called before Setup()
+func (d *Downloader) SetNullAs(nullAs string) {
+	d.nulls = true
+	d.nullAs = nullAs
+}
+
+// checkNullAs checks the representation of the nulls can't be mistaken for the end of a field
+func (d *Downloader) checkNullAs() error {
+	if !d.nulls {
+		return nil
+	}
+	if strings.ContainsAny(d.nullAs, "\r\n") || (normalizeOutputFormat(d.OutputFormat) == TSVOutputFormat && strings.Contains(d.nullAs, "\t")) {
+		return fmt.Errorf("the representation of the nulls can't contain a tab or a line break: %q", d.nullAs)
+	}
+	return nil
+}
+
+// nullColumns returns which columns of the header are nullable, nil unless the options write nulls
+func (o FormatOptions) nullColumns(header []string) []bool {
+	if !o.Nulls {
+		return nil
+	}
+	nullable := make([]bool, len(header))
+	for i, column := range header {
+		nullable[i] = isNullableColumn(column)
+	}
+	return nullable
+}
+
+// withNulls returns the fields with their empty nullable values replaced with nullAs, a copy if any is replaced
+func withNulls(fields []string, nullable []bool, nullAs string) []string {
+	if nullable == nil || nullAs == "" {
+		return fields
+	}
+	replaced := fields
+	copied := false
+	for i, field := range fields {
+		if field != "" || i >= len(nullable) || !nullable[i] {
+			continue
+		}
+		// the fields of the row may still be used, e.g. by the partitions
+		if !copied {
+			replaced, copied = append([]string(nil), fields...), true
+		}
+		replaced[i] = nullAs
+	}
+	return replaced
+}
+
+// withoutNulls returns the fields of a row read back from an output with the nulls written empty again,
+// in place, so they match the values of the API
+func withoutNulls(fields []string, nullable []bool, nullAs string) []string {
+	if nullable == nil || nullAs == "" {
+		return fields
+	}
+	for i, field := range fields {
+		if i < len(nullable) && nullable[i] && field == nullAs {
+			fields[i] = ""
+		}
+	}
+	return fields
+}
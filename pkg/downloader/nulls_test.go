@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNullAs(t *testing.T) {
+	header := []string{"id", "title", "response_ms", "indexable"}
+	row := []string{"1", "", "", ""}
+	options := FormatOptions{Nulls: true, NullAs: NullAsPostgres}
+
+	expected := map[string]string{
+		TSVOutputFormat:  "1\t\t\\N\t\\N\n",
+		CSVOutputFormat:  "1,,\\N,\\N\n",
+		JSONOutputFormat: `{"id":"1","title":"","response_ms":null,"indexable":null}` + "\n",
+	}
+	for format, written := range expected {
+		var buf bytes.Buffer
+		writer, err := newRowWriter(format, &buf, header, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+		writer.Flush()
+		if buf.String() != written {
+			t.Errorf("%s: expected %q, got %q", format, written, buf.String())
+		}
+	}
+	if !reflect.DeepEqual(row, []string{"1", "", "", ""}) {
+		t.Errorf("the row written shouldn't change, got %q", row)
+	}
+
+	// read back, the nulls are empty values again
+	read := withoutNulls([]string{"1", "", `\N`, `\N`}, options.nullColumns(header), options.NullAs)
+	if !reflect.DeepEqual(read, row) {
+		t.Errorf("expected %q, got %q", row, read)
+	}
+
+	// a number column without values is still a number column
+	types := inferColumnTypes(header, [][]string{row})
+	if expected := []columnType{integerColumn, textColumn, realColumn, textColumn}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+
+	d := &Downloader{nulls: true, nullAs: "a\tb"}
+	if err := d.checkNullAs(); err == nil {
+		t.Error("expected a tab to be rejected in the nulls of a tsv output")
+	}
+}
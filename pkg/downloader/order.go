@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Orders are validated and normalized client-side before the download starts, following the API grammar:
+//
+//	order = key { "," key }            the rows are sorted by the first key, then by the next ones
+//	key   = field [ ":" direction ]    the direction is "asc" (default) or "desc"
+//
+// e.g. "status_code:desc,url". The fields are the ones of the filters.
+
+// orderDirections the directions of an order key, the first being the default
+var orderDirections = []string{"asc", "desc"}
+
+// OrderError a precise description of what's wrong in an order, before any request is made
+type OrderError struct {
+	Order    string
+	Key      string // the faulty key
+	Position int    // the position of the faulty key, starting at 1
+	Reason   string
+}
+
+func (e *OrderError) Error() string {
+	return fmt.Sprintf("invalid order %q: key %d %q: %s", e.Order, e.Position, e.Key, e.Reason)
+}
+
+// NormalizeOrder checks an order against the API grammar and the fields of the mode ("pages" if empty),
+// and returns it as sent to the API: lowercase, without spaces nor the default direction, e.g. "depth,url:desc"
+func NormalizeOrder(mode string, order string) (string, error) {
+	order = strings.TrimSpace(order)
+	if order == "" {
+		return "", nil
+	}
+	if mode == "" {
+		mode = "pages"
+	}
+	fields, ok := filterFields[mode]
+	if !ok {
+		return "", fmt.Errorf("mode has to be 'pages', 'links' or 'hints'")
+	}
+
+	keys := strings.Split(order, ",")
+	ordered := map[string]bool{}
+	for i, key := range keys {
+		fail := func(format string, a ...interface{}) error {
+			return &OrderError{Order: order, Key: key, Position: i + 1, Reason: fmt.Sprintf(format, a...)}
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return "", fail("empty key, remove the extra ','")
+		}
+
+		parts := strings.Split(strings.ToLower(key), ":")
+		if len(parts) > 2 {
+			return "", fail("expected field or field:direction")
+		}
+		field := strings.TrimSpace(parts[0])
+		if _, ok := fields[field]; !ok {
+			if suggestion := closestField(field, fields); suggestion != "" {
+				return "", fail("unknown field %q for mode %s, did you mean %q?", field, mode, suggestion)
+			}
+			return "", fail("unknown field %q for mode %s", field, mode)
+		}
+		if ordered[field] {
+			return "", fail("%s is already ordered by", field)
+		}
+		ordered[field] = true
+
+		keys[i] = field
+		if len(parts) == 2 {
+			direction := strings.TrimSpace(parts[1])
+			if !containsString(orderDirections, direction) {
+				return "", fail("direction %q of %s has to be one of %s", direction, field, strings.Join(orderDirections, ", "))
+			}
+			if direction != orderDirections[0] {
+				keys[i] += ":" + direction
+			}
+		}
+	}
+	return strings.Join(keys, ","), nil
+}
@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOrder(t *testing.T) {
+	for order, normalized := range map[string]string{
+		"":                           "",
+		"url":                        "url",
+		"Status_Code:DESC, url:asc":  "status_code:desc,url",
+		" depth : desc ,response_ms": "depth:desc,response_ms",
+	} {
+		if got, err := NormalizeOrder("pages", order); err != nil || got != normalized {
+			t.Errorf("%q: expected %q, got %q (%v)", order, normalized, got, err)
+		}
+	}
+	if _, err := NormalizeOrder("links", "target_url:desc"); err != nil {
+		t.Errorf("target url orders should be valid for links: %v", err)
+	}
+
+	for order, reason := range map[string]string{
+		"stauts_code":      `did you mean "status_code"?`,
+		"url:up":           `direction "up" of url`,
+		"url,":             "empty key",
+		"url:desc:1":       "expected field or field:direction",
+		"depth,url,depth":  "already ordered by",
+		"anchor_text:desc": "unknown field",
+	} {
+		_, err := NormalizeOrder("pages", order)
+		if err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("%q: expected an error about %q, got %v", order, reason, err)
+		}
+	}
+}
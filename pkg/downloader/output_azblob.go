@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+)
+
+const (
+	// AzureBlockSize the size of every block staged to Azure Blob Storage.
+	// The maximum number of blocks of a blob being 50000, this allows uploads up to ~800GB
+	AzureBlockSize = 16 * 1024 * 1024
+)
+
+func init() {
+	remoteOutputs["azblob"] = newAzureBlobOutput
+}
+
+// blockStager stages the blocks of a block blob, then commits them, a *blockblob.Client
+type blockStager interface {
+	StageBlock(ctx context.Context, blockID string, body io.ReadSeekCloser, options *blockblob.StageBlockOptions) (blockblob.StageBlockResponse, error)
+	CommitBlockList(ctx context.Context, blockIDs []string, options *blockblob.CommitBlockListOptions) (blockblob.CommitBlockListResponse, error)
+}
+
+// azureBlobOutput streams the output to Azure Blob Storage as a block blob: the blocks are staged while the output
+// is written, and committed once it's completed. The storage account is read from AZURE_STORAGE_ACCOUNT,
+// credentials from AZURE_STORAGE_SAS_TOKEN, AZURE_STORAGE_KEY or else the Azure default credentials.
+type azureBlobOutput struct {
+	location  string
+	client    blockStager
+	blockSize int
+	block     []byte   // the data of the block being written
+	blocks    []string // the IDs of the blocks staged, in order
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// azureBlobURL returns the https:// URL of the blob of azblob://container/path, in the AZURE_STORAGE_ACCOUNT account
+func azureBlobURL(location *url.URL) (string, error) {
+	container, path := location.Host, strings.TrimPrefix(location.Path, "/")
+	if container == "" || path == "" {
+		return "", fmt.Errorf("invalid Azure Blob output %q: expected azblob://container/path", location)
+	}
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if account == "" {
+		return "", fmt.Errorf("the storage account of the Azure Blob output %s has to be set in AZURE_STORAGE_ACCOUNT", location)
+	}
+	blobURL := url.URL{Scheme: "https", Host: account + ".blob.core.windows.net", Path: "/" + container + "/" + path}
+	return blobURL.String(), nil
+}
+
+// newAzureBlobOutput starts a staged upload to azblob://container/path
+func newAzureBlobOutput(location *url.URL) (io.WriteCloser, error) {
+	blobURL, err := azureBlobURL(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var client *blockblob.Client
+	if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+		client, err = blockblob.NewClientWithNoCredential(blobURL+"?"+strings.TrimPrefix(sas, "?"), nil)
+	} else if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		var credential *blob.SharedKeyCredential
+		if credential, err = blob.NewSharedKeyCredential(os.Getenv("AZURE_STORAGE_ACCOUNT"), key); err == nil {
+			client, err = blockblob.NewClientWithSharedKeyCredential(blobURL, credential, nil)
+		}
+	} else {
+		var credential *azidentity.DefaultAzureCredential
+		if credential, err = azidentity.NewDefaultAzureCredential(nil); err == nil {
+			client, err = blockblob.NewClient(blobURL, credential, nil)
+		}
+	}
+	if err != nil {
+		return nil, &UploadError{Output: location.String(), Err: err}
+	}
+	return newStagedBlobOutput(location.String(), client, AzureBlockSize), nil
+}
+
+// newStagedBlobOutput returns the output staging blocks of blockSize with the client
+func newStagedBlobOutput(location string, client blockStager, blockSize int) *azureBlobOutput {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &azureBlobOutput{location: location, client: client, blockSize: blockSize,
+		block: make([]byte, 0, blockSize), ctx: ctx, cancel: cancel}
+}
+
+func (o *azureBlobOutput) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := o.blockSize - len(o.block)
+		if n > len(p)-written {
+			n = len(p) - written
+		}
+		o.block = append(o.block, p[written:written+n]...)
+		written += n
+		if len(o.block) == o.blockSize {
+			if err := o.stageBlock(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// stageBlock uploads the block being written, a failed block is retried by the client library
+func (o *azureBlobOutput) stageBlock() error {
+	// the IDs of the blocks of a blob all have the same length
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%06d", len(o.blocks))))
+	if _, err := o.client.StageBlock(o.ctx, id, streaming.NopCloser(bytes.NewReader(o.block)), nil); err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	o.blocks = append(o.blocks, id)
+	o.block = o.block[:0]
+	return nil
+}
+
+// Close stages the last block and commits the blocks, the blob is only visible once they're committed
+func (o *azureBlobOutput) Close() error {
+	defer o.cancel()
+	if len(o.block) > 0 {
+		if err := o.stageBlock(); err != nil {
+			return err
+		}
+	}
+	if _, err := o.client.CommitBlockList(o.ctx, o.blocks, nil); err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	return nil
+}
+
+// Abort cancels the upload without committing the blocks, Azure discards the uncommitted blocks after a week
+func (o *azureBlobOutput) Abort(err error) error {
+	o.cancel()
+	return nil
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+)
+
+// recordedBlobStager records the blocks staged and committed
+type recordedBlobStager struct {
+	staged    map[string][]byte
+	committed []string
+}
+
+func (s *recordedBlobStager) StageBlock(ctx context.Context, blockID string, body io.ReadSeekCloser, options *blockblob.StageBlockOptions) (blockblob.StageBlockResponse, error) {
+	data, err := ioutil.ReadAll(body)
+	s.staged[blockID] = data
+	return blockblob.StageBlockResponse{}, err
+}
+
+func (s *recordedBlobStager) CommitBlockList(ctx context.Context, blockIDs []string, options *blockblob.CommitBlockListOptions) (blockblob.CommitBlockListResponse, error) {
+	s.committed = blockIDs
+	return blockblob.CommitBlockListResponse{}, nil
+}
+
+func TestAzureBlobOutput(t *testing.T) {
+	stager := &recordedBlobStager{staged: map[string][]byte{}}
+	output := newStagedBlobOutput("azblob://exports/crawl.tsv", stager, 4)
+	for _, data := range []string{"id\turl\n", "1\thttp://example.com/\n"} {
+		if _, err := output.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stager.committed != nil {
+		t.Fatal("the blocks shouldn't be committed before the output is closed")
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stager.committed) != 8 {
+		t.Fatalf("expected 8 blocks to be committed, got %d", len(stager.committed))
+	}
+	var blob []byte
+	for _, id := range stager.committed {
+		if len(id) != len(stager.committed[0]) {
+			t.Errorf("the block IDs should have the same length, got %q and %q", id, stager.committed[0])
+		}
+		blob = append(blob, stager.staged[id]...)
+	}
+	if string(blob) != "id\turl\n1\thttp://example.com/\n" {
+		t.Errorf("unexpected blob %q", blob)
+	}
+}
+
+func TestAzureBlobURL(t *testing.T) {
+	defer os.Setenv("AZURE_STORAGE_ACCOUNT", os.Getenv("AZURE_STORAGE_ACCOUNT"))
+	os.Setenv("AZURE_STORAGE_ACCOUNT", "audisto")
+
+	location, _ := url.Parse("azblob://exports/crawls/crawl 1.tsv")
+	blobURL, err := azureBlobURL(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobURL != "https://audisto.blob.core.windows.net/exports/crawls/crawl%201.tsv" {
+		t.Errorf("unexpected blob URL %s", blobURL)
+	}
+
+	location, _ = url.Parse("azblob://exports")
+	if _, err = azureBlobURL(location); err == nil {
+		t.Error("expected an error for an output without a path")
+	}
+	os.Setenv("AZURE_STORAGE_ACCOUNT", "")
+	location, _ = url.Parse("azblob://exports/crawl.tsv")
+	if _, err = azureBlobURL(location); err == nil {
+		t.Error("expected an error without a storage account")
+	}
+}
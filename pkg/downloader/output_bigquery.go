@@ -0,0 +1,294 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// BigQueryInsertBatchSize the number of rows of every streaming insert request
+	BigQueryInsertBatchSize = 500
+)
+
+func init() {
+	tableLocations["bq"] = newBigQueryOutput
+	suffixedLocations["bq"] = suffixedBigQueryLocation
+}
+
+// bigQueryTypes the BigQuery types of the inferred column types, for auto-created tables
+var bigQueryTypes = map[columnType]bigquery.FieldType{
+	textColumn:    bigquery.StringFieldType,
+	integerColumn: bigquery.IntegerFieldType,
+	realColumn:    bigquery.FloatFieldType,
+	boolColumn:    bigquery.BooleanFieldType,
+}
+
+// bigQueryLocation the table of a bq://project.dataset.table output, and its GCS staging URI if any
+type bigQueryLocation struct {
+	project string
+	dataset string
+	table   string
+	staging string
+}
+
+// parseBigQueryLocation parses a bq://project.dataset.table[?staging=gs://bucket/prefix] output.
+// The project may contain dots (domain-scoped projects), dataset and table are the last two parts.
+func parseBigQueryLocation(location string) (bigQueryLocation, error) {
+	invalid := fmt.Errorf("invalid BigQuery output %q: expected bq://project.dataset.table", location)
+
+	i := strings.Index(location, "://")
+	if i < 0 {
+		return bigQueryLocation{}, invalid
+	}
+	path, rawQuery := location[i+3:], ""
+	if j := strings.Index(path, "?"); j >= 0 {
+		path, rawQuery = path[:j], path[j+1:]
+	}
+
+	parts := strings.Split(path, ".")
+	if len(parts) < 3 {
+		return bigQueryLocation{}, invalid
+	}
+	n := len(parts)
+	parsed := bigQueryLocation{project: strings.Join(parts[:n-2], "."), dataset: parts[n-2], table: parts[n-1]}
+	if parsed.project == "" || parsed.dataset == "" || parsed.table == "" {
+		return bigQueryLocation{}, invalid
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return bigQueryLocation{}, fmt.Errorf("invalid BigQuery output %q: %v", location, err)
+	}
+	if parsed.staging = query.Get("staging"); parsed.staging != "" && !strings.HasPrefix(parsed.staging, "gs://") {
+		return bigQueryLocation{}, fmt.Errorf("invalid BigQuery output %q: staging has to be a gs://bucket/prefix URI", location)
+	}
+	return parsed, nil
+}
+
+// suffixedBigQueryLocation appends the suffix to the table of the output
+func suffixedBigQueryLocation(location string, suffix string) string {
+	if i := strings.Index(location, "?"); i >= 0 {
+		return location[:i] + "_" + suffix + location[i:]
+	}
+	return location + "_" + suffix
+}
+
+// bigQueryOutput loads the rows into a BigQuery table, either with streaming inserts (default) or by
+// staging them to GCS as newline-delimited JSON, loaded by a single load job once the download completes.
+// The table is created if it doesn't exist yet, an existing table is appended to.
+// Credentials are read from GOOGLE_APPLICATION_CREDENTIALS or the gcloud default credentials.
+type bigQueryOutput struct {
+	location bigQueryLocation
+	replace  bool
+	kinds    map[string]string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	client   *bigquery.Client
+	table    *bigquery.Table
+	columns  []string
+	schema   bigquery.Schema
+	types    []columnType
+	// staged the object the rows are staged to, when loaded by a load job
+	staged        string
+	stagingWriter io.WriteCloser
+	stagingJSON   *json.Encoder
+}
+
+// newBigQueryOutput connects to the BigQuery project of the output
+func newBigQueryOutput(location string, options tableOptions) (tableOutput, error) {
+	parsed, err := parseBigQueryLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := bigquery.NewClient(ctx, parsed.project)
+	if err != nil {
+		cancel()
+		return nil, &UploadError{Output: location, Err: err}
+	}
+
+	return &bigQueryOutput{
+		location: parsed,
+		replace:  options.Replace,
+		kinds:    options.Kinds,
+		ctx:      ctx,
+		cancel:   cancel,
+		client:   client,
+		table:    client.Dataset(parsed.dataset).Table(parsed.table),
+	}, nil
+}
+
+// name returns the table name, for error messages
+func (o *bigQueryOutput) name() string {
+	return fmt.Sprintf("%s.%s.%s", o.location.project, o.location.dataset, o.location.table)
+}
+
+// InsertRows streams the rows of a chunk into the table, or writes them to the staged file.
+// The table is created (or checked) by the first call.
+func (o *bigQueryOutput) InsertRows(header []string, rows [][]string) error {
+	if o.columns == nil {
+		if err := o.prepareTable(header, rows); err != nil {
+			return err
+		}
+	} else if err := checkTableHeader(o.columns, header); err != nil {
+		return err
+	}
+
+	if o.stagingJSON != nil {
+		for _, row := range rows {
+			record := map[string]interface{}{}
+			for i, value := range tableValues(row, o.types) {
+				record[o.schema[i].Name] = value
+			}
+			if err := o.stagingJSON.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for start := 0; start < len(rows); start += BigQueryInsertBatchSize {
+		batch := rows[start:minInt(start+BigQueryInsertBatchSize, len(rows))]
+		savers := make([]*bigquery.ValuesSaver, len(batch))
+		for i, row := range batch {
+			values := tableValues(row, o.types)
+			saver := &bigquery.ValuesSaver{Schema: o.schema, Row: make([]bigquery.Value, len(values))}
+			for j, value := range values {
+				saver.Row[j] = value
+			}
+			savers[i] = saver
+		}
+		if err := o.table.Inserter().Put(o.ctx, savers); err != nil {
+			return &UploadError{Output: "bq://" + o.name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// prepareTable creates the table with the columns of the header, typed by their kinds, or from the rows of the
+// first chunk. The columns of an existing table are checked instead. When staging, the staged file is created as well.
+func (o *bigQueryOutput) prepareTable(header []string, rows [][]string) error {
+	metadata, err := o.table.Metadata(o.ctx)
+	if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusNotFound {
+		metadata, err = nil, nil
+	}
+	if err != nil {
+		return &UploadError{Output: "bq://" + o.name(), Err: err}
+	}
+
+	if metadata == nil {
+		o.types = tableColumnTypes(header, rows, o.kinds)
+		for i, column := range header {
+			o.schema = append(o.schema, &bigquery.FieldSchema{Name: sanitizeColumnName(column), Type: bigQueryTypes[o.types[i]]})
+		}
+		// the load job creates the table itself
+		if o.location.staging == "" {
+			if err = o.table.Create(o.ctx, &bigquery.TableMetadata{Schema: o.schema}); err != nil {
+				return &UploadError{Output: "bq://" + o.name(), Err: err}
+			}
+		}
+	} else {
+		if o.replace && o.location.staging == "" {
+			return fmt.Errorf("table %s already exists: it can only be replaced when staging to GCS (?staging=gs://bucket/prefix)", o.name())
+		}
+		// empty values are NULL, unless stored into a string column
+		fields := map[string]*bigquery.FieldSchema{}
+		for _, field := range metadata.Schema {
+			fields[field.Name] = field
+		}
+		o.types = make([]columnType, len(header))
+		for i, column := range header {
+			field, ok := fields[sanitizeColumnName(column)]
+			if !ok {
+				return fmt.Errorf("column %q does not exist in table %s", sanitizeColumnName(column), o.name())
+			}
+			if field.Type != bigquery.StringFieldType {
+				o.types[i] = integerColumn
+			}
+			o.schema = append(o.schema, field)
+		}
+	}
+	o.columns = header
+
+	if o.location.staging != "" {
+		o.staged = fmt.Sprintf("%s/%s-%d.json", strings.TrimSuffix(o.location.staging, "/"), o.location.table, time.Now().Unix())
+		if o.stagingWriter, err = openRemoteOutput(o.staged); err != nil {
+			return err
+		}
+		o.stagingJSON = json.NewEncoder(o.stagingWriter)
+	}
+	return nil
+}
+
+// Close completes the staged file and loads it into the table, the staged file being deleted once loaded
+func (o *bigQueryOutput) Close() error {
+	defer o.cancel()
+	defer o.client.Close()
+	if o.stagingWriter == nil {
+		return nil
+	}
+
+	if err := o.stagingWriter.Close(); err != nil {
+		return err
+	}
+
+	source := bigquery.NewGCSReference(o.staged)
+	source.SourceFormat = bigquery.JSON
+	source.Schema = o.schema
+	loader := o.table.LoaderFrom(source)
+	loader.CreateDisposition = bigquery.CreateIfNeeded
+	loader.WriteDisposition = bigquery.WriteAppend
+	if o.replace {
+		loader.WriteDisposition = bigquery.WriteTruncate
+	}
+
+	job, err := loader.Run(o.ctx)
+	if err != nil {
+		return &UploadError{Output: "bq://" + o.name(), Err: err}
+	}
+	status, err := job.Wait(o.ctx)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return &UploadError{Output: "bq://" + o.name(), Err: fmt.Errorf("load job of %s failed: %v", o.staged, err)}
+	}
+	return o.deleteStaged()
+}
+
+// deleteStaged deletes the staged file from GCS
+func (o *bigQueryOutput) deleteStaged() error {
+	u, err := url.Parse(o.staged)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(o.ctx)
+	if err != nil {
+		return &UploadError{Output: o.staged, Err: err}
+	}
+	defer client.Close()
+	if err = client.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/")).Delete(o.ctx); err != nil {
+		return &UploadError{Output: o.staged, Err: err}
+	}
+	return nil
+}
+
+// Abort discards the staged file, nothing is loaded. Rows already streamed into the table are kept.
+func (o *bigQueryOutput) Abort(err error) error {
+	defer o.cancel()
+	if a, ok := o.stagingWriter.(aborter); ok {
+		a.Abort(err)
+	}
+	return o.client.Close()
+}
@@ -0,0 +1,30 @@
+package downloader
+
+import "testing"
+
+func TestParseBigQueryLocation(t *testing.T) {
+	for location, expected := range map[string]bigQueryLocation{
+		"bq://project.dataset.pages":                         {project: "project", dataset: "dataset", table: "pages"},
+		"bq://example.com:project.dataset.pages":             {project: "example.com:project", dataset: "dataset", table: "pages"},
+		"bq://project.dataset.pages?staging=gs://bucket/tmp": {project: "project", dataset: "dataset", table: "pages", staging: "gs://bucket/tmp"},
+	} {
+		parsed, err := parseBigQueryLocation(location)
+		if err != nil {
+			t.Errorf("%q: %v", location, err)
+		} else if parsed != expected {
+			t.Errorf("%q: expected %+v, got %+v", location, expected, parsed)
+		}
+	}
+
+	for _, location := range []string{"bq://project.dataset", "bq://project..pages", "bq://project.dataset.pages?staging=s3://bucket/tmp"} {
+		if _, err := parseBigQueryLocation(location); err == nil {
+			t.Errorf("%q should be refused", location)
+		}
+	}
+}
+
+func TestBigQueryModeLocation(t *testing.T) {
+	if location := ModeOutputFilename("bq://project.dataset.crawl?staging=gs://bucket/tmp", "links", ""); location != "bq://project.dataset.crawl_links?staging=gs://bucket/tmp" {
+		t.Errorf("the mode should be appended to the table, got %q", location)
+	}
+}
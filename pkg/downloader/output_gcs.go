@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// GCSChunkSize the size of every chunk of the GCS resumable upload.
+	// A failed chunk is retried by the client library without restarting the whole upload.
+	GCSChunkSize = 16 * 1024 * 1024
+)
+
+func init() {
+	remoteOutputs["gs"] = newGCSOutput
+	remoteMetadataReaders["gs"] = gcsMetadata
+}
+
+// gcsOutput streams the output to Google Cloud Storage using a resumable upload.
+// Credentials are read from GOOGLE_APPLICATION_CREDENTIALS or the gcloud default credentials.
+type gcsOutput struct {
+	location string
+	client   *storage.Client
+	writer   *storage.Writer
+	cancel   context.CancelFunc
+}
+
+// newGCSOutput starts a resumable upload to gs://bucket/object
+func newGCSOutput(location *url.URL) (io.WriteCloser, error) {
+	bucket, object := location.Host, strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid GCS output %q: expected gs://bucket/object", location)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		cancel()
+		return nil, &UploadError{Output: location.String(), Err: err}
+	}
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ChunkSize = GCSChunkSize
+
+	return &gcsOutput{location: location.String(), client: client, writer: writer, cancel: cancel}, nil
+}
+
+// SetMetadata sets the metadata the object is uploaded with, before it's written to
+func (o *gcsOutput) SetMetadata(metadata map[string]string) {
+	o.writer.Metadata = metadata
+}
+
+func (o *gcsOutput) Write(p []byte) (int, error) {
+	n, err := o.writer.Write(p)
+	if err != nil {
+		return n, &UploadError{Output: o.location, Err: err}
+	}
+	return n, nil
+}
+
+// Close finalizes the upload, the object is only visible once it succeeds
+func (o *gcsOutput) Close() error {
+	defer o.client.Close()
+	defer o.cancel()
+	if err := o.writer.Close(); err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	return nil
+}
+
+// Abort cancels the upload, no object is created
+func (o *gcsOutput) Abort(err error) error {
+	o.cancel()
+	o.writer.Close()
+	return o.client.Close()
+}
+
+// gcsMetadata reads the metadata of the object of gs://bucket/object, nil if it doesn't exist
+func gcsMetadata(ctx context.Context, location *url.URL) (map[string]string, error) {
+	bucket, object := location.Host, strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid GCS output %q: expected gs://bucket/object", location)
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	attrs, err := client.Bucket(bucket).Object(object).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the metadata of %s: %v", location, err)
+	}
+	return attrs.Metadata, nil
+}
@@ -0,0 +1,224 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+const (
+	// KafkaBatchSize the default number of messages of every batch produced to Kafka
+	KafkaBatchSize = 100
+	// KafkaBatchBytes the default size of every batch produced to Kafka
+	KafkaBatchBytes = 1 << 20
+	// KafkaBatchTimeout the default time a batch produced to Kafka waits to be full
+	KafkaBatchTimeout = time.Second
+	// KafkaWriteTimeout how long a batch may take to be produced, it's then retried
+	KafkaWriteTimeout = 30 * time.Second
+)
+
+func init() {
+	if err := RegisterOutputBackend("kafka", func() OutputBackend { return &kafkaOutput{} }); err != nil {
+		panic(err)
+	}
+	suffixedLocations["kafka"] = suffixedKafkaLocation
+}
+
+// kafkaAcks the acknowledgements the produced messages wait for, by ?acks= value:
+// all and leader deliver every message at least once, none at most once
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	"all":    kafka.RequireAll,
+	"leader": kafka.RequireOne,
+	"none":   kafka.RequireNone,
+}
+
+// kafkaCompressions the compressions of the produced batches, by ?compression= value
+var kafkaCompressions = map[string]kafka.Compression{
+	"gzip":   kafka.Gzip,
+	"snappy": kafka.Snappy,
+	"lz4":    kafka.Lz4,
+	"zstd":   kafka.Zstd,
+}
+
+// kafkaLocation the topic of a kafka://broker:9092/topic output, along with the producer settings of its query
+type kafkaLocation struct {
+	brokers      []string
+	topic        string
+	key          string // the column keying the messages, "" for no key
+	acks         string
+	batchSize    int
+	batchBytes   int64
+	batchTimeout time.Duration
+	compression  string
+	tls          bool
+	username     string // SASL/PLAIN credentials, "" for none
+	password     string
+}
+
+// parseKafkaLocation parses a kafka://[user:pass@]broker:9092[,broker2:9092]/topic[?key=url&acks=all...] output
+func parseKafkaLocation(location string) (kafkaLocation, error) {
+	invalid := fmt.Errorf("invalid Kafka output %q: expected kafka://broker:9092/topic", RedactOutput(location))
+	u, err := url.Parse(location)
+	if err != nil {
+		return kafkaLocation{}, invalid
+	}
+	parsed := kafkaLocation{topic: strings.Trim(u.Path, "/"), acks: "all", batchSize: KafkaBatchSize,
+		batchBytes: KafkaBatchBytes, batchTimeout: KafkaBatchTimeout}
+	for _, broker := range strings.Split(u.Host, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			parsed.brokers = append(parsed.brokers, broker)
+		}
+	}
+	if len(parsed.brokers) == 0 || parsed.topic == "" || strings.Contains(parsed.topic, "/") {
+		return kafkaLocation{}, invalid
+	}
+	if u.User != nil {
+		parsed.username = u.User.Username()
+		parsed.password, _ = u.User.Password()
+	}
+
+	query := u.Query()
+	parsed.key = strings.TrimSpace(query.Get("key"))
+	if acks := strings.ToLower(query.Get("acks")); acks != "" {
+		if _, ok := kafkaAcks[acks]; !ok {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: acks has to be all, leader or none, got %q", acks)
+		}
+		parsed.acks = acks
+	}
+	if compression := strings.ToLower(query.Get("compression")); compression != "" {
+		if _, ok := kafkaCompressions[compression]; !ok {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: compression has to be gzip, snappy, lz4 or zstd, got %q", compression)
+		}
+		parsed.compression = compression
+	}
+	if size := query.Get("batch_size"); size != "" {
+		if parsed.batchSize, err = strconv.Atoi(size); err != nil || parsed.batchSize < 1 {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: batch_size has to be a positive number of messages, got %q", size)
+		}
+	}
+	if size := query.Get("batch_bytes"); size != "" {
+		if parsed.batchBytes, err = ParseSize(size); err != nil {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: batch_bytes: %v", err)
+		}
+	}
+	if timeout := query.Get("batch_timeout"); timeout != "" {
+		if parsed.batchTimeout, err = time.ParseDuration(timeout); err != nil || parsed.batchTimeout <= 0 {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: batch_timeout has to be a duration, e.g. 500ms, got %q", timeout)
+		}
+	}
+	if tls := query.Get("tls"); tls != "" {
+		if parsed.tls, err = strconv.ParseBool(tls); err != nil {
+			return kafkaLocation{}, fmt.Errorf("invalid Kafka output: tls has to be true or false, got %q", tls)
+		}
+	}
+	return parsed, nil
+}
+
+// suffixedKafkaLocation appends the suffix to the topic of the output
+func suffixedKafkaLocation(location string, suffix string) string {
+	if i := strings.Index(location, "?"); i >= 0 {
+		return location[:i] + "_" + suffix + location[i:]
+	}
+	return location + "_" + suffix
+}
+
+// kafkaWriter produces the messages, a *kafka.Writer
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// kafkaOutput publishes every row as a JSON object to a Kafka topic, the rows of a chunk being produced
+// in batches. With acks=all or leader, a chunk is written once every message is acknowledged.
+type kafkaOutput struct {
+	writer   kafkaWriter
+	location kafkaLocation
+	headers  []kafka.Header // the crawl and the mode of every message
+	keyIndex int            // the column keying the messages, -1 for no key
+	header   []string       // the header the key column was found in
+}
+
+func (o *kafkaOutput) Open(location string, options OutputBackendOptions) error {
+	parsed, err := parseKafkaLocation(location)
+	if err != nil {
+		return err
+	}
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(parsed.brokers...),
+		Topic:        parsed.topic,
+		Balancer:     &kafka.Hash{}, // the messages of a key go to the same partition, round robin without a key
+		BatchSize:    parsed.batchSize,
+		BatchBytes:   parsed.batchBytes,
+		BatchTimeout: parsed.batchTimeout,
+		WriteTimeout: KafkaWriteTimeout,
+		RequiredAcks: kafkaAcks[parsed.acks],
+		Async:        parsed.acks == "none",
+		Compression:  kafkaCompressions[parsed.compression],
+	}
+	if parsed.tls || parsed.username != "" {
+		transport := &kafka.Transport{}
+		if parsed.tls {
+			transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if parsed.username != "" {
+			transport.SASL = plain.Mechanism{Username: parsed.username, Password: parsed.password}
+		}
+		writer.Transport = transport
+	}
+	o.open(writer, parsed, options)
+	return nil
+}
+
+// open sets the writer the messages are produced with
+func (o *kafkaOutput) open(writer kafkaWriter, location kafkaLocation, options OutputBackendOptions) {
+	o.writer, o.location, o.keyIndex = writer, location, -1
+	o.headers = []kafka.Header{
+		{Key: "audisto-crawl", Value: []byte(strconv.FormatUint(options.CrawlID, 10))},
+		{Key: "audisto-mode", Value: []byte(options.Mode)},
+	}
+}
+
+func (o *kafkaOutput) WriteRows(header []string, rows [][]string) error {
+	if o.header == nil && o.location.key != "" {
+		for i, column := range header {
+			if column == o.location.key {
+				o.keyIndex = i
+			}
+		}
+		if o.keyIndex < 0 {
+			return fmt.Errorf("the Kafka key %q is not a column of the rows (%s)", o.location.key, strings.Join(header, ", "))
+		}
+	}
+	o.header = header
+
+	messages := make([]kafka.Message, len(rows))
+	var buf bytes.Buffer
+	encoder := newJSONRowWriter(&buf, header, FormatOptions{})
+	for i, row := range rows {
+		buf.Reset()
+		if err := encoder.WriteRow(row); err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Value: append([]byte(nil), bytes.TrimSuffix(buf.Bytes(), []byte("\n"))...), Headers: o.headers}
+		if o.keyIndex >= 0 && o.keyIndex < len(row) {
+			messages[i].Key = []byte(row[o.keyIndex])
+		}
+	}
+	if err := o.writer.WriteMessages(context.Background(), messages...); err != nil {
+		return fmt.Errorf("cannot produce the rows to Kafka topic %s: %v", o.location.topic, err)
+	}
+	return nil
+}
+
+// Close produces the messages still batched, and closes the connections
+func (o *kafkaOutput) Close() error {
+	return o.writer.Close()
+}
@@ -0,0 +1,154 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	// ParquetOutputFormat writes the rows to a Parquet file, with typed columns and snappy compression
+	ParquetOutputFormat = "parquet"
+
+	// DefaultParquetRowGroupSize the size of the Parquet row groups if NOT explicitly set
+	DefaultParquetRowGroupSize = 128 * 1024 * 1024
+
+	// parquetWriters the number of goroutines encoding the Parquet pages
+	parquetWriters = 4
+)
+
+func init() {
+	tableFormats[ParquetOutputFormat] = newParquetOutput
+}
+
+// SetParquetRowGroupSize sets the size in bytes of the row groups of the Parquet output, a row group
+// being buffered in memory before it's written. It has to be called before Setup()
+func (d *Downloader) SetParquetRowGroupSize(size int64) {
+	d.rowGroupSize = size
+}
+
+// parquetTypes the Parquet schema types of the inferred column types, all columns are nullable
+var parquetTypes = map[columnType]string{
+	textColumn:    "type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+	integerColumn: "type=INT64, repetitiontype=OPTIONAL",
+	realColumn:    "type=DOUBLE, repetitiontype=OPTIONAL",
+	boolColumn:    "type=BOOLEAN, repetitiontype=OPTIONAL",
+}
+
+// parquetOutput writes the rows to a Parquet file, local or remote (e.g. S3).
+// The schema is typed from the kinds of the columns, the types of the other ones being inferred from the first
+// chunk; the file is only valid once closed.
+type parquetOutput struct {
+	location     string
+	stream       io.WriteCloser
+	rowGroupSize int64
+	writer       *writer.CSVWriter
+	kinds        map[string]string
+	columns      []string
+	types        []columnType
+}
+
+// newParquetOutput creates the Parquet file, or starts uploading it to a remote output
+func newParquetOutput(location string, options tableOptions) (tableOutput, error) {
+	if location == "" {
+		return nil, fmt.Errorf("the parquet output format requires an output file")
+	}
+
+	output := &parquetOutput{location: location, rowGroupSize: options.RowGroupSize, kinds: options.Kinds}
+	if output.rowGroupSize <= 0 {
+		output.rowGroupSize = DefaultParquetRowGroupSize
+	}
+
+	if IsRemoteOutput(location) {
+		stream, err := openRemoteOutput(location)
+		if err != nil {
+			return nil, err
+		}
+		// remote outputs are hashed while they're written
+		output.stream = newHashedOutput(stream)
+		return output, nil
+	}
+
+	if _, err := os.Stat(location); err == nil && !options.Replace {
+		return nil, fmt.Errorf("%q file already exists: use --no-resume to replace it", location)
+	}
+	file, err := os.Create(location)
+	if err != nil {
+		return nil, err
+	}
+	output.stream = file
+	return output, nil
+}
+
+// InsertRows writes the rows of a chunk, the schema being created from the first chunk.
+// Rows are flushed to the file once a row group is full.
+func (o *parquetOutput) InsertRows(header []string, rows [][]string) error {
+	if o.writer == nil {
+		if err := o.createSchema(header, rows); err != nil {
+			return err
+		}
+	} else if err := checkTableHeader(o.columns, header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		values := tableValues(row, o.types)
+		record := make([]*string, len(values))
+		for i, value := range values {
+			if value != nil {
+				s := fmt.Sprint(value)
+				record[i] = &s
+			}
+		}
+		if err := o.writer.WriteString(record); err != nil {
+			return fmt.Errorf("cannot write row %v to %s: %v", row, o.location, err)
+		}
+	}
+	return nil
+}
+
+// createSchema creates the Parquet writer with the columns of the header, typed by their kinds, or from the
+// rows of the first chunk
+func (o *parquetOutput) createSchema(header []string, rows [][]string) error {
+	types := tableColumnTypes(header, rows, o.kinds)
+	metadata := make([]string, len(header))
+	for i, column := range header {
+		metadata[i] = fmt.Sprintf("name=%s, %s", sanitizeColumnName(column), parquetTypes[types[i]])
+	}
+
+	w, err := writer.NewCSVWriterFromWriter(metadata, o.stream, parquetWriters)
+	if err != nil {
+		return fmt.Errorf("cannot create the Parquet schema of %s: %v", o.location, err)
+	}
+	w.RowGroupSize = o.rowGroupSize
+
+	o.writer, o.columns, o.types = w, header, types
+	return nil
+}
+
+// Close writes the remaining row groups and the file footer
+func (o *parquetOutput) Close() error {
+	if o.writer != nil {
+		if err := o.writer.WriteStop(); err != nil {
+			o.Abort(err)
+			return fmt.Errorf("cannot complete %s: %v", o.location, err)
+		}
+	}
+	return o.stream.Close()
+}
+
+// Abort discards the output, a Parquet file without its footer is not readable
+func (o *parquetOutput) Abort(err error) error {
+	if a, ok := o.stream.(aborter); ok {
+		return a.Abort(err)
+	}
+	o.stream.Close()
+	return os.Remove(o.location)
+}
+
+// Stream returns the stream the Parquet file is written to
+func (o *parquetOutput) Stream() io.WriteCloser {
+	return o.stream
+}
@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "crawl.parquet")
+
+	output, err := newParquetOutput(location, tableOptions{Table: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []string{"id", "url", "response ms"}
+	if err = output.InsertRows(header, [][]string{{"1", "http://example.com/", "0.5"}, {"2", "http://example.com/a", ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows(header, [][]string{{"3", "http://example.com/b", "12"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows([]string{"id"}, [][]string{{"4"}}); err == nil {
+		t.Errorf("a chunk with different columns should be refused")
+	}
+	if err = output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := local.NewLocalFileReader(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parquetReader, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parquetReader.ReadStop()
+
+	if rows := parquetReader.GetNumRows(); rows != 3 {
+		t.Errorf("expected 3 rows, got %d", rows)
+	}
+	expected := map[string]parquet.Type{"id": parquet.Type_INT64, "url": parquet.Type_BYTE_ARRAY, "response_ms": parquet.Type_DOUBLE}
+	// the reader renames the columns, the names of the file are the external ones
+	for i, column := range parquetReader.Footer.Schema[1:] {
+		name := parquetReader.SchemaHandler.GetExName(i + 1)
+		if kind, ok := expected[name]; !ok || column.GetType() != kind {
+			t.Errorf("unexpected column %s of type %v", name, column.GetType())
+		}
+	}
+	if codec := parquetReader.Footer.RowGroups[0].Columns[0].MetaData.Codec; codec != parquet.CompressionCodec_SNAPPY {
+		t.Errorf("expected snappy compression, got %v", codec)
+	}
+
+	// existing files are only replaced with --no-resume
+	if _, err = newParquetOutput(location, tableOptions{Table: "pages"}); err == nil {
+		t.Errorf("an existing file should be refused")
+	}
+	output, err = newParquetOutput(location, tableOptions{Table: "pages", Replace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.Abort(nil)
+	if _, err = os.Stat(location); !os.IsNotExist(err) {
+		t.Errorf("an aborted file should be removed")
+	}
+}
@@ -0,0 +1,285 @@
+package downloader
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	tableLocations["postgres"] = newPostgresOutput
+	tableLocations["postgresql"] = newPostgresOutput
+	suffixedLocations["postgres"] = suffixedPostgresLocation
+	suffixedLocations["postgresql"] = suffixedPostgresLocation
+	upsertTableOutputs["postgres"] = true
+	upsertTableOutputs["postgresql"] = true
+}
+
+// postgresTypes the PostgreSQL types of the column types, for auto-created tables: the IDs, counts and codes
+// are BIGINT
+var postgresTypes = map[columnType]string{
+	textColumn:    "TEXT",
+	integerColumn: "BIGINT",
+	realColumn:    "DOUBLE PRECISION",
+	boolColumn:    "BOOLEAN",
+}
+
+// postgresTextTypes the PostgreSQL types empty values are stored as is into, instead of NULL
+var postgresTextTypes = map[string]bool{
+	"text":              true,
+	"character varying": true,
+	"character":         true,
+}
+
+// postgresOutput copies the rows into a PostgreSQL table, with a COPY per chunk (in its own transaction).
+// The table is created if it doesn't exist yet, an existing table is appended to, or upserted into by the key
+// columns if any: the rows with the same key are deleted before the COPY.
+type postgresOutput struct {
+	db       *sql.DB
+	location string
+	schema   string
+	table    string
+	replace  bool
+	key      []string
+	kinds    map[string]string
+	columns  []string
+	types    []columnType
+	keys     []int // the positions of the key columns in the columns
+}
+
+// parsePostgresLocation splits a postgres:// output into the connection URL and the table, read
+// from the table parameter (e.g. ?table=pages or ?table=audisto.pages) and defaulting to the given one
+func parsePostgresLocation(location string, defaultTable string) (dsn string, schema string, table string, err error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid output URL %q: %v", RedactOutput(location), err)
+	}
+
+	query := u.Query()
+	table = query.Get("table")
+	query.Del("table")
+	u.RawQuery = query.Encode()
+	if table == "" {
+		table = defaultTable
+	}
+
+	if i := strings.Index(table, "."); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+		if schema == "" {
+			return "", "", "", fmt.Errorf("invalid table in output URL %q", RedactOutput(location))
+		}
+	}
+	if table == "" {
+		return "", "", "", fmt.Errorf("invalid table in output URL %q", RedactOutput(location))
+	}
+	return u.String(), schema, table, nil
+}
+
+// suffixedPostgresLocation appends the suffix to the table parameter of the output, if any
+func suffixedPostgresLocation(location string, suffix string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	query := u.Query()
+	if table := query.Get("table"); table != "" {
+		query.Set("table", table+"_"+suffix)
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// newPostgresOutput connects to the PostgreSQL database of the output URL
+func newPostgresOutput(location string, options tableOptions) (tableOutput, error) {
+	dsn, schema, table, err := parsePostgresLocation(location, options.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to PostgreSQL database %s: %v", RedactOutput(location), err)
+	}
+	return &postgresOutput{db: db, location: RedactOutput(location), schema: schema, table: table, replace: options.Replace,
+		key: options.Key, kinds: options.Kinds}, nil
+}
+
+// qualifiedTable returns the quoted table name, prefixed with its schema if any
+func (o *postgresOutput) qualifiedTable() string {
+	if o.schema == "" {
+		return quoteIdentifier(o.table)
+	}
+	return quoteIdentifier(o.schema) + "." + quoteIdentifier(o.table)
+}
+
+// InsertRows copies the rows of a chunk in a single transaction, creating the table first if needed
+func (o *postgresOutput) InsertRows(header []string, rows [][]string) error {
+	if o.columns == nil {
+		if err := o.prepareTable(header, rows); err != nil {
+			return err
+		}
+	} else if err := checkTableHeader(o.columns, header); err != nil {
+		return err
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = o.deleteKeys(tx, rows); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot upsert into table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+	copyIn := pq.CopyIn(o.table, o.columns...)
+	if o.schema != "" {
+		copyIn = pq.CopyInSchema(o.schema, o.table, o.columns...)
+	}
+	statement, err := tx.Prepare(copyIn)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot copy into table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+
+	for _, row := range rows {
+		if _, err = statement.Exec(tableValues(row, o.types)...); err != nil {
+			statement.Close()
+			tx.Rollback()
+			return fmt.Errorf("cannot copy into table %s of %s: %v", o.qualifiedTable(), o.location, err)
+		}
+	}
+	// an Exec without values flushes the COPY
+	if _, err = statement.Exec(); err == nil {
+		err = statement.Close()
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("cannot copy into table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+	return tx.Commit()
+}
+
+// prepareTable creates the table with the columns of the header, typed by their kinds, or from the rows of
+// the first chunk.
+// The columns of an existing table are checked instead, the table being emptied when replaced.
+func (o *postgresOutput) prepareTable(header []string, rows [][]string) error {
+	existing, err := o.tableColumns()
+	if err != nil {
+		return err
+	}
+
+	if len(existing) == 0 {
+		types := tableColumnTypes(header, rows, o.kinds)
+		definitions := make([]string, len(header))
+		for i, column := range header {
+			definitions[i] = quoteIdentifier(column) + " " + postgresTypes[types[i]]
+		}
+		if _, err = o.db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", o.qualifiedTable(), strings.Join(definitions, ", "))); err != nil {
+			return fmt.Errorf("cannot create table %s in %s: %v", o.qualifiedTable(), o.location, err)
+		}
+		o.columns, o.types = header, types
+		return o.indexKey()
+	}
+
+	// empty values are NULL, unless stored into a text column
+	types := make([]columnType, len(header))
+	for i, column := range header {
+		dataType, ok := existing[column]
+		if !ok {
+			return fmt.Errorf("column %q does not exist in table %s of %s", column, o.qualifiedTable(), o.location)
+		}
+		if !postgresTextTypes[dataType] {
+			types[i] = integerColumn
+		}
+	}
+	if o.replace {
+		if _, err = o.db.Exec("TRUNCATE TABLE " + o.qualifiedTable()); err != nil {
+			return fmt.Errorf("cannot empty table %s of %s: %v", o.qualifiedTable(), o.location, err)
+		}
+	}
+	o.columns, o.types = header, types
+	return o.indexKey()
+}
+
+// indexKey indexes the key columns the rows are upserted by, unless indexed already
+func (o *postgresOutput) indexKey() error {
+	if o.key == nil {
+		return nil
+	}
+	keys, err := columnPositions(o.columns, o.key)
+	if err != nil {
+		return fmt.Errorf("cannot upsert into table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+	names := make([]string, len(keys))
+	for i, position := range keys {
+		names[i] = quoteIdentifier(o.columns[position])
+	}
+	index := quoteIdentifier(o.table + "_upsert_key")
+	if _, err = o.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", index, o.qualifiedTable(), strings.Join(names, ", "))); err != nil {
+		return fmt.Errorf("cannot index table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+	o.keys = keys
+	return nil
+}
+
+// deleteKeys deletes the rows of the table with the keys of the rows upserted, in the transaction of their COPY
+func (o *postgresOutput) deleteKeys(tx *sql.Tx, rows [][]string) error {
+	if o.keys == nil {
+		return nil
+	}
+	conditions := make([]string, len(o.keys))
+	for i, position := range o.keys {
+		conditions[i] = fmt.Sprintf("%s = $%d", quoteIdentifier(o.columns[position]), i+1)
+	}
+	statement, err := tx.Prepare(fmt.Sprintf("DELETE FROM %s WHERE %s", o.qualifiedTable(), strings.Join(conditions, " AND ")))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+	for _, row := range rows {
+		values := tableValues(row, o.types)
+		keyValues := make([]interface{}, len(o.keys))
+		for i, position := range o.keys {
+			keyValues[i] = values[position]
+		}
+		if _, err = statement.Exec(keyValues...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the data type of every column of the table, by name; none if the table doesn't exist
+func (o *postgresOutput) tableColumns() (map[string]string, error) {
+	query := `SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2`
+	rows, err := o.db.Query(query, o.schema, o.table)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read table %s of %s: %v", o.qualifiedTable(), o.location, err)
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var name, dataType string
+		if err = rows.Scan(&name, &dataType); err != nil {
+			return nil, err
+		}
+		columns[name] = dataType
+	}
+	return columns, rows.Err()
+}
+
+func (o *postgresOutput) Close() error {
+	return o.db.Close()
+}
+
+// Abort closes the connection, every chunk copied so far is kept
+func (o *postgresOutput) Abort(err error) error {
+	return o.db.Close()
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// S3PartSize the size of every part of the S3 multipart upload.
+	// The maximum number of parts being 10000, this allows uploads up to ~150GB
+	S3PartSize = 16 * 1024 * 1024
+)
+
+func init() {
+	remoteOutputs["s3"] = newS3Output
+	remoteMetadataReaders["s3"] = s3Metadata
+}
+
+// s3Output streams the output to S3 using a multipart upload, nothing is stored on the local disk.
+// Credentials and region are read the AWS SDK way: environment variables, then shared config files.
+type s3Output struct {
+	location string
+	uploader *s3manager.Uploader
+	input    *s3manager.UploadInput
+	reader   *io.PipeReader
+	pipe     *io.PipeWriter
+	done     chan error
+	started  bool
+}
+
+// newS3Output prepares a multipart upload to s3://bucket/key, started once written to
+func newS3Output(location *url.URL) (io.WriteCloser, error) {
+	bucket, key, err := s3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := newS3Session()
+	if err != nil {
+		return nil, err
+	}
+
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.PartSize = S3PartSize
+	})
+
+	reader, writer := io.Pipe()
+	return &s3Output{
+		location: location.String(),
+		uploader: uploader,
+		input:    &s3manager.UploadInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: reader},
+		reader:   reader,
+		pipe:     writer,
+		done:     make(chan error, 1),
+	}, nil
+}
+
+// s3Location returns the bucket and the key of s3://bucket/key
+func s3Location(location *url.URL) (string, string, error) {
+	bucket, key := location.Host, strings.TrimPrefix(location.Path, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 output %q: expected s3://bucket/key", location)
+	}
+	return bucket, key, nil
+}
+
+func newS3Session() (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S3 session error: %v", err)
+	}
+	return sess, nil
+}
+
+// start starts the multipart upload, its metadata being set
+func (o *s3Output) start() {
+	if o.started {
+		return
+	}
+	o.started = true
+	go func() {
+		_, err := o.uploader.Upload(o.input)
+		// unblock writes if the upload stopped before reading everything
+		o.reader.CloseWithError(err)
+		o.done <- err
+	}()
+}
+
+// SetMetadata sets the metadata the object is uploaded with, before it's written to
+func (o *s3Output) SetMetadata(metadata map[string]string) {
+	o.input.Metadata = aws.StringMap(metadata)
+}
+
+func (o *s3Output) Write(p []byte) (int, error) {
+	o.start()
+	n, err := o.pipe.Write(p)
+	if err != nil {
+		return n, &UploadError{Output: o.location, Err: err}
+	}
+	return n, nil
+}
+
+// Close completes the multipart upload, and waits for it to finish
+func (o *s3Output) Close() error {
+	o.start()
+	o.pipe.Close()
+	if err := <-o.done; err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	return nil
+}
+
+// Abort makes the uploader abort the multipart upload, uploaded parts are discarded
+func (o *s3Output) Abort(err error) error {
+	if !o.started {
+		return nil
+	}
+	o.pipe.CloseWithError(err)
+	<-o.done
+	return nil
+}
+
+// s3Metadata reads the metadata of the object of s3://bucket/key, nil if it doesn't exist
+func s3Metadata(ctx context.Context, location *url.URL) (map[string]string, error) {
+	bucket, key, err := s3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := newS3Session()
+	if err != nil {
+		return nil, err
+	}
+	object, err := s3.New(sess).HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the metadata of %s: %v", location, err)
+	}
+	return aws.StringValueMap(object.Metadata), nil
+}
@@ -0,0 +1,332 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// SFTPBufferSize the size of the data uploaded at once to an SFTP output, kept until the server acknowledged it
+	SFTPBufferSize = 1024 * 1024
+	// SFTPReconnects the number of times the connection to an SFTP server is opened again when an upload is interrupted
+	SFTPReconnects = 5
+	// SFTPReconnectPause the pause before the first reconnection, then multiplied by the number of attempts
+	SFTPReconnectPause = 2 * time.Second
+	// SFTPDialTimeout how long connecting to an SFTP server may take
+	SFTPDialTimeout = 30 * time.Second
+)
+
+// the default private keys of SSH, in ~/.ssh, used when SFTP_KEY_FILE isn't set
+var sftpDefaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+func init() {
+	remoteOutputs["sftp"] = newSFTPOutput
+}
+
+// sftpSession a connection to an SFTP server, an sftpClient
+type sftpSession interface {
+	OpenFile(path string, flags int) (sftpFile, error)
+	MkdirAll(path string) error
+	Rename(oldname, newname string) error
+	Remove(path string) error
+	Close() error
+}
+
+// sftpFile a file opened on an SFTP server, an *sftp.File
+type sftpFile interface {
+	io.WriteCloser
+	io.Seeker
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+}
+
+// sftpClient the session of an SFTP connection, over its SSH connection
+type sftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (c sftpClient) OpenFile(path string, flags int) (sftpFile, error) {
+	file, err := c.Client.OpenFile(path, flags)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Rename renames the file, replacing the existing one. Servers without the posix-rename extension
+// can't rename over an existing file, it's removed first.
+func (c sftpClient) Rename(oldname, newname string) error {
+	if err := c.Client.PosixRename(oldname, newname); err == nil {
+		return nil
+	}
+	c.Client.Remove(newname)
+	return c.Client.Rename(oldname, newname)
+}
+
+func (c sftpClient) Close() error {
+	c.Client.Close()
+	return c.conn.Close()
+}
+
+// sftpOutput uploads the output to an SFTP server, to [PATH].partial renamed to the path once completed.
+// An interrupted upload is resumed: the connection is opened again, and the upload continues after
+// the data acknowledged by the server.
+type sftpOutput struct {
+	location string
+	path     string
+	dial     func() (sftpSession, error)
+	pause    time.Duration
+	session  sftpSession
+	file     sftpFile
+	buf      []byte // the data not uploaded yet
+	uploaded int64  // the size of the data acknowledged by the server
+}
+
+// sftpPath returns the path of the file of sftp://user@host/path/file.tsv on the server: /path/file.tsv is
+// an absolute path, /~/file.tsv is relative to the login directory
+func sftpPath(location *url.URL) (string, error) {
+	p := location.Path
+	if strings.HasPrefix(p, "/~/") {
+		p = strings.TrimPrefix(p, "/~/")
+	}
+	if location.Host == "" || location.User == nil || location.User.Username() == "" || p == "" || strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("invalid SFTP output %q: expected sftp://user@host/path/file.tsv", RedactOutput(location.String()))
+	}
+	return p, nil
+}
+
+// newSFTPOutput connects to the server of sftp://user@host/path/file.tsv and starts the upload
+func newSFTPOutput(location *url.URL) (io.WriteCloser, error) {
+	p, err := sftpPath(location)
+	if err != nil {
+		return nil, err
+	}
+	config, err := sftpClientConfig(location)
+	if err != nil {
+		return nil, err
+	}
+	address := location.Host
+	if location.Port() == "" {
+		address = net.JoinHostPort(location.Hostname(), "22")
+	}
+
+	o := &sftpOutput{location: RedactOutput(location.String()), path: p, pause: SFTPReconnectPause}
+	o.dial = func() (sftpSession, error) {
+		conn, err := ssh.Dial("tcp", address, config)
+		if err != nil {
+			return nil, err
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return sftpClient{Client: client, conn: conn}, nil
+	}
+	if err = o.open(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// sftpClientConfig the SSH settings of the connection: the server is verified by SFTP_KNOWN_HOSTS or
+// ~/.ssh/known_hosts; the user authenticated by ssh-agent, SFTP_KEY_FILE or the default keys, or the password
+// of the location
+func sftpClientConfig(location *url.URL) (*ssh.ClientConfig, error) {
+	home, _ := os.UserHomeDir()
+	knownHosts := os.Getenv("SFTP_KNOWN_HOSTS")
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the SSH known hosts %s (set SFTP_KNOWN_HOSTS to use another file): %v", knownHosts, err)
+	}
+
+	var methods []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+			return agent.NewClient(conn).Signers()
+		}))
+	}
+
+	keys := []string{os.Getenv("SFTP_KEY_FILE")}
+	if keys[0] == "" {
+		keys = nil
+		for _, key := range sftpDefaultKeys {
+			if key = filepath.Join(home, ".ssh", key); fExists(key) == nil {
+				keys = append(keys, key)
+			}
+		}
+	}
+	var signers []ssh.Signer
+	for _, key := range keys {
+		signer, err := sftpSigner(key)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if password, ok := location.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no SSH key to connect to %s: set SFTP_KEY_FILE, or add a key to ssh-agent", location.Host)
+	}
+
+	return &ssh.ClientConfig{
+		User:            location.User.Username(),
+		Auth:            methods,
+		HostKeyCallback: hostKeys,
+		Timeout:         SFTPDialTimeout,
+	}, nil
+}
+
+// sftpSigner reads the private key of the file, decrypted by SFTP_KEY_PASSPHRASE if it's encrypted
+func sftpSigner(key string) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the SSH key %s: %v", key, err)
+	}
+	var signer ssh.Signer
+	if passphrase := os.Getenv("SFTP_KEY_PASSPHRASE"); passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, fmt.Errorf("the SSH key %s is encrypted, set its passphrase in SFTP_KEY_PASSPHRASE", key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key %s: %v", key, err)
+	}
+	return signer, nil
+}
+
+// partial returns the file the output is uploaded to until completed
+func (o *sftpOutput) partial() string {
+	return o.path + PartialSuffix
+}
+
+// open connects to the server and creates the partial file
+func (o *sftpOutput) open() error {
+	session, err := o.dial()
+	if err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	if dir := path.Dir(o.path); dir != "." && dir != "/" {
+		if err = session.MkdirAll(dir); err != nil {
+			session.Close()
+			return &UploadError{Output: o.location, Err: err}
+		}
+	}
+	file, err := session.OpenFile(o.partial(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		session.Close()
+		return &UploadError{Output: o.location, Err: err}
+	}
+	o.session, o.file = session, file
+	return nil
+}
+
+// reopen connects to the server again, and reopens the partial file right after the data acknowledged
+func (o *sftpOutput) reopen() error {
+	o.session.Close()
+	session, err := o.dial()
+	if err != nil {
+		return err
+	}
+	o.session = session
+	file, err := session.OpenFile(o.partial(), os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	o.file = file
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < o.uploaded {
+		return fmt.Errorf("cannot resume the upload, %s is smaller than the data uploaded: it has been altered", o.partial())
+	}
+	if err = file.Truncate(o.uploaded); err != nil {
+		return err
+	}
+	_, err = file.Seek(o.uploaded, io.SeekStart)
+	return err
+}
+
+func (o *sftpOutput) Write(p []byte) (int, error) {
+	o.buf = append(o.buf, p...)
+	if len(o.buf) >= SFTPBufferSize {
+		if err := o.upload(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// upload writes the buffered data to the server, resuming the upload if it's interrupted
+func (o *sftpOutput) upload() error {
+	_, err := o.file.Write(o.buf)
+	for attempt := 1; err != nil && attempt <= SFTPReconnects; attempt++ {
+		time.Sleep(time.Duration(attempt) * o.pause)
+		if err = o.reopen(); err == nil {
+			_, err = o.file.Write(o.buf)
+		}
+	}
+	if err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	o.uploaded += int64(len(o.buf))
+	o.buf = o.buf[:0]
+	return nil
+}
+
+// Close uploads the data left and renames the partial file to the output
+func (o *sftpOutput) Close() error {
+	// the session is opened again by the reconnections
+	defer func() { o.session.Close() }()
+	if len(o.buf) > 0 {
+		if err := o.upload(); err != nil {
+			return err
+		}
+	}
+	if err := o.file.Close(); err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	if err := o.session.Rename(o.partial(), o.path); err != nil {
+		return &UploadError{Output: o.location, Err: err}
+	}
+	return nil
+}
+
+// Abort removes the partial file, an upload can't be resumed across runs
+func (o *sftpOutput) Abort(err error) error {
+	defer o.session.Close()
+	o.file.Close()
+	return o.session.Remove(o.partial())
+}
@@ -0,0 +1,185 @@
+package downloader
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// SQLiteOutputFormat inserts the rows into a table of an SQLite database file, named after the mode
+	SQLiteOutputFormat = "sqlite"
+)
+
+func init() {
+	tableFormats[SQLiteOutputFormat] = newSQLiteOutput
+	upsertTableOutputs[SQLiteOutputFormat] = true
+}
+
+// sqliteTypes the SQLite types of the inferred column types
+var sqliteTypes = map[columnType]string{
+	textColumn:    "TEXT",
+	integerColumn: "INTEGER",
+	realColumn:    "REAL",
+	boolColumn:    "BOOLEAN",
+}
+
+// sqliteOutput inserts the rows into a table of an SQLite database, a transaction per chunk. The rows are
+// upserted by the key columns, if any: the rows with the same key are deleted first.
+type sqliteOutput struct {
+	db      *sql.DB
+	table   string
+	key     []string
+	exists  bool // the table exists already, it's upserted into
+	kinds   map[string]string
+	columns []string
+	types   []columnType
+	keys    []int // the positions of the key columns in the columns
+}
+
+// newSQLiteOutput opens (or creates) the SQLite database file
+func newSQLiteOutput(location string, options tableOptions) (tableOutput, error) {
+	if location == "" || IsRemoteOutput(location) {
+		return nil, fmt.Errorf("the sqlite output format requires a local output file")
+	}
+	table := options.Table
+
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open SQLite database %s: %v", location, err)
+	}
+	output := &sqliteOutput{db: db, table: table, key: options.Key, kinds: options.Kinds}
+
+	var name string
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		db.Close()
+		return nil, fmt.Errorf("cannot open SQLite database %s: %v", location, err)
+	case options.Key != nil:
+		output.exists = true
+	case !options.Replace:
+		db.Close()
+		return nil, fmt.Errorf("table %q already exists in %s: use --no-resume to replace it, or --append to upsert into it", table, location)
+	default:
+		if _, err = db.Exec("DROP TABLE " + quoteIdentifier(table)); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// InsertRows inserts the rows of a chunk in a single transaction, creating the table first if needed
+func (o *sqliteOutput) InsertRows(header []string, rows [][]string) error {
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	columns, types, keys := o.columns, o.types, o.keys
+	if columns == nil {
+		columns, types = header, tableColumnTypes(header, rows, o.kinds)
+		if o.key != nil {
+			if keys, err = columnPositions(columns, o.key); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("cannot upsert into table %q: %v", o.table, err)
+			}
+		}
+		if !o.exists {
+			err = createSQLiteTable(tx, o.table, columns, types)
+		}
+		if err == nil && keys != nil {
+			err = createSQLiteKeyIndex(tx, o.table, columns, keys)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	} else if err = checkTableHeader(columns, header); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = quoteIdentifier(column)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	statement, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdentifier(o.table), strings.Join(names, ", "), placeholders))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer statement.Close()
+
+	var deletion *sql.Stmt
+	if keys != nil {
+		conditions := make([]string, len(keys))
+		for i, position := range keys {
+			conditions[i] = names[position] + " IS ?"
+		}
+		if deletion, err = tx.Prepare(fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdentifier(o.table), strings.Join(conditions, " AND "))); err != nil {
+			tx.Rollback()
+			return err
+		}
+		defer deletion.Close()
+	}
+
+	for _, row := range rows {
+		values := tableValues(row, types)
+		if deletion != nil {
+			keyValues := make([]interface{}, len(keys))
+			for i, position := range keys {
+				keyValues[i] = values[position]
+			}
+			if _, err = deletion.Exec(keyValues...); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if _, err = statement.Exec(values...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	o.columns, o.types, o.keys = columns, types, keys
+	return nil
+}
+
+// createSQLiteTable creates the table with the given columns, typed from the rows of the first chunk
+func createSQLiteTable(tx *sql.Tx, table string, columns []string, types []columnType) error {
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		definitions[i] = quoteIdentifier(column) + " " + sqliteTypes[types[i]]
+	}
+	_, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(table), strings.Join(definitions, ", ")))
+	return err
+}
+
+// createSQLiteKeyIndex indexes the key columns the rows are upserted by, unless indexed already
+func createSQLiteKeyIndex(tx *sql.Tx, table string, columns []string, keys []int) error {
+	names := make([]string, len(keys))
+	for i, position := range keys {
+		names[i] = quoteIdentifier(columns[position])
+	}
+	index := quoteIdentifier(table + "_upsert_key")
+	_, err := tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", index, quoteIdentifier(table), strings.Join(names, ", ")))
+	return err
+}
+
+func (o *sqliteOutput) Close() error {
+	return o.db.Close()
+}
+
+// Abort closes the database, every chunk inserted so far is kept
+func (o *sqliteOutput) Abort(err error) error {
+	return o.db.Close()
+}
@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInferColumnTypes(t *testing.T) {
+	header := []string{"id", "score", "url", "empty"}
+	rows := [][]string{{"1", "0.5", "http://example.com/", ""}, {"2", "1", "http://example.com/a", ""}, {"", "", "", ""}}
+	expected := []columnType{integerColumn, realColumn, textColumn, textColumn}
+	if types := inferColumnTypes(header, rows); !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+
+	// the columns of known kinds aren't typed from the first chunk: the scores of the next ones can be reals
+	kinds := map[string]string{"id": "integer", "score": "number", "url": "string", "empty": "bool"}
+	expected = []columnType{integerColumn, realColumn, textColumn, boolColumn}
+	if types := tableColumnTypes(header, rows, kinds); !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+}
+
+func TestSQLiteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "crawl.db")
+
+	output, err := newSQLiteOutput(location, tableOptions{Table: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []string{"id", "url", "status_code"}
+	if err = output.InsertRows(header, [][]string{{"1", "http://example.com/", "200"}, {"2", "http://example.com/a", ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows(header, [][]string{{"3", "http://example.com/b", "404"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = output.InsertRows([]string{"id"}, [][]string{{"4"}}); err == nil {
+		t.Errorf("chunks with different columns should be rejected")
+	}
+	if err = output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count, errors int
+	if err = db.QueryRow(`SELECT COUNT(*), COUNT(status_code) FROM pages WHERE id <= 3`).Scan(&count, &errors); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || errors != 2 {
+		t.Errorf("expected 3 rows with 2 status codes, got %d and %d", count, errors)
+	}
+
+	// an existing table is only replaced on demand
+	if _, err = newSQLiteOutput(location, tableOptions{Table: "pages"}); err == nil {
+		t.Errorf("an existing table should not be replaced")
+	}
+	replaced, err := newSQLiteOutput(location, tableOptions{Table: "pages", Replace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced.Close()
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsRemoteOutput(t *testing.T) {
+	for location, expected := range map[string]bool{
+		"s3://bucket/key.tsv":  true,
+		"S3://bucket/key.tsv":  true,
+		"gs://bucket/key.tsv":  true,
+		"crawl.tsv":            false,
+		"/tmp/crawl.tsv":       false,
+		"unknown://crawl.tsv":  false,
+		"C:\\exports\\out.tsv": false,
+	} {
+		if IsRemoteOutput(location) != expected {
+			t.Errorf("IsRemoteOutput(%q) should be %v", location, expected)
+		}
+	}
+}
+
+func TestRunStdout(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	defer func(previous *os.File) { os.Stdout = previous }(os.Stdout)
+	os.Stdout = stdout
+
+	if err = New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: StdoutOutput}).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(streamed) != "id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n" {
+		t.Errorf("unexpected rows streamed to stdout %q", streamed)
+	}
+	if _, err = stdout.Write(nil); err != nil {
+		t.Error("stdout should not be closed by the download")
+	}
+	if fExists(resumerSuffix) == nil {
+		t.Error("nothing should be persisted to resume stdout")
+	}
+}
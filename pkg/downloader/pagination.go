@@ -0,0 +1,155 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// PaginationAuto pages through the chunks by the cursors of the API once it returns them, by their offset
+	// otherwise (default)
+	PaginationAuto = "auto"
+
+	// PaginationOffset pages through the chunks by their offset only, the chunk number and size
+	PaginationOffset = "offset"
+
+	// nextCursorHeader the response header of the cursor paging to the chunk following the one received
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// ParsePagination validates a user given pagination, auto (default) or offset
+func ParsePagination(value string) (string, error) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "":
+		return PaginationAuto, nil
+	case PaginationAuto, PaginationOffset:
+		return value, nil
+	}
+	return "", fmt.Errorf("pagination has to be '%s' or '%s': %q", PaginationAuto, PaginationOffset, value)
+}
+
+// pagination the strategy the client pages through the chunks of a target by
+type pagination interface {
+	// setParams sets the query params of the request of the given chunk
+	setParams(params url.Values, number uint64, size uint64)
+	// observe records the response header of the given chunk, received
+	observe(number uint64, size uint64, header http.Header)
+	// sequential checks if the chunks have to be requested one after another, each once the previous one
+	// is received
+	sequential() bool
+	// reset forgets the chunks of the previous target
+	reset()
+}
+
+// newPagination returns the pagination of the given name, validated by ParsePagination
+func newPagination(name string) pagination {
+	if name == PaginationOffset {
+		return offsetPagination{}
+	}
+	return &cursorPagination{cursors: map[uint64]string{}}
+}
+
+// offsetPagination requests the chunks by their number and size
+type offsetPagination struct{}
+
+func (offsetPagination) setParams(params url.Values, number uint64, size uint64) {
+	params.Add("chunk", strconv.FormatUint(number, 10))
+	params.Add("chunk_size", strconv.FormatUint(size, 10))
+}
+
+func (offsetPagination) observe(number uint64, size uint64, header http.Header) {}
+
+func (offsetPagination) sequential() bool {
+	return false
+}
+
+func (offsetPagination) reset() {}
+
+// cursorPagination requests a chunk by the cursor returned along with the previous chunk, so rows added or
+// removed while downloading don't shift the chunks. The chunks no cursor is known for are requested by their
+// offset: the first one of a target, the one a download resumes from, or a chunk not starting where a previous
+// one ended, e.g. once the chunk size was throttled. It's shared by the copies of the client.
+type cursorPagination struct {
+	mu      sync.Mutex
+	cursors map[uint64]string // the cursors returned by the API, by the element they page to
+}
+
+func (p *cursorPagination) setParams(params url.Values, number uint64, size uint64) {
+	p.mu.Lock()
+	cursor, ok := p.cursors[number*size]
+	p.mu.Unlock()
+	if !ok {
+		offsetPagination{}.setParams(params, number, size)
+		return
+	}
+	params.Add("cursor", cursor)
+	params.Add("chunk_size", strconv.FormatUint(size, 10))
+}
+
+func (p *cursorPagination) observe(number uint64, size uint64, header http.Header) {
+	cursor := strings.TrimSpace(header.Get(nextCursorHeader))
+	if cursor == "" {
+		return
+	}
+	p.mu.Lock()
+	p.cursors[(number+1)*size] = cursor
+	p.mu.Unlock()
+}
+
+func (p *cursorPagination) sequential() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// once the API returns cursors, a chunk's cursor is known once the previous chunk is received
+	return len(p.cursors) > 0
+}
+
+func (p *cursorPagination) reset() {
+	p.mu.Lock()
+	p.cursors = map[uint64]string{}
+	p.mu.Unlock()
+}
+
+// SetPagination sets how the chunks are paged through, auto (default) or offset. Once Audisto API returns
+// cursors, auto requests the chunks by their cursor: the chunks stay consistent while the crawl is updated, but
+// they're requested one after another, whatever the concurrency. Offset requests them by their number and size.
+// It has to be called before Setup()
+func (d *Downloader) SetPagination(name string) error {
+	name, err := ParsePagination(name)
+	if err != nil {
+		return err
+	}
+	d.pagination = name
+	return nil
+}
+
+// chunkParams sets the query params paging to the client chunk
+func (api *AudistoAPIClient) chunkParams(params url.Values) {
+	if api.pagination == nil {
+		offsetPagination{}.setParams(params, api.ChunkNumber, api.ChunkSize)
+		return
+	}
+	api.pagination.setParams(params, api.ChunkNumber, api.ChunkSize)
+}
+
+// observeChunk records the paging returned along with a chunk received
+func (api *AudistoAPIClient) observeChunk(number uint64, size uint64, header http.Header) {
+	if api.pagination != nil {
+		api.pagination.observe(number, size, header)
+	}
+}
+
+// sequentialChunks checks if the chunks are requested one after another, instead of in parallel
+func (api *AudistoAPIClient) sequentialChunks() bool {
+	return api.pagination != nil && api.pagination.sequential()
+}
+
+// resetPagination forgets the paging of the previous target, before downloading a new one
+func (api *AudistoAPIClient) resetPagination() {
+	if api.pagination != nil {
+		api.pagination.reset()
+	}
+}
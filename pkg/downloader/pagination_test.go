@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveCursorPages serves 5 pages in chunks of 2, every chunk but the last one returning the cursor of the next
+// one, the rows starting at the cursor or at the chunk offset. The requests are recorded by their paging.
+func serveCursorPages(requested *[]string, mu *sync.Mutex) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":5,"page":0,"size":2}}`))
+			return
+		}
+		var chunk, size, start int
+		fmt.Sscan(query.Get("chunk_size"), &size)
+		if cursor := query.Get("cursor"); cursor != "" {
+			fmt.Sscanf(cursor, "after-%d", &start)
+		} else {
+			fmt.Sscan(query.Get("chunk"), &chunk)
+			start = chunk * size
+		}
+		mu.Lock()
+		*requested = append(*requested, "chunk="+query.Get("chunk")+",cursor="+query.Get("cursor"))
+		mu.Unlock()
+
+		if start+size < 5 {
+			w.Header().Set(nextCursorHeader, fmt.Sprintf("after-%d", start+size))
+		}
+		fmt.Fprint(w, "id\turl\n")
+		for id := start; id < start+size && id < 5; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", id, id)
+		}
+	})
+}
+
+func TestCursorPagination(t *testing.T) {
+	for _, test := range []struct {
+		pagination string
+		requested  string
+	}{
+		{PaginationAuto, "chunk=0,cursor= chunk=,cursor=after-2 chunk=,cursor=after-4"},
+		{PaginationOffset, "chunk=0,cursor= chunk=1,cursor= chunk=4,cursor="},
+	} {
+		var requested []string
+		var mu sync.Mutex
+		stop := serveCursorPages(&requested, &mu)
+		dir, err := ioutil.TempDir("", "pagination")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := filepath.Join(dir, "crawl.tsv")
+		options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+			Pagination: test.pagination}
+		err = New(options).Run(context.Background())
+		stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(output)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 6 || lines[5] != "4\thttp://example.com/4" {
+			t.Errorf("%s: unexpected output %q", test.pagination, data)
+		}
+		if strings.Join(requested, " ") != test.requested {
+			t.Errorf("%s: expected the requests %s, got %v", test.pagination, test.requested, requested)
+		}
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	if pagination, err := ParsePagination(""); err != nil || pagination != PaginationAuto {
+		t.Errorf("expected the auto pagination by default, got %q, %v", pagination, err)
+	}
+	if pagination, err := ParsePagination(" Offset "); err != nil || pagination != PaginationOffset {
+		t.Errorf("expected the offset pagination, got %q, %v", pagination, err)
+	}
+	if _, err := ParsePagination("page"); err == nil {
+		t.Error("an unknown pagination should be refused")
+	}
+}
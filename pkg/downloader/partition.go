@@ -0,0 +1,320 @@
+package downloader
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxPartitions the most files a partitioned output is written to, every partition keeping its file open
+const MaxPartitions = 500
+
+// PartitionByHost partitions the rows by the host of their url column, unless the rows have a host column
+const PartitionByHost = "host"
+
+// SetPartitionBy routes the rows into a file per distinct value of the given column, named after the output,
+// e.g. pages.tsv -> pages.status_code=404.tsv, every file starting with the header. "" for a single file.
+// PartitionByHost partitions by the host of the URLs, e.g. pages.host=www.example.com.tsv.
+// It has to be called before Setup()
+func (d *Downloader) SetPartitionBy(column string) {
+	d.partitionBy = strings.TrimSpace(column)
+}
+
+// PartitionFilename returns the file of the rows having the given value in the column, of a partitioned output.
+// Characters of the value that don't belong in a filename are replaced by "_", an empty value is "_": those
+// are suffixed with "~" and a hash of the value, so distinct values never share a file.
+func PartitionFilename(output string, column string, value string) string {
+	return partitionFile(output, column, partitionName(value))
+}
+
+// partitionFile returns the file of the partition of the given name, see partitionName
+func partitionFile(output string, column string, name string) string {
+	return infixedFilename(output, "."+column+"="+name)
+}
+
+// partitionName returns the value as part of a filename. Values that aren't a filename as they are get the
+// hash of the value after their sanitized characters: "~" isn't kept in a value, the names don't collide.
+func partitionName(value string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '.' || r == '_' {
+			return r
+		}
+		return '_'
+	}, value)
+	if sanitized == value && value != "" {
+		return value
+	}
+	if sanitized == "" {
+		sanitized = "_"
+	}
+	digest := sha256.Sum256([]byte(value))
+	return sanitized + "~" + hex.EncodeToString(digest[:4])
+}
+
+// partitionedOutputExists checks if any partition of the output exists, whatever the column
+func partitionedOutputExists(output string) bool {
+	files, _ := filepath.Glob(infixedFilename(output, ".*=*"))
+	return len(files) > 0
+}
+
+// partition a file of a partitioned output
+type partition struct {
+	filename      string
+	file          *os.File
+	compressor    compressor // nil when not compressing
+	writer        *bufio.Writer
+	headerWritten bool
+}
+
+// flush flushes the buffered rows, the partition is complete up to this point
+func (p *partition) flush() error {
+	if err := p.writer.Flush(); err != nil {
+		return err
+	}
+	if p.compressor != nil {
+		return p.compressor.Checkpoint()
+	}
+	return nil
+}
+
+func (p *partition) close() error {
+	err := p.writer.Flush()
+	if p.compressor != nil {
+		if closeErr := p.compressor.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := p.file.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// partitionFiles returns the existing files of the partitioned output
+func (d *Downloader) partitionFiles() ([]string, error) {
+	return filepath.Glob(infixedFilename(d.origOutputFilename, "."+d.partitionBy+"=*"))
+}
+
+// outputExists returns nil if the output exists: its file, or any file of a partitioned output
+func (d *Downloader) outputExists() error {
+	if d.partitionBy == "" {
+		return fExists(d.OutputFilename)
+	}
+	if files, _ := d.partitionFiles(); len(files) == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// preparePartitions sets a partitioned output up, the partitions being opened once they get rows.
+// Resumed partitions are restored to their size at the last confirmed chunk, the other partition files
+// (of a previous download, or created after that chunk) are removed.
+func (d *Downloader) preparePartitions(resumed bool) error {
+	files, err := d.partitionFiles()
+	if err != nil {
+		return err
+	}
+
+	confirmed := map[string]bool{}
+	if resumed {
+		for name, size := range d.Progress.Partitions {
+			filename := partitionFile(d.origOutputFilename, d.partitionBy, name)
+			info, err := os.Stat(filename)
+			if err != nil || info.Size() < size {
+				return fmt.Errorf("cannot resume; %q file is missing or smaller than the last confirmed chunk, it has been altered: use --no-resume to create new", filename)
+			}
+			if err = os.Truncate(filename, size); err != nil {
+				return err
+			}
+			confirmed[filename] = true
+		}
+	}
+	for _, filename := range files {
+		if !confirmed[filename] {
+			os.Remove(filename)
+			os.Remove(filename + ChecksumSuffix)
+		}
+	}
+
+	d.partitions = map[string]*partition{}
+	return nil
+}
+
+// openPartition returns the partition of the value, opening its file the first time
+func (d *Downloader) openPartition(value string) (*partition, error) {
+	name := partitionName(value)
+	if p, ok := d.partitions[name]; ok {
+		return p, nil
+	}
+	if len(d.partitions) >= MaxPartitions {
+		return nil, fmt.Errorf("more than %d distinct values of %s, partition by a column having less values", MaxPartitions, d.partitionBy)
+	}
+	return d.openPartitionFile(name, PartitionFilename(d.origOutputFilename, d.partitionBy, value))
+}
+
+// openPartitionFile opens the file of a partition, appending to it
+func (d *Downloader) openPartitionFile(name string, filename string) (*partition, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	compressor, err := newCompressor(d.Compression, d.compressionLevel, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// the sidecar of a previous download of the partition would be stale until completed
+	if d.checksum {
+		os.Remove(filename + ChecksumSuffix)
+	}
+
+	p := &partition{filename: filename, file: file, compressor: compressor}
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		p.headerWritten = true
+	}
+	if compressor != nil {
+		p.writer = bufio.NewWriter(compressor)
+	} else {
+		p.writer = bufio.NewWriter(file)
+	}
+	if !p.headerWritten {
+		if err = d.writeBOM(p.writer); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	d.partitions[name] = p
+	return p, nil
+}
+
+// partitionSizes returns the size of every partition file, by partition name
+func (d *Downloader) partitionSizes() map[string]int64 {
+	sizes := make(map[string]int64, len(d.partitions))
+	for name, p := range d.partitions {
+		if info, err := p.file.Stat(); err == nil {
+			sizes[name] = info.Size()
+		}
+	}
+	return sizes
+}
+
+// closePartitions flushes and closes every partition, writing their checksum if requested
+func (d *Downloader) closePartitions() error {
+	var err error
+	for _, p := range d.partitions {
+		closeErr := p.close()
+		if closeErr == nil {
+			d.stats.outputCompleted(p.filename, "")
+		}
+		if closeErr == nil && d.checksum {
+			closeErr = d.writeOutputChecksum(p.filename, p.file)
+		}
+		if closeErr == nil {
+			closeErr = d.postProcess(p.filename)
+		}
+		if closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	d.partitions = nil
+	return err
+}
+
+// partitionRowWriter routes the rows of a chunk to the partition of their value
+type partitionRowWriter struct {
+	d       *Downloader
+	header  []string
+	column  int                      // the index of the partition column in the rows
+	host    bool                     // the rows are partitioned by the host of the URL of the column
+	writers map[*partition]RowWriter // the RowWriters of the chunk, by partition
+}
+
+func (d *Downloader) newPartitionRowWriter(header []string) (RowWriter, error) {
+	for i, column := range header {
+		if column == d.partitionBy {
+			return &partitionRowWriter{d: d, header: header, column: i, writers: map[*partition]RowWriter{}}, nil
+		}
+	}
+	if d.partitionBy == PartitionByHost {
+		for i, column := range header {
+			if column == "url" {
+				return &partitionRowWriter{d: d, header: header, column: i, host: true, writers: map[*partition]RowWriter{}}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot partition by %s, the columns are: %s", d.partitionBy, strings.Join(header, ", "))
+}
+
+// urlHost returns the lower-cased host of a URL, without its port, "" if it has none
+func urlHost(location string) string {
+	u, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// WriteHeader does nothing, every partition starts with its own header
+func (w *partitionRowWriter) WriteHeader() error {
+	return nil
+}
+
+func (w *partitionRowWriter) WriteRow(fields []string) error {
+	value := ""
+	if w.column < len(fields) {
+		value = fields[w.column]
+	}
+	if w.host {
+		value = urlHost(value)
+	}
+	p, err := w.d.openPartition(value)
+	if err != nil {
+		return err
+	}
+	writer, err := w.d.partitionWriter(w.writers, p, w.header)
+	if err != nil {
+		return err
+	}
+	return writer.WriteRow(fields)
+}
+
+func (w *partitionRowWriter) Flush() error {
+	return flushPartitionWriters(w.writers)
+}
+
+// partitionWriter returns the RowWriter of the chunk for the partition, writing the header if the partition has none yet
+func (d *Downloader) partitionWriter(writers map[*partition]RowWriter, p *partition, header []string) (RowWriter, error) {
+	if writer, ok := writers[p]; ok {
+		return writer, nil
+	}
+	writer, err := newRowWriter(d.OutputFormat, p.writer, header, d.formatOptions())
+	if err != nil {
+		return nil, err
+	}
+	if !p.headerWritten && !d.noHeader {
+		if err = writer.WriteHeader(); err != nil {
+			return nil, err
+		}
+	}
+	p.headerWritten = true
+	writers[p] = writer
+	return writer, nil
+}
+
+// flushPartitionWriters flushes the RowWriters of a chunk, then their partitions
+func flushPartitionWriters(writers map[*partition]RowWriter) error {
+	for p, writer := range writers {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if err := p.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartitionFilename(t *testing.T) {
+	names := map[[2]string]string{
+		{"pages.tsv", "404"}:                  "pages.status_code=404.tsv",
+		{"exports/pages.csv.gz", "200"}:       "exports/pages.status_code=200.csv.gz",
+		{"pages.tsv", ""}:                     "pages.status_code=_~e3b0c442.tsv",
+		{"pages.tsv", "http://example.com/a"}: "pages.status_code=http___example.com_a~5bd48fa6.tsv",
+	}
+	for c, expected := range names {
+		if name := PartitionFilename(c[0], "status_code", c[1]); name != expected {
+			t.Errorf("expected %q as the partition %q of %q, got %q", expected, c[1], c[0], name)
+		}
+	}
+
+	// the values sanitized alike don't share a file
+	seen := map[string]string{}
+	for _, value := range []string{"a/b", "a_b", "a b", "", "_", "a_b~0"} {
+		name := partitionName(value)
+		if other, ok := seen[name]; ok {
+			t.Errorf("%q and %q are both partitioned to %q", value, other, name)
+		}
+		seen[name] = value
+	}
+}
+
+// servePartitionedAPI serves 4 pages of 2 status codes, in chunks of 2 pages. The second chunk fails while failing is set.
+func servePartitionedAPI(failing *bool) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":1}}`))
+			return
+		}
+		switch query.Get("chunk") {
+		case "0":
+			w.Write([]byte("id\tstatus_code\n1\t200\n2\t404\n"))
+		case "1":
+			if *failing {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("id\tstatus_code\n3\t200\n4\t301\n"))
+		}
+	})
+}
+
+func TestRunPartitioned(t *testing.T) {
+	failing := true
+	defer servePartitionedAPI(&failing)()
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "pages.tsv")
+	// partitions of a previous download are removed when starting again
+	ioutil.WriteFile(PartitionFilename(output, "status_code", "500"), []byte("stale"), 0644)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+		PartitionBy: "status_code", NoResume: true}
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Fatal("the download should fail on the second chunk")
+	}
+	// rows written after the last confirmed chunk are dropped when resuming
+	ioutil.WriteFile(PartitionFilename(output, "status_code", "301"), []byte("id\tstatus_code\n4\t301\n"), 0644)
+	failing = false
+	options.NoResume = false
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions := map[string]string{
+		"200": "id\tstatus_code\n1\t200\n3\t200\n",
+		"404": "id\tstatus_code\n2\t404\n",
+		"301": "id\tstatus_code\n4\t301\n",
+	}
+	for value, expected := range partitions {
+		written, err := ioutil.ReadFile(PartitionFilename(output, "status_code", value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != expected {
+			t.Errorf("unexpected partition %s %q", value, written)
+		}
+	}
+	if fExists(PartitionFilename(output, "status_code", "500")) == nil || fExists(output) == nil {
+		t.Error("only the partitions of the download should be written")
+	}
+	if !IsDownloadCompleted(output) {
+		t.Error("the download should be completed")
+	}
+}
+
+func TestPartitionByHost(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":3}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://www.example.com/\n2\thttps://Blog.Example.com:8443/a\n3\thttp://www.example.com/b\n"))
+	})()
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "pages.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		PartitionBy: PartitionByHost}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	partitions := map[string]string{
+		"www.example.com":  "id\turl\n1\thttp://www.example.com/\n3\thttp://www.example.com/b\n",
+		"blog.example.com": "id\turl\n2\thttps://Blog.Example.com:8443/a\n",
+	}
+	for host, expected := range partitions {
+		written, err := ioutil.ReadFile(PartitionFilename(output, PartitionByHost, host))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != expected {
+			t.Errorf("unexpected partition %s %q", host, written)
+		}
+	}
+}
+
+func TestPartitionByUnknownColumn(t *testing.T) {
+	failing := false
+	defer servePartitionedAPI(&failing)()
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "pages.tsv"), PartitionBy: "depth"})
+	if err = d.Run(context.Background()); err == nil {
+		t.Error("partitioning by a missing column should fail")
+	}
+}
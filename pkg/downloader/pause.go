@@ -0,0 +1,99 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+// pauseControl pauses the download between chunks, see Pause
+type pauseControl struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed once resumed, nil unless paused
+	since   time.Time     // when the download was paused
+	total   time.Duration // how long the download was paused, the current pause excluded
+}
+
+// Pause pauses the download: the chunks being downloaded are written, the output flushed and the resume state
+// persisted, then no chunk is requested until Resume() is called, freeing the bandwidth. An interrupted paused
+// download can be resumed as usual. It's safe to be called from any goroutine, before Run() too.
+func (d *Downloader) Pause() {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+	if d.pause.paused {
+		return
+	}
+	d.pause.paused, d.pause.resumed, d.pause.since = true, make(chan struct{}), time.Now()
+}
+
+// Resume resumes a paused download from the chunk following the last one written
+func (d *Downloader) Resume() {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+	if !d.pause.paused {
+		return
+	}
+	d.pause.total += time.Since(d.pause.since)
+	d.pause.paused = false
+	close(d.pause.resumed)
+}
+
+// Paused tells if the download is paused, see Pause
+func (d *Downloader) Paused() bool {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+	return d.pause.paused
+}
+
+// pausedFor returns how long the download was paused, the current pause included
+func (d *Downloader) pausedFor() time.Duration {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+	if d.pause.paused {
+		return d.pause.total + time.Since(d.pause.since)
+	}
+	return d.pause.total
+}
+
+// awaitResume blocks while the download is paused, once the chunks written. It returns ErrStopped once stopped
+// while paused.
+func (d *Downloader) awaitResume() error {
+	d.pause.mu.Lock()
+	resumed := d.pause.resumed
+	paused := d.pause.paused
+	d.pause.mu.Unlock()
+	if !paused {
+		return nil
+	}
+
+	// the prefetched chunks would be stale once resumed, no request is left running
+	d.dropPrefetched()
+	if err := d.flushOutput(); err != nil {
+		return err
+	}
+	if err := d.PersistConfig(); err != nil {
+		return err
+	}
+	d.appendLog(INFO, "Download paused")
+	d.log().WithField("event", PausedEvent).Info("download paused")
+
+	var done <-chan struct{}
+	if d.ctx != nil {
+		done = d.ctx.Done()
+	}
+	for {
+		select {
+		case <-resumed:
+			d.appendLog(INFO, "Download resumed")
+			d.log().WithField("event", ResumedEvent).Info("download resumed")
+			return nil
+		case <-done:
+			return ErrStopped
+		case <-time.After(RefreshInterval):
+			// Stop is set without cancelling the context
+			if d.Stop {
+				return ErrStopped
+			}
+		}
+	}
+}
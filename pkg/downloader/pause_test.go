@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	var mu sync.Mutex
+	chunks := 0
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		mu.Lock()
+		chunks++
+		mu.Unlock()
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})()
+	dir, err := ioutil.TempDir("", "pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output})
+	d.Pause()
+	if !d.Paused() {
+		t.Fatal("expected the download to be paused")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(context.Background())
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the paused download returned: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	mu.Lock()
+	if chunks != 0 {
+		t.Errorf("the paused download requested %d chunks", chunks)
+	}
+	mu.Unlock()
+
+	d.Resume()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if d.Paused() || d.DoneElements != 2 {
+		t.Errorf("expected the resumed download to complete, %d elements", d.DoneElements)
+	}
+	if paused := d.Summary(nil).PausedSeconds; paused < 0.2 {
+		t.Errorf("expected the pause to be summarized, got %gs", paused)
+	}
+}
+
+func TestPauseCancelled(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv")})
+	d.Pause()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := d.Run(ctx); err == nil {
+		t.Error("a download cancelled while paused should return an error")
+	}
+}
@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// IsPipeOutput checks if the output is a named pipe (FIFO) or a device, e.g. /dev/stdout.
+// Those are written as a stream: they can't be resumed, truncated nor read back.
+func IsPipeOutput(location string) bool {
+	if location == "" || IsRemoteOutput(location) || IsTableOutputLocation(location) {
+		return false
+	}
+	info, err := os.Stat(location)
+	return err == nil && info.Mode()&(os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice) != 0
+}
+
+// openPipe opens the pipe output for writing, waiting for a reader to open it.
+// Rows are written as the chunks are downloaded, the next chunks are only requested once the previous
+// ones are written: a slow reader slows the download down, at most the chunks in flight are kept in memory.
+func (d *Downloader) openPipe() error {
+	d.appendLog(INFO, fmt.Sprintf("Streaming the download to the pipe %s, at the pace of its reader", d.OutputFilename))
+	pipe, err := os.OpenFile(d.OutputFilename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	// the pipe is hashed while written, as a remote output
+	return d.setOutput(pipe, nil)
+}
+
+// pipeError explains the error of a write to a pipe whose reader went away
+func (d *Downloader) pipeError(err error) error {
+	if !d.pipe {
+		return err
+	}
+	cause := err
+	if pathErr, ok := err.(*os.PathError); ok {
+		cause = pathErr.Err
+	}
+	if cause == syscall.EPIPE {
+		return fmt.Errorf("the reader of the pipe %s went away, the download stopped", d.OutputFilename)
+	}
+	return err
+}
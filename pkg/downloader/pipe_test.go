@@ -0,0 +1,52 @@
+// +build !windows
+
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunPipe(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "pages.fifo")
+	if err = syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("cannot create a FIFO: %v", err)
+	}
+
+	// a pipe is written again by every download, nothing is resumed
+	for i := 0; i < 2; i++ {
+		read := make(chan []byte)
+		go func() {
+			rows, _ := ioutil.ReadFile(fifo)
+			read <- rows
+		}()
+		if err = New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: fifo, Checksum: true}).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if rows := <-read; string(rows) != "id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n" {
+			t.Errorf("unexpected rows read from the pipe %q", rows)
+		}
+	}
+	if fExists(fifo+resumerSuffix) == nil {
+		t.Error("nothing should be persisted to resume a pipe")
+	}
+	if fExists(fifo+ChecksumSuffix) != nil {
+		t.Error("the pipe is hashed while written, its checksum should be written")
+	}
+
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: fifo, SplitRows: 1})
+	if err = d.Prepare(); err == nil {
+		t.Error("a pipe can't be split")
+	}
+}
@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultBufferSize the number of rows held between the stages of the chunk pipeline, see SetBufferSize
+const DefaultBufferSize = 1000
+
+// SetBufferSize sets how many rows can be held between reading, processing and writing a chunk.
+// A chunk requested alone is written as it's received: the memory used depends on the buffer size,
+// not on the chunk size. Chunks requested in parallel, or verified with SetChecksum, are received whole first.
+// It has to be called before Setup()
+func (d *Downloader) SetBufferSize(rows int) error {
+	if rows < 1 {
+		return fmt.Errorf("the buffer size has to be at least 1 row")
+	}
+	d.bufferSize = rows
+	return nil
+}
+
+// chunkStream the body of a response being received, decompressed if needed
+type chunkStream struct {
+	reader     io.Reader
+	closers    []io.Closer
+	url        string
+	counters   *requestCounters
+	countBytes bool       // the bytes read count as downloaded, for chunks written as they're received
+	span       trace.Span // the span of the chunk request, ended once closed
+	bytes      int        // the bytes read so far, after decompression
+	err        error      // the read error, if any
+	// resume requests the response again once reading it timed out, the bytes read being skipped, see
+	// AudistoAPIClient.resumeStream; nil if it can't be retried
+	resume  func(retry int, skip int) (*chunkStream, error)
+	retries int // the retries of the timed out reads so far
+}
+
+func (s *chunkStream) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.bytes += n
+	if s.countBytes {
+		s.counters.countDownloadedBytes(n)
+	}
+	if err != nil && err != io.EOF {
+		if isTimeout(err) {
+			s.counters.countTimeout()
+			if s.retry() {
+				return n, nil
+			}
+			err = &NetworkError{Err: fmt.Errorf("Timed out reading the URL %s: %s", s.url, err)}
+		}
+		s.err = err
+	}
+	return n, err
+}
+
+// retry reads the rest of the response from the response requested again, as per the retry policy.
+// It returns false once the retries are exhausted, or if the response can't be requested again.
+func (s *chunkStream) retry() bool {
+	if s.resume == nil {
+		return false
+	}
+	s.retries++
+	next, err := s.resume(s.retries, s.bytes)
+	if err != nil {
+		return false
+	}
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i].Close()
+	}
+	s.reader, s.closers = next.reader, next.closers
+	return true
+}
+
+// Close closes the response, it can be called more than once
+func (s *chunkStream) Close() error {
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if closeErr := s.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	s.closers = nil
+	if s.span != nil {
+		s.span.SetAttributes(attribute.Int("audisto.bytes", s.bytes))
+		endSpan(s.span, s.err)
+		s.span = nil
+	}
+	return err
+}
+
+// reader returns the reader of the rows of the chunk, received as they're read if streamed
+func (c fetchedChunk) reader() io.Reader {
+	if c.stream != nil {
+		return c.stream
+	}
+	return bytes.NewReader(c.body)
+}
+
+// received returns the bytes of the chunk received so far
+func (c fetchedChunk) received() int {
+	if c.stream != nil {
+		return c.stream.bytes
+	}
+	return len(c.body)
+}
+
+// close closes the response of a streamed chunk
+func (c fetchedChunk) close() {
+	if c.stream != nil {
+		c.stream.Close()
+	}
+}
+
+// closeChunks closes the responses of the chunks, written or not
+func closeChunks(chunks []fetchedChunk) {
+	for _, chunk := range chunks {
+		chunk.close()
+	}
+}
+
+// processedRow a row of a chunk, ready to be written
+type processedRow struct {
+	fields []string // the projected fields
+	write  bool     // false for a row not matching the where expression: downloaded, but not written
+	url    string   // the URL counted by the duplicates report, "" unless reported
+	id     string   // the id of the row, "" unless the drift is checked
+}
+
+// chunkPipeline reads the rows of a chunk and processes them (transforms, where expression, columns),
+// each in its own goroutine, while the rows processed are written. At most bufferSize rows are held
+// between two stages, whatever the chunk size.
+type chunkPipeline struct {
+	rows    chan processedRow
+	done    chan struct{}
+	wg      sync.WaitGroup
+	chunk   fetchedChunk
+	scanner *bufio.Scanner
+}
+
+// startChunkPipeline starts reading and processing the rows of the chunk following its header,
+// the given number of rows already downloaded being skipped
+func (d *Downloader) startChunkPipeline(chunk fetchedChunk, scanner *bufio.Scanner, headerLine string,
+	skip uint64, projection columnsProjection) *chunkPipeline {
+	p := &chunkPipeline{
+		rows:    make(chan processedRow, d.bufferSize),
+		done:    make(chan struct{}),
+		chunk:   chunk,
+		scanner: scanner,
+	}
+	lines := make(chan string, d.bufferSize)
+	sanitizer := d.newRowSanitizer(strings.Split(headerLine, "\t"))
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		defer close(lines)
+		// skip lines that we alredy have
+		for i := uint64(0); i < skip && scanner.Scan(); i++ {
+			d.debugf("skipping this row: \n%s ", scanner.Text())
+		}
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		defer close(p.rows)
+		for line := range lines {
+			// a header repeated within the chunk is not a row
+			if line == headerLine {
+				continue
+			}
+			// malformed values are sanitized first, a tab in a title shifts the columns
+			fields := d.enrichRow(sanitizer.apply(strings.Split(line, "\t")))
+			// the URLs listed and the conditions of the filter left to the client are matched as downloaded,
+			// before any transform
+			listed := d.urls.match(fields) && d.localFilter.match(fields)
+			id := d.drift.id(fields)
+			// rows are transformed first, the where expression matches the transformed values
+			d.transformRow(fields)
+			row := processedRow{fields: d.annotations.row(projection.apply(fields)), write: listed && (d.where == nil || d.where.Match(fields)), id: id}
+			if d.duplicates != nil {
+				row.url = d.duplicates.url(fields)
+			}
+			select {
+			case p.rows <- row:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// stop stops reading the chunk before its end, e.g. once writing failed, and waits for the stages to return
+func (p *chunkPipeline) stop() {
+	close(p.done)
+	// a read waiting for the network returns once the response is closed
+	p.chunk.close()
+	p.wg.Wait()
+}
+
+// err returns the error reading the chunk, once every row is received
+func (p *chunkPipeline) err() error {
+	return p.scanner.Err()
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamedChunkCutShortResumes(t *testing.T) {
+	// the first response stalls after two rows, outlasting the request timeout
+	var requests int32
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":4}}`))
+			return
+		}
+		chunk, _ := strconv.Atoi(r.URL.Query().Get("chunk"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("chunk_size"))
+		w.Write([]byte("id\turl\n"))
+		for row := chunk * size; row < (chunk+1)*size; row++ {
+			fmt.Fprintf(w, "%d\t%c\n", row+1, 'a'+row)
+			if row == 1 && atomic.AddInt32(&requests, 1) == 1 {
+				w.(http.Flusher).Flush()
+				time.Sleep(500 * time.Millisecond)
+			}
+		}
+	})()
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		ChunkSize: 4, BufferSize: 1, RequestTimeout: 200 * time.Millisecond,
+		RetryPolicy: &RetryPolicy{MaxRetries: 0, Backoff: time.Millisecond}}
+	// without retries, the response timing out fails the download
+	if err = New(options).Run(context.Background()); !IsNetworkError(err) {
+		t.Fatalf("expected a network error, got %v", err)
+	}
+	written, err := ioutil.ReadFile(output + PartialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n1\ta\n2\tb\n" {
+		t.Errorf("the rows received before the timeout should be written, got %q", written)
+	}
+
+	// resumed from the first row not written
+	options.RequestTimeout = 0
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written, err = ioutil.ReadFile(output); err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n1\ta\n2\tb\n3\tc\n4\td\n" {
+		t.Errorf("unexpected resumed output %q", written)
+	}
+
+	// with a retry, the rest of the response is read from the chunk requested again
+	atomic.StoreInt32(&requests, 0)
+	options.Output, options.RequestTimeout = filepath.Join(dir, "retried.tsv"), 200*time.Millisecond
+	options.RetryPolicy = &RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written, err = ioutil.ReadFile(options.Output); err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n1\ta\n2\tb\n3\tc\n4\td\n" {
+		t.Errorf("unexpected retried output %q", written)
+	}
+}
@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FilePlaceholder the placeholder of a post-process command replaced with the completed file, see SetPostProcess
+	FilePlaceholder = "{file}"
+	// NamePlaceholder the placeholder of a post-process command replaced with the name of the completed file
+	NamePlaceholder = "{name}"
+	// DirPlaceholder the placeholder of a post-process command replaced with the directory of the completed file
+	DirPlaceholder = "{dir}"
+	// PartPlaceholder the placeholder of a post-process command replaced with the number of the completed part,
+	// "" unless the output is split
+	PartPlaceholder = "{part}"
+	// SHA256Placeholder the placeholder of a post-process command replaced with the SHA-256 of the completed file,
+	// "" unless checksummed
+	SHA256Placeholder = "{sha256}"
+)
+
+// PostProcessPlaceholders the placeholders of the post-process commands
+var PostProcessPlaceholders = []string{FilePlaceholder, NamePlaceholder, DirPlaceholder, CrawlIDPlaceholder,
+	ModePlaceholder, PartPlaceholder, SHA256Placeholder}
+
+// SetPostProcess runs the command after every output file is completed: each part of a split output, each
+// partition, the pages and the links files of targets=self, the file being complete and checksummed already.
+// The command is run by the shell (sh, cmd on Windows), its placeholders (see PostProcessPlaceholders)
+// replaced with their value, quoted, e.g. "gsutil cp {file} gs://bucket/{crawl_id}/". Its output goes to
+// stderr. A command failing fails the download with a PostProcessError, the file staying complete.
+// "" runs nothing. It has to be called before Setup()
+func (d *Downloader) SetPostProcess(command string) error {
+	if err := ValidatePostProcess(command); err != nil {
+		return err
+	}
+	d.postProcessCommand = strings.TrimSpace(command)
+	return nil
+}
+
+// ValidatePostProcess checks the placeholders of a post-process command
+func ValidatePostProcess(command string) error {
+	for _, placeholder := range outputPlaceholderPattern.FindAllString(command, -1) {
+		if !containsString(PostProcessPlaceholders, placeholder) {
+			return fmt.Errorf("unknown placeholder %s in the post-process command, the placeholders are: %s", placeholder,
+				strings.Join(PostProcessPlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+// postProcessCommandFor returns the post-process command of a completed output, its placeholders replaced
+func (d *Downloader) postProcessCommandFor(output string) string {
+	name, dir := filepath.Base(output), filepath.Dir(output)
+	if IsRemoteOutput(output) {
+		name, dir = path.Base(output), path.Dir(output)
+	}
+	part := ""
+	if d.isSplit() {
+		part = strconv.Itoa(d.part)
+	}
+	replacements := []string{
+		FilePlaceholder, shellQuote(output),
+		NamePlaceholder, shellQuote(name),
+		DirPlaceholder, shellQuote(dir),
+		PartPlaceholder, shellQuote(part),
+		SHA256Placeholder, shellQuote(d.stats.checksums[output]),
+	}
+	if d.client != nil {
+		replacements = append(replacements, CrawlIDPlaceholder, shellQuote(strconv.FormatUint(d.client.CrawlID, 10)),
+			ModePlaceholder, shellQuote(d.client.Mode))
+	}
+	// in a single pass: the values replaced, e.g. a file named {mode}, aren't replaced again
+	return strings.NewReplacer(replacements...).Replace(d.postProcessCommand)
+}
+
+// postProcess runs the post-process command of a completed output, if any
+func (d *Downloader) postProcess(output string) error {
+	if d.postProcessCommand == "" || output == "" {
+		return nil
+	}
+	command := d.postProcessCommandFor(output)
+	d.appendLog(INFO, "Post-processing "+RedactOutput(output))
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := shellCommand(ctx, command)
+	// stdout may be the rows of another download
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return &PostProcessError{Output: RedactOutput(output), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// +build !windows
+
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	for value, expected := range map[string]string{
+		"crawl.tsv":        "crawl.tsv",
+		"/tmp/crawl 1.tsv": "'/tmp/crawl 1.tsv'",
+		"it's.tsv":         `'it'\''s.tsv'`,
+		"":                 "''",
+	} {
+		if quoted := shellQuote(value); quoted != expected {
+			t.Errorf("%q: expected %s, got %s", value, expected, quoted)
+		}
+	}
+}
+
+func TestPostProcessCommandFor(t *testing.T) {
+	// the placeholders in the values replaced are left as is, e.g. a directory named {mode}
+	d := &Downloader{postProcessCommand: "echo {file} {mode}", client: &AudistoAPIClient{CrawlID: 1, Mode: "links; rm -rf ~"}}
+	if command := d.postProcessCommandFor("/tmp/{mode}/crawl.tsv"); command != `echo '/tmp/{mode}/crawl.tsv' 'links; rm -rf ~'` {
+		t.Errorf("unexpected command %s", command)
+	}
+}
+
+func TestValidatePostProcess(t *testing.T) {
+	if err := ValidatePostProcess("gsutil cp {file} gs://bucket/{crawl_id}/{mode}/"); err != nil {
+		t.Error(err)
+	}
+	if err := ValidatePostProcess("cp {file} {target}"); err == nil {
+		t.Error("expected the unknown placeholder to be rejected")
+	}
+}
+
+func TestPostProcess(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := query.Get("chunk")
+		w.Write([]byte("id\turl\n" + chunk + "\thttp://example.com/" + chunk + "\n"))
+	})()
+	dir, err := ioutil.TempDir("", "postprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	processed := filepath.Join(dir, "processed.txt")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 1,
+		SplitRows: 2, PostProcess: "echo {name} {part} {crawl_id} {mode} >> " + shellQuote(processed)}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(processed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Base(PartFilename(output, 1)) + " 1 12345 pages\n" + filepath.Base(PartFilename(output, 2)) + " 2 12345 pages\n"
+	if string(data) != expected {
+		t.Errorf("expected every part to be post-processed once completed, got %q", data)
+	}
+
+	// a failing command fails the download, the file staying complete
+	options = Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "failed.tsv"),
+		ChunkSize: 1, PostProcess: "test -s {file} && false"}
+	if err = New(options).Run(context.Background()); !IsPostProcessFailed(err) {
+		t.Fatalf("expected a post-process error, got %v", err)
+	}
+	if !IsDownloadCompleted(options.Output) {
+		t.Error("the download should be completed")
+	}
+}
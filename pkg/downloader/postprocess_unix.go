@@ -0,0 +1,26 @@
+// +build !windows
+
+package downloader
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// shellSafe matches the values the shell reads as they are, without quotes
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// shellCommand returns the command run by the shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// shellQuote quotes a value for the shell, as a single word
+func shellQuote(value string) string {
+	if shellSafe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package downloader
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// shellCommand returns the command run by cmd, the command line being passed as is
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd /S /C "` + command + `"`}
+	return cmd
+}
+
+// shellQuote quotes a value for cmd, as a single word: file names can't have double quotes.
+// A % is expanded within double quotes, it's escaped out of them, e.g. "100"^%" done".
+func shellQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t&|<>^()%!,;=") {
+		return value
+	}
+	return `"` + strings.Replace(value, "%", `"^%"`, -1) + `"`
+}
@@ -0,0 +1,86 @@
+package downloader
+
+// SetPrefetch when set to false, the next chunks are requested once the current ones are written. Otherwise
+// (default) they're requested while the current ones are written, so the network isn't idle while the rows are
+// processed and written, nor the disk while the next chunks are received. The chunks prefetched are received
+// whole: one more chunk (or --concurrency chunks) is held in memory. The chunks aren't prefetched while the
+// chunk size is tuned, their timings would be skewed.
+// It has to be called before Setup()
+func (d *Downloader) SetPrefetch(prefetch bool) {
+	d.noPrefetch = !prefetch
+}
+
+// chunkPrefetch the chunks following the ones being written, requested ahead
+type chunkPrefetch struct {
+	number uint64 // the number of the first chunk requested
+	size   uint64 // the size of the chunks requested
+	chunks []fetchedChunk
+	err    error
+	done   chan struct{} // closed once the chunks are fetched
+}
+
+// wait waits for the chunks to be fetched, and returns them
+func (p *chunkPrefetch) wait() ([]fetchedChunk, error) {
+	<-p.done
+	return p.chunks, p.err
+}
+
+// prefetchChunks starts requesting the chunks following the given ones, expecting them to be written whole.
+// Nothing is requested when the given chunks are the last ones of the target.
+func (d *Downloader) prefetchChunks(chunks []fetchedChunk) {
+	// the chunks paged through by keyset are requested once the previous ones are written
+	if d.noPrefetch || d.chunkSizeTuner != nil || len(chunks) == 0 || d.drift != nil && d.drift.keyset {
+		return
+	}
+	last := chunks[len(chunks)-1]
+	done, total := last.start+last.size, d.CurrentTarget.TotalElements
+	if done >= total {
+		return
+	}
+	// the last chunk of the target is requested with the remaining elements only, as nextChunkNumber() does
+	size := last.size
+	if total-done < size {
+		size = total - done
+	}
+	if done%size != 0 {
+		return
+	}
+
+	// the client's chunk number and size change while the current chunks are written, the chunks are requested
+	// by a copy of it
+	p := &chunkPrefetch{number: done / size, size: size, done: make(chan struct{})}
+	client, count := *d.client, d.chunksCount(p.number, size)
+	d.prefetched = p
+	go func() {
+		defer close(p.done)
+		p.chunks, p.err = d.fetchChunks(&client, p.number, size, count, false)
+	}()
+}
+
+// takePrefetched returns the prefetched chunks if they're the ones to be requested next, ok is false otherwise.
+// Prefetched chunks that don't follow the chunks written, e.g. once the chunk size is throttled or a chunk
+// was short, are dropped. So are the ones that failed, they're requested again to be retried.
+func (d *Downloader) takePrefetched(number uint64, size uint64) (chunks []fetchedChunk, ok bool) {
+	p := d.prefetched
+	if p == nil {
+		return nil, false
+	}
+	d.prefetched = nil
+	chunks, err := p.wait()
+	if err != nil || p.number != number || p.size != size {
+		closeChunks(chunks)
+		return nil, false
+	}
+	d.debugf("Next %d chunk(s) prefetched", len(chunks))
+	return chunks, true
+}
+
+// dropPrefetched drops the prefetched chunks once the target is downloaded or failed, waiting for their requests
+func (d *Downloader) dropPrefetched() {
+	if d.prefetched == nil {
+		return
+	}
+	chunks, _ := d.prefetched.wait()
+	closeChunks(chunks)
+	d.prefetched = nil
+}
@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// servePrefetchedRows serves total pages in chunks of 10. The rows of the first chunk are only sent once the
+// second chunk is requested, or after a while: a download writing a chunk before requesting the next one waits.
+func servePrefetchedRows(total int, requested *[]string, waited *bool, mu *sync.Mutex) func() {
+	// the chunks requested by their first row, the size of the last one being the elements left
+	started := map[int]chan struct{}{}
+	startedChunk := func(start int) chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		if started[start] == nil {
+			started[start] = make(chan struct{})
+		}
+		return started[start]
+	}
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			fmt.Fprintf(w, `{"chunk":{"total":%d,"page":0,"size":10}}`, total)
+			return
+		}
+		var chunk, size int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Sscan(r.URL.Query().Get("chunk_size"), &size)
+		mu.Lock()
+		*requested = append(*requested, r.URL.Query().Get("chunk"))
+		mu.Unlock()
+		close(startedChunk(chunk * size))
+
+		fmt.Fprint(w, "id\turl\n")
+		w.(http.Flusher).Flush()
+		if chunk == 0 && size < total {
+			select {
+			case <-startedChunk((chunk + 1) * size):
+			case <-time.After(2 * time.Second):
+				mu.Lock()
+				*waited = true
+				mu.Unlock()
+			}
+		}
+		for id := chunk * size; id < (chunk+1)*size && id < total; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", id, id)
+		}
+	})
+}
+
+func TestPrefetch(t *testing.T) {
+	var requested []string
+	var waited bool
+	var mu sync.Mutex
+	defer servePrefetchedRows(35, &requested, &waited, &mu)()
+	dir, err := ioutil.TempDir("", "prefetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 10}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 36 || lines[1] != "0\thttp://example.com/0" || lines[35] != "34\thttp://example.com/34" {
+		t.Errorf("expected the 35 rows in order, got %d lines", len(lines))
+	}
+
+	// every chunk is requested once, the second one while the first one is received
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(requested, ",") != "0,1,2,6" {
+		t.Errorf("unexpected chunks requested %v", requested)
+	}
+	if waited {
+		t.Errorf("a chunk was requested once the previous one was written")
+	}
+}
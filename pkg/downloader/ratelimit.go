@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the requests sent to Audisto API.
+// Up to "burst" requests can be sent at once, then one request every interval.
+// It's safe to be used by parallel requests.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewRateLimiter makes a RateLimiter allowing the given number of requests per period, e.g. 600 per minute
+func NewRateLimiter(requests int, per time.Duration) (*RateLimiter, error) {
+	if requests < 1 || per <= 0 {
+		return nil, fmt.Errorf("rate limit has to be at least one request per period")
+	}
+	// bursts are capped to the number of parallel requests we can make
+	burst := float64(requests)
+	if burst > MaxConcurrency {
+		burst = MaxConcurrency
+	}
+	return &RateLimiter{
+		interval: per / time.Duration(requests),
+		burst:    burst,
+		tokens:   burst,
+		last:     time.Now(),
+	}, nil
+}
+
+// Wait blocks until a request can be sent
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	// refill the bucket with the tokens earned since the last request
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// take a token, possibly in advance: waiting requests queue up by driving the bucket negative
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens * float64(l.interval))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// ParseRateLimit parses a rate limit in the form of "10/s", "600/m" or "3600/h".
+// A number alone is a number of requests per second.
+func ParseRateLimit(limit string) (requests int, per time.Duration, err error) {
+	limit = strings.ToLower(strings.TrimSpace(limit))
+	parts := strings.SplitN(limit, "/", 2)
+
+	requests, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests < 1 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q: expected e.g. 10/s or 600/m", limit)
+	}
+
+	per = time.Second
+	if len(parts) == 2 {
+		switch strings.TrimSpace(parts[1]) {
+		case "s", "sec", "second":
+			per = time.Second
+		case "m", "min", "minute":
+			per = time.Minute
+		case "h", "hour":
+			per = time.Hour
+		default:
+			return 0, 0, fmt.Errorf("invalid rate limit %q: the period has to be s, m or h", limit)
+		}
+	}
+	return requests, per, nil
+}
@@ -0,0 +1,36 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for limit, expected := range map[string]time.Duration{"10": time.Second, "10/s": time.Second, "10/m": time.Minute, "10/H": time.Hour} {
+		requests, per, err := ParseRateLimit(limit)
+		if err != nil || requests != 10 || per != expected {
+			t.Errorf("%q: expected 10 requests per %v, got %d per %v (%v)", limit, expected, requests, per, err)
+		}
+	}
+	for _, limit := range []string{"", "0/s", "ten/s", "10/day"} {
+		if _, _, err := ParseRateLimit(limit); err == nil {
+			t.Errorf("%q should not be a valid rate limit", limit)
+		}
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter, err := NewRateLimiter(100, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the burst is served at once, the following requests are spaced by 10ms
+	start := time.Now()
+	for i := 0; i < MaxConcurrency+5; i++ {
+		limiter.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("requests beyond the burst should be delayed, took %v", elapsed)
+	}
+}
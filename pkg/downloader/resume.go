@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+)
+
+// resumeParameters the parameters a download was begun with.
+// Resuming a download with different parameters would produce an inconsistent output file.
+type resumeParameters struct {
+	CrawlID uint64 `json:"crawlID"`
+	Mode    string `json:"mode"`
+	Filter  string `json:"filter"`
+	Order   string `json:"order"`
+	Columns string `json:"columns,omitempty"`
+
+	SplitRows uint64 `json:"splitRows,omitempty"`
+	SplitSize int64  `json:"splitSize,omitempty"`
+
+	PartitionBy string `json:"partitionBy,omitempty"`
+	EnrichPages bool   `json:"enrichPages,omitempty"`
+	AddColumns  string `json:"addColumns,omitempty"`
+	Where       string `json:"where,omitempty"`
+	Transforms  string `json:"transforms,omitempty"`
+	Limit       uint64 `json:"limit,omitempty"`
+	URLs        string `json:"urls,omitempty"` // the digest of the URLs file
+}
+
+// resumeProgress keeps track of the last chunk confirmed to be written to the output file
+type resumeProgress struct {
+	// LastChunk the number of the last completed chunk
+	LastChunk uint64 `json:"lastChunk"`
+	// ChunkSize the size of the chunks when the last chunk was completed (chunks can be throttled)
+	ChunkSize uint64 `json:"chunkSize"`
+	// OutputSize the size in bytes of the output file once the last chunk was written
+	OutputSize int64 `json:"outputSize"`
+	// Header the header of the first chunk, the following chunks have to match it
+	Header []string `json:"header,omitempty"`
+
+	// Part the part of a split output the last chunk was written to, with its rows and bytes at that point
+	Part      int    `json:"part,omitempty"`
+	PartRows  uint64 `json:"partRows,omitempty"`
+	PartBytes int64  `json:"partBytes,omitempty"`
+
+	// Partitions the size of every file of a partitioned output once the last chunk was written, by partition
+	Partitions map[string]int64 `json:"partitions,omitempty"`
+
+	// ExportedAt when the download was begun, the exported_at column added to the rows, see SetAddColumns
+	ExportedAt string `json:"exportedAt,omitempty"`
+}
+
+// validate checks if the given parameters match the ones a download was begun with.
+func (p resumeParameters) validate(requested resumeParameters) error {
+	// resume files persisted by previous versions of this package don't have parameters
+	if p == (resumeParameters{}) {
+		return nil
+	}
+
+	if p.CrawlID != requested.CrawlID {
+		return fmt.Errorf("this file was begun with --crawl=%d; continuing with --crawl=%d will break the file", p.CrawlID, requested.CrawlID)
+	}
+	if p.Mode != requested.Mode {
+		return fmt.Errorf("this file was begun with --mode=%q; continuing with --mode=%q will break the file", p.Mode, requested.Mode)
+	}
+	// the URLs narrow the filter, they're compared first
+	if p.URLs != requested.URLs {
+		return fmt.Errorf("this file was begun with another --urls-file (%q); continuing with %q will break the file", p.URLs, requested.URLs)
+	}
+	if p.Filter != requested.Filter {
+		return fmt.Errorf("this file was begun with --filter=%q; continuing with --filter=%q will break the file", p.Filter, requested.Filter)
+	}
+	if p.Order != requested.Order {
+		return fmt.Errorf("this file was begun with --order=%q; continuing with --order=%q will break the file", p.Order, requested.Order)
+	}
+	if p.Columns != requested.Columns {
+		return fmt.Errorf("this file was begun with --columns=%q; continuing with --columns=%q will break the file", p.Columns, requested.Columns)
+	}
+	if p.SplitRows != requested.SplitRows || p.SplitSize != requested.SplitSize {
+		return fmt.Errorf("this file was begun with --split-rows=%d --split-size=%d; continuing with --split-rows=%d --split-size=%d will break the parts",
+			p.SplitRows, p.SplitSize, requested.SplitRows, requested.SplitSize)
+	}
+	if p.PartitionBy != requested.PartitionBy {
+		return fmt.Errorf("this file was begun with --partition-by=%q; continuing with --partition-by=%q will break the partitions", p.PartitionBy, requested.PartitionBy)
+	}
+	if p.EnrichPages != requested.EnrichPages {
+		return fmt.Errorf("this file was begun with --enrich-pages=%v; continuing with --enrich-pages=%v will break the file", p.EnrichPages, requested.EnrichPages)
+	}
+	if p.AddColumns != requested.AddColumns {
+		return fmt.Errorf("this file was begun with --add-columns=%q; continuing with --add-columns=%q will break the file", p.AddColumns, requested.AddColumns)
+	}
+	if p.Where != requested.Where {
+		return fmt.Errorf("this file was begun with --where=%q; continuing with --where=%q will break the file", p.Where, requested.Where)
+	}
+	if p.Limit != requested.Limit {
+		return fmt.Errorf("this file was begun with --limit=%d; continuing with --limit=%d will break the file", p.Limit, requested.Limit)
+	}
+	if p.Transforms != requested.Transforms {
+		return fmt.Errorf("this file was begun with the transforms %q; continuing with the transforms %q will break the file", p.Transforms, requested.Transforms)
+	}
+	return nil
+}
+
+// SetMustResume when set to true, Setup() fails if there's no previous download to resume,
+// instead of silently starting a new download.
+func (d *Downloader) SetMustResume(mustResume bool) {
+	d.mustResume = mustResume
+}
+
+// confirmChunk records the chunk as completely written, along with the current size of the output file
+func (d *Downloader) confirmChunk(chunk fetchedChunk) {
+	if chunk.size > 0 {
+		d.Progress.LastChunk = chunk.start / chunk.size
+	}
+	d.Progress.ChunkSize = chunk.size
+	d.Progress.Part, d.Progress.PartRows, d.Progress.PartBytes = d.part, d.partRows, d.partBytes
+
+	if d.partitions != nil {
+		d.Progress.Partitions = d.partitionSizes()
+	}
+	if d.outputFile != nil {
+		if info, err := d.outputFile.Stat(); err == nil {
+			d.Progress.OutputSize = info.Size()
+		}
+	}
+}
+
+// restoreOutputFile drops from the output file whatever was written after the last confirmed chunk.
+// Rows written after it are not counted in the resume state, they will be downloaded again.
+func (d *Downloader) restoreOutputFile(file *os.File) error {
+	// resume files persisted by previous versions of this package don't record the output size
+	if d.Progress.OutputSize == 0 {
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < d.Progress.OutputSize {
+		return fmt.Errorf("cannot resume; %q file is smaller than the last confirmed chunk, it has been altered: use --no-resume to create new", d.OutputFilename)
+	}
+
+	if info.Size() > d.Progress.OutputSize {
+		d.appendLog(WARNING, fmt.Sprintf("Dropping %d bytes written after the last confirmed chunk\n", info.Size()-d.Progress.OutputSize))
+		return file.Truncate(d.Progress.OutputSize)
+	}
+	return nil
+}
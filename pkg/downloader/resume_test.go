@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResumeParametersValidate(t *testing.T) {
+	persisted := resumeParameters{CrawlID: 1, Mode: "pages", Filter: "http_status:404"}
+
+	if err := persisted.validate(persisted); err != nil {
+		t.Errorf("same parameters should be valid: %v", err)
+	}
+
+	changed := persisted
+	changed.Filter = "http_status:200"
+	if err := persisted.validate(changed); err == nil {
+		t.Errorf("a different filter should not be valid")
+	}
+
+	changed = persisted
+	changed.Columns = "url,depth"
+	if err := persisted.validate(changed); err == nil {
+		t.Errorf("different columns should not be valid")
+	}
+
+	// resume files without parameters can always be resumed
+	if err := (resumeParameters{}).validate(changed); err != nil {
+		t.Errorf("empty persisted parameters should be valid: %v", err)
+	}
+}
+
+func TestRestoreOutputFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("header\nrow1\nrow2 partially writ")
+
+	d := &Downloader{Progress: resumeProgress{OutputSize: int64(len("header\nrow1\n"))}}
+	if err := d.restoreOutputFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+	if string(content) != "header\nrow1\n" {
+		t.Errorf("output file should be truncated to the last confirmed chunk, got %q", content)
+	}
+
+	d.Progress.OutputSize = 1000
+	if err := d.restoreOutputFile(file); err == nil {
+		t.Errorf("an output file smaller than the confirmed size should not be resumed")
+	}
+}
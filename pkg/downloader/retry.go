@@ -0,0 +1,248 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultMaxRetries the number of retries of a failed request if NOT explicitly set
+	DefaultMaxRetries = 5
+
+	// DefaultRetryBackoff the pause before the first retry if NOT explicitly set, doubled on every retry
+	DefaultRetryBackoff = 2 * time.Second
+
+	// DefaultMaxRetryBackoff caps the pause between two retries, unless the API asks for more (Retry-After)
+	DefaultMaxRetryBackoff = 2 * time.Minute
+)
+
+// RetryPolicy defines how requests to Audisto API are retried on network errors and transient
+// responses (429 and 5xx), using an exponential backoff with jitter.
+type RetryPolicy struct {
+	// MaxRetries the number of retries after the first attempt, 0 disables retries
+	MaxRetries int
+	// Backoff the pause before the first retry, doubled on every retry
+	Backoff time.Duration
+	// MaxBackoff caps the pause between two retries
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used if NOT explicitly set
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultRetryBackoff,
+		MaxBackoff: DefaultMaxRetryBackoff,
+	}
+}
+
+// isTransientStatusCode checks if a response status code is worth retrying the request for
+func isTransientStatusCode(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns the pause before the given retry, starting at 1.
+// A Retry-After header of the response always wins over the computed backoff.
+func (p RetryPolicy) delay(retry int, response *http.Response) time.Duration {
+	if response != nil {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return retryAfter
+		}
+	}
+
+	backoff := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff == 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	// "equal jitter": half of the backoff is kept, the other half is random.
+	// This spreads the retries of parallel requests instead of retrying all at once.
+	if half := int64(backoff / 2); half > 0 {
+		return time.Duration(half + rand.Int63n(half))
+	}
+	return backoff
+}
+
+// parseRetryAfter parses a Retry-After header value, either delay-seconds or an HTTP-date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// doWithRetries executes the request, retrying it as per the client retry policy.
+// The last response (or error) is returned once the retries are exhausted.
+func (api *AudistoAPIClient) doWithRetries(request *http.Request) (*http.Response, error) {
+	policy := api.RetryPolicy
+
+	for retry := 0; ; retry++ {
+		if retry > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request.Body = body
+		}
+
+		if api.retries != nil {
+			*api.retries = retry
+		}
+
+		// every attempt is an API call of the budget, if any
+		if err := api.counters.spendCall(); err != nil {
+			return nil, err
+		}
+
+		// retries count towards the rate limit as well
+		if api.RateLimiter != nil {
+			api.RateLimiter.Wait()
+		}
+
+		// every attempt is a span, retries having a resend count
+		ctx, span := startSpan(api.traceContext, "api request",
+			attribute.String("http.request.method", request.Method),
+			attribute.Int("http.request.resend_count", retry))
+		injectTraceContext(ctx, request)
+		response, err := api.httpClient.Do(request)
+		endRequestSpan(span, response, err)
+		if err == nil && !isTransientStatusCode(response.StatusCode) {
+			return response, nil
+		}
+		// a request missing from the fixtures replayed is missing on retries too
+		if retry >= policy.MaxRetries || IsFixtureNotFound(err) {
+			return response, err
+		}
+
+		api.counters.countError()
+		api.counters.countRetry()
+		api.Metrics.retry()
+		if isTimeout(err) {
+			api.counters.countTimeout()
+		}
+		if response != nil {
+			if response.StatusCode == http.StatusGatewayTimeout {
+				api.counters.countTimeout()
+			}
+			// drain the body so the connection can be reused
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		delay := policy.delay(retry+1, response)
+		entry := api.log().WithFields(logrus.Fields{"event": RetryEvent, "retry": retry + 1, "delay": delay.String()})
+		if response != nil {
+			entry = entry.WithField("status", response.StatusCode)
+		} else {
+			entry = entry.WithError(err)
+		}
+		entry.Warn("retrying request")
+
+		if api.Context == nil {
+			time.Sleep(delay)
+			continue
+		}
+		select {
+		case <-time.After(delay):
+		case <-api.Context.Done():
+			return nil, api.Context.Err()
+		}
+	}
+}
+
+// resumeStream requests again the response of a request whose body timed out while it was read, after the
+// delay of the retry, skipping the bytes read already: the chunks are served again the same. Every retry is a
+// single request, the timed out reads of a stream being retried up to the retries of the policy.
+func (api *AudistoAPIClient) resumeStream(request *http.Request, retry int, skip int) (*chunkStream, error) {
+	policy := api.RetryPolicy
+	if retry > policy.MaxRetries {
+		return nil, fmt.Errorf("too many retries")
+	}
+	api.counters.countError()
+	api.counters.countRetry()
+	api.Metrics.retry()
+	delay := policy.delay(retry, nil)
+	api.log().WithFields(logrus.Fields{"event": RetryEvent, "retry": retry, "delay": delay.String()}).
+		Warn("retrying timed out response")
+	if api.Context == nil {
+		time.Sleep(delay)
+	} else {
+		select {
+		case <-time.After(delay):
+		case <-api.Context.Done():
+			return nil, api.Context.Err()
+		}
+	}
+
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = body
+	}
+	// a single request, the retry of the stream being the retry of the policy
+	client := *api
+	client.RetryPolicy = RetryPolicy{}
+	stream, statusCode, _, err := client.fetchStream(request)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		stream.Close()
+		return nil, fmt.Errorf("the URL %s responded with status %d", request.URL, statusCode)
+	}
+	if _, err = io.CopyN(ioutil.Discard, stream.reader, int64(skip)); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// countError increments the errors count displayed in the progress report.
+// It's safe to be called from parallel requests, and on nil counters.
+func (c *requestCounters) countError() {
+	if c != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+// countRetry increments the retries count of the run summary
+func (c *requestCounters) countRetry() {
+	if c != nil {
+		atomic.AddInt64(&c.retries, 1)
+	}
+}
+
+// countTimeout increments the timeouts count displayed in the progress report
+func (c *requestCounters) countTimeout() {
+	if c != nil {
+		atomic.AddInt64(&c.timeouts, 1)
+	}
+}
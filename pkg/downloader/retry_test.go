@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, Backoff: time.Second, MaxBackoff: 4 * time.Second}
+
+	for retry, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 4 * time.Second} {
+		delay := policy.delay(retry, nil)
+		if delay < max/2 || delay > max {
+			t.Errorf("retry %d: delay %v should be between %v and %v", retry, delay, max/2, max)
+		}
+	}
+
+	response := &http.Response{Header: http.Header{"Retry-After": []string{"7"}}}
+	if delay := policy.delay(1, response); delay != 7*time.Second {
+		t.Errorf("Retry-After should be honored, got %v", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("120"); !ok || wait != 2*time.Minute {
+		t.Errorf("delay-seconds should be parsed, got %v", wait)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if wait, ok := parseRetryAfter(date); !ok || wait < 59*time.Minute {
+		t.Errorf("HTTP-date should be parsed, got %v", wait)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Errorf("invalid values should be ignored")
+	}
+}
+
+func TestDoWithRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &AudistoAPIClient{RetryPolicy: RetryPolicy{MaxRetries: 5, Backoff: time.Millisecond}}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	response, err := client.doWithRetries(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || requests != 3 {
+		t.Errorf("expected a 200 after 3 requests, got %d after %d requests", response.StatusCode, requests)
+	}
+
+	// retries exhausted, the last response is returned
+	requests = 0
+	client.RetryPolicy.MaxRetries = 1
+	request, _ = http.NewRequest("GET", server.URL, nil)
+	response, err = client.doWithRetries(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusServiceUnavailable || requests != 2 {
+		t.Errorf("expected a 503 after 2 requests, got %d after %d requests", response.StatusCode, requests)
+	}
+}
@@ -0,0 +1,477 @@
+package downloader
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Options the settings of a download, the zero value of every setting being its default.
+// Credentials, CrawlID and Mode are required by Run(), Output too unless the data is written to stdout.
+// The credentials are either the Username and Password or the APIToken.
+type Options struct {
+	Username string
+	Password string
+	APIToken string
+	CrawlID  uint64
+	Mode     string // one of the ExportModes: "pages", "links" or "hints", AllModes is up to the caller: one Downloader per mode
+	Output   string // a local path, s3://, gs://, azblob://, sftp://, postgres:// or bq:// location
+
+	Filter      string
+	Where       string   // client-side filter of the rows, see ParseWhere
+	URLsFile    string   // the URLs the rows are restricted to, one a line, see SetURLsFile
+	Transforms  []string // client-side transforms of the columns, see ParseTransform
+	Limit       uint64   // the first elements to download, 0 for every element, see SetLimit
+	Sample      string   // a random sample of the rows to write, e.g. "1%" or "10000", see SetSample
+	Order       string
+	Targets     string // "self" or a path to a file containing link target pages (IDs)
+	NoDetails   bool
+	Columns     []string // the columns to write, in that order, nil for every column
+	AddColumns  []string // metadata columns appended to every row, see SetAddColumns
+	NoHeader    bool
+	NoResume    bool // start again, even if there is something to resume
+	MustResume  bool // fail if there is nothing to resume
+	ChunkNumber uint64
+
+	ChunkSize     uint64 // elements of every chunk, 0 for the API default chunk size
+	AutoChunkSize bool   // tune the chunk size while downloading, ChunkSize is ignored then
+	Concurrency   int    // chunks downloaded in parallel, 1 if 0
+	BufferSize    int    // rows held between reading, processing and writing a chunk, DefaultBufferSize if 0
+	NoPrefetch    bool   // request the next chunks once the current ones are written, see SetPrefetch
+	Pagination    string // auto (default) or offset, how the chunks are paged through, see SetPagination
+	DriftCheck    bool   // request the total elements again before writing the chunks paged by offset, see SetDriftCheck
+	SortBy        string // columns the completed output file is sorted by, e.g. "status_code:desc,url", see SetSortBy
+	TempDir       string // directory of the temporary files, e.g. the sorted runs, "" for the one of the output, see SetTempDir
+
+	OutputFormat     string // tsv (default), csv, json, sqlite or parquet
+	Delimiter        string // fields delimiter of the csv output format
+	LineEnding       string // lf (default) or crlf, see SetLineEnding
+	Encoding         string // utf-8 (default) or utf-8-bom for Excel, see SetEncoding
+	Sanitize         string // auto (default), escape, strip or off, how malformed field values are written, see SetSanitize
+	Nulls            bool   // write the empty values of the number and bool columns as NullAs, null in json, see SetNullAs
+	NullAs           string // the representation of the nulls of the tsv and csv outputs, e.g. \N
+	Compression      string // "", gzip or zstd
+	CompressionLevel int
+	Encrypt          string // age:<recipient> or gpg:<public key file>, "" for no encryption, see SetEncryption
+	Checksum         bool
+	NoAtomic         bool   // write local output files in place instead of their partial file, see SetAtomic
+	WaitForLock      bool   // wait for another download of the output to finish instead of failing, see SetWaitForLock
+	DiskSpaceCheck   bool   // fail before starting if the disk can't hold the estimated download, see SetDiskSpaceCheck
+	ForceDiskSpace   bool   // warn only if the disk can't hold the estimated download
+	RowGroupSize     int64  // size of the Parquet row groups in bytes, 0 for DefaultParquetRowGroupSize
+	SplitRows        uint64 // rows of every part of a split output, 0 for no limit
+	SplitSize        int64  // bytes of every part of a split output (before compression), 0 for no limit
+	PartitionBy      string // the column routing rows to a file per value, "" for a single output file
+	EnrichPages      bool   // join the status code, title and depth of their source and target page onto the links
+	SkipFailedChunks bool   // skip the chunks failing after every retry, see SetSkipFailedChunks
+	ReportDuplicates bool   // list the URLs of the pages found more than once, see SetReportDuplicates
+
+	DiffBaseline string   // a previous export the rows are diffed against, "" to write every row, see SetDiff
+	DiffKey      []string // the columns matching the rows of the baseline, url if nil
+	DiffSplit    bool     // write a file per kind of difference instead of a diff column
+
+	Append    bool     // merge the download into the existing output instead of replacing it, see SetMerge
+	AppendKey []string // the columns the rows are upserted by, url if nil
+
+	Aggregation *Aggregation // the groups of rows to write instead of the rows, nil for every row, see SetAggregation
+
+	PostProcess string // the command run once every output file is completed, "" for none, see SetPostProcess
+
+	SkipIfUnchanged bool // skip the download to S3 or GCS when the previous object is unchanged, see SetSkipIfUnchanged
+
+	Budget *Budget // the API calls and bytes the download may spend, nil for no cap, see Budget
+
+	RetryPolicy  *RetryPolicy // nil for the DefaultRetryPolicy
+	RateLimit    int          // maximum requests per RateLimitPer, 0 for no limit
+	RateLimitPer time.Duration
+	MaxBandwidth int64  // bytes per second, 0 for no limit
+	Proxy        string // proxy URL, defaults to HTTP_PROXY / HTTPS_PROXY
+	TLS          TLSOptions
+	Transport    TransportOptions
+	APIBaseURL   string // base URL of a staging or on-premises API, "" for https://api.audisto.com
+	APIVersion   string // "" for AudistoAPIVersion
+
+	UserAgent string   // the User-Agent of the requests, "" for the Go default one
+	Headers   []string // added to every request, as "Name: value" each, e.g. "X-Team: seo"
+
+	AuthCacheFile string // the session cookies of the API are persisted to, "" for none, see SetAuthCacheFile
+
+	Record string // directory the responses of the API are recorded to, "" for none, see SetRecord
+	Replay string // directory of the recorded responses answering the requests instead of the API, see SetReplay
+
+	RequestTimeout time.Duration // how long every request may take, 0 for no limit
+	JobTimeout     time.Duration // how long Run() may take, 0 for no limit, see SetJobTimeout
+
+	WaitForCrawl bool          // wait for a crawl in progress to finish before downloading it, see SetWaitForCrawl
+	PollInterval time.Duration // how often the crawl status is checked, DefaultCrawlPollInterval if 0
+	MaxCrawlWait time.Duration // how long the crawl is waited for, 0 for no limit
+
+	Logger    logrus.FieldLogger
+	Notifiers []Notifier
+	Metrics   *Metrics // nil for no metrics
+
+	TimingReport bool // record the timing of every chunk for TimingReport(), see SetTimingReport
+
+	// OnProgress when set, is called with the progress of the download every RefreshInterval,
+	// and with the final progress once completed
+	OnProgress func(StatusReport)
+	// Status when set, receives the progress of the download instead, it is closed once completed
+	Status chan<- StatusReport
+}
+
+// New creates a new downloader with the given options, see Run().
+// Options can also be changed by the setters, before Setup() is called: the options left to their zero value
+// don't override them, the ones set do once Prepare() applies them.
+func New(options Options) *Downloader {
+	d := &Downloader{Stop: false, concurrency: 1, bufferSize: DefaultBufferSize, sortRunSize: DefaultSortRunSize,
+		sortFanIn: sortMergeFanIn, options: options}
+
+	status := options.Status
+	if status == nil && options.OnProgress != nil {
+		reports := make(chan StatusReport)
+		go func() {
+			for report := range reports {
+				options.OnProgress(report)
+			}
+		}()
+		status = reports
+	}
+	if status != nil {
+		d.status = status
+		d.done = make(chan struct{})
+	}
+	return d
+}
+
+// Run downloads as per the options, until the download completes, fails or the context is cancelled.
+// It's Prepare() and Start() in a row. Once the context is cancelled, the chunks being downloaded
+// are written (pending retries are cancelled), the output is flushed and closed, and the resume state
+// persisted: ctx.Err() is returned then, the download can be resumed. The same goes once the job timeout,
+// if any, elapses: a JobTimeoutError is returned then, or once the budget, if any, is exhausted: a
+// BudgetExhaustedError is returned then. A crawl still in progress is waited for first, if set to.
+func (d *Downloader) Run(ctx context.Context) error {
+	started := time.Now()
+	// a locked output is waited for until cancelled, if set to
+	d.ctx = ctx
+	defer d.unlockOutput()
+	if err := d.Prepare(); err != nil {
+		d.stopReporting()
+		if exhausted := d.budget.exhaustion(); exhausted != nil {
+			return exhausted
+		}
+		return err
+	}
+	// nothing is downloaded, the output being unchanged
+	if d.unchanged {
+		return d.Start()
+	}
+
+	parent := ctx
+	if d.jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, started.Add(d.jobTimeout))
+		defer cancel()
+	}
+	if d.budget != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = d.withBudget(ctx)
+		defer cancel()
+	}
+
+	d.ctx = ctx
+	d.client.Context = ctx
+	// the totals of a crawl in progress are not final yet
+	if err := d.awaitCrawl(); err != nil {
+		d.stopReporting()
+		return d.runError(err, parent)
+	}
+	if err := d.checkDiskSpace(); err != nil {
+		d.stopReporting()
+		return err
+	}
+	return d.runError(d.Start(), parent)
+}
+
+// runError returns the error of Run(), the context of Run() being cancelled or its job timeout elapsing
+func (d *Downloader) runError(err error, parent context.Context) error {
+	if err != nil && parent.Err() == nil {
+		if exhausted := d.budget.exhaustion(); exhausted != nil {
+			return exhausted
+		}
+	}
+	if err != nil && d.ctx.Err() != nil {
+		if parent.Err() == nil && d.ctx.Err() == context.DeadlineExceeded {
+			return &JobTimeoutError{Timeout: d.jobTimeout}
+		}
+		return d.ctx.Err()
+	}
+	return err
+}
+
+// stopped checks if the download has to stop: Stop is set or the context of Run() is cancelled
+func (d *Downloader) stopped() bool {
+	return d.Stop || (d.ctx != nil && d.ctx.Err() != nil)
+}
+
+// Prepare applies the options and sets the download up: Start() or Estimate() can be called then.
+// The options left to their zero value don't override what the setters were called with.
+func (d *Downloader) Prepare() error {
+	options := d.options
+
+	if options.Logger != nil {
+		d.SetLogger(options.Logger)
+	}
+	if options.Metrics != nil {
+		d.SetMetrics(options.Metrics)
+	}
+	if options.TimingReport {
+		d.SetTimingReport(true)
+	}
+	if options.AutoChunkSize {
+		d.SetAutoChunkSize(true)
+	}
+	if options.MustResume {
+		d.SetMustResume(true)
+	}
+	if options.Checksum {
+		d.SetChecksum(true)
+	}
+	if options.NoAtomic {
+		d.SetAtomic(false)
+	}
+	if options.WaitForLock {
+		d.SetWaitForLock(true)
+	}
+	if options.NoPrefetch {
+		d.SetPrefetch(false)
+	}
+	if options.DriftCheck {
+		d.SetDriftCheck(true)
+	}
+	if options.DiskSpaceCheck || options.ForceDiskSpace {
+		d.SetDiskSpaceCheck(options.DiskSpaceCheck, options.ForceDiskSpace)
+	}
+	if options.NoHeader {
+		d.SetNoHeader(true)
+	}
+	if options.RowGroupSize != 0 {
+		d.SetParquetRowGroupSize(options.RowGroupSize)
+	}
+	if options.SplitRows != 0 {
+		d.SetSplitRows(options.SplitRows)
+	}
+	if options.PartitionBy != "" {
+		d.SetPartitionBy(options.PartitionBy)
+	}
+	if options.EnrichPages {
+		d.SetEnrichPages(true)
+	}
+	if options.SkipFailedChunks {
+		d.SetSkipFailedChunks(true)
+	}
+	if options.Where != "" {
+		d.SetWhere(options.Where)
+	}
+	if options.Limit != 0 {
+		d.SetLimit(options.Limit)
+	}
+	if options.ReportDuplicates {
+		d.SetReportDuplicates(true)
+	}
+	if options.Budget != nil {
+		d.SetBudget(options.Budget)
+	}
+	if options.Nulls {
+		d.SetNullAs(options.NullAs)
+	}
+	for _, notifier := range options.Notifiers {
+		d.AddNotifier(notifier)
+	}
+
+	// the settings defaulting to a value of their own get it unless set
+	if options.Pagination != "" || d.pagination == "" {
+		if err := d.SetPagination(options.Pagination); err != nil {
+			return err
+		}
+	}
+	if options.OutputFormat != "" || d.OutputFormat == "" {
+		if err := d.SetOutputFormat(options.OutputFormat); err != nil {
+			return err
+		}
+	}
+	if options.OutputFormat == CSVOutputFormat && options.Delimiter != "" {
+		if err := d.SetDelimiter(options.Delimiter); err != nil {
+			return err
+		}
+	}
+	if options.LineEnding != "" {
+		if err := d.SetLineEnding(options.LineEnding); err != nil {
+			return err
+		}
+	}
+	if options.Encoding != "" {
+		if err := d.SetEncoding(options.Encoding); err != nil {
+			return err
+		}
+	}
+	if options.Sanitize != "" || d.sanitize == "" {
+		if err := d.SetSanitize(options.Sanitize); err != nil {
+			return err
+		}
+	}
+	if options.Columns != nil {
+		if err := d.SetColumns(options.Columns); err != nil {
+			return err
+		}
+	}
+	if options.Transforms != nil {
+		if err := d.SetTransforms(options.Transforms); err != nil {
+			return err
+		}
+	}
+	if options.AddColumns != nil {
+		if err := d.SetAddColumns(options.AddColumns); err != nil {
+			return err
+		}
+	}
+	if options.Sample != "" {
+		if err := d.SetSample(options.Sample); err != nil {
+			return err
+		}
+	}
+	if options.Aggregation != nil {
+		if err := d.SetAggregation(options.Aggregation); err != nil {
+			return err
+		}
+	}
+	if options.URLsFile != "" {
+		if err := d.SetURLsFile(options.URLsFile); err != nil {
+			return err
+		}
+	}
+	if options.DiffBaseline != "" {
+		if err := d.SetDiff(options.DiffBaseline, options.DiffKey, options.DiffSplit); err != nil {
+			return err
+		}
+	}
+	if options.Append {
+		if err := d.SetMerge(true, options.AppendKey); err != nil {
+			return err
+		}
+	}
+	if options.PostProcess != "" {
+		if err := d.SetPostProcess(options.PostProcess); err != nil {
+			return err
+		}
+	}
+	if options.SkipIfUnchanged {
+		d.SetSkipIfUnchanged(true)
+	}
+	if options.Compression != "" || options.CompressionLevel != 0 {
+		if err := d.SetCompression(options.Compression, options.CompressionLevel); err != nil {
+			return err
+		}
+	}
+	if options.Encrypt != "" {
+		if err := d.SetEncryption(options.Encrypt); err != nil {
+			return err
+		}
+	}
+	if options.SplitSize != 0 {
+		if err := d.SetSplitSize(options.SplitSize); err != nil {
+			return err
+		}
+	}
+	if options.RetryPolicy != nil {
+		if err := d.SetRetryPolicy(*options.RetryPolicy); err != nil {
+			return err
+		}
+	}
+	if options.RateLimit > 0 {
+		if err := d.SetRateLimit(options.RateLimit, options.RateLimitPer); err != nil {
+			return err
+		}
+	}
+	if options.MaxBandwidth > 0 {
+		if err := d.SetMaxBandwidth(options.MaxBandwidth); err != nil {
+			return err
+		}
+	}
+	if options.Proxy != "" {
+		if err := d.SetProxy(options.Proxy); err != nil {
+			return err
+		}
+	}
+	if options.Concurrency > 0 {
+		if err := d.SetConcurrency(options.Concurrency); err != nil {
+			return err
+		}
+	}
+	if options.SortBy != "" {
+		if err := d.SetSortBy(options.SortBy); err != nil {
+			return err
+		}
+	}
+	if options.TempDir != "" {
+		if err := d.SetTempDir(options.TempDir); err != nil {
+			return err
+		}
+	}
+	if options.BufferSize > 0 {
+		if err := d.SetBufferSize(options.BufferSize); err != nil {
+			return err
+		}
+	}
+	if !options.TLS.IsZero() {
+		if err := d.SetTLS(options.TLS); err != nil {
+			return err
+		}
+	}
+	if !options.Transport.IsZero() {
+		if err := d.SetTransport(options.Transport); err != nil {
+			return err
+		}
+	}
+	if err := d.SetRecord(options.Record); err != nil {
+		return err
+	}
+	if err := d.SetReplay(options.Replay); err != nil {
+		return err
+	}
+	if options.RequestTimeout != 0 {
+		if err := d.SetRequestTimeout(options.RequestTimeout); err != nil {
+			return err
+		}
+	}
+	if options.JobTimeout != 0 {
+		if err := d.SetJobTimeout(options.JobTimeout); err != nil {
+			return err
+		}
+	}
+	if options.WaitForCrawl || options.PollInterval != 0 || options.MaxCrawlWait != 0 || d.crawlPollInterval == 0 {
+		if err := d.SetWaitForCrawl(options.WaitForCrawl, options.PollInterval, options.MaxCrawlWait); err != nil {
+			return err
+		}
+	}
+	if options.APIToken != "" {
+		d.SetAPIToken(options.APIToken)
+	}
+	if options.AuthCacheFile != "" {
+		d.SetAuthCacheFile(options.AuthCacheFile)
+	}
+	if options.UserAgent != "" || options.Headers != nil {
+		if err := d.SetHeaders(options.UserAgent, options.Headers); err != nil {
+			return err
+		}
+	}
+	if options.APIBaseURL != "" || options.APIVersion != "" || d.apiBaseURL == "" {
+		if err := d.SetAPIEndpoint(options.APIBaseURL, options.APIVersion); err != nil {
+			return err
+		}
+	}
+
+	return d.Setup(options.Username, options.Password, options.CrawlID, options.Mode, options.NoDetails,
+		options.ChunkNumber, options.ChunkSize, options.Output, options.Filter, options.NoResume,
+		options.Order, options.Targets)
+}
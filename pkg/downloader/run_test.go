@@ -0,0 +1,275 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveAPI sends the requests of the default HTTP client to a test API server serving 2 pages,
+// until the returned function is called
+func serveAPI(handler http.HandlerFunc) func() {
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("output") == "json" {
+				w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+				return
+			}
+			w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+		}
+	}
+	server := httptest.NewServer(handler)
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		request.URL.Scheme, request.URL.Host = "http", server.Listener.Addr().String()
+		return defaultTransport.RoundTrip(request)
+	})
+	return func() {
+		http.DefaultTransport = defaultTransport
+		server.Close()
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestRun(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var last StatusReport
+	output := filepath.Join(dir, "crawl.csv")
+	d := New(Options{
+		Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		OutputFormat: CSVOutputFormat, Delimiter: ";", ChunkSize: 10,
+		OnProgress: func(report StatusReport) {
+			mu.Lock()
+			last = report
+			mu.Unlock()
+		},
+	})
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id;url\n1;http://example.com/a\n2;http://example.com/b\n" {
+		t.Errorf("unexpected output %q", written)
+	}
+	if d.DoneElements != 2 {
+		t.Errorf("expected 2 downloaded elements, got %d", d.DoneElements)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last.TotalElements != 2 {
+		t.Errorf("the progress should be reported, got %+v", last)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv")})
+	if err = d.Run(ctx); err != context.Canceled {
+		t.Errorf("a cancelled download should return context.Canceled, got %v", err)
+	}
+}
+
+func TestPrepareInvalidOptions(t *testing.T) {
+	invalid := map[string]Options{
+		"output format": {Username: "user", Password: "pass", CrawlID: 1, OutputFormat: "xml"},
+		"compression":   {Username: "user", Password: "pass", CrawlID: 1, Compression: "bzip2"},
+		"concurrency":   {Username: "user", Password: "pass", CrawlID: 1, Concurrency: MaxConcurrency + 1},
+		"credentials":   {CrawlID: 1},
+	}
+	for name, options := range invalid {
+		if err := New(options).Prepare(); err == nil {
+			t.Errorf("an invalid %s should be refused", name)
+		}
+	}
+}
+
+func TestRunCancelledDuringRetries(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})()
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	status := make(chan StatusReport)
+	go func() {
+		for range status {
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	d := New(Options{
+		Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		RetryPolicy: &RetryPolicy{MaxRetries: 5, Backoff: time.Hour},
+		Status:      status,
+	})
+
+	started := time.Now()
+	if err = d.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("a cancelled download should return the context error, got %v", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Errorf("the pending retries should be cancelled")
+	}
+	if fExists(d.getResumeFilename()) != nil {
+		t.Errorf("the resume state should be kept")
+	}
+}
+
+func TestPrepareKeepsSetters(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv")})
+	d.SetChecksum(true)
+	d.SetNoHeader(true)
+	if err = d.SetSanitize(SanitizeStrip); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.checksum || !d.noHeader || d.sanitize != SanitizeStrip {
+		t.Errorf("the setters called before Prepare() should be kept: checksum %v, no header %v, sanitize %s", d.checksum, d.noHeader, d.sanitize)
+	}
+	if d.pagination != PaginationAuto || d.OutputFormat != TSVOutputFormat {
+		t.Errorf("the settings not set should get their default: pagination %q, format %q", d.pagination, d.OutputFormat)
+	}
+}
+
+func TestRunClosesStatus(t *testing.T) {
+	status := make(chan StatusReport)
+	if err := New(Options{Status: status}).Run(context.Background()); err == nil {
+		t.Fatal("a download without credentials should fail")
+	}
+	if _, open := <-status; open {
+		t.Error("the status channel should be closed once Run returns")
+	}
+}
+
+func TestRunErrorClasses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	classes := map[int]func(error) bool{
+		http.StatusUnauthorized:       func(err error) bool { return IsAuthError(err) && IsCredentialsError(err) },
+		http.StatusForbidden:          func(err error) bool { return IsAuthError(err) && IsPermissionDenied(err) },
+		http.StatusPaymentRequired:    IsQuotaExceeded,
+		http.StatusTooManyRequests:    IsNetworkError,
+		http.StatusServiceUnavailable: IsNetworkError,
+	}
+	for statusCode, is := range classes {
+		stop := serveAPI(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+		})
+		d := New(Options{
+			Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+			RetryPolicy: &RetryPolicy{MaxRetries: 0, Backoff: time.Millisecond},
+		})
+		if err = d.Run(context.Background()); err == nil || !is(err) {
+			t.Errorf("unexpected error on a %d response: %v", statusCode, err)
+		}
+		stop()
+	}
+
+	if IsAuthError(&QuotaExceededError{APIError: APIError{StatusCode: 402}}) || IsQuotaExceeded(&APIError{StatusCode: 402}) {
+		t.Error("an exceeded quota is not an authentication error")
+	}
+	if IsAuthError(&APIError{StatusCode: 404, Message: "Not found"}) || IsNetworkError(&APIError{StatusCode: 404, Message: "Not found"}) {
+		t.Error("a 404 is neither an authentication nor a network error")
+	}
+	if !IsNetworkError(&NetworkError{Err: ErrStopped}) || IsNetworkError(ErrStopped) {
+		t.Error("only network errors should be network errors")
+	}
+}
+
+func TestRunQuotaExceeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	resetAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	for name, header := range map[string][2]string{
+		"Retry-After":       {"Retry-After", "3600"},
+		"X-RateLimit-Reset": {"X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10)},
+		"an HTTP date":      {"X-RateLimit-Reset", resetAt.UTC().Format(http.TimeFormat)},
+	} {
+		stop := serveAPI(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(header[0], header[1])
+			w.WriteHeader(http.StatusPaymentRequired)
+		})
+		err = New(Options{
+			Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		}).Run(context.Background())
+		stop()
+		quotaErr, ok := err.(*QuotaExceededError)
+		if !ok {
+			t.Errorf("%s: expected the quota to be exceeded, got %v", name, err)
+			continue
+		}
+		if wait := quotaErr.ResetAt.Sub(resetAt); wait < -2*time.Second || wait > 2*time.Second {
+			t.Errorf("%s: expected the quota to reset at %v, got %v", name, resetAt, quotaErr.ResetAt)
+		}
+		if !strings.Contains(quotaErr.Error(), "resets at") {
+			t.Errorf("%s: expected the reset time to be reported, got %q", name, quotaErr.Error())
+		}
+	}
+
+	// the crawl denied is reported
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})()
+	err = New(Options{
+		Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+	}).Run(context.Background())
+	if permissionErr, ok := err.(*PermissionError); !ok || permissionErr.CrawlID != 12345 || !strings.Contains(err.Error(), "crawl 12345") {
+		t.Errorf("expected the access to crawl 12345 to be denied, got %v", err)
+	}
+}
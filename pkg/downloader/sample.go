@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSampleRows the largest sample of rows, the sampled rows being held in memory until the download is completed
+const MaxSampleRows = 1000000
+
+// rowSample the random sample of the rows downloaded, picked by reservoir sampling: every row downloaded
+// has the same chance to be written
+type rowSample struct {
+	percent float64 // the sample size in percent of the elements of the crawl, 0 for a number of rows
+	size    int     // the number of rows of the sample, computed from percent once the elements are known
+	seen    uint64  // the rows offered to the sample so far
+	header  []string
+	rows    []sampledRow
+	random  *rand.Rand
+}
+
+// sampledRow a row of the sample, along with its position in the download
+type sampledRow struct {
+	index  uint64
+	fields []string
+}
+
+// parseSample parses a sample size, a percentage of the elements (e.g. 1%) or a number of rows (e.g. 10000)
+func parseSample(sample string) (*rowSample, error) {
+	s := &rowSample{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if strings.HasSuffix(sample, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(sample, "%")), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid sample %q: expected a percentage between 0 and 100%%, e.g. 1%%", sample)
+		}
+		s.percent = percent
+		return s, nil
+	}
+	size, err := strconv.Atoi(sample)
+	if err != nil || size < 1 || size > MaxSampleRows {
+		return nil, fmt.Errorf("invalid sample %q: expected a percentage, e.g. 1%%, or a number of rows up to %d", sample, MaxSampleRows)
+	}
+	s.size = size
+	return s, nil
+}
+
+// ValidateSample checks the sample size, a percentage (e.g. 1%) or a number of rows (e.g. 10000)
+func ValidateSample(sample string) error {
+	_, err := parseSample(strings.TrimSpace(sample))
+	return err
+}
+
+// SetSample makes the downloader write a random sample of the rows instead of every row: a percentage of the
+// elements (e.g. "1%") or a number of rows (e.g. "10000"), "" for every row (default). The rows are sampled
+// client-side, every element is still downloaded, see SetLimit to download only the first ones.
+// The sample is held in memory and written in the order of the download once completed.
+// It has to be called before Setup()
+func (d *Downloader) SetSample(sample string) error {
+	if sample = strings.TrimSpace(sample); sample == "" {
+		d.sample = nil
+		return nil
+	}
+	s, err := parseSample(sample)
+	if err != nil {
+		return err
+	}
+	d.sample = s
+	return nil
+}
+
+// SetLimit makes the downloader download only the first limit elements (pages or links), the following
+// ones not being requested from the API. 0 for every element (default). It has to be called before Setup()
+func (d *Downloader) SetLimit(limit uint64) {
+	d.limit = limit
+}
+
+// limitedTotal returns the elements to download out of the total, once limited
+func (d *Downloader) limitedTotal(total uint64) uint64 {
+	if d.limit > 0 && total > d.limit {
+		return d.limit
+	}
+	return total
+}
+
+// sampleWriter collects the rows of the chunks into the sample, instead of writing them
+type sampleWriter struct {
+	sample *rowSample
+}
+
+func (w *sampleWriter) WriteHeader() error {
+	return nil
+}
+
+// WriteRow offers the row to the sample: the first rows fill it, then every row replaces a random one
+// of the sample with a decreasing probability (algorithm R)
+func (w *sampleWriter) WriteRow(fields []string) error {
+	s := w.sample
+	s.seen++
+	row := sampledRow{index: s.seen}
+	if len(s.rows) < s.size {
+		row.fields = append([]string(nil), fields...)
+		s.rows = append(s.rows, row)
+	} else if i := s.random.Int63n(int64(s.seen)); i < int64(s.size) {
+		row.fields = append([]string(nil), fields...)
+		s.rows[i] = row
+	}
+	return nil
+}
+
+func (w *sampleWriter) Flush() error {
+	return nil
+}
+
+// newSampleWriter returns the writer of the rows of a chunk into the sample, sized once the elements are known
+func (d *Downloader) newSampleWriter(header []string) RowWriter {
+	if d.sample.percent > 0 && d.sample.size == 0 {
+		d.sample.size = int(math.Ceil(float64(d.TotalElements) * d.sample.percent / 100))
+		if d.sample.size > MaxSampleRows {
+			d.sample.size = MaxSampleRows
+		}
+	}
+	d.sample.header = header
+	return &sampleWriter{sample: d.sample}
+}
+
+// writeSample writes the rows of the sample to the output once the download is completed, in their order
+func (d *Downloader) writeSample() error {
+	if d.sample == nil || d.sample.header == nil {
+		return nil
+	}
+	rows := d.sample.rows
+	sort.Slice(rows, func(i, j int) bool { return rows[i].index < rows[j].index })
+
+	writer, err := d.newOutputWriter(d.sample.header)
+	if err != nil {
+		return err
+	}
+	// the writer of the sample didn't write the header of the chunks
+	d.headerWritten = false
+	if err = d.writeHeader(writer); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err = writer.WriteRow(row.fields); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	d.stats.rows = uint64(len(rows))
+	d.appendLog(INFO, fmt.Sprintf("Wrote a sample of %d rows out of %d", len(rows), d.sample.seen))
+	return d.flushOutput()
+}
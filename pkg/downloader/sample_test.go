@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveRows serves total pages in chunks of 10, recording the chunks requested
+func serveRows(total int, requested *[]string, mu *sync.Mutex) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			fmt.Fprintf(w, `{"chunk":{"total":%d,"page":0,"size":10}}`, total)
+			return
+		}
+		mu.Lock()
+		*requested = append(*requested, r.URL.Query().Get("chunk")+"/"+r.URL.Query().Get("chunk_size"))
+		mu.Unlock()
+		var chunk, size int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Sscan(r.URL.Query().Get("chunk_size"), &size)
+		fmt.Fprint(w, "id\turl\n")
+		for id := chunk * size; id < (chunk+1)*size && id < total; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", id, id)
+		}
+	})
+}
+
+func TestLimit(t *testing.T) {
+	var requested []string
+	var mu sync.Mutex
+	defer serveRows(100, &requested, &mu)()
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 10, Limit: 15}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 16 || lines[15] != "14\thttp://example.com/14" {
+		t.Errorf("expected the first 15 rows, got %d lines", len(lines))
+	}
+	// only the elements of the limit are requested: the chunk 2 of 5 elements is the elements 10 to 14
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requested) != 2 || requested[0] != "0/10" || requested[1] != "2/5" {
+		t.Errorf("unexpected chunks requested %v", requested)
+	}
+}
+
+func TestSample(t *testing.T) {
+	var requested []string
+	var mu sync.Mutex
+	defer serveRows(100, &requested, &mu)()
+	dir, err := ioutil.TempDir("", "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for sample, size := range map[string]int{"5": 5, "12%": 12, "1000": 100} {
+		output := filepath.Join(dir, "crawl.tsv")
+		options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 10,
+			Sample: sample, NoResume: true}
+		if err = New(options).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != size+1 || lines[0] != "id\turl" {
+			t.Errorf("expected a sample of %d rows for %s, got %d lines", size, sample, len(lines))
+			continue
+		}
+		// the rows are written in the order of the download
+		previous := -1
+		for _, line := range lines[1:] {
+			var id int
+			fmt.Sscan(line, &id)
+			if id <= previous {
+				t.Errorf("the sampled rows are out of order: %q", lines)
+				break
+			}
+			previous = id
+		}
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	for _, sample := range []string{"0", "-5", "0%", "101%", "ten", "1.5", fmt.Sprint(MaxSampleRows + 1)} {
+		if _, err := parseSample(sample); err == nil {
+			t.Errorf("expected the sample %q to be invalid", sample)
+		}
+	}
+}
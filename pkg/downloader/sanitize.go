@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+const (
+	// SanitizeAuto escapes the control characters of the field values of tsv outputs, the other formats quoting
+	// them; invalid UTF-8 is replaced and shifted columns repaired whatever the format (default)
+	SanitizeAuto = "auto"
+	// SanitizeEscape escapes the tabs, line feeds and carriage returns of the field values as \t, \n and \r,
+	// the other control characters being removed
+	SanitizeEscape = "escape"
+	// SanitizeStrip replaces the tabs, line feeds and carriage returns of the field values with a space,
+	// the other control characters being removed
+	SanitizeStrip = "strip"
+	// SanitizeOff writes the field values as received
+	SanitizeOff = "off"
+
+	// EncodingUTF8 writes the outputs in UTF-8 (default)
+	EncodingUTF8 = "utf-8"
+	// EncodingUTF8BOM writes the outputs in UTF-8, starting with a byte order mark so Excel reads them as UTF-8
+	EncodingUTF8BOM = "utf-8-bom"
+)
+
+// utf8BOM the byte order mark of UTF-8
+const utf8BOM = "\uFEFF"
+
+// freeTextColumns the columns of free text, e.g. a title, a tab of which shifts the following columns
+var freeTextColumns = []string{"title", "anchor_text"}
+
+// ParseSanitize validates a user given sanitation of the field values: auto (default), escape, strip or off
+func ParseSanitize(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return SanitizeAuto, nil
+	case SanitizeAuto, SanitizeEscape, SanitizeStrip, SanitizeOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid sanitation %q, it has to be %s, %s, %s or %s", mode, SanitizeAuto, SanitizeEscape, SanitizeStrip, SanitizeOff)
+}
+
+// ParseEncoding validates a user given output encoding: utf-8 (default) or utf-8-bom
+func ParseEncoding(encoding string) (string, error) {
+	switch encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding {
+	case "", EncodingUTF8, "utf8":
+		return EncodingUTF8, nil
+	case EncodingUTF8BOM, "utf8-bom":
+		return EncodingUTF8BOM, nil
+	}
+	return "", fmt.Errorf("invalid encoding %q, it has to be %s or %s", encoding, EncodingUTF8, EncodingUTF8BOM)
+}
+
+// SetSanitize sets how the field values are sanitized before they're written, see ParseSanitize: invalid UTF-8
+// is replaced with U+FFFD, the tabs of a free text column (e.g. a title) shifting the following columns are
+// merged back into it, and the tabs and line breaks of the values are escaped or stripped, so a malformed
+// title can't corrupt a tsv output. It has to be called before Setup()
+func (d *Downloader) SetSanitize(mode string) error {
+	mode, err := ParseSanitize(mode)
+	if err != nil {
+		return err
+	}
+	d.sanitize = mode
+	return nil
+}
+
+// SetEncoding sets the encoding of the tsv and csv outputs, see ParseEncoding. It has to be called before Setup()
+func (d *Downloader) SetEncoding(encoding string) error {
+	encoding, err := ParseEncoding(encoding)
+	if err != nil {
+		return err
+	}
+	d.bom = encoding == EncodingUTF8BOM
+	return nil
+}
+
+// sanitizedCounters the rows sanitized by a download, by cause. They're updated with atomic operations.
+type sanitizedCounters struct {
+	rows     int64 // the rows with a field sanitized, whatever the cause
+	invalid  int64 // the rows with invalid UTF-8
+	control  int64 // the rows with control characters
+	repaired int64 // the rows with shifted columns merged back into their free text column
+}
+
+// rowSanitizer sanitizes the fields of the rows of a chunk, nil if they're written as received
+type rowSanitizer struct {
+	counters *sanitizedCounters
+	columns  int  // the columns of the header
+	text     int  // the position of the free text column absorbing the extra fields, -1 if none
+	control  bool // escape or strip the control characters
+	escape   bool // escape them instead of stripping them
+}
+
+// newRowSanitizer returns the sanitizer of the rows of a chunk with the given header, nil if it's off
+func (d *Downloader) newRowSanitizer(header []string) *rowSanitizer {
+	tsv := normalizeOutputFormat(d.OutputFormat) == TSVOutputFormat && !d.isTableOutput()
+	return newRowSanitizer(header, d.sanitize, tsv, &d.sanitized)
+}
+
+// newRowSanitizer returns the sanitizer of the given mode of the rows with the given header, counted in counters,
+// nil if it's off. tsv is whether the rows are written to a tsv output, the control characters of which
+// are escaped in auto mode.
+func newRowSanitizer(header []string, mode string, tsv bool, counters *sanitizedCounters) *rowSanitizer {
+	if mode == SanitizeOff {
+		return nil
+	}
+	s := &rowSanitizer{counters: counters, columns: len(header), text: -1}
+	switch mode {
+	case SanitizeEscape, SanitizeStrip:
+		s.control, s.escape = true, mode == SanitizeEscape
+	default:
+		s.control, s.escape = tsv, true
+	}
+	if positions, err := columnPositions(header, freeTextColumns[:1]); err == nil {
+		s.text = positions[0]
+	} else if positions, err = columnPositions(header, freeTextColumns[1:]); err == nil {
+		s.text = positions[0]
+	}
+	return s
+}
+
+// apply sanitizes the fields of a row, in place unless its shifted columns are merged back
+func (s *rowSanitizer) apply(fields []string) []string {
+	if s == nil {
+		return fields
+	}
+	var invalid, control, repaired bool
+	// the tabs of the free text column split it into several fields
+	if extra := len(fields) - s.columns; extra > 0 && s.text >= 0 {
+		merged := make([]string, 0, s.columns)
+		merged = append(merged, fields[:s.text]...)
+		merged = append(merged, strings.Join(fields[s.text:s.text+extra+1], "\t"))
+		fields = append(merged, fields[s.text+extra+1:]...)
+		repaired = true
+	}
+	for i, field := range fields {
+		value, invalidField, controlField := s.field(field)
+		fields[i] = value
+		invalid, control = invalid || invalidField, control || controlField
+	}
+
+	if invalid || control || repaired {
+		atomic.AddInt64(&s.counters.rows, 1)
+	}
+	if invalid {
+		atomic.AddInt64(&s.counters.invalid, 1)
+	}
+	if control {
+		atomic.AddInt64(&s.counters.control, 1)
+	}
+	if repaired {
+		atomic.AddInt64(&s.counters.repaired, 1)
+	}
+	return fields
+}
+
+// field sanitizes a value, and returns whether it had invalid UTF-8 or control characters
+func (s *rowSanitizer) field(value string) (string, bool, bool) {
+	clean := true
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c >= utf8.RuneSelf || (s.control && (c < 0x20 || c == 0x7f)) {
+			clean = false
+			break
+		}
+	}
+	if clean || (utf8.ValidString(value) && !s.control) {
+		return value, false, false
+	}
+
+	var invalid, control bool
+	var sanitized strings.Builder
+	sanitized.Grow(len(value))
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid = true
+			sanitized.WriteRune(utf8.RuneError)
+		case s.control && (r == '\t' || r == '\n' || r == '\r'):
+			control = true
+			if !s.escape {
+				sanitized.WriteByte(' ')
+			} else if r == '\t' {
+				sanitized.WriteString(`\t`)
+			} else if r == '\n' {
+				sanitized.WriteString(`\n`)
+			} else {
+				sanitized.WriteString(`\r`)
+			}
+		case s.control && (r < 0x20 || r == 0x7f):
+			control = true
+		default:
+			sanitized.WriteRune(r)
+		}
+	}
+	return sanitized.String(), invalid, control
+}
+
+// reportSanitized logs the rows sanitized by the download, if any
+func (d *Downloader) reportSanitized() {
+	rows := atomic.LoadInt64(&d.sanitized.rows)
+	if rows == 0 {
+		return
+	}
+	d.appendLog(WARNING, fmt.Sprintf("Sanitized the fields of %d rows: %d with invalid UTF-8, %d with control characters, %d with shifted columns repaired",
+		rows, atomic.LoadInt64(&d.sanitized.invalid), atomic.LoadInt64(&d.sanitized.control), atomic.LoadInt64(&d.sanitized.repaired)))
+}
+
+// writeBOM starts a new output with the byte order mark of UTF-8, if set to
+func (d *Downloader) writeBOM(w io.Writer) error {
+	if !d.bom {
+		return nil
+	}
+	_, err := io.WriteString(w, utf8BOM)
+	return err
+}
+
+// withoutBOM returns a reader of r skipping the byte order mark of UTF-8 it starts with, if any
+func withoutBOM(r io.Reader) io.Reader {
+	buffered, ok := r.(*bufio.Reader)
+	if !ok {
+		buffered = bufio.NewReader(r)
+	}
+	if bom, err := buffered.Peek(len(utf8BOM)); err == nil && bytes.Equal(bom, []byte(utf8BOM)) {
+		buffered.Discard(len(utf8BOM))
+	}
+	return buffered
+}
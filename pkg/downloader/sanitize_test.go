@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunSanitize(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		fmt.Fprint(w, "id\ttitle\turl\n")
+		fmt.Fprint(w, "1\tA\ttitle\thttp://example.com/a\n")
+		fmt.Fprint(w, "2\tB\xff\x01\thttp://example.com/b\n")
+		fmt.Fprint(w, "3\tC\thttp://example.com/c\n")
+	})()
+	dir, err := ioutil.TempDir("", "sanitize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, Encoding: EncodingUTF8BOM}
+	download := New(options)
+	if err = download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := utf8BOM + "id\ttitle\turl\n1\tA\\ttitle\thttp://example.com/a\n2\tB\uFFFD\thttp://example.com/b\n3\tC\thttp://example.com/c\n"
+	if string(written) != expected {
+		t.Errorf("unexpected sanitized output %q", written)
+	}
+	if sanitized := download.Summary(nil).Sanitized; sanitized != 2 {
+		t.Errorf("expected 2 rows sanitized, got %d", sanitized)
+	}
+
+	// the byte order mark isn't part of the header read back
+	reader, err := decompressedReader(bytes.NewReader(written))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read, _ := ioutil.ReadAll(reader); string(read) != expected[len(utf8BOM):] {
+		t.Errorf("expected the byte order mark to be skipped, got %q", read)
+	}
+
+	options.Encoding = "latin1"
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected an unknown encoding to fail the download")
+	}
+	options.Encoding, options.OutputFormat = EncodingUTF8BOM, JSONOutputFormat
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("expected a byte order mark to be rejected for json outputs")
+	}
+}
+
+func TestRowSanitizer(t *testing.T) {
+	d := &Downloader{OutputFormat: JSONOutputFormat}
+	header := []string{"source_url", "anchor_text", "target_url"}
+
+	// json quotes the control characters, only invalid UTF-8 and the shifted columns are fixed
+	sanitizer := d.newRowSanitizer(header)
+	if fields := sanitizer.apply([]string{"a", "x", "y\n", "b"}); !reflect.DeepEqual(fields, []string{"a", "x\ty\n", "b"}) {
+		t.Errorf("unexpected repaired fields %q", fields)
+	}
+
+	d.sanitize = SanitizeStrip
+	sanitizer = d.newRowSanitizer(header)
+	if fields := sanitizer.apply([]string{"a", "x\r\ny\x7f", "b\xc3"}); !reflect.DeepEqual(fields, []string{"a", "x  y", "b\uFFFD"}) {
+		t.Errorf("unexpected stripped fields %q", fields)
+	}
+
+	d.sanitize = SanitizeOff
+	if sanitizer = d.newRowSanitizer(header); sanitizer.apply([]string{"a\t"})[0] != "a\t" {
+		t.Error("expected the fields to be kept as received")
+	}
+	if _, err := ParseSanitize("unknown"); err == nil {
+		t.Error("expected an unknown sanitation to be rejected")
+	}
+}
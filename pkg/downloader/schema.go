@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"fmt"
+)
+
+// SchemaColumn a column of an export, with the kind of its values: "integer" (e.g. the IDs, counts and codes),
+// "number", "string" or "bool"
+type SchemaColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// exportSchema the columns of the export of every mode, in the order of the API
+var exportSchema = map[string][]SchemaColumn{
+	"pages": {
+		{"id", "integer", "ID of the page in the crawl"},
+		{"url", "string", "URL of the page"},
+		{"status_code", "integer", "HTTP status code of the page, e.g. 200 or 404"},
+		{"depth", "integer", "Clicks from the start page to the page"},
+		{"content_type", "string", "Content-Type of the response, e.g. text/html"},
+		{"indexable", "bool", "Whether the page can be indexed by search engines"},
+		{"canonical", "string", "Canonical URL of the page, empty if it has none"},
+		{"title", "string", "Title of the page"},
+		{"size", "integer", "Size of the response, in bytes"},
+		{"response_ms", "number", "Response time of the page, in milliseconds"},
+		{"inlinks", "integer", "Links to the page from the other pages of the crawl"},
+		{"outlinks", "integer", "Links of the page"},
+		{"hint", "string", "Hints of the checks failed by the page"},
+	},
+	"links": {
+		{"id", "integer", "ID of the link in the crawl"},
+		{"source_page", "integer", "ID of the page the link is on"},
+		{"target_page", "integer", "ID of the page the link points to"},
+		{"source_url", "string", "URL of the page the link is on"},
+		{"target_url", "string", "URL the link points to"},
+		{"anchor_text", "string", "Anchor text of the link"},
+		{"nofollow", "bool", "Whether the link is rel=nofollow"},
+		{"status_code", "integer", "HTTP status code of the target of the link"},
+		{"hint", "string", "Hints of the checks failed by the link"},
+	},
+	"hints": {
+		{"id", "integer", "ID of the hint in the crawl"},
+		{"page", "integer", "ID of the page the hint is reported for"},
+		{"url", "string", "URL of the page the hint is reported for"},
+		{"status_code", "integer", "HTTP status code of the page"},
+		{"hint", "string", "Name of the check failed by the page, e.g. duplicate_title"},
+		{"category", "string", "Category of the check, e.g. content, indexability or performance"},
+		{"severity", "string", "Severity of the hint: error, warning or notice"},
+		{"description", "string", "What the check found, e.g. the other pages with the same title"},
+	},
+}
+
+// Schema returns the columns of the export of a mode ("pages" if empty), in their order. With enriched, the
+// columns joined onto the links by SetEnrichPages follow, e.g. target_title.
+func Schema(mode string, enriched bool) ([]SchemaColumn, error) {
+	if mode == "" {
+		mode = "pages"
+	}
+	columns, ok := exportSchema[mode]
+	if !ok {
+		return nil, fmt.Errorf("mode has to be 'pages', 'links' or 'hints'")
+	}
+	columns = append([]SchemaColumn(nil), columns...)
+	if !enriched || mode != "links" {
+		return columns, nil
+	}
+
+	kinds := map[string]string{}
+	for _, column := range exportSchema["pages"] {
+		kinds[column.Name] = column.Type
+	}
+	for _, prefix := range []string{EnrichSourcePrefix, EnrichTargetPrefix} {
+		page := "the page the link is on"
+		if prefix == EnrichTargetPrefix {
+			page = "the page the link points to"
+		}
+		for _, name := range EnrichedPageColumns {
+			columns = append(columns, SchemaColumn{prefix + name, kinds[name], fmt.Sprintf("%s of %s", name, page)})
+		}
+	}
+	return columns, nil
+}
+
+// schemaKinds returns the kinds of the values of the columns of every mode, by column name: the integers are
+// filtered and compared as numbers
+func schemaKinds(schema map[string][]SchemaColumn) map[string]map[string]string {
+	kinds := map[string]map[string]string{}
+	for mode, columns := range schema {
+		kinds[mode] = map[string]string{}
+		for _, column := range columns {
+			kind := column.Type
+			if kind == "integer" {
+				kind = "number"
+			}
+			kinds[mode][column.Name] = kind
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	columns, err := Schema("links", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, column := range columns {
+		names[column.Name] = column.Type
+	}
+	for name, kind := range map[string]string{"source_url": "string", "nofollow": "bool", "target_status_code": "integer", "target_depth": "integer", "source_title": "string"} {
+		if names[name] != kind {
+			t.Errorf("expected the %s column %s, got %q", kind, name, names[name])
+		}
+	}
+
+	// the enriched columns only apply to the links
+	pages, err := Schema("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != len(exportSchema["pages"]) || pages[0].Name != "id" {
+		t.Errorf("unexpected pages columns %v", pages)
+	}
+	if _, err = Schema("all", false); err == nil {
+		t.Error("expected an error for the mode all")
+	}
+
+	hints, err := Schema(HintsMode, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hints) != len(exportSchema[HintsMode]) || hints[1].Name != "page" || hints[6].Name != "severity" {
+		t.Errorf("unexpected hints columns %v", hints)
+	}
+}
@@ -0,0 +1,450 @@
+package downloader
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSortRunSize the bytes of rows sorted in memory at once by SetSortBy, every sorted run
+// being written to a temporary file before the runs are merged
+const DefaultSortRunSize = 64 << 20
+
+// sortMergeFanIn the run files merged at once: more runs are first merged into intermediate runs,
+// so that the files open stay bounded however large the output
+const sortMergeFanIn = 64
+
+// sortKey a column the rows are sorted by
+type sortKey struct {
+	column string // lower-cased
+	desc   bool
+	index  int // the position of the column in the written rows, see bindSortKeys
+}
+
+// SetSortBy makes the downloader sort the rows of the output once downloaded, by comma separated columns,
+// each followed by :asc (default) or :desc, e.g. "status_code:desc,url". Numbers are sorted as numbers,
+// before text; rows with the same values keep the order they were downloaded in. The completed output
+// is sorted by an external merge sort, through temporary files next to it: outputs larger than the memory
+// are sorted as well. Only local tsv and csv output files can be sorted.
+// It has to be called before Setup()
+func (d *Downloader) SetSortBy(sortBy string) error {
+	d.sortKeys = nil
+	sortBy = strings.TrimSpace(sortBy)
+	if sortBy == "" {
+		return nil
+	}
+	for _, key := range strings.Split(sortBy, ",") {
+		parts := strings.Split(strings.ToLower(key), ":")
+		column := strings.TrimSpace(parts[0])
+		if column == "" || len(parts) > 2 {
+			return fmt.Errorf("invalid sort key %q, expected column or column:asc or column:desc", strings.TrimSpace(key))
+		}
+		sk := sortKey{column: column}
+		if len(parts) == 2 {
+			switch strings.TrimSpace(parts[1]) {
+			case "asc":
+			case "desc":
+				sk.desc = true
+			default:
+				return fmt.Errorf("invalid sort direction %q of %s, expected asc or desc", strings.TrimSpace(parts[1]), column)
+			}
+		}
+		d.sortKeys = append(d.sortKeys, sk)
+	}
+	return nil
+}
+
+// bindSortKeys finds the sorted columns in the header of the written rows
+func (d *Downloader) bindSortKeys(header []string) error {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for i, key := range d.sortKeys {
+		position, ok := positions[key.column]
+		if !ok {
+			return fmt.Errorf("unknown column %q to sort by, the columns are: %s", key.column, strings.Join(header, ", "))
+		}
+		d.sortKeys[i].index = position
+	}
+	return nil
+}
+
+// lessRow compares two rows by the sort keys
+func (d *Downloader) lessRow(a, b []string) bool {
+	for _, key := range d.sortKeys {
+		c := compareSortValues(fieldAt(a, key.index), fieldAt(b, key.index))
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// compareSortValues compares two values, as numbers if both are, numbers coming before text otherwise
+func compareSortValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// sortOutputFile sorts the rows of the completed file written to the output: sorted runs of rows are written
+// to temporary files, then merged to the output. The written file is removed once sorted.
+func (d *Downloader) sortOutputFile(written string, output string) error {
+	d.appendLog(INFO, fmt.Sprintf("Sorting %s by %s...", output, d.sortDescription()))
+	in, err := os.Open(written)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader, err := decompressedReader(in)
+	if err != nil {
+		return err
+	}
+	format := normalizeOutputFormat(d.OutputFormat)
+	next := newRowReader(format, reader, d.formatOptions().Delimiter)
+
+	var header []string
+	if !d.noHeader {
+		if header, err = next(); err == io.EOF {
+			// nothing to sort
+			in.Close()
+			return os.Rename(written, output)
+		} else if err != nil {
+			return fmt.Errorf("cannot sort %s: %v", output, err)
+		}
+	} else if len(d.Progress.Header) > 0 {
+		projection, err := newColumnsProjection(d.Progress.Header, d.columns)
+		if err != nil {
+			return err
+		}
+		header = d.annotations.header(projection.apply(d.Progress.Header))
+	}
+
+	// sorted runs of at most sortRunSize bytes of rows
+	dir, err := d.createTempDir(output, "sort")
+	if err != nil {
+		return fmt.Errorf("cannot sort %s: %v", output, err)
+	}
+	defer os.RemoveAll(dir)
+	var runs []string
+	var rows [][]string
+	var spilled int64
+	size := 0
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot sort %s: %v", output, err)
+		}
+		rows = append(rows, row)
+		for _, field := range row {
+			size += len(field) + 16
+		}
+		if size >= d.sortRunSize {
+			run, bytes, err := d.writeSortRun(dir, len(runs), rows)
+			if err != nil {
+				return err
+			}
+			runs, rows, size = append(runs, run), nil, 0
+			spilled += bytes
+			d.stats.tempFilesWritten(spilled)
+		}
+	}
+	in.Close()
+
+	sorted := output + ".sorting"
+	file, err := os.Create(sorted)
+	if err != nil {
+		return err
+	}
+	if err = d.writeSortedRows(file, header, runs, rows); err != nil {
+		file.Close()
+		os.Remove(sorted)
+		return fmt.Errorf("cannot sort %s: %v", output, err)
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(sorted)
+		return err
+	}
+	if err = os.Rename(sorted, output); err != nil {
+		return err
+	}
+	if written != output {
+		return os.Remove(written)
+	}
+	return nil
+}
+
+// sortDescription returns the sort keys as passed to SetSortBy
+func (d *Downloader) sortDescription() string {
+	keys := make([]string, len(d.sortKeys))
+	for i, key := range d.sortKeys {
+		keys[i] = key.column
+		if key.desc {
+			keys[i] += ":desc"
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// writeSortRun sorts rows and writes them to a temporary run file, returned along with its size
+func (d *Downloader) writeSortRun(dir string, number int, rows [][]string) (string, int64, error) {
+	sort.SliceStable(rows, func(i, j int) bool { return d.lessRow(rows[i], rows[j]) })
+	return writeRunFile(filepath.Join(dir, fmt.Sprintf("run%06d", number)), func(write func([]string) error) error {
+		for _, row := range rows {
+			if err := write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeRunFile writes the rows written by rows to a run file, returned along with its size
+func writeRunFile(filename string, rows func(write func([]string) error) error) (string, int64, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	w := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(w)
+	if err = rows(func(row []string) error { return encoder.Encode(row) }); err != nil {
+		file.Close()
+		return "", 0, err
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return "", 0, err
+	}
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	return filename, size, file.Close()
+}
+
+// mergeSortRuns merges the runs of more than sortFanIn files into intermediate runs, consecutive runs
+// at once to keep the order of the rows with the same values, until they can be merged to the output.
+// The runs merged are removed.
+func (d *Downloader) mergeSortRuns(runs []string) ([]string, error) {
+	fanIn := d.sortFanIn
+	if fanIn < 2 {
+		fanIn = sortMergeFanIn
+	}
+	var spilled int64
+	for _, run := range runs {
+		if info, err := os.Stat(run); err == nil {
+			spilled += info.Size()
+		}
+	}
+	// the rows left in memory are merged with the last runs into the output, taking the place of a file
+	for level := 1; len(runs) >= fanIn; level++ {
+		var merged []string
+		for i := 0; i < len(runs); i += fanIn {
+			group := runs[i:minInt(i+fanIn, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			filename := filepath.Join(filepath.Dir(group[0]), fmt.Sprintf("merge%02d-%06d", level, len(merged)))
+			run, bytes, err := writeRunFile(filename, func(write func([]string) error) error {
+				return d.mergeRunFiles(group, nil, write)
+			})
+			if err != nil {
+				return nil, err
+			}
+			d.stats.tempFilesWritten(spilled + bytes)
+			for _, name := range group {
+				if info, err := os.Stat(name); err == nil {
+					spilled -= info.Size()
+				}
+				os.Remove(name)
+			}
+			spilled += bytes
+			merged = append(merged, run)
+		}
+		runs = merged
+	}
+	return runs, nil
+}
+
+// mergeRunFiles merges the rows of the run files and the rows left in memory, sorted already, in order.
+// Every run file is closed as soon as its rows are merged.
+func (d *Downloader) mergeRunFiles(runs []string, rows [][]string, write func([]string) error) error {
+	merge := &sortMerge{less: d.lessRow}
+	for i, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		// closed on errors, the merge stopping before the end of the run
+		defer file.Close()
+		decoder := gob.NewDecoder(bufio.NewReader(file))
+		if err = merge.add(i, func() ([]string, error) {
+			var row []string
+			err := decoder.Decode(&row)
+			if err == io.EOF {
+				file.Close()
+			}
+			return row, err
+		}); err != nil {
+			return err
+		}
+	}
+	if err := merge.add(len(runs), func() ([]string, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}); err != nil {
+		return err
+	}
+
+	for merge.Len() > 0 {
+		row, err := merge.pop()
+		if err != nil {
+			return err
+		}
+		if err = write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSortedRows writes the header and the rows of the runs merged in order, along with the rows left
+// in memory, in the format and compression of the output. At most sortFanIn run files are open at once.
+func (d *Downloader) writeSortedRows(file *os.File, header []string, runs []string, rows [][]string) error {
+	runs, err := d.mergeSortRuns(runs)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(file)
+	var w io.Writer = buffered
+	var c compressor
+	if d.Compression != "" {
+		var err error
+		if c, err = newCompressor(d.Compression, d.compressionLevel, buffered); err != nil {
+			return err
+		}
+		w = c
+	}
+	writer, err := newRowWriter(normalizeOutputFormat(d.OutputFormat), w, header, d.formatOptions())
+	if err != nil {
+		return err
+	}
+	if !d.noHeader {
+		if err = writer.WriteHeader(); err != nil {
+			return err
+		}
+	}
+
+	// the rows left in memory are the last run, merged with the ones written
+	sort.SliceStable(rows, func(i, j int) bool { return d.lessRow(rows[i], rows[j]) })
+	if err = d.mergeRunFiles(runs, rows, writer.WriteRow); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	if c != nil {
+		if err = c.Close(); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// sortRun the next row of a sorted run being merged
+type sortRun struct {
+	number int // runs are numbered in the order of the rows, rows with the same values keep that order
+	row    []string
+	next   func() ([]string, error)
+}
+
+// sortMerge merges sorted runs, a heap of the next row of every run
+type sortMerge struct {
+	runs []*sortRun
+	less func(a, b []string) bool
+}
+
+func (m *sortMerge) Len() int { return len(m.runs) }
+
+func (m *sortMerge) Less(i, j int) bool {
+	if m.less(m.runs[i].row, m.runs[j].row) {
+		return true
+	}
+	if m.less(m.runs[j].row, m.runs[i].row) {
+		return false
+	}
+	return m.runs[i].number < m.runs[j].number
+}
+
+func (m *sortMerge) Swap(i, j int) { m.runs[i], m.runs[j] = m.runs[j], m.runs[i] }
+
+func (m *sortMerge) Push(x interface{}) { m.runs = append(m.runs, x.(*sortRun)) }
+
+func (m *sortMerge) Pop() interface{} {
+	run := m.runs[len(m.runs)-1]
+	m.runs = m.runs[:len(m.runs)-1]
+	return run
+}
+
+// add adds a run to the merge, unless it's empty
+func (m *sortMerge) add(number int, next func() ([]string, error)) error {
+	row, err := next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(m, &sortRun{number: number, row: row, next: next})
+	return nil
+}
+
+// pop returns the smallest next row of the runs, the run moving on to its next row
+func (m *sortMerge) pop() ([]string, error) {
+	run := m.runs[0]
+	row := run.row
+	next, err := run.next()
+	switch {
+	case err == io.EOF:
+		heap.Pop(m)
+	case err != nil:
+		return nil, err
+	default:
+		run.row = next
+		heap.Fix(m, 0)
+	}
+	return row, nil
+}
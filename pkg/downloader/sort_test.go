@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSortBy(t *testing.T) {
+	statusCodes := []string{"404", "200", "301", "200", "404", "200"}
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":6,"page":0,"size":2}}`))
+			return
+		}
+		chunk, _ := strconv.Atoi(r.URL.Query().Get("chunk"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("chunk_size"))
+		w.Write([]byte("id\turl\tstatus_code\n"))
+		for row := chunk * size; row < (chunk+1)*size; row++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%c\t%s\n", row+1, 'f'-row, statusCodes[row])
+		}
+	})()
+	dir, err := ioutil.TempDir("", "sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		ChunkSize: 2, SortBy: "status_code:desc, url", Columns: []string{"url", "status_code"}}
+	d := New(options)
+	// a run of about two rows, merged with the others
+	d.sortRunSize = 100
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "url\tstatus_code\n" +
+		"http://example.com/b\t404\nhttp://example.com/f\t404\nhttp://example.com/d\t301\n" +
+		"http://example.com/a\t200\nhttp://example.com/c\t200\nhttp://example.com/e\t200\n"
+	if string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, written)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("the partial file and the runs should be removed once sorted, got %d files", len(files))
+	}
+
+	// a run of every row, merged two files at once through intermediate runs
+	options.Output = filepath.Join(dir, "cascaded.tsv")
+	d = New(options)
+	d.sortRunSize, d.sortFanIn = 10, 2
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written, err = ioutil.ReadFile(options.Output); err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, written)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("the intermediate runs should be removed once sorted, got %d files", len(files))
+	}
+
+	options.Output, options.SortBy = filepath.Join(dir, "crawl.json"), "url"
+	options.OutputFormat = JSONOutputFormat
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("only tsv and csv outputs should be sorted")
+	}
+}
+
+func TestCompareSortValues(t *testing.T) {
+	for _, values := range [][2]string{{"9", "10"}, {"2.5", "abc"}, {"abc", "abd"}, {"", "a"}} {
+		if compareSortValues(values[0], values[1]) >= 0 || compareSortValues(values[1], values[0]) <= 0 {
+			t.Errorf("%q should be sorted before %q", values[0], values[1])
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SetSplitRows splits the output into parts of at most the given number of rows, e.g. crawl.part0001.tsv,
+// crawl.part0002.tsv, every part starting with the header. 0 for no limit.
+// It has to be called before Setup()
+func (d *Downloader) SetSplitRows(rows uint64) {
+	d.splitRows = rows
+}
+
+// SetSplitSize splits the output into parts of at most the given number of bytes, see SetSplitRows.
+// The bytes are counted before compression, compressed parts are smaller. 0 for no limit.
+// It has to be called before Setup()
+func (d *Downloader) SetSplitSize(bytes int64) error {
+	if bytes < 0 {
+		return fmt.Errorf("split size can't be negative")
+	}
+	d.splitSize = bytes
+	return nil
+}
+
+// ParseSize parses a number of bytes, e.g. 1GB or 500MB (1GB = 1024MB)
+func ParseSize(size string) (int64, error) {
+	bytes, err := parseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: expected e.g. 1GB or 500MB", size)
+	}
+	return bytes, nil
+}
+
+// PartFilename returns the name of a part of a split output, numbered from 1: the part number is
+// inserted before the extension, e.g. crawl.tsv.gz -> crawl.part0001.tsv.gz
+func PartFilename(output string, part int) string {
+	return infixedFilename(output, fmt.Sprintf(".part%04d", part))
+}
+
+// infixedFilename inserts the infix before the extension of the output, and its compression and encryption
+// extensions if any
+func infixedFilename(output string, infix string) string {
+	encrypted := encryptionExtension(output)
+	output = output[:len(output)-len(encrypted)]
+	ext := ""
+	for _, compression := range []string{GzipCompression, ZstdCompression} {
+		if suffix := compressionExtension(compression); strings.HasSuffix(strings.ToLower(output), suffix) {
+			ext = output[len(output)-len(suffix):]
+		}
+	}
+	return suffixedFilename(strings.TrimSuffix(output, ext), infix, "") + ext + encrypted
+}
+
+// isSplit checks if the output is split into parts
+func (d *Downloader) isSplit() bool {
+	return d.splitRows > 0 || d.splitSize > 0
+}
+
+// partFull checks if the current part reached a limit, the next row goes to a new part
+func (d *Downloader) partFull() bool {
+	if d.splitRows > 0 && d.partRows >= d.splitRows {
+		return true
+	}
+	return d.splitSize > 0 && d.partBytes >= d.splitSize
+}
+
+// nextPart closes the current part and makes the downloader write to the following one
+func (d *Downloader) nextPart() error {
+	if err := d.closeOutput(nil); err != nil {
+		return err
+	}
+	d.part++
+	d.partRows, d.partBytes = 0, 0
+	d.OutputFilename = PartFilename(d.origOutputFilename, d.part)
+	d.appendLog(INFO, "Writing part "+d.OutputFilename)
+
+	if d.isRemoteOutput() {
+		remoteOutput, err := openRemoteOutput(d.OutputFilename)
+		if err != nil {
+			return err
+		}
+		return d.setOutput(remoteOutput, nil)
+	}
+	newFile, err := os.Create(d.writtenFilename(d.OutputFilename))
+	if err != nil {
+		return err
+	}
+	return d.setOutput(newFile, newFile)
+}
+
+// nextPartWriter flushes the current part and returns a RowWriter of the following one,
+// the header being written already
+func (d *Downloader) nextPartWriter(writer RowWriter, header []string) (RowWriter, error) {
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	if err := d.nextPart(); err != nil {
+		return nil, err
+	}
+	writer, err := d.newChunkWriter(header)
+	if err != nil {
+		return nil, err
+	}
+	return writer, d.writeHeader(writer)
+}
+
+// restorePart restores the part of the last confirmed chunk, when resuming a split output.
+// Parts written after it are removed.
+func (d *Downloader) restorePart() {
+	d.part, d.partRows, d.partBytes = d.Progress.Part, d.Progress.PartRows, d.Progress.PartBytes
+	if d.part == 0 {
+		d.part = 1
+	}
+	d.OutputFilename = PartFilename(d.origOutputFilename, d.part)
+	d.removePartsAfter(d.part)
+}
+
+// countedOutput returns the writer of the rows, counting the bytes of the current part when split by size
+func (d *Downloader) countedOutput() io.Writer {
+	if d.splitSize == 0 || d.outputWriter == nil {
+		return d.outputWriter
+	}
+	return &countingWriter{w: d.outputWriter, count: &d.partBytes}
+}
+
+// removePartsAfter deletes the local parts following the given one, along with their checksums:
+// those of a previous download, or written after the last confirmed chunk
+func (d *Downloader) removePartsAfter(part int) {
+	for next := part + 1; ; next++ {
+		name := PartFilename(d.origOutputFilename, next)
+		// the last part written may be partial
+		if os.Remove(name) != nil && os.Remove(name+PartialSuffix) != nil {
+			return
+		}
+		os.Remove(name + PartialSuffix)
+		os.Remove(name + ChecksumSuffix)
+	}
+}
+
+// countingWriter counts the bytes written to the current part
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.count += int64(n)
+	return n, err
+}
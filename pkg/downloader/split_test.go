@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartFilename(t *testing.T) {
+	names := map[string]string{
+		"crawl.tsv":                 "crawl.part0001.tsv",
+		"exports/crawl.csv.gz":      "exports/crawl.part0001.csv.gz",
+		"crawl.json.zst":            "crawl.part0001.json.zst",
+		"crawl":                     "crawl.part0001",
+		"s3://bucket/exports/c.tsv": "s3://bucket/exports/c.part0001.tsv",
+	}
+	for output, expected := range names {
+		if name := PartFilename(output, 1); name != expected {
+			t.Errorf("expected %q as the first part of %q, got %q", expected, output, name)
+		}
+	}
+	if name := PartFilename("crawl.tsv", 12); name != "crawl.part0012.tsv" {
+		t.Errorf("unexpected part name %q", name)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]int64{"1GB": 1 << 30, "500MB": 500 << 20, "1.5k": 1536, "2048": 2048}
+	for size, expected := range sizes {
+		if bytes, err := ParseSize(size); err != nil || bytes != expected {
+			t.Errorf("expected %d bytes for %q, got %d (%v)", expected, size, bytes, err)
+		}
+	}
+	for _, invalid := range []string{"", "GB", "1TB", "-1MB"} {
+		if _, err := ParseSize(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+}
+
+func TestRunSplit(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := map[string]Options{
+		"rows": {SplitRows: 1},
+		"size": {SplitSize: 20}, // the header and a single row
+	}
+	for name, o := range options {
+		output := filepath.Join(dir, name+".tsv")
+		// the parts of a previous, bigger download are removed
+		for part := 2; part <= 3; part++ {
+			ioutil.WriteFile(PartFilename(output, part), []byte("stale"), 0644)
+		}
+
+		o.Username, o.Password, o.CrawlID, o.Mode, o.Output = "user", "pass", 12345, "pages", output
+		if err = New(o).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for part, row := range []string{"1\thttp://example.com/a\n", "2\thttp://example.com/b\n"} {
+			written, err := ioutil.ReadFile(PartFilename(output, part+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(written) != "id\turl\n"+row {
+				t.Errorf("split by %s: unexpected part %d %q", name, part+1, written)
+			}
+		}
+		if fExists(PartFilename(output, 3)) == nil || fExists(output) == nil {
+			t.Errorf("split by %s: only the parts should be written", name)
+		}
+		if !IsDownloadCompleted(output) {
+			t.Errorf("split by %s: the download should be completed", name)
+		}
+	}
+}
+
+func TestResumeSplit(t *testing.T) {
+	failing := true
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := query.Get("chunk")
+		if chunk == "2" && failing {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("id\turl\n" + chunk + "\thttp://example.com/" + chunk + "\n"))
+	})()
+	dir, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 1, SplitRows: 2}
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Fatal("the download should fail on the third chunk")
+	}
+	failing = false
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []string{"id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n", "id\turl\n2\thttp://example.com/2\n"}
+	for i, expected := range parts {
+		written, err := ioutil.ReadFile(PartFilename(output, i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(written) != expected {
+			t.Errorf("unexpected part %d %q", i+1, written)
+		}
+	}
+}
+
+func TestSplitTableOutput(t *testing.T) {
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 1, Output: "postgres://localhost/db", SplitRows: 10})
+	if err := d.Prepare(); err == nil {
+		t.Error("a database output can't be split")
+	}
+}
@@ -0,0 +1,211 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// StateBundleSuffix the suffix of the state bundle exported for an output, see ExportState
+	StateBundleSuffix = ".audisto-state"
+	// stateBundleVersion the version of the state bundles written by ExportState
+	stateBundleVersion = 1
+)
+
+// stateBundle the portable resume state of a download: its resume file, and the files written so far.
+// The files are recorded by their role rather than their path, to be found next to another output.
+type stateBundle struct {
+	Version int             `json:"version"`
+	Output  string          `json:"output"` // the output the state was exported for, as a hint
+	State   json.RawMessage `json:"state"`  // the resume file, as is
+	Files   []bundledFile   `json:"files"`
+}
+
+// bundledFile a file written so far, up to the last confirmed chunk
+type bundledFile struct {
+	Name      string `json:"name"`                // the name of the file on the exporting machine
+	Part      int    `json:"part,omitempty"`      // the part of a split output, 0 unless split
+	Partition string `json:"partition,omitempty"` // the partition of a partitioned output, "" unless partitioned
+	Partial   bool   `json:"partial,omitempty"`   // the file is the partial file of the output, see SetAtomic
+	Size      int64  `json:"size"`                // the bytes confirmed, the file is truncated to them when resumed
+	SHA256    string `json:"sha256"`              // the hex SHA-256 of the bytes confirmed
+}
+
+// filename returns the file at the location of an output
+func (f bundledFile) filename(output string, partitionBy string) string {
+	filename := output
+	switch {
+	case f.Partition != "":
+		filename = partitionFile(output, partitionBy, f.Partition)
+	case f.Part > 0:
+		filename = PartFilename(output, f.Part)
+	}
+	if f.Partial {
+		filename += PartialSuffix
+	}
+	return filename
+}
+
+// ExportState writes the resume state of the unfinished download of a local output as a portable bundle,
+// along with the size and SHA-256 of what's written of the output so far: copied along with the output
+// files, the bundle is imported by ImportState to complete the download elsewhere, e.g. on another machine.
+func ExportState(output string, w io.Writer) error {
+	resumeFilename := output + resumerSuffix
+	state, err := ioutil.ReadFile(resumeFilename)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no unfinished download of %q to export", output)
+	}
+	if err != nil {
+		return err
+	}
+	d := &Downloader{}
+	if err = json.Unmarshal(state, d); err != nil {
+		return fmt.Errorf("resumer file error: %v", err)
+	}
+
+	bundle := stateBundle{Version: stateBundleVersion, Output: output, State: state}
+	if bundle.Files, err = d.bundledFiles(output); err != nil {
+		return err
+	}
+	for i, file := range bundle.Files {
+		filename := file.filename(output, d.Parameters.PartitionBy)
+		if bundle.Files[i].SHA256, err = prefixChecksum(filename, file.Size); err != nil {
+			return fmt.Errorf("cannot export the state of %q: %v", output, err)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "	")
+	return encoder.Encode(bundle)
+}
+
+// bundledFiles returns the files written so far of the resumed download, without their SHA-256
+func (d *Downloader) bundledFiles(output string) ([]bundledFile, error) {
+	// partitions are written in place
+	if d.Parameters.PartitionBy != "" {
+		var files []bundledFile
+		for name, size := range d.Progress.Partitions {
+			filename := partitionFile(output, d.Parameters.PartitionBy, name)
+			files = append(files, bundledFile{Name: filepath.Base(filename), Partition: name, Size: size})
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Partition < files[j].Partition })
+		return files, nil
+	}
+
+	var files []bundledFile
+	current := bundledFile{Size: d.Progress.OutputSize}
+	if d.Parameters.SplitRows > 0 || d.Parameters.SplitSize > 0 {
+		current.Part = d.Progress.Part
+		if current.Part == 0 {
+			current.Part = 1
+		}
+		// the previous parts are completed
+		for part := 1; part < current.Part; part++ {
+			filename := PartFilename(output, part)
+			info, err := os.Stat(filename)
+			if err != nil {
+				return nil, fmt.Errorf("cannot export the state of %q: %v", output, err)
+			}
+			files = append(files, bundledFile{Name: filepath.Base(filename), Part: part, Size: info.Size()})
+		}
+	}
+	// the current file is its partial file, unless written in place
+	current.Partial = true
+	if fExists(current.filename(output, "")) != nil {
+		current.Partial = false
+	}
+	current.Name = filepath.Base(current.filename(output, ""))
+	return append(files, current), nil
+}
+
+// ImportState imports a bundle written by ExportState, so the download is resumed to the given output:
+// the files of the bundle have to be next to the output, with the names they'd have been written to.
+// They're checked against the bundle before the resume file of the output is written. A download begun
+// with targets is resumed with the given targets file, checked to be the same file as well.
+func ImportState(r io.Reader, output string, targets string) error {
+	var bundle stateBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return fmt.Errorf("invalid state bundle: %v", err)
+	}
+	if bundle.Version != stateBundleVersion {
+		return fmt.Errorf("unsupported state bundle version %d, expected %d", bundle.Version, stateBundleVersion)
+	}
+	d := &Downloader{}
+	if err := json.Unmarshal(bundle.State, d); err != nil {
+		return fmt.Errorf("invalid state bundle: %v", err)
+	}
+
+	resumeFilename := output + resumerSuffix
+	if fExists(resumeFilename) == nil {
+		return fmt.Errorf("%q already has a download to resume, remove %s to import the state", output, resumeFilename)
+	}
+	for _, file := range bundle.Files {
+		filename := file.filename(output, d.Parameters.PartitionBy)
+		checksum, err := prefixChecksum(filename, file.Size)
+		if err != nil {
+			return fmt.Errorf("cannot import the state, copy %s of the exported download to %s: %v", file.Name, filename, err)
+		}
+		if checksum != file.SHA256 {
+			return fmt.Errorf("cannot import the state, %s is not the file %s of the exported download", filename, file.Name)
+		}
+	}
+
+	// the paths of the resume file are the ones of this machine
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(bundle.State, &state); err != nil {
+		return fmt.Errorf("invalid state bundle: %v", err)
+	}
+	outputFilename := output
+	if d.Parameters.SplitRows > 0 || d.Parameters.SplitSize > 0 {
+		outputFilename = PartFilename(output, d.Progress.Part)
+		if d.Progress.Part == 0 {
+			outputFilename = PartFilename(output, 1)
+		}
+	}
+	state["outputFilename"], _ = json.Marshal(outputFilename)
+	if d.TargetsFilename != "" {
+		if targets == "" {
+			return fmt.Errorf("the download was begun with --targets=%s, pass the same targets file", d.TargetsFilename)
+		}
+		md5, err := getFileMD5Hash(targets)
+		if err != nil {
+			return err
+		}
+		if md5 != d.TargetsFileMD5 {
+			return fmt.Errorf("cannot import the state, %s is not the targets file %s of the exported download", targets, d.TargetsFilename)
+		}
+		state["targetsFilename"], _ = json.Marshal(targets)
+	}
+
+	config, err := json.MarshalIndent(state, "", "	")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(resumeFilename, config, 0644)
+}
+
+// prefixChecksum computes the hex SHA-256 of the first bytes of a file, the file having at least as many
+func prefixChecksum(filename string, size int64) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(file, size))
+	if err != nil {
+		return "", err
+	}
+	if n < size {
+		return "", fmt.Errorf("%s is smaller than the last confirmed chunk", filename)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportAndImportState(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := r.URL.Query().Get("chunk")
+		if chunk == "1" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprintf(w, "id\turl\n%s\thttp://example.com/%s\n", chunk, chunk)
+	})()
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// begun on a machine, the second chunk outlasting the job timeout
+	begun := filepath.Join(dir, "laptop", "crawl.tsv")
+	os.Mkdir(filepath.Dir(begun), 0755)
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: begun,
+		ChunkSize: 1, JobTimeout: 100 * time.Millisecond}
+	if err = New(options).Run(context.Background()); !IsJobTimeout(err) {
+		t.Fatalf("expected a job timeout, got %v", err)
+	}
+	var bundle bytes.Buffer
+	if err = ExportState(begun, &bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	// the partial output is needed, unaltered
+	moved := filepath.Join(dir, "server", "crawl.tsv")
+	os.Mkdir(filepath.Dir(moved), 0755)
+	if err = ImportState(bytes.NewReader(bundle.Bytes()), moved, ""); err == nil {
+		t.Fatal("the state should not be imported without the partial output")
+	}
+	partial, err := ioutil.ReadFile(begun + PartialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(moved+PartialSuffix, []byte("id\turl\n9\thttp://example.com/9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ImportState(bytes.NewReader(bundle.Bytes()), moved, ""); err == nil {
+		t.Fatal("the state should not be imported along with another partial output")
+	}
+
+	// completed elsewhere
+	if err = ioutil.WriteFile(moved+PartialSuffix, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ImportState(bytes.NewReader(bundle.Bytes()), moved, ""); err != nil {
+		t.Fatal(err)
+	}
+	options.Output, options.JobTimeout, options.MustResume = moved, 0, true
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n2\thttp://example.com/2\n" {
+		t.Errorf("unexpected resumed output %q", written)
+	}
+}
+
+func TestExportStateOfNoDownload(t *testing.T) {
+	if err := ExportState(filepath.Join(os.TempDir(), "no-download.tsv"), ioutil.Discard); err == nil {
+		t.Error("expected an error exporting the state of no download")
+	}
+}
@@ -2,6 +2,7 @@ package downloader
 
 import (
 	"math/big"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,9 +13,6 @@ const (
 
 // progress bar elements
 var (
-	timeoutCount int
-	errorCount   int
-
 	averageTimePer1000 float64 = 1
 
 	// RefreshInterval time between to progress updates
@@ -26,15 +24,18 @@ var (
 type StatusReport struct {
 	ETA                         time.Duration
 	ChunkSize                   uint64
+	CurrentChunk                uint64
 	TotalElements, DoneElements uint64
 	Mode                        string
 	TimeoutsCount, ErrorsCount  int
 	ProgressPercentage          float64
+	DownloadedBytes             uint64
 	OutputFilename              string
 	Logs                        []map[LogType]string
 	IsIngTargetMode             bool
 	TotalIDsCount               int
 	CurrentIDOrderNumber        int
+	Paused                      bool // no chunk is requested until resumed, see Pause
 }
 
 // IsDone a helper function to know if the download is considered done.
@@ -63,35 +64,137 @@ func reportProgressStatus(downloader *Downloader) {
 	}
 }
 
-// ProgressReport make the downloader tell its current status
+// progressSnapshot the progress of the download as of the last chunk written, read by ProgressReport: the
+// progress reporter and the callers of ProgressReport run in goroutines of their own while the download
+// updates its progress, see publishProgress
+type progressSnapshot struct {
+	target               currentTarget
+	chunkSize            uint64
+	mode                 string
+	logs                 []map[LogType]string
+	outputFilename       string
+	inTargetsMode        bool
+	currentIDOrderNumber int
+	totalIDsCount        int
+}
+
+// publishProgress publishes the progress of the download to ProgressReport. It's called by the goroutine
+// running the download only: once a chunk is written, a target is begun, a message logged and the download
+// returns.
+func (d *Downloader) publishProgress() {
+	progress := progressSnapshot{
+		target: d.CurrentTarget,
+		// the logs are only appended to, the entries published aren't written again
+		logs:                 d.logs[:len(d.logs):len(d.logs)],
+		outputFilename:       RedactOutput(d.OutputFilename),
+		inTargetsMode:        d.isInTargetsMode() && d.currentTargetsFilename != "self",
+		currentIDOrderNumber: d.TargetsFileNextID,
+		totalIDsCount:        d.totalIDsCount,
+	}
+	if d.client != nil {
+		progress.chunkSize, progress.mode = d.client.ChunkSize, d.client.Mode
+	}
+	d.progressMu.Lock()
+	defer d.progressMu.Unlock()
+	d.progress = progress
+}
+
+// ProgressReport make the downloader tell its current status, as of the last chunk written. It's safe to be
+// called from any goroutine while the download runs.
 func (d *Downloader) ProgressReport() StatusReport {
+	d.progressMu.Lock()
+	progress := d.progress
+	d.progressMu.Unlock()
+	target := progress.target
 
 	// Calculate Estimated Time of Arival
-	ETAuint64, _ := big.NewFloat(0).Quo(big.NewFloat(0).Quo(big.NewFloat(0).Sub(big.NewFloat(0).SetUint64(d.CurrentTarget.TotalElements), big.NewFloat(0).SetUint64(d.CurrentTarget.DoneElements)), big.NewFloat(1000)), big.NewFloat(averageTimePer1000)).Uint64()
+	ETAuint64, _ := big.NewFloat(0).Quo(big.NewFloat(0).Quo(big.NewFloat(0).Sub(big.NewFloat(0).SetUint64(target.TotalElements), big.NewFloat(0).SetUint64(target.DoneElements)), big.NewFloat(1000)), big.NewFloat(averageTimePer1000)).Uint64()
+
+	var currentChunk uint64
+	if progress.chunkSize > 0 {
+		currentChunk = target.DoneElements / progress.chunkSize
+	}
 
 	// Calculate the progress percentage
 	var progressPerc *big.Float = big.NewFloat(0.0)
 	var progressF float64
-	if d.CurrentTarget.TotalElements > 0 && d.CurrentTarget.DoneElements > 0 {
-		progressPerc = big.NewFloat(0).Quo(big.NewFloat(100), big.NewFloat(0).Quo(big.NewFloat(0).SetUint64(d.CurrentTarget.TotalElements), big.NewFloat(0).SetUint64(d.CurrentTarget.DoneElements)))
+	if target.TotalElements > 0 && target.DoneElements > 0 {
+		progressPerc = big.NewFloat(0).Quo(big.NewFloat(100), big.NewFloat(0).Quo(big.NewFloat(0).SetUint64(target.TotalElements), big.NewFloat(0).SetUint64(target.DoneElements)))
 		progressF, _ = progressPerc.Float64()
 	}
 
 	return StatusReport{
 		ETA:                  time.Duration(ETAuint64) * time.Millisecond * ETAFactor,
-		Mode:                 d.client.Mode,
-		ChunkSize:            d.client.ChunkSize,
-		TotalElements:        d.CurrentTarget.TotalElements,
-		DoneElements:         d.CurrentTarget.DoneElements,
-		TimeoutsCount:        timeoutCount,
-		ErrorsCount:          errorCount,
+		Mode:                 progress.mode,
+		ChunkSize:            progress.chunkSize,
+		CurrentChunk:         currentChunk,
+		TotalElements:        target.TotalElements,
+		DoneElements:         target.DoneElements,
+		TimeoutsCount:        int(atomic.LoadInt64(&d.counters.timeouts)),
+		ErrorsCount:          int(atomic.LoadInt64(&d.counters.errors)),
 		ProgressPercentage:   progressF,
-		Logs:                 d.logs,
-		OutputFilename:       d.OutputFilename,
-		IsIngTargetMode:      d.isInTargetsMode() && d.currentTargetsFilename != "self",
-		CurrentIDOrderNumber: d.TargetsFileNextID,
-		TotalIDsCount:        d.totalIDsCount,
+		DownloadedBytes:      uint64(atomic.LoadInt64(&d.counters.bytes)),
+		Logs:                 progress.logs,
+		OutputFilename:       progress.outputFilename,
+		IsIngTargetMode:      progress.inTargetsMode,
+		CurrentIDOrderNumber: progress.currentIDOrderNumber,
+		TotalIDsCount:        progress.totalIDsCount,
+		Paused:               d.Paused(),
+	}
+}
+
+// requestCounters the errors, timeouts and bytes of the requests of a download, displayed in the progress report.
+// They're updated with atomic operations, requests are made in parallel.
+type requestCounters struct {
+	timeouts int64
+	errors   int64
+	retries  int64
+	bytes    int64
+	calls    int64 // the API calls made, retries included
+
+	budget *Budget // the budget the calls and bytes are spent from, nil for no cap
+	stop   func()  // stops the download once its budget is exhausted, nil before Run()
+}
+
+// countDownloadedBytes adds to the bytes downloaded from Audisto API, used to report the throughput, spent from
+// the budget if any. It's safe to be called from parallel requests, and on nil counters.
+func (c *requestCounters) countDownloadedBytes(n int) {
+	if c != nil {
+		atomic.AddInt64(&c.bytes, int64(n))
+		if c.budget != nil && c.budget.spendBytes(n) {
+			c.stopRun()
+		}
+	}
+}
+
+// startReporting starts the progress reporter, unless it's running already (the recursive start() of
+// targets=self) or there's no status channel
+func (d *Downloader) startReporting() {
+	if d.status == nil || d.reporting != nil {
+		return
+	}
+	d.publishProgress()
+	d.reporting = make(chan struct{})
+	go func() {
+		defer close(d.reporting)
+		reportProgressStatus(d)
+	}()
+}
+
+// stopReporting makes the progress reporter send its last report, and waits for it to close the
+// status channel. The status channel is closed once Start() returns, whether it failed or not.
+func (d *Downloader) stopReporting() {
+	d.publishProgress()
+	if d.reporting == nil {
+		d.closeStatusChannel()
+		return
+	}
+	select {
+	case <-d.done:
+	default:
+		close(d.done)
 	}
+	<-d.reporting
 }
 
 func (d *Downloader) closeStatusChannel() {
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// RunSummary the machine-readable summary of a finished download, see Summary
+type RunSummary struct {
+	Event           string          `json:"event"` // CompletedEvent or FailedEvent
+	CrawlID         uint64          `json:"crawlID"`
+	Mode            string          `json:"mode"`
+	Output          string          `json:"output"`
+	Elements        uint64          `json:"elements"` // elements downloaded
+	Rows            uint64          `json:"rows"`     // rows written, the rows not matching the where expression excluded
+	Bytes           int64           `json:"bytes"`    // bytes downloaded from the API
+	APICalls        int64           `json:"apiCalls"` // requests sent to the API, retries included
+	Duration        string          `json:"duration"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	PausedSeconds   float64         `json:"pausedSeconds,omitempty"`
+	Retries         int64           `json:"retries"`
+	Timeouts        int64           `json:"timeouts"`
+	Errors          int64           `json:"errors"`
+	TempBytes       int64           `json:"tempBytes,omitempty"` // the most bytes of temporary files held at once
+	Sanitized       int64           `json:"sanitized,omitempty"` // rows whose fields were sanitized, see SetSanitize
+	Drifts          int             `json:"drifts,omitempty"`    // the times the total elements changed, see SetDriftCheck
+	Unchanged       bool            `json:"unchanged,omitempty"` // the download was skipped, see SetSkipIfUnchanged
+	Chunks          ChunksSummary   `json:"chunks"`
+	Outputs         []OutputSummary `json:"outputs"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// ChunksSummary the chunks of a finished download
+type ChunksSummary struct {
+	Written        int     `json:"written"`
+	Skipped        int     `json:"skipped"` // the chunks failed and skipped, see SetSkipFailedChunks
+	Size           uint64  `json:"size"`    // the size of the last chunk requested
+	AverageSeconds float64 `json:"averageSeconds"`
+	SlowestSeconds float64 `json:"slowestSeconds"`
+}
+
+// OutputSummary a file or a table written by a download, along with its size and SHA-256 when it's local
+type OutputSummary struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// runStats the rows, chunks and outputs written by a download, for its summary
+type runStats struct {
+	rows      uint64            // rows written
+	chunks    int               // chunks written
+	fetching  time.Duration     // time spent fetching the batches of chunks
+	slowest   time.Duration     // the longest time fetching a batch of chunks
+	duration  time.Duration     // how long Start() took
+	outputs   []string          // the outputs completed, in order
+	checksums map[string]string // the SHA-256 of the outputs computed while writing them, by output
+	tempBytes int64             // the most bytes of temporary files held at once
+}
+
+// chunkWritten records a written chunk, along with its rows written
+func (s *runStats) chunkWritten(rows int) {
+	s.chunks++
+	s.rows += uint64(rows)
+}
+
+// chunksFetched records the time spent fetching a batch of chunks
+func (s *runStats) chunksFetched(elapsed time.Duration) {
+	s.fetching += elapsed
+	if elapsed > s.slowest {
+		s.slowest = elapsed
+	}
+}
+
+// tempFilesWritten records the bytes of the temporary files held at once
+func (s *runStats) tempFilesWritten(bytes int64) {
+	if bytes > s.tempBytes {
+		s.tempBytes = bytes
+	}
+}
+
+// outputCompleted records a completed output, along with its SHA-256 if computed already
+func (s *runStats) outputCompleted(output string, checksum string) {
+	if output == "" {
+		return
+	}
+	if checksum != "" {
+		if s.checksums == nil {
+			s.checksums = map[string]string{}
+		}
+		s.checksums[output] = checksum
+	}
+	for _, completed := range s.outputs {
+		if completed == output {
+			return
+		}
+	}
+	s.outputs = append(s.outputs, output)
+}
+
+// Summary returns the summary of the download once Run() returned err: the rows and bytes downloaded,
+// retries, chunks and the outputs completed. The SHA-256 of the local outputs is computed if not yet.
+func (d *Downloader) Summary(err error) RunSummary {
+	summary := RunSummary{
+		Event:           CompletedEvent,
+		Elements:        d.DoneElements,
+		Rows:            d.stats.rows,
+		Bytes:           atomic.LoadInt64(&d.counters.bytes),
+		APICalls:        atomic.LoadInt64(&d.counters.calls),
+		Duration:        d.stats.duration.Round(time.Millisecond).String(),
+		DurationSeconds: d.stats.duration.Seconds(),
+		Retries:         atomic.LoadInt64(&d.counters.retries),
+		Timeouts:        atomic.LoadInt64(&d.counters.timeouts),
+		Errors:          atomic.LoadInt64(&d.counters.errors),
+		TempBytes:       d.stats.tempBytes,
+		Sanitized:       atomic.LoadInt64(&d.sanitized.rows),
+		Chunks:          ChunksSummary{Written: d.stats.chunks, Skipped: len(d.FailedChunks), SlowestSeconds: d.stats.slowest.Seconds()},
+		Outputs:         []OutputSummary{},
+		Output:          RedactOutput(d.origOutputFilename),
+	}
+	if d.client != nil {
+		summary.CrawlID, summary.Mode, summary.Chunks.Size = d.client.CrawlID, d.client.Mode, d.client.ChunkSize
+	}
+	if d.drift != nil {
+		summary.Drifts = d.drift.drifts
+	}
+	summary.Unchanged, summary.PausedSeconds = d.unchanged, d.pausedFor().Seconds()
+	if d.stats.chunks > 0 {
+		summary.Chunks.AverageSeconds = d.stats.fetching.Seconds() / float64(d.stats.chunks)
+	}
+	if err != nil {
+		summary.Event, summary.Error = FailedEvent, err.Error()
+	}
+
+	for _, output := range d.stats.outputs {
+		o := OutputSummary{Name: RedactOutput(output), SHA256: d.stats.checksums[output]}
+		if !IsRemoteOutput(output) && !IsTableOutputLocation(output) {
+			if info, statErr := os.Stat(output); statErr == nil && info.Mode().IsRegular() {
+				o.Bytes = info.Size()
+				if o.SHA256 == "" {
+					o.SHA256, _ = fileChecksum(output)
+				}
+			}
+		}
+		summary.Outputs = append(summary.Outputs, o)
+	}
+	// the partitions are completed in no particular order
+	sort.SliceStable(summary.Outputs, func(i, j int) bool { return summary.Outputs[i].Name < summary.Outputs[j].Name })
+	return summary
+}
@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\tstatus_code\n1\thttp://example.com/a\t200\n2\thttp://example.com/b\t404\n"))
+	})()
+	dir, err := ioutil.TempDir("", "summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, Where: "status_code == 404"}
+	d := New(options)
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	summary := d.Summary(nil)
+	if summary.Event != CompletedEvent || summary.CrawlID != 12345 || summary.Mode != "pages" {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if summary.Elements != 2 || summary.Rows != 1 || summary.Chunks.Written != 1 || summary.Bytes == 0 {
+		t.Errorf("expected 2 elements downloaded and 1 row written in 1 chunk, got %+v", summary)
+	}
+	checksum, err := fileChecksum(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Outputs) != 1 || summary.Outputs[0].Name != output || summary.Outputs[0].SHA256 != checksum || summary.Outputs[0].Bytes == 0 {
+		t.Errorf("unexpected outputs %+v, expected %s with SHA-256 %s", summary.Outputs, output, checksum)
+	}
+
+	if failed := d.Summary(errors.New("failed")); failed.Event != FailedEvent || failed.Error != "failed" {
+		t.Errorf("expected a failed summary, got %+v", failed)
+	}
+}
@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempDirPrefix the prefix of the directory of the temporary files of a download, within the temporary directory
+const tempDirPrefix = "data-downloader-"
+
+// SetTempDir sets the directory the temporary files are written to, e.g. the sorted runs of --sort-by, instead of
+// the directory of the output. The output partial file stays next to the output, it's renamed to it once completed.
+// The temporary files of a download are written to a directory of their own within it, removed once the download
+// completes, fails or is stopped. An empty directory writes them next to the output.
+// It has to be called before Setup()
+func (d *Downloader) SetTempDir(dir string) error {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		d.tempDir = ""
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid temporary directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid temporary directory %s: not a directory", dir)
+	}
+	d.tempDir = dir
+	return nil
+}
+
+// createTempDir creates a temporary directory for the given output, named after the purpose, e.g. "sort".
+// It's created within the directory of the temporary files of the download, if SetTempDir was called.
+func (d *Downloader) createTempDir(output string, purpose string) (string, error) {
+	if d.tempDir == "" {
+		return ioutil.TempDir(filepath.Dir(output), "."+filepath.Base(output)+"."+purpose)
+	}
+	if d.tempFiles == "" {
+		dir, err := ioutil.TempDir(d.tempDir, tempDirPrefix)
+		if err != nil {
+			return "", err
+		}
+		d.tempFiles = dir
+	}
+	return ioutil.TempDir(d.tempFiles, purpose)
+}
+
+// removeTempDir removes the directory of the temporary files of the download, if any, along with what's left in it
+func (d *Downloader) removeTempDir() {
+	if d.tempFiles == "" {
+		return
+	}
+	if err := os.RemoveAll(d.tempFiles); err != nil {
+		d.appendLog(WARNING, fmt.Sprintf("Cannot remove the temporary files %s: %v", d.tempFiles, err))
+	}
+	d.tempFiles = ""
+}
+
+// checkTempDiskSpace compares the estimated size of the temporary files of the download with the free space of
+// their disk, when it's not the disk of the output: sorting the output writes about its size of sorted runs.
+// The disk of the output was checked by checkDiskSpace.
+func (d *Downloader) checkTempDiskSpace(needed uint64) error {
+	if len(d.sortKeys) == 0 || d.tempDir == "" {
+		return nil
+	}
+	free, err := freeDiskSpace(d.tempDir)
+	if err != nil {
+		d.appendLog(WARNING, fmt.Sprintf("Cannot check the free disk space of %s: %v", d.tempDir, err))
+		return nil
+	}
+	if needed <= free {
+		return nil
+	}
+	err = &DiskSpaceError{Dir: d.tempDir, Needed: needed, Free: free}
+	if !d.forceDiskSpace {
+		return err
+	}
+	d.appendLog(WARNING, err.Error()+", downloading anyway")
+	return nil
+}
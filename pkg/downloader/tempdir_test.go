@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempDir(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":4}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n"))
+		for _, page := range []string{"d", "b", "c", "a"} {
+			fmt.Fprintf(w, "1\thttp://example.com/%s\n", page)
+		}
+	})()
+	dir, err := ioutil.TempDir("", "tempdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "tmp")
+	if err = os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		SortBy: "url", Columns: []string{"url"}, TempDir: tmp}
+	d := New(options)
+	// a run of about a row, spilled to the temporary directory
+	d.sortRunSize = 10
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "url\nhttp://example.com/a\nhttp://example.com/b\nhttp://example.com/c\nhttp://example.com/d\n"
+	if string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, written)
+	}
+	if files, _ := ioutil.ReadDir(tmp); len(files) != 0 {
+		t.Errorf("the temporary files should be removed once sorted, got %d files", len(files))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("only the output should be left next to it, got %d files", len(files)-1)
+	}
+	if summary := d.Summary(nil); summary.TempBytes == 0 {
+		t.Error("the bytes of the sorted runs should be reported")
+	}
+
+	if err = New(options).SetTempDir(output); err == nil {
+		t.Error("a file should be refused as the temporary directory")
+	}
+}
@@ -0,0 +1,42 @@
+package downloader
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// SetRequestTimeout limits how long a request may take, reading the response included, 0 for no limit.
+// A request timing out, while awaiting the response or while reading it, is retried as per the retry policy:
+// the rest of a response timing out while it's read is read from the response requested again.
+// It fails with a NetworkError once the retries are exhausted.
+func (api *AudistoAPIClient) SetRequestTimeout(timeout time.Duration) {
+	api.httpClient.Timeout = timeout
+}
+
+// SetRequestTimeout limits how long every request to the API may take, so a stuck chunk doesn't hang
+// the download forever, 0 for no limit. It has to be called before Setup()
+func (d *Downloader) SetRequestTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("the request timeout can't be negative")
+	}
+	d.requestTimeout = timeout
+	return nil
+}
+
+// SetJobTimeout limits how long Run() may take, setting up the download included, 0 for no limit.
+// Once elapsed, the download stops as if the context was cancelled and a JobTimeoutError is returned.
+// It has to be called before Run()
+func (d *Downloader) SetJobTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("the job timeout can't be negative")
+	}
+	d.jobTimeout = timeout
+	return nil
+}
+
+// isTimeout checks if the error is a request timing out
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunJobTimeout(t *testing.T) {
+	// the second chunk outlasts the job timeout
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":3,"page":0,"size":1}}`))
+			return
+		}
+		chunk := r.URL.Query().Get("chunk")
+		if chunk == "1" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprintf(w, "id\turl\n%s\thttp://example.com/%s\n", chunk, chunk)
+	})()
+	dir, err := ioutil.TempDir("", "timeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		ChunkSize: 1, JobTimeout: 100 * time.Millisecond}
+	err = New(options).Run(context.Background())
+	if !IsJobTimeout(err) {
+		t.Fatalf("expected a job timeout, got %v", err)
+	}
+	// the chunk being downloaded is written to the partial file, the download can be resumed
+	written, err := ioutil.ReadFile(output + PartialSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fExists(output) == nil {
+		t.Error("the output should not exist until completed")
+	}
+	if string(written) != "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n" {
+		t.Errorf("unexpected partial output %q", written)
+	}
+	if fExists(output+resumerSuffix) != nil {
+		t.Error("the resume state should be persisted")
+	}
+
+	options.JobTimeout = 0
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ = ioutil.ReadFile(output); string(written) != "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n2\thttp://example.com/2\n" {
+		t.Errorf("unexpected resumed output %q", written)
+	}
+	if fExists(output+PartialSuffix) == nil {
+		t.Error("the partial file should be renamed to the output once completed")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})()
+
+	client, err := NewClient("user", "pass", 12345, "pages", false, 0, 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}
+	client.SetRequestTimeout(50 * time.Millisecond)
+	started := time.Now()
+	if _, _, err = client.FetchChunk(0, 1); !IsNetworkError(err) {
+		t.Errorf("expected a network error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 400*time.Millisecond {
+		t.Errorf("the requests should time out, took %v", elapsed)
+	}
+}
+
+func TestRequestTimeoutReadingResponse(t *testing.T) {
+	// the first response stalls once its first row is sent
+	var requests int32
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id\turl\n1\thttp://example.com/1\n"))
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte("2\thttp://example.com/2\n"))
+	})()
+
+	client, err := NewClient("user", "pass", 12345, "pages", false, 0, 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}
+	client.SetRequestTimeout(100 * time.Millisecond)
+	body, _, err := client.FetchChunk(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "id\turl\n1\thttp://example.com/1\n2\thttp://example.com/2\n"; string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("the timed out response should be requested again, got %d requests", requests)
+	}
+
+	// without retries, the timed out response fails
+	atomic.StoreInt32(&requests, 0)
+	client.RetryPolicy = RetryPolicy{}
+	if _, _, err = client.FetchChunk(0, 2); !IsNetworkError(err) {
+		t.Errorf("expected a network error, got %v", err)
+	}
+}
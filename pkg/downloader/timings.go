@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"sort"
+	"time"
+)
+
+// ChunkTiming how long a chunk took to be requested and written, see SetTimingReport
+type ChunkTiming struct {
+	Chunk      uint64    `json:"chunk"` // the number of the chunk
+	Size       uint64    `json:"size"`  // the elements requested
+	Started    time.Time `json:"started"`
+	StatusCode int       `json:"statusCode"`
+	Retries    int       `json:"retries"`
+	Bytes      int       `json:"bytes"` // received from the API
+	Rows       int       `json:"rows"`  // written to the output
+	// LatencyMs from the request to its response, retries included: to the first byte of a chunk written as it's
+	// received (Streamed), the time receiving its body being part of WriteMs then, to the last byte otherwise
+	LatencyMs float64 `json:"latencyMs"`
+	WriteMs   float64 `json:"writeMs"`
+	Streamed  bool    `json:"streamed"`
+}
+
+// ChunkSizeTiming the chunks of a size, to compare the chunk sizes tried, e.g. by SetAutoChunkSize
+type ChunkSizeTiming struct {
+	Size             uint64  `json:"size"`
+	Chunks           int     `json:"chunks"`
+	AverageLatencyMs float64 `json:"averageLatencyMs"`
+	AverageWriteMs   float64 `json:"averageWriteMs"`
+	ElementsPerSec   float64 `json:"elementsPerSecond"` // the elements requested, by the time requesting and writing them
+}
+
+// DurationStats the distribution of a duration in milliseconds
+type DurationStats struct {
+	Average float64 `json:"average"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+// TimingReport how long the chunks of a download took, see SetTimingReport
+type TimingReport struct {
+	CrawlID         uint64            `json:"crawlID"`
+	Mode            string            `json:"mode"`
+	API             string            `json:"api"` // the host and version of the API requested
+	DurationSeconds float64           `json:"durationSeconds"`
+	Chunks          int               `json:"chunks"`
+	Bytes           int64             `json:"bytes"`
+	Rows            uint64            `json:"rows"`
+	Retries         int               `json:"retries"`
+	LatencyMs       DurationStats     `json:"latencyMs"`
+	WriteMs         DurationStats     `json:"writeMs"`
+	BySize          []ChunkSizeTiming `json:"bySize"`
+	Timings         []ChunkTiming     `json:"timings"`
+}
+
+// SetTimingReport when set to true, the latency, size, retries and write duration of every chunk are recorded
+// for TimingReport(). It has to be called before Setup()
+func (d *Downloader) SetTimingReport(enabled bool) {
+	d.timingReport = enabled
+}
+
+// recordTiming records the timing of a chunk, once written (or failed) in the given time
+func (d *Downloader) recordTiming(chunk fetchedChunk, rows int, written time.Duration) {
+	if !d.timingReport {
+		return
+	}
+	d.timings = append(d.timings, ChunkTiming{
+		Chunk:      chunk.start / chunk.size,
+		Size:       chunk.size,
+		Started:    chunk.requested,
+		StatusCode: chunk.statusCode,
+		Retries:    chunk.retries,
+		Bytes:      chunk.received(),
+		Rows:       rows,
+		LatencyMs:  milliseconds(chunk.latency),
+		WriteMs:    milliseconds(written),
+		Streamed:   chunk.stream != nil,
+	})
+}
+
+// TimingReport returns how long the chunks of the download took, once Start() returned.
+// Timings is empty unless SetTimingReport was set.
+func (d *Downloader) TimingReport() TimingReport {
+	report := TimingReport{DurationSeconds: d.stats.duration.Seconds(), Timings: d.timings}
+	if d.client != nil {
+		report.CrawlID, report.Mode, report.API = d.client.CrawlID, d.client.Mode, d.client.GetAPIEndpoint()
+	}
+	if report.Timings == nil {
+		report.Timings = []ChunkTiming{}
+	}
+
+	latencies := make([]float64, len(d.timings))
+	writes := make([]float64, len(d.timings))
+	sizes := map[uint64]*ChunkSizeTiming{}
+	for i, timing := range d.timings {
+		report.Bytes += int64(timing.Bytes)
+		report.Rows += uint64(timing.Rows)
+		report.Retries += timing.Retries
+		latencies[i], writes[i] = timing.LatencyMs, timing.WriteMs
+
+		size, ok := sizes[timing.Size]
+		if !ok {
+			size = &ChunkSizeTiming{Size: timing.Size}
+			sizes[timing.Size] = size
+		}
+		size.Chunks++
+		size.AverageLatencyMs += timing.LatencyMs
+		size.AverageWriteMs += timing.WriteMs
+	}
+	report.Chunks = len(d.timings)
+	report.LatencyMs, report.WriteMs = durationStats(latencies), durationStats(writes)
+
+	report.BySize = []ChunkSizeTiming{}
+	for _, size := range sizes {
+		if elapsed := size.AverageLatencyMs + size.AverageWriteMs; elapsed > 0 {
+			size.ElementsPerSec = float64(size.Size) * float64(size.Chunks) / (elapsed / 1000)
+		}
+		size.AverageLatencyMs /= float64(size.Chunks)
+		size.AverageWriteMs /= float64(size.Chunks)
+		report.BySize = append(report.BySize, *size)
+	}
+	sort.Slice(report.BySize, func(i, j int) bool { return report.BySize[i].Size < report.BySize[j].Size })
+	return report
+}
+
+// durationStats returns the distribution of the given durations in milliseconds, sorted in place
+func durationStats(durations []float64) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+	sort.Float64s(durations)
+	var stats DurationStats
+	for _, duration := range durations {
+		stats.Average += duration
+	}
+	stats.Average /= float64(len(durations))
+	stats.P50 = durations[(len(durations)-1)*50/100]
+	stats.P95 = durations[(len(durations)-1)*95/100]
+	stats.Max = durations[len(durations)-1]
+	return stats
+}
+
+// milliseconds returns a duration in milliseconds, to the microsecond
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTimingReport(t *testing.T) {
+	var requests int64
+	defer serveCountedPages(&requests)()
+	dir, err := ioutil.TempDir("", "timings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: filepath.Join(dir, "crawl.tsv"),
+		ChunkSize: 5, TimingReport: true}
+	download := New(options)
+	if err = download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report := download.TimingReport()
+	if report.Mode != "pages" || report.CrawlID != 12345 {
+		t.Errorf("unexpected download of the report %d %s", report.CrawlID, report.Mode)
+	}
+	if report.Chunks != 2 || len(report.Timings) != 2 || report.Rows != 10 {
+		t.Fatalf("expected 2 chunks of 10 rows, got %d chunks of %d rows", report.Chunks, report.Rows)
+	}
+	for i, timing := range report.Timings {
+		if timing.Chunk != uint64(i) || timing.Size != 5 || timing.StatusCode != 200 || timing.Bytes == 0 || timing.Started.IsZero() {
+			t.Errorf("unexpected timing of chunk %d: %+v", i, timing)
+		}
+	}
+	if len(report.BySize) != 1 || report.BySize[0].Size != 5 || report.BySize[0].Chunks != 2 {
+		t.Errorf("expected the 2 chunks of size 5, got %+v", report.BySize)
+	}
+	if report.LatencyMs.Max < report.LatencyMs.P50 {
+		t.Errorf("unexpected latencies %+v", report.LatencyMs)
+	}
+
+	// nothing is recorded unless asked to
+	options.TimingReport, options.NoResume = false, true
+	download = New(options)
+	if err = download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if report = download.TimingReport(); report.Chunks != 0 {
+		t.Errorf("expected no timing recorded, got %d chunks", report.Chunks)
+	}
+}
@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// TLSOptions the TLS settings of the requests to the API, e.g. behind a TLS-intercepting gateway
+type TLSOptions struct {
+	CACert             string // path of a PEM bundle of CAs trusted on top of the system ones
+	ClientCert         string // path of a PEM client certificate, sent along with ClientKey
+	ClientKey          string // path of the PEM private key of ClientCert
+	InsecureSkipVerify bool   // the certificate of the API is not verified, never use it but for testing
+}
+
+// IsZero checks if the options keep the default TLS settings
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// NewTLSConfig loads the certificates of the TLS options
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: options.InsecureSkipVerify}
+
+	if caCert := strings.TrimSpace(options.CACert); caCert != "" {
+		bundle, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the CA bundle: %v", err)
+		}
+		// the system pool is not available on every platform, the bundle is trusted alone then
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no PEM certificate found in the CA bundle %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+
+	clientCert, clientKey := strings.TrimSpace(options.ClientCert), strings.TrimSpace(options.ClientKey)
+	if (clientCert == "") != (clientKey == "") {
+		return nil, fmt.Errorf("a client certificate and its key have to be set together")
+	}
+	if clientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// SetTLSConfig makes the client use the given TLS settings instead of the default ones
+func (api *AudistoAPIClient) SetTLSConfig(config *tls.Config) {
+	api.transport().TLSClientConfig = config
+}
+
+// transport returns the own transport of the client, cloned from the default one the first time,
+// so the proxy and TLS settings apply together
+func (api *AudistoAPIClient) transport() *http.Transport {
+	if transport, ok := api.httpClient.Transport.(*http.Transport); ok {
+		return transport
+	}
+	// unless the default transport was replaced by the program
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	}
+	api.httpClient.Transport = transport
+	return transport
+}
+
+// SetTLS sets the TLS settings of the requests, loading the certificates.
+// It has to be called before Setup()
+func (d *Downloader) SetTLS(options TLSOptions) error {
+	if options.IsZero() {
+		d.tlsConfig = nil
+		return nil
+	}
+	config, err := NewTLSConfig(options)
+	if err != nil {
+		return err
+	}
+	d.tlsConfig = config
+	return nil
+}
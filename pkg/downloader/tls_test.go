@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	get := func(options *TLSOptions) error {
+		client := &AudistoAPIClient{}
+		if options != nil {
+			config, err := NewTLSConfig(*options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.SetTLSConfig(config)
+		}
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		response, err := client.doWithRetries(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+	if get(nil) == nil {
+		t.Error("the certificate of the test server should not be trusted by default")
+	}
+	if err = get(&TLSOptions{CACert: bundle}); err != nil {
+		t.Errorf("the certificate of the CA bundle should be trusted: %v", err)
+	}
+	if err = get(&TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("the certificate should not be verified: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "empty.pem"), []byte("no certificate"), 0644)
+	for _, invalid := range []TLSOptions{{CACert: filepath.Join(dir, "empty.pem")}, {CACert: filepath.Join(dir, "missing.pem")},
+		{ClientCert: bundle}, {ClientCert: bundle, ClientKey: bundle}} {
+		if _, err = NewTLSConfig(invalid); err == nil {
+			t.Errorf("%+v should be refused", invalid)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName the instrumentation name of the OpenTelemetry spans of the downloads.
+// Spans are recorded with the global tracer provider, see otel.SetTracerProvider(): nothing is recorded
+// until one is set. Start() records a download span, the child of the span of the context of Run() if any,
+// with a span per chunk request, per attempt of a request (retries included) and per chunk written.
+const TracerName = "github.com/audisto/data-downloader/pkg/downloader"
+
+// startSpan starts a span, the child of the span of the given context, nil for a root span.
+// The tracer is taken from the global provider every time, a provider set afterwards is used.
+func startSpan(parent context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	return otel.Tracer(TracerName).Start(parent, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends a span, recording the error if any
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endRequestSpan ends the span of an attempt of a request, a transient response being an error as well
+func endRequestSpan(span trace.Span, response *http.Response, err error) {
+	if response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+		if err == nil && isTransientStatusCode(response.StatusCode) {
+			span.SetStatus(codes.Error, response.Status)
+		}
+	}
+	endSpan(span, err)
+}
+
+// injectTraceContext adds the trace context of the given context to the request header (traceparent with
+// the W3C propagator), as per the global propagator, so the requests can be followed on the API side
+func injectTraceContext(ctx context.Context, request *http.Request) {
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+}
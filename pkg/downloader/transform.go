@@ -0,0 +1,225 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Columns can be transformed client-side, every row being transformed before it's filtered and written.
+// A transform names a column and the functions applied to its values, in order, separated by "|":
+//
+//	url: url_decode | lower
+//	title: trim | regex_replace(\s+, " ")
+//
+// The arguments of a function are separated by commas, an argument containing a comma or a parenthesis
+// has to be quoted with ' or ". The functions are listed in TransformFunctions.
+
+// TransformFunctions the functions of the transforms, with their arguments
+var TransformFunctions = []string{
+	"lower",
+	"upper",
+	"trim",
+	"url_decode",
+	"replace(old, new)",
+	"regex_replace(regexp, replacement)",
+}
+
+// transformFunction transforms a value
+type transformFunction func(value string) string
+
+// newTransformFunctions the constructors of the functions of the transforms, by name, given their arguments
+var newTransformFunctions = map[string]func(arguments []string) (transformFunction, error){
+	"lower": noArguments(strings.ToLower),
+	"upper": noArguments(strings.ToUpper),
+	"trim":  noArguments(strings.TrimSpace),
+	// a value that is not validly escaped is kept as is
+	"url_decode": noArguments(func(value string) string {
+		if decoded, err := url.PathUnescape(value); err == nil {
+			return decoded
+		}
+		return value
+	}),
+	"replace": func(arguments []string) (transformFunction, error) {
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("replace expects 2 arguments (old, new), got %d", len(arguments))
+		}
+		return func(value string) string {
+			return strings.Replace(value, arguments[0], arguments[1], -1)
+		}, nil
+	},
+	"regex_replace": func(arguments []string) (transformFunction, error) {
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("regex_replace expects 2 arguments (regexp, replacement), got %d", len(arguments))
+		}
+		pattern, err := regexp.Compile(arguments[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp: %v", err)
+		}
+		return func(value string) string {
+			return pattern.ReplaceAllString(value, arguments[1])
+		}, nil
+	},
+}
+
+func noArguments(function transformFunction) func(arguments []string) (transformFunction, error) {
+	return func(arguments []string) (transformFunction, error) {
+		if len(arguments) > 0 {
+			return nil, fmt.Errorf("no arguments expected, got %d", len(arguments))
+		}
+		return function, nil
+	}
+}
+
+// Transform a parsed transform of a column, see ParseTransform
+type Transform struct {
+	column    string // lower-cased
+	index     int    // the position of the column in the rows
+	functions []transformFunction
+}
+
+// ParseTransform parses a transform, e.g. "url: url_decode | lower"
+func ParseTransform(transform string) (*Transform, error) {
+	separator := strings.Index(transform, ":")
+	if separator < 0 {
+		return nil, fmt.Errorf("invalid transform %q: expected column: function | function...", transform)
+	}
+	t := &Transform{column: strings.ToLower(strings.TrimSpace(transform[:separator]))}
+	if t.column == "" {
+		return nil, fmt.Errorf("invalid transform %q: empty column name", transform)
+	}
+
+	calls, err := splitTransform(transform[separator+1:], '|')
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %v", transform, err)
+	}
+	for _, call := range calls {
+		function, err := parseTransformCall(strings.TrimSpace(call))
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform %q: %v", transform, err)
+		}
+		t.functions = append(t.functions, function)
+	}
+	return t, nil
+}
+
+// parseTransformCall parses a function of a transform, e.g. lower or regex_replace(\s+, " ")
+func parseTransformCall(call string) (transformFunction, error) {
+	name, arguments := call, []string(nil)
+	if open := strings.Index(call, "("); open >= 0 {
+		if !strings.HasSuffix(call, ")") {
+			return nil, fmt.Errorf("expected \")\" at the end of %q", call)
+		}
+		name = strings.TrimSpace(call[:open])
+		if inner := strings.TrimSpace(call[open+1 : len(call)-1]); inner != "" {
+			var err error
+			if arguments, err = splitTransform(inner, ','); err != nil {
+				return nil, err
+			}
+			for i, argument := range arguments {
+				arguments[i] = unquoteTransformArgument(strings.TrimSpace(argument))
+			}
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("missing function")
+	}
+
+	newFunction, ok := newTransformFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q, the functions are: %s", name, strings.Join(TransformFunctions, ", "))
+	}
+	function, err := newFunction(arguments)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return function, nil
+}
+
+// splitTransform splits on the separator, unless quoted or within parentheses
+func splitTransform(s string, separator byte) ([]string, error) {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("unexpected \")\" at position %d", i+1)
+			}
+			depth--
+		case c == separator && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("missing \")\"")
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unquoteTransformArgument removes the quotes of a quoted argument, backslashes are kept as is for the regexps
+func unquoteTransformArgument(argument string) string {
+	if len(argument) >= 2 && (argument[0] == '\'' || argument[0] == '"') && argument[len(argument)-1] == argument[0] {
+		return argument[1 : len(argument)-1]
+	}
+	return argument
+}
+
+// SetTransforms makes the downloader transform the values of the columns before the rows are written, see ParseTransform.
+// The transforms are applied in the given order. It has to be called before Setup()
+func (d *Downloader) SetTransforms(transforms []string) error {
+	d.transforms = nil
+	d.transformSpecs = nil
+	for _, transform := range transforms {
+		t, err := ParseTransform(transform)
+		if err != nil {
+			return err
+		}
+		d.transforms = append(d.transforms, t)
+		d.transformSpecs = append(d.transformSpecs, strings.TrimSpace(transform))
+	}
+	return nil
+}
+
+// bindTransforms finds the columns of the transforms in a chunk header
+func (d *Downloader) bindTransforms(header []string) error {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, t := range d.transforms {
+		position, ok := positions[t.column]
+		if !ok {
+			return fmt.Errorf("unknown column %q in the transforms, the available columns are: %s", t.column, strings.Join(header, ", "))
+		}
+		t.index = position
+	}
+	return nil
+}
+
+// transformRow applies the transforms to a row, bound by bindTransforms()
+func (d *Downloader) transformRow(fields []string) {
+	for _, t := range d.transforms {
+		if t.index >= len(fields) {
+			continue
+		}
+		for _, function := range t.functions {
+			fields[t.index] = function(fields[t.index])
+		}
+	}
+}
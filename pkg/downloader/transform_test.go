@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTransform(t *testing.T) {
+	transforms := map[string][2]string{
+		"url: lower":                                {"HTTP://Example.com/A", "http://example.com/a"},
+		"url: url_decode":                           {"http://example.com/caf%C3%A9?q=a+b", "http://example.com/café?q=a+b"},
+		"url: url_decode | upper":                   {"/a%2", "/A%2"}, // invalid escapes are kept
+		`title: regex_replace(\s+, " ")`:            {"a \t b\n\nc", "a b c"},
+		"title: trim | regex_replace('^(.)', <$1>)": {"  ab ", "<a>b"},
+		"title: replace(',', ';')":                  {"a,b,c", "a;b;c"},
+		"Title: regex_replace((a|b), x)":            {"abc", "xxc"},
+	}
+	for transform, c := range transforms {
+		parsed, err := ParseTransform(transform)
+		if err != nil {
+			t.Errorf("%s: %v", transform, err)
+			continue
+		}
+		d := &Downloader{transforms: []*Transform{parsed}}
+		if err = d.bindTransforms([]string{"URL", "title"}); err != nil {
+			t.Fatal(err)
+		}
+		fields := []string{c[0], c[0]}
+		d.transformRow(fields)
+		if fields[parsed.index] != c[1] {
+			t.Errorf("%s: expected %q, got %q", transform, c[1], fields[parsed.index])
+		}
+	}
+
+	for _, invalid := range []string{"lower", ": lower", "url:", "url: lowercase", "url: lower(1)", "url: replace(a)",
+		"url: regex_replace((, x)", "url: regex_replace('(', x)", "url: replace('a, b)", "url: lower)"} {
+		if _, err := ParseTransform(invalid); err == nil {
+			t.Errorf("%q should be refused", invalid)
+		}
+	}
+}
+
+func TestRunTransform(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		Transforms: []string{"url: upper", "url: replace(HTTP://, '')"}, Where: "url == 'EXAMPLE.COM/B'"})
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n2\tEXAMPLE.COM/B\n" {
+		t.Errorf("unexpected output %q", written)
+	}
+
+	d = New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, NoResume: true,
+		Transforms: []string{"title: lower"}})
+	if err = d.Run(context.Background()); err == nil {
+		t.Error("a column missing from the download should be refused")
+	}
+}
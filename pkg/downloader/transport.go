@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultIdleConnTimeout how long idle connections are kept for the next requests, as for http.DefaultTransport
+	DefaultIdleConnTimeout = 90 * time.Second
+
+	// DefaultKeepAlive the TCP keep-alive period of the connections, as for http.DefaultTransport
+	DefaultKeepAlive = 30 * time.Second
+)
+
+// TransportOptions the connection settings of the requests to the API, the zero value keeping the defaults
+type TransportOptions struct {
+	MaxIdleConns    int           // idle connections kept for reuse, 0 for as many as chunks requested in parallel
+	DisableHTTP2    bool          // use HTTP/1.1 even if the API supports HTTP/2
+	IdleConnTimeout time.Duration // how long idle connections are kept, 0 for DefaultIdleConnTimeout
+	KeepAlive       time.Duration // TCP keep-alive period, 0 for DefaultKeepAlive
+}
+
+// IsZero checks if the options keep the default connection settings
+func (o TransportOptions) IsZero() bool {
+	return o == TransportOptions{}
+}
+
+// validate checks the options, negative values being refused
+func (o TransportOptions) validate() error {
+	if o.MaxIdleConns < 0 {
+		return fmt.Errorf("the maximum of idle connections can't be negative")
+	}
+	if o.IdleConnTimeout < 0 || o.KeepAlive < 0 {
+		return fmt.Errorf("the idle connection timeout and the keep-alive period can't be negative")
+	}
+	return nil
+}
+
+// SetTransportOptions sets the connection settings of the client. Connections are reused by the following
+// requests, parallel ones included: the copies of the client share its transport.
+func (api *AudistoAPIClient) SetTransportOptions(options TransportOptions) {
+	transport := api.transport()
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConns
+		if transport.MaxIdleConns < options.MaxIdleConns {
+			transport.MaxIdleConns = options.MaxIdleConns
+		}
+	}
+	if options.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = options.IdleConnTimeout
+	}
+	if options.KeepAlive > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: options.KeepAlive}
+		transport.DialContext = dialer.DialContext
+	}
+	if options.DisableHTTP2 {
+		// a non-nil empty map disables the HTTP/2 upgrade of TLS connections
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+}
+
+// SetTransport sets the connection settings of the requests to the API.
+// It has to be called before Setup()
+func (d *Downloader) SetTransport(options TransportOptions) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+	d.transportOptions = options
+	return nil
+}
+
+// clientTransportOptions returns the connection settings of the client: as many idle connections
+// as chunks requested in parallel are kept unless set, so every chunk request reuses a connection
+func (d *Downloader) clientTransportOptions() TransportOptions {
+	options := d.transportOptions
+	if options.MaxIdleConns == 0 && d.concurrency > http.DefaultMaxIdleConnsPerHost {
+		options.MaxIdleConns = d.concurrency
+	}
+	return options
+}
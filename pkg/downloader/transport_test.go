@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetTransportOptions(t *testing.T) {
+	var connections int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("id\turl\n"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &AudistoAPIClient{}
+	client.SetTransportOptions(TransportOptions{MaxIdleConns: 4})
+	for round := 0; round < 3; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// parallel requests are sent by copies of the client, as for the chunks
+				copied := *client
+				request, _ := http.NewRequest("GET", server.URL, nil)
+				if _, _, err := copied.fetch(request); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	if connections > 4 {
+		t.Errorf("the connections should be reused by the next requests, %d were opened", connections)
+	}
+}
+
+func TestDisableHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, disabled := range []bool{false, true} {
+		client := &AudistoAPIClient{}
+		client.SetTransportOptions(TransportOptions{DisableHTTP2: disabled})
+		client.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		body, _, err := client.fetch(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "HTTP/2.0"
+		if disabled {
+			expected = "HTTP/1.1"
+		}
+		if string(body) != expected {
+			t.Errorf("expected %s with DisableHTTP2 %v, got %s", expected, disabled, body)
+		}
+	}
+
+	if err := (&Downloader{}).SetTransport(TransportOptions{MaxIdleConns: -1}); err == nil {
+		t.Error("a negative maximum of idle connections should be refused")
+	}
+}
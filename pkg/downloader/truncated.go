@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"fmt"
+)
+
+// chunkEnd returns the element following the last one of a chunk, the last chunk of a target being cut
+// at its total elements
+func (d *Downloader) chunkEnd(chunk fetchedChunk) uint64 {
+	if end := chunk.start + chunk.size; end < d.CurrentTarget.TotalElements {
+		return end
+	}
+	return d.CurrentTarget.TotalElements
+}
+
+// checkChunkRows validates the rows of a chunk received whole against its size: a chunk short of rows was
+// truncated, the rows missing are requested again with the next chunks, as many times in a row as the retry
+// policy allows. Once every retry is exhausted a TruncatedChunkError is returned.
+func (d *Downloader) checkChunkRows(chunk fetchedChunk) error {
+	end := d.chunkEnd(chunk)
+	if d.CurrentTarget.DoneElements >= end {
+		// rows in excess are written, the chunk is counted by its size
+		d.CurrentTarget.DoneElements = chunk.start + chunk.size
+		d.truncatedRetries = 0
+		return nil
+	}
+
+	// the retries of a chunk cut at the same row again are counted
+	if d.CurrentTarget.DoneElements != d.truncatedAt {
+		d.truncatedAt, d.truncatedRetries = d.CurrentTarget.DoneElements, 0
+	}
+	d.counters.countError()
+	received, expected := d.CurrentTarget.DoneElements-chunk.start, end-chunk.start
+	if d.truncatedRetries >= d.client.RetryPolicy.MaxRetries {
+		return &TruncatedChunkError{Chunk: chunk.start / chunk.size, Received: received, Expected: expected}
+	}
+	d.truncatedRetries++
+	d.appendLog(WARNING, fmt.Sprintf("Chunk %d is truncated, %d of %d rows were received: requesting the rows missing again",
+		chunk.start/chunk.size, received, expected))
+	return nil
+}
+
+// checkTotalElements validates the elements received by a completed download against the total elements
+// announced by the API, once every chunk was validated
+func (d *Downloader) checkTotalElements() error {
+	if d.isInTargetsMode() || d.retry != nil || d.DoneElements >= d.TotalElements {
+		return nil
+	}
+	return &ShortExportError{Received: d.DoneElements, Total: d.TotalElements}
+}
@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveTruncatedChunk serves 4 pages in chunks of 2, the chunk 0 being cut after its first row the given times
+func serveTruncatedChunk(truncated *int32) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":2}}`))
+			return
+		}
+		var chunk, size int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Sscan(r.URL.Query().Get("chunk_size"), &size)
+		end := (chunk + 1) * size
+		if chunk == 0 && atomic.AddInt32(truncated, -1) >= 0 {
+			end = 1
+		}
+		fmt.Fprint(w, "id\turl\n")
+		for id := chunk * size; id < end && id < 4; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\n", id, id)
+		}
+	})
+}
+
+func TestTruncatedChunkRequestedAgain(t *testing.T) {
+	truncated := int32(1)
+	defer serveTruncatedChunk(&truncated)()
+	dir, err := ioutil.TempDir("", "truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+		RetryPolicy: &RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "id\turl\n0\thttp://example.com/0\n1\thttp://example.com/1\n2\thttp://example.com/2\n3\thttp://example.com/3\n"
+	if string(data) != expected {
+		t.Errorf("expected the rows missing to be requested again, got %q", data)
+	}
+}
+
+func TestTruncatedChunkFailsAfterRetries(t *testing.T) {
+	truncated := int32(3)
+	defer serveTruncatedChunk(&truncated)()
+	dir, err := ioutil.TempDir("", "truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, ChunkSize: 2,
+		RetryPolicy: &RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond}}
+	err = New(options).Run(context.Background())
+	truncatedErr, ok := err.(*TruncatedChunkError)
+	if !ok {
+		t.Fatalf("expected the chunk still truncated to fail the download, got %v", err)
+	}
+	if truncatedErr.Chunk != 0 || truncatedErr.Received != 1 || truncatedErr.Expected != 2 {
+		t.Errorf("unexpected error %+v", truncatedErr)
+	}
+}
+
+func TestCheckTotalElements(t *testing.T) {
+	d := &Downloader{DoneElements: 3, TotalElements: 4}
+	if err := d.checkTotalElements(); !IsTruncated(err) {
+		t.Errorf("expected a short export, got %v", err)
+	}
+	d.DoneElements = 4
+	if err := d.checkTotalElements(); err != nil {
+		t.Errorf("expected a complete export, got %v", err)
+	}
+}
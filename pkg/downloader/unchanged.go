@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CrawlMetadata the metadata of the remote outputs holding the crawl downloaded, see SetSkipIfUnchanged
+	CrawlMetadata = "audisto-crawl-id"
+	// ElementsMetadata the metadata of the remote outputs holding the total elements of the download
+	ElementsMetadata = "audisto-elements"
+	// SettingsMetadata the metadata of the remote outputs holding the SHA-256 of the settings of the download
+	SettingsMetadata = "audisto-settings"
+)
+
+// remoteMetadataReaders the readers of the metadata of the objects of the remote outputs, by URL scheme.
+// They return nil metadata for an object that doesn't exist.
+var remoteMetadataReaders = map[string]func(ctx context.Context, location *url.URL) (map[string]string, error){}
+
+// metadataOutput is implemented by the remote outputs storing metadata along with the object, set before
+// anything is written
+type metadataOutput interface {
+	SetMetadata(metadata map[string]string)
+}
+
+// SetSkipIfUnchanged when set to true, the download to an S3 or a GCS object is skipped once the object of the
+// previous download has the metadata of this one: the same crawl, total elements and settings, the rows it
+// would write being the same then. It costs the API call of the total elements, nothing is written.
+// The object written stores the metadata of the download, for the next one to compare with.
+// The outputs that are split or partitioned, and the targets, can't be compared.
+// It has to be called before Setup()
+func (d *Downloader) SetSkipIfUnchanged(enabled bool) {
+	d.skipIfUnchanged = enabled
+}
+
+// Unchanged tells if the download was skipped, the output being unchanged since the previous one,
+// see SetSkipIfUnchanged
+func (d *Downloader) Unchanged() bool {
+	return d.unchanged
+}
+
+// unchangedValidation checks if the output of a download can be compared with the previous one
+func (d *Downloader) unchangedValidation() error {
+	if !d.skipIfUnchanged {
+		return nil
+	}
+	if _, ok := remoteMetadataReaders[remoteOutputScheme(d.OutputFilename)]; !ok {
+		return fmt.Errorf("only the S3 and GCS outputs store the metadata compared to skip the unchanged downloads")
+	}
+	if d.isSplit() || d.partitionBy != "" || d.currentTargetsFilename != "" {
+		return fmt.Errorf("split and partitioned outputs, and targets, can't be compared to skip the unchanged downloads")
+	}
+	return nil
+}
+
+// outputMetadata returns the metadata of the output of the download: its crawl, its total elements and the
+// SHA-256 of the settings the rows depend on
+func (d *Downloader) outputMetadata() map[string]string {
+	settings, _ := json.Marshal(struct {
+		Parameters   resumeParameters `json:"parameters"`
+		NoDetails    bool             `json:"noDetails"`
+		NoHeader     bool             `json:"noHeader"`
+		OutputFormat string           `json:"outputFormat"`
+		Delimiter    string           `json:"delimiter"`
+		LineEnding   string           `json:"lineEnding"`
+		NullAs       string           `json:"nullAs"`
+		Compression  string           `json:"compression"`
+		Encrypted    bool             `json:"encrypted"`
+	}{d.Parameters, d.NoDetails, d.noHeader, d.OutputFormat, d.Delimiter, d.LineEnding, d.nullAs, d.Compression,
+		d.encryption != nil})
+	digest := sha256.Sum256(settings)
+	return map[string]string{
+		CrawlMetadata:    strconv.FormatUint(d.client.CrawlID, 10),
+		ElementsMetadata: strconv.FormatUint(d.TotalElements, 10),
+		SettingsMetadata: hex.EncodeToString(digest[:]),
+	}
+}
+
+// checkUnchanged compares the metadata of the output with the one of the object of the previous download,
+// the total elements being requested
+func (d *Downloader) checkUnchanged() (bool, error) {
+	if err := d.calculateTotalElements(); err != nil {
+		return false, err
+	}
+	location, err := url.Parse(d.OutputFilename)
+	if err != nil {
+		return false, fmt.Errorf("invalid output URL %q: %v", d.OutputFilename, err)
+	}
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	previous, err := remoteMetadataReaders[remoteOutputScheme(d.OutputFilename)](ctx, location)
+	if err != nil || previous == nil {
+		return false, err
+	}
+	// S3 capitalizes the metadata keys
+	stored := map[string]string{}
+	for key, value := range previous {
+		stored[strings.ToLower(key)] = value
+	}
+	for key, value := range d.outputMetadata() {
+		if stored[key] != value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
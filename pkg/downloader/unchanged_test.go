@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryObjects the objects uploaded to the memobj:// outputs of the tests, along with their metadata. The scheme
+// isn't memory://, registered as an output backend by TestOutputBackend.
+var memoryObjects = struct {
+	sync.Mutex
+	data     map[string]string
+	metadata map[string]map[string]string
+}{data: map[string]string{}, metadata: map[string]map[string]string{}}
+
+func init() {
+	remoteOutputs["memobj"] = func(location *url.URL) (io.WriteCloser, error) {
+		return &memoryOutput{location: location.String()}, nil
+	}
+	remoteMetadataReaders["memobj"] = func(ctx context.Context, location *url.URL) (map[string]string, error) {
+		memoryObjects.Lock()
+		defer memoryObjects.Unlock()
+		return memoryObjects.metadata[location.String()], nil
+	}
+}
+
+type memoryOutput struct {
+	location string
+	metadata map[string]string
+	buffer   bytes.Buffer
+}
+
+func (o *memoryOutput) SetMetadata(metadata map[string]string) {
+	// stored capitalized, as S3 does
+	o.metadata = map[string]string{}
+	for key, value := range metadata {
+		o.metadata[strings.Title(key)] = value
+	}
+}
+
+func (o *memoryOutput) Write(p []byte) (int, error) {
+	return o.buffer.Write(p)
+}
+
+func (o *memoryOutput) Close() error {
+	memoryObjects.Lock()
+	defer memoryObjects.Unlock()
+	memoryObjects.data[o.location] = o.buffer.String()
+	memoryObjects.metadata[o.location] = o.metadata
+	return nil
+}
+
+func TestSkipIfUnchanged(t *testing.T) {
+	var mu sync.Mutex
+	total, chunks := 2, 0
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":` + strconv.Itoa(total) + `,"page":0,"size":1}}`))
+			return
+		}
+		chunks++
+		// as many rows as the total elements
+		rows := "id\turl\n"
+		for id := 1; id <= total; id++ {
+			rows += fmt.Sprintf("%d\thttp://example.com/%d\n", id, id)
+		}
+		w.Write([]byte(rows))
+	})()
+
+	output := "memobj://bucket/crawl.tsv"
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, SkipIfUnchanged: true}
+	download := New(options)
+	if err := download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if download.Unchanged() || chunks != 1 {
+		t.Fatalf("expected the first download to be written, %d chunks", chunks)
+	}
+	memoryObjects.Lock()
+	metadata := memoryObjects.metadata[output]
+	memoryObjects.Unlock()
+	if metadata["Audisto-Crawl-Id"] != "12345" || metadata["Audisto-Elements"] != "2" {
+		t.Errorf("expected the metadata of the download to be stored, got %v", metadata)
+	}
+
+	// nothing changed: no chunk is downloaded
+	download = New(options)
+	if err := download.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !download.Unchanged() || chunks != 1 || !download.Summary(nil).Unchanged {
+		t.Errorf("expected the unchanged download to be skipped, %d chunks", chunks)
+	}
+
+	// other settings, or other elements, are downloaded anyway
+	changed := options
+	changed.Columns = []string{"url"}
+	for _, options := range []Options{changed, options} {
+		if options.Columns == nil {
+			mu.Lock()
+			total = 3
+			mu.Unlock()
+		}
+		download = New(options)
+		if err := download.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if download.Unchanged() {
+			t.Errorf("%v: expected the changed download to be written", options.Columns)
+		}
+	}
+	if chunks != 3 {
+		t.Errorf("expected the changed downloads to be written, %d chunks", chunks)
+	}
+}
+
+func TestSkipIfUnchangedValidation(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "unchanged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, options := range map[string]Options{
+		"a local file":         {Output: filepath.Join(dir, "crawl.tsv")},
+		"a split output":       {Output: "memobj://bucket/crawl.tsv", SplitRows: 10},
+		"a partitioned output": {Output: "memobj://bucket/crawl.tsv", PartitionBy: "status_code"},
+	} {
+		options.Username, options.Password, options.CrawlID, options.SkipIfUnchanged = "user", "pass", 1, true
+		if err := New(options).Prepare(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
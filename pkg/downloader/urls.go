@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// urlList the URLs the rows are restricted to, see SetURLsFile
+type urlList struct {
+	filename string
+	urls     map[string]bool
+	sorted   []string // the URLs, sorted, for the server-side filter and the digest
+	column   int      // the position of the URL column in the rows, -1 until bound
+}
+
+// SetURLsFile restricts the rows written to the ones whose URL is listed in the given file, one URL a line,
+// blank lines and lines starting with # being skipped. The URL of a page is matched, the source URL of a link.
+// The rows are narrowed server-side by a filter where possible (the URL itself, or the path the URLs share),
+// then matched client-side. "" for every row. It has to be called before Setup()
+func (d *Downloader) SetURLsFile(filename string) error {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		d.urls = nil
+		return nil
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read the URLs file: %v", err)
+	}
+	defer file.Close()
+
+	list := &urlList{filename: filename, urls: map[string]bool{}, column: -1}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		url := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), utf8BOM))
+		if url == "" || strings.HasPrefix(url, "#") || list.urls[url] {
+			continue
+		}
+		list.urls[url] = true
+		list.sorted = append(list.sorted, url)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read the URLs file %s: %v", filename, err)
+	}
+	if len(list.urls) == 0 {
+		return fmt.Errorf("the URLs file %s lists no URL", filename)
+	}
+	sort.Strings(list.sorted)
+	d.urls = list
+	return nil
+}
+
+// urlColumn returns the column of the rows of a mode the URLs are matched against
+func urlColumn(mode string) string {
+	if mode == "links" {
+		return "source_url"
+	}
+	return "url"
+}
+
+// filter returns the server-side filter narrowing the rows to the URLs: the URL itself for a single one, the
+// prefix the URLs share otherwise, as long as it spans their host. "" when the URLs can't be narrowed.
+func (l *urlList) filter(mode string) string {
+	prefix := l.sorted[0]
+	if len(l.sorted) > 1 {
+		// the URLs being sorted, the first and the last ones share the shortest prefix
+		last := l.sorted[len(l.sorted)-1]
+		n := 0
+		for n < len(prefix) && n < len(last) && prefix[n] == last[n] {
+			n++
+		}
+		prefix = prefix[:n]
+		scheme := strings.Index(prefix, "://")
+		if scheme < 0 || !strings.Contains(prefix[scheme+len("://"):], "/") {
+			return ""
+		}
+	}
+	// a comma separates the conditions of a filter
+	if strings.Contains(prefix, ",") {
+		return ""
+	}
+	if len(l.sorted) == 1 {
+		return urlColumn(mode) + ":eq:" + prefix
+	}
+	return urlColumn(mode) + ":prefix:" + prefix
+}
+
+// digest identifies the URLs, for the resume parameters
+func (l *urlList) digest() string {
+	sum := sha256.Sum256([]byte(strings.Join(l.sorted, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// bind finds the URL column of the mode in a chunk header
+func (l *urlList) bind(mode string, header []string) error {
+	column := urlColumn(mode)
+	for i, name := range header {
+		if strings.ToLower(strings.TrimSpace(name)) == column {
+			l.column = i
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s column to match the URLs of %s, the available columns are: %s", column, l.filename, strings.Join(header, ", "))
+}
+
+// match reports whether the URL of a row is listed, every row matches without a list
+func (l *urlList) match(fields []string) bool {
+	if l == nil {
+		return true
+	}
+	return l.column >= 0 && l.column < len(fields) && l.urls[fields[l.column]]
+}
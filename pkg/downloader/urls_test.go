@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestURLsFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		urls   []string
+		mode   string
+		filter string
+	}{
+		{[]string{"https://example.com/a"}, "pages", "url:eq:https://example.com/a"},
+		{[]string{"https://example.com/a"}, "links", "source_url:eq:https://example.com/a"},
+		{[]string{"https://example.com/blog/b", "https://example.com/blog/a"}, "pages", "url:prefix:https://example.com/blog/"},
+		{[]string{"https://example.com/a", "https://example.org/a"}, "pages", ""},
+		{[]string{"https://example.com/a,b"}, "pages", ""},
+	}
+	for _, test := range tests {
+		d := &Downloader{}
+		if err := d.SetURLsFile(writeURLs(t, dir, test.urls...)); err != nil {
+			t.Fatal(err)
+		}
+		if filter := d.urls.filter(test.mode); filter != test.filter {
+			t.Errorf("%v: expected the filter %q, got %q", test.urls, test.filter, filter)
+		}
+		if filter := d.urls.filter(test.mode); filter != "" {
+			if err := ValidateFilter(test.mode, filter); err != nil {
+				t.Errorf("%v: invalid filter: %v", test.urls, err)
+			}
+		}
+	}
+
+	if err := (&Downloader{}).SetURLsFile(writeURLs(t, dir, "# no URL", "")); err == nil {
+		t.Error("a file without URL should be rejected")
+	}
+}
+
+func TestDownloadURLs(t *testing.T) {
+	var filters []string
+	defer serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		filters = append(filters, r.URL.Query().Get("filter"))
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":4,"page":0,"size":1}}`))
+			return
+		}
+		fmt.Fprint(w, "id\turl\n")
+		for id := 0; id < 4; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/blog/%d\n", id, id)
+		}
+	})()
+	dir, err := ioutil.TempDir("", "urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		Filter: "status_code:200", URLsFile: writeURLs(t, dir, "# listed", "http://example.com/blog/2", "", "http://example.com/blog/0")}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "id\turl\n0\thttp://example.com/blog/0\n2\thttp://example.com/blog/2\n"; string(data) != expected {
+		t.Errorf("expected the listed URLs only, got %q", data)
+	}
+	for _, filter := range filters {
+		if filter != "status_code:200,url:prefix:http://example.com/blog/" {
+			t.Errorf("expected the URLs to narrow the filter, got %q", filter)
+		}
+	}
+
+	options.Targets = filepath.Join(dir, "targets.txt")
+	if err = New(options).Run(context.Background()); err == nil {
+		t.Error("a URLs file should be rejected with targets")
+	}
+}
+
+// writeURLs writes the lines of a URLs file to the directory
+func writeURLs(t *testing.T, dir string, lines ...string) string {
+	file, err := ioutil.TempFile(dir, "urls.*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, line := range lines {
+		fmt.Fprintln(file, line)
+	}
+	return file.Name()
+}
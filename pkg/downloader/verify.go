@@ -0,0 +1,230 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultVerifySamples the rows of an export spot-checked against the API by Verify
+const DefaultVerifySamples = 10
+
+// VerifyOptions the export checked by Verify, and how
+type VerifyOptions struct {
+	File      string // the export, a local tsv or csv file, compressed or not
+	Format    string // tsv (default) or csv
+	Delimiter string // fields delimiter of the csv format, "," if ""
+	NoHeader  bool   // the export was written without its header row, its columns are the ones of the API
+	Samples   int    // rows spot-checked against the API, DefaultVerifySamples if 0, none if negative
+	Seed      int64  // seed of the rows spot-checked, random if 0
+}
+
+// VerifyReport the result of Verify: the rows of the export against the elements of the API, its checksum
+// and the rows spot-checked
+type VerifyReport struct {
+	File     string        `json:"file"`
+	Rows     uint64        `json:"rows"`               // rows of the export, the header excluded
+	Total    uint64        `json:"total"`              // elements of the mode, as per the API
+	Checksum string        `json:"checksum,omitempty"` // "ok" or "mismatch" as per the .sha256 sidecar, "" if there's none
+	Samples  []VerifiedRow `json:"samples"`
+	Passed   bool          `json:"passed"`
+}
+
+// VerifiedRow a row of the export spot-checked against the element of the API at its position
+type VerifiedRow struct {
+	Row        uint64   `json:"row"` // the position of the row in the export, from 0
+	Matched    bool     `json:"matched"`
+	Mismatches []string `json:"mismatches,omitempty"` // the columns differing, e.g. `title: "A" != "B"`
+}
+
+// Failures returns why the export failed the verification, nil if it passed
+func (r *VerifyReport) Failures() []string {
+	var failures []string
+	switch {
+	case r.Rows < r.Total:
+		failures = append(failures, fmt.Sprintf("%d rows are missing: %d of %d", r.Total-r.Rows, r.Rows, r.Total))
+	case r.Rows > r.Total:
+		failures = append(failures, fmt.Sprintf("%d rows in excess: %d of %d", r.Rows-r.Total, r.Rows, r.Total))
+	}
+	if r.Checksum == "mismatch" {
+		failures = append(failures, "the SHA-256 of the file doesn't match its "+ChecksumSuffix+" sidecar")
+	}
+	for _, sample := range r.Samples {
+		if !sample.Matched {
+			failures = append(failures, fmt.Sprintf("row %d differs from the API: %s", sample.Row, strings.Join(sample.Mismatches, ", ")))
+		}
+	}
+	return failures
+}
+
+// sampledExportRow a row of the export kept to be spot-checked
+type sampledExportRow struct {
+	index  uint64
+	fields []string
+}
+
+// Verify checks an export downloaded before is complete and untampered: its rows are counted against the
+// elements of the client mode (with its filter), its SHA-256 is checked against its .sha256 sidecar if any,
+// and a random sample of its rows is compared with the elements of the API at their position, by column.
+// The rows of an export sorted by --sort-by, filtered by --where or transformed differ from the API ones,
+// they can only be counted. An error is returned only if the verification couldn't be done.
+func Verify(client *AudistoAPIClient, options VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{File: options.File, Samples: []VerifiedRow{}}
+	format := normalizeOutputFormat(options.Format)
+	if format != TSVOutputFormat && format != CSVOutputFormat {
+		return nil, fmt.Errorf("only tsv and csv exports can be verified")
+	}
+	var delimiter rune
+	if format == CSVOutputFormat && options.Delimiter != "" {
+		var err error
+		if delimiter, err = parseDelimiter(options.Delimiter); err != nil {
+			return nil, err
+		}
+	}
+	samples := options.Samples
+	if samples == 0 {
+		samples = DefaultVerifySamples
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	// the sidecar is checked first, the file hashed as it's on the disk
+	if sidecar, err := ioutil.ReadFile(options.File + ChecksumSuffix); err == nil {
+		checksum, err := fileChecksum(options.File)
+		if err != nil {
+			return nil, err
+		}
+		report.Checksum = "mismatch"
+		if fields := strings.Fields(string(sidecar)); len(fields) > 0 && strings.EqualFold(fields[0], checksum) {
+			report.Checksum = "ok"
+		}
+	}
+
+	header, rows, sampled, err := readExport(options.File, format, delimiter, options.NoHeader, samples, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return nil, err
+	}
+	report.Rows = rows
+	if report.Total, err = client.GetTotalElements(); err != nil {
+		return nil, err
+	}
+
+	for _, row := range sampled {
+		verified, err := verifyRow(client, format, header, row)
+		if err != nil {
+			return nil, err
+		}
+		report.Samples = append(report.Samples, verified)
+	}
+	report.Passed = len(report.Failures()) == 0
+	return report, nil
+}
+
+// readExport counts the rows of an export, returned along with its header, nil if it has none, and a random
+// sample of its rows in their order (algorithm R)
+func readExport(filename string, format string, delimiter rune, noHeader bool, samples int,
+	random *rand.Rand) (header []string, rows uint64, sampled []sampledExportRow, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer file.Close()
+	reader, err := decompressedReader(file)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	next := newRowReader(format, reader, delimiter)
+
+	if !noHeader {
+		if header, err = next(); err == io.EOF {
+			return nil, 0, nil, fmt.Errorf("%s is empty, it has no header", filename)
+		} else if err != nil {
+			return nil, 0, nil, fmt.Errorf("cannot read %s: %v", filename, err)
+		}
+	}
+	for {
+		fields, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("cannot read %s: %v", filename, err)
+		}
+		row := sampledExportRow{index: rows, fields: fields}
+		rows++
+		if len(sampled) < samples {
+			sampled = append(sampled, row)
+		} else if i := random.Int63n(int64(rows)); i < int64(samples) {
+			sampled[i] = row
+		}
+	}
+	sort.Slice(sampled, func(i, j int) bool { return sampled[i].index < sampled[j].index })
+	return header, rows, sampled, nil
+}
+
+// verifyRow compares a row of the export with the element of the API at its position, by the columns of the
+// export header, by position without one. The element is sanitized as downloads do by default.
+func verifyRow(client *AudistoAPIClient, format string, header []string, row sampledExportRow) (VerifiedRow, error) {
+	verified := VerifiedRow{Row: row.index}
+	body, statusCode, responseHeader, err := client.fetchChunk(row.index, 1)
+	if err != nil {
+		return verified, err
+	}
+	if statusCode != 200 {
+		switch statusCode {
+		case 401, 402, 403:
+			return verified, statusCodeError(statusCode, responseHeader, client.CrawlID)
+		}
+		if message, ok := StatusCodesErrors[statusCode]; ok {
+			return verified, &APIError{StatusCode: statusCode, Message: message}
+		}
+		return verified, &APIError{StatusCode: statusCode, Message: fmt.Sprintf("Error while fetching the row %d (code %v)", row.index, statusCode)}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1<<26)
+	var apiHeader, apiFields []string
+	if scanner.Scan() {
+		apiHeader = strings.Split(scanner.Text(), "\t")
+	}
+	if scanner.Scan() {
+		apiFields = newRowSanitizer(apiHeader, SanitizeAuto, format == TSVOutputFormat, &sanitizedCounters{}).apply(strings.Split(scanner.Text(), "\t"))
+	}
+	if apiFields == nil {
+		verified.Mismatches = []string{"the API has no element at this position"}
+		return verified, nil
+	}
+
+	columns := header
+	if columns == nil {
+		columns = apiHeader
+	}
+	apiIndex := map[string]int{}
+	for i, column := range apiHeader {
+		apiIndex[column] = i
+	}
+	for i, column := range columns {
+		j, ok := apiIndex[column]
+		if !ok || i >= len(row.fields) {
+			continue
+		}
+		var apiValue string
+		if j < len(apiFields) {
+			apiValue = apiFields[j]
+		}
+		if row.fields[i] != apiValue {
+			verified.Mismatches = append(verified.Mismatches, fmt.Sprintf("%s: %q != %q", column, row.fields[i], apiValue))
+		}
+	}
+	verified.Matched = len(verified.Mismatches) == 0
+	return verified, nil
+}
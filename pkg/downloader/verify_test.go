@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveVerifiedPages serves 20 pages, by chunks of any size
+func serveVerifiedPages() func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":20,"page":0,"size":1}}`))
+			return
+		}
+		var chunk, size int
+		fmt.Sscan(r.URL.Query().Get("chunk"), &chunk)
+		fmt.Sscan(r.URL.Query().Get("chunk_size"), &size)
+		fmt.Fprint(w, "id\turl\ttitle\n")
+		for id := chunk * size; id < (chunk+1)*size && id < 20; id++ {
+			fmt.Fprintf(w, "%d\thttp://example.com/%d\tPage %d\n", id, id, id)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	defer serveVerifiedPages()()
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client, err := NewClient("user", "pass", 12345, "pages", false, 0, 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an export of some of the columns
+	export := "url\tid\n"
+	for id := 0; id < 20; id++ {
+		export += fmt.Sprintf("http://example.com/%d\t%d\n", id, id)
+	}
+	file := filepath.Join(dir, "crawl.tsv")
+	if err = ioutil.WriteFile(file, []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Verify(client, VerifyOptions{File: file, Samples: 5, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed || report.Rows != 20 || report.Total != 20 || len(report.Samples) != 5 || report.Checksum != "" {
+		t.Errorf("expected the export to pass, got %+v: %v", report, report.Failures())
+	}
+
+	// a row altered, and one missing
+	export = "url\tid\n"
+	for id := 0; id < 19; id++ {
+		export += fmt.Sprintf("http://example.com/%d\t%d\n", id, id/3)
+	}
+	if err = ioutil.WriteFile(file, []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(file+ChecksumSuffix, []byte("0000  crawl.tsv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Verify(client, VerifyOptions{File: file, Samples: 19})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed || report.Checksum != "mismatch" {
+		t.Errorf("expected the export to fail, got %+v", report)
+	}
+	// the rows missing, the checksum and every altered row
+	if failures := report.Failures(); len(failures) != 2+18 {
+		t.Errorf("unexpected failures %v", failures)
+	}
+}
@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultCrawlPollInterval how often the status of a crawl is checked while waiting for it, see SetWaitForCrawl
+const DefaultCrawlPollInterval = time.Minute
+
+var (
+	// FinishedCrawlStatuses the statuses of a finished crawl, the other ones are still in progress
+	FinishedCrawlStatuses = []string{"finished", "completed", "done"}
+	// StoppedCrawlStatuses the statuses of a crawl that won't finish, it's not waited for
+	StoppedCrawlStatuses = []string{"failed", "cancelled", "canceled", "aborted"}
+)
+
+// Finished checks if the crawl is finished, its pages and links complete
+func (c Crawl) Finished() bool {
+	return hasCrawlStatus(c.Status, FinishedCrawlStatuses)
+}
+
+func hasCrawlStatus(status string, statuses []string) bool {
+	status = strings.ToLower(strings.TrimSpace(status))
+	for _, s := range statuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetWaitForCrawl when set to true, Run() waits for a crawl still in progress to finish before downloading it,
+// instead of downloading what's crawled so far: its status is checked every interval (DefaultCrawlPollInterval
+// if 0). Once maxWait elapses (0 for no limit), a CrawlNotFinishedError is returned, nothing being downloaded.
+// It has to be called before Run()
+func (d *Downloader) SetWaitForCrawl(wait bool, interval time.Duration, maxWait time.Duration) error {
+	if interval < 0 || maxWait < 0 {
+		return fmt.Errorf("the poll interval and the maximum wait for the crawl can't be negative")
+	}
+	if interval == 0 {
+		interval = DefaultCrawlPollInterval
+	}
+	d.waitForCrawl, d.crawlPollInterval, d.maxCrawlWait = wait, interval, maxWait
+	return nil
+}
+
+// awaitCrawl waits until the crawl is finished, if set to, see SetWaitForCrawl
+func (d *Downloader) awaitCrawl() error {
+	if !d.waitForCrawl {
+		return nil
+	}
+	started := time.Now()
+	for {
+		crawl, err := d.client.GetCrawl()
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(crawl.Status) == "" {
+			d.appendLog(WARNING, fmt.Sprintf("The status of crawl %d is unknown, it's downloaded without waiting", d.client.CrawlID))
+			return nil
+		}
+		if crawl.Finished() {
+			if waited := time.Since(started); waited >= d.crawlPollInterval {
+				d.appendLog(INFO, fmt.Sprintf("Crawl %d finished after waiting %v", d.client.CrawlID, waited.Round(time.Second)))
+			}
+			return nil
+		}
+		if hasCrawlStatus(crawl.Status, StoppedCrawlStatuses) {
+			return fmt.Errorf("crawl %d is %s, it won't finish", d.client.CrawlID, crawl.Status)
+		}
+
+		waited := time.Since(started)
+		if d.maxCrawlWait > 0 && waited+d.crawlPollInterval > d.maxCrawlWait {
+			return &CrawlNotFinishedError{CrawlID: d.client.CrawlID, Status: crawl.Status, Waited: waited.Round(time.Second)}
+		}
+		d.appendLog(INFO, fmt.Sprintf("Crawl %d is still %s, checking again in %v", d.client.CrawlID, crawl.Status, d.crawlPollInterval))
+		select {
+		case <-time.After(d.crawlPollInterval):
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+	}
+}
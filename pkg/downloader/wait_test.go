@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveCrawlInProgress serves a crawl running until its status was checked the given times, finished then
+func serveCrawlInProgress(running int32, checks *int32) func() {
+	return serveAPI(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/12345") {
+			status := "running"
+			if atomic.AddInt32(checks, 1) > running {
+				status = "finished"
+			}
+			fmt.Fprintf(w, `{"crawl":{"id":12345,"domain":"example.com","status":%q}}`, status)
+			return
+		}
+		if r.URL.Query().Get("output") == "json" {
+			w.Write([]byte(`{"chunk":{"total":2,"page":0,"size":1}}`))
+			return
+		}
+		w.Write([]byte("id\turl\n1\thttp://example.com/a\n2\thttp://example.com/b\n"))
+	})
+}
+
+func TestWaitForCrawl(t *testing.T) {
+	var checks int32
+	defer serveCrawlInProgress(2, &checks)()
+	dir, err := ioutil.TempDir("", "wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		WaitForCrawl: true, PollInterval: 10 * time.Millisecond}
+	if err = New(options).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if checks != 3 {
+		t.Errorf("expected the crawl status to be checked 3 times, got %d", checks)
+	}
+	if err = fExists(output); err != nil {
+		t.Error("the crawl should be downloaded once finished")
+	}
+}
+
+func TestWaitForCrawlMaxWait(t *testing.T) {
+	var checks int32
+	defer serveCrawlInProgress(100, &checks)()
+	dir, err := ioutil.TempDir("", "wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	options := Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output,
+		WaitForCrawl: true, PollInterval: 10 * time.Millisecond, MaxCrawlWait: 50 * time.Millisecond}
+	if err = New(options).Run(context.Background()); !IsCrawlNotFinished(err) {
+		t.Fatalf("expected the crawl not to finish in time, got %v", err)
+	}
+	if fExists(output) == nil {
+		t.Error("the crawl should not be downloaded")
+	}
+}
@@ -0,0 +1,415 @@
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rows can be filtered client-side by a where expression, evaluated against every row before it's written,
+// for the conditions the API filters don't support:
+//
+//	expression = and { "||" and }
+//	and        = not { "&&" not }
+//	not        = "!" not | "(" expression ")" | comparison
+//	comparison = operand operator operand       operators: == != < <= > >= =~ !~ (regex match)
+//	operand    = column | number | 'string' | "string" | true | false
+//
+// e.g. "status_code >= 400 && depth < 5" or "url =~ '/blog/' && !(indexable == false)".
+// Comparisons are typed: the columns known to be numbers or booleans (see filterFields) are compared as such,
+// so are the other columns compared to a number or a boolean. A value that can't be read as the type
+// of the comparison matches != only.
+
+// whereKind the type of a comparison
+type whereKind string
+
+const (
+	whereAny    whereKind = ""       // two columns of unknown types: numbers if both values are, strings otherwise
+	whereNumber whereKind = "number" // the kinds are named after the kinds of filterFields
+	whereString whereKind = "string"
+	whereBool   whereKind = "bool"
+)
+
+// WhereError a precise description of what's wrong in a where expression, before any request is made
+type WhereError struct {
+	Expression string
+	Position   int // the position of the faulty token, starting at 1
+	Reason     string
+}
+
+func (e *WhereError) Error() string {
+	return fmt.Sprintf("invalid where expression %q at position %d: %s", e.Expression, e.Position, e.Reason)
+}
+
+// Where a parsed where expression, see ParseWhere
+type Where struct {
+	root    whereNode
+	columns []*whereOperand // the column operands, bound to the header of the chunks
+}
+
+// ParseWhere parses a where expression, the types of the columns being the ones of the mode ("pages" if empty)
+func ParseWhere(mode string, expression string) (*Where, error) {
+	if mode == "" {
+		mode = "pages"
+	}
+	tokens, err := tokenizeWhere(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{expression: expression, tokens: tokens, fields: filterFields[mode], where: &Where{}}
+	if p.where.root, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != whereEnd {
+		return nil, p.errorf(token, "unexpected %q", token.text)
+	}
+	return p.where, nil
+}
+
+// SetWhere makes the downloader write only the rows matching the where expression, see ParseWhere.
+// The expression is parsed by Setup(), along with the mode. It has to be called before Setup()
+func (d *Downloader) SetWhere(expression string) {
+	d.whereExpression = strings.TrimSpace(expression)
+}
+
+// bind finds the columns of the expression in a chunk header
+func (w *Where) bind(header []string) error {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, operand := range w.columns {
+		position, ok := positions[operand.column]
+		if !ok {
+			return fmt.Errorf("unknown column %q in the where expression, the available columns are: %s", operand.column, strings.Join(header, ", "))
+		}
+		operand.index = position
+	}
+	return nil
+}
+
+// Match checks if a row, bound by bind(), matches the expression
+func (w *Where) Match(fields []string) bool {
+	return w.root.eval(fields)
+}
+
+type whereNode interface {
+	eval(fields []string) bool
+}
+
+type whereAnd struct{ left, right whereNode }
+type whereOr struct{ left, right whereNode }
+type whereNot struct{ node whereNode }
+
+func (n whereAnd) eval(fields []string) bool { return n.left.eval(fields) && n.right.eval(fields) }
+func (n whereOr) eval(fields []string) bool  { return n.left.eval(fields) || n.right.eval(fields) }
+func (n whereNot) eval(fields []string) bool { return !n.node.eval(fields) }
+
+// whereOperand a column or a literal of a comparison
+type whereOperand struct {
+	column  string // lower-cased, "" for a literal
+	index   int    // the position of the column in the rows
+	literal string
+	kind    whereKind // the type of a literal or a known column, whereAny for other columns
+}
+
+func (o *whereOperand) value(fields []string) string {
+	if o.column == "" {
+		return o.literal
+	}
+	if o.index < len(fields) {
+		return fields[o.index]
+	}
+	return ""
+}
+
+type whereComparison struct {
+	left, right *whereOperand
+	operator    string
+	kind        whereKind
+	pattern     *regexp.Regexp // the regexp of =~ and !~
+}
+
+func (c *whereComparison) eval(fields []string) bool {
+	left, right := c.left.value(fields), c.right.value(fields)
+	switch c.operator {
+	case "=~":
+		return c.pattern.MatchString(left)
+	case "!~":
+		return !c.pattern.MatchString(left)
+	}
+
+	var order int
+	switch c.kind {
+	case whereNumber, whereAny:
+		l, lErr := strconv.ParseFloat(left, 64)
+		r, rErr := strconv.ParseFloat(right, 64)
+		if lErr == nil && rErr == nil {
+			order = compareFloats(l, r)
+			break
+		}
+		if c.kind == whereNumber {
+			return c.operator == "!="
+		}
+		order = strings.Compare(left, right)
+	case whereBool:
+		l, lErr := strconv.ParseBool(left)
+		r, rErr := strconv.ParseBool(right)
+		if lErr != nil || rErr != nil {
+			return c.operator == "!="
+		}
+		if l != r {
+			order = 1
+		}
+	default:
+		order = strings.Compare(left, right)
+	}
+
+	switch c.operator {
+	case "==":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+func compareFloats(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+type whereTokenKind int
+
+const (
+	whereEnd whereTokenKind = iota
+	whereIdentifier
+	whereNumberLiteral
+	whereStringLiteral
+	whereOperator
+)
+
+type whereToken struct {
+	kind     whereTokenKind
+	text     string // the string of a string literal, unquoted
+	position int
+}
+
+// whereOperators the operators, longest first so "<=" is not read as "<"
+var whereOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")"}
+
+var whereComparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true}
+
+func tokenizeWhere(expression string) ([]whereToken, error) {
+	var tokens []whereToken
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expression[i+1:], c)
+			if end < 0 {
+				return nil, &WhereError{Expression: expression, Position: i + 1, Reason: "unterminated string"}
+			}
+			tokens = append(tokens, whereToken{kind: whereStringLiteral, text: expression[i+1 : i+1+end], position: i + 1})
+			i += end + 2
+			continue
+		case isWhereDigit(c) || (c == '-' && i+1 < len(expression) && isWhereDigit(expression[i+1])):
+			end := i + 1
+			for end < len(expression) && (isWhereDigit(expression[end]) || expression[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: whereNumberLiteral, text: expression[i:end], position: i + 1})
+			i = end
+			continue
+		case isWhereLetter(c):
+			end := i + 1
+			for end < len(expression) && (isWhereLetter(expression[end]) || isWhereDigit(expression[end]) || expression[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: whereIdentifier, text: expression[i:end], position: i + 1})
+			i = end
+			continue
+		}
+
+		operator := ""
+		for _, o := range whereOperators {
+			if strings.HasPrefix(expression[i:], o) {
+				operator = o
+				break
+			}
+		}
+		if operator == "" {
+			return nil, &WhereError{Expression: expression, Position: i + 1, Reason: fmt.Sprintf("unexpected %q", c)}
+		}
+		tokens = append(tokens, whereToken{kind: whereOperator, text: operator, position: i + 1})
+		i += len(operator)
+	}
+	return append(tokens, whereToken{kind: whereEnd, text: "end of expression", position: len(expression) + 1}), nil
+}
+
+func isWhereDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWhereLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// whereParser a recursive descent parser of the where expressions grammar
+type whereParser struct {
+	expression string
+	tokens     []whereToken
+	next       int
+	fields     map[string]string // the types of the known columns
+	where      *Where
+}
+
+func (p *whereParser) peek() whereToken {
+	return p.tokens[p.next]
+}
+
+func (p *whereParser) take() whereToken {
+	token := p.tokens[p.next]
+	if token.kind != whereEnd {
+		p.next++
+	}
+	return token
+}
+
+func (p *whereParser) errorf(token whereToken, format string, a ...interface{}) error {
+	return &WhereError{Expression: p.expression, Position: token.position, Reason: fmt.Sprintf(format, a...)}
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for token := p.peek(); token.kind == whereOperator && token.text == "||"; token = p.peek() {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = whereOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for token := p.peek(); token.kind == whereOperator && token.text == "&&"; token = p.peek() {
+		p.take()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = whereAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseNot() (whereNode, error) {
+	token := p.peek()
+	if token.kind == whereOperator && token.text == "!" {
+		p.take()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return whereNot{node}, nil
+	}
+	if token.kind == whereOperator && token.text == "(" {
+		p.take()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != whereOperator || closing.text != ")" {
+			return nil, p.errorf(closing, "expected \")\", got %q", closing.text)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *whereParser) parseComparison() (whereNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	token := p.take()
+	if token.kind != whereOperator || !whereComparisonOperators[token.text] {
+		return nil, p.errorf(token, "expected a comparison operator (== != < <= > >= =~ !~), got %q", token.text)
+	}
+	rightToken := p.peek()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &whereComparison{left: left, right: right, operator: token.text, kind: left.kind}
+	if left.kind != right.kind {
+		switch {
+		case left.kind == whereAny:
+			comparison.kind = right.kind
+		case right.kind != whereAny:
+			return nil, p.errorf(rightToken, "a %s can't be compared with a %s", left.kind, right.kind)
+		}
+	}
+
+	switch token.text {
+	case "=~", "!~":
+		if right.column != "" || right.kind != whereString || (comparison.kind != whereString && comparison.kind != whereAny) {
+			return nil, p.errorf(token, "%s matches a string with a 'regexp'", token.text)
+		}
+		if comparison.pattern, err = regexp.Compile(right.literal); err != nil {
+			return nil, p.errorf(rightToken, "invalid regexp: %v", err)
+		}
+	case "<", "<=", ">", ">=":
+		if comparison.kind == whereBool {
+			return nil, p.errorf(token, "booleans can only be compared with == and !=")
+		}
+	}
+	return comparison, nil
+}
+
+func (p *whereParser) parseOperand() (*whereOperand, error) {
+	token := p.take()
+	switch token.kind {
+	case whereNumberLiteral:
+		if _, err := strconv.ParseFloat(token.text, 64); err != nil {
+			return nil, p.errorf(token, "invalid number %q", token.text)
+		}
+		return &whereOperand{literal: token.text, kind: whereNumber}, nil
+	case whereStringLiteral:
+		return &whereOperand{literal: token.text, kind: whereString}, nil
+	case whereIdentifier:
+		if lower := strings.ToLower(token.text); lower == "true" || lower == "false" {
+			return &whereOperand{literal: lower, kind: whereBool}, nil
+		}
+		column := strings.ToLower(token.text)
+		operand := &whereOperand{column: column, kind: whereKind(p.fields[column])}
+		p.where.columns = append(p.where.columns, operand)
+		return operand, nil
+	}
+	return nil, p.errorf(token, "expected a column, a number, a 'string' or a boolean, got %q", token.text)
+}
@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWhereMatch(t *testing.T) {
+	header := []string{"id", "url", "status_code", "depth", "indexable", "custom"}
+	rows := map[string][]string{
+		"a": {"1", "https://example.com/blog/a", "200", "2", "true", "10"},
+		"b": {"2", "https://example.com/b", "404", "3", "false", "9"},
+		"c": {"3", "https://example.com/blog/c", "500", "7", "false", ""},
+	}
+	expressions := map[string]string{
+		"status_code >= 400 && depth < 5":                "b",
+		"status_code >= 400 || depth < 5":                "abc",
+		"url =~ '/blog/' && !(indexable == true)":        "c",
+		`url !~ "/blog/"`:                                "b",
+		"status_code == 200 || (depth > 2 && depth < 7)": "ab",
+		"custom > 9":                     "a", // numbers, not strings: "10" > "9"
+		"custom != 10":                   "bc",
+		"indexable != false":             "a",
+		"url == 'https://example.com/b'": "b",
+		"depth >= 2.5":                   "bc",
+		"id == depth":                    "",
+		"custom < id":                    "", // compared as numbers, id is one: "" matches != only
+	}
+	for expression, expected := range expressions {
+		where, err := ParseWhere("pages", expression)
+		if err != nil {
+			t.Errorf("%s: %v", expression, err)
+			continue
+		}
+		if err = where.bind(header); err != nil {
+			t.Fatal(err)
+		}
+		matched := ""
+		for _, name := range []string{"a", "b", "c"} {
+			if where.Match(rows[name]) {
+				matched += name
+			}
+		}
+		if matched != expected {
+			t.Errorf("%s: expected the rows %q to match, got %q", expression, expected, matched)
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	invalid := map[string]int{
+		"status_code >= ":            16,
+		"status_code = 200":          13,
+		"status_code >= 'abc'":       16,
+		"url > 3":                    7,
+		"indexable < true":           11,
+		"url =~ '('":                 8,
+		"url =~ depth":               8,
+		"(depth < 3":                 11,
+		"depth < 3)":                 10,
+		"title == 'unterminated":     10,
+		"depth < 3 && status_code @": 26,
+	}
+	for expression, position := range invalid {
+		_, err := ParseWhere("pages", expression)
+		whereErr, ok := err.(*WhereError)
+		if !ok {
+			t.Errorf("%q should be refused, got %v", expression, err)
+			continue
+		}
+		if whereErr.Position != position {
+			t.Errorf("%q: expected the error at position %d, got %v", expression, position, err)
+		}
+	}
+}
+
+func TestRunWhere(t *testing.T) {
+	defer serveAPI(nil)()
+	dir, err := ioutil.TempDir("", "where")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "crawl.tsv")
+	d := New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, Where: "url =~ '/b$'"})
+	if err = d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "id\turl\n2\thttp://example.com/b\n" {
+		t.Errorf("unexpected output %q", written)
+	}
+	if d.DoneElements != 2 {
+		t.Errorf("the skipped rows are downloaded too, expected 2 downloaded elements, got %d", d.DoneElements)
+	}
+
+	d = New(Options{Username: "user", Password: "pass", CrawlID: 12345, Mode: "pages", Output: output, NoResume: true, Where: "title == ''"})
+	if err = d.Run(context.Background()); err == nil {
+		t.Error("a column missing from the download should be refused")
+	}
+}
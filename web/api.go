@@ -0,0 +1,453 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/audisto/data-downloader/pkg/downloader"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ControlAPIQueueSize the number of downloads that can wait for the running one
+	ControlAPIQueueSize = 100
+)
+
+// JobStatus the state of a download started through the control API
+type JobStatus string
+
+// Job statuses
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobPaused    JobStatus = "paused"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// DownloadRequest the JSON payload of POST /api/downloads.
+// Username and password, or the API token, default to the ones the server is started with.
+type DownloadRequest struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	APIToken     string `json:"apiToken"`
+	CrawlID      uint64 `json:"crawlID"`
+	Mode         string `json:"mode"`
+	Filter       string `json:"filter"`
+	Order        string `json:"order"`
+	Output       string `json:"output"`
+	OutputFormat string `json:"outputFormat"`
+	Delimiter    string `json:"delimiter"`
+	Compression  string `json:"compression"`
+	Columns      string `json:"columns"`
+	NoDetails    bool   `json:"noDetails"`
+	NoResume     bool   `json:"noResume"`
+	ChunkSize    uint64 `json:"chunkSize"`
+	Concurrency  int    `json:"concurrency"`
+}
+
+// JobProgress the progress of a download, as of its last status report
+type JobProgress struct {
+	TotalElements   uint64  `json:"totalElements"`
+	DoneElements    uint64  `json:"doneElements"`
+	Percentage      float64 `json:"percentage"`
+	ETA             string  `json:"eta"`
+	ChunkSize       uint64  `json:"chunkSize"`
+	ErrorsCount     int     `json:"errorsCount"`
+	TimeoutsCount   int     `json:"timeoutsCount"`
+	DownloadedBytes uint64  `json:"downloadedBytes"`
+}
+
+// Job a download started through the control API, credentials are never part of its JSON
+type Job struct {
+	ID         string      `json:"id"`
+	Status     JobStatus   `json:"status"`
+	CrawlID    uint64      `json:"crawlID"`
+	Mode       string      `json:"mode"`
+	Output     string      `json:"output"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Progress   JobProgress `json:"progress"`
+	Error      string      `json:"error,omitempty"`
+
+	download *downloader.Downloader
+	cancel   context.CancelFunc
+}
+
+// ControlAPI a REST API to start, follow and cancel downloads. Downloads run one at a time,
+// in the order they were requested, the history is kept for the lifetime of the server.
+type ControlAPI struct {
+	// Username, Password the default credentials of the downloads
+	Username, Password string
+	// APIToken the default credentials of the downloads instead of the username and password
+	APIToken string
+	// APIBaseURL, APIVersion the API the downloads are requested from, "" for the default ones
+	APIBaseURL, APIVersion string
+	// TLS, Transport the TLS and connection settings of the requests of the downloads
+	TLS       downloader.TLSOptions
+	Transport downloader.TransportOptions
+	// Metrics when set, the downloads are recorded in it and served on GET /metrics
+	Metrics *downloader.Metrics
+	// Token when not empty, requests have to send it as an "Authorization: Bearer <token>" header.
+	// Without it, the server only listens on the loopback interface.
+	Token string
+	// OutputDir the directory the local outputs of the downloads are written to, the outputs requested being
+	// relative paths inside it, "" for the current directory
+	OutputDir string
+	// AllowedOutputs the URL schemes of the remote outputs the downloads may be written to, e.g. "s3",
+	// nil for local outputs only
+	AllowedOutputs []string
+
+	mu     sync.Mutex
+	jobs   []*Job
+	byID   map[string]*Job
+	lastID int
+	queue  chan *Job
+}
+
+// NewControlAPI returns a control API, its downloads start once Register is called
+func NewControlAPI(username, password, token string) *ControlAPI {
+	return &ControlAPI{
+		Username: username,
+		Password: password,
+		Token:    token,
+		byID:     map[string]*Job{},
+		queue:    make(chan *Job, ControlAPIQueueSize),
+	}
+}
+
+// StartControlAPI starts the control API server on the given port, it blocks until the server fails.
+// It listens on every interface when requests are authenticated by a token, on the loopback interface otherwise.
+func StartControlAPI(port uint, api *ControlAPI) error {
+	gin.SetMode(gin.ReleaseMode)
+
+	server := gin.New()
+	server.Use(Logger())
+	server.Use(gin.Recovery())
+	api.Register(server)
+
+	host := "127.0.0.1"
+	if api.Token != "" {
+		host = "0.0.0.0"
+	}
+	fmt.Printf("Control API listening on http://%s:%d/api/downloads\n", host, port)
+	return server.Run(fmt.Sprintf("%s:%d", host, port))
+}
+
+// Register adds the API routes to the server, and starts running the requested downloads
+func (api *ControlAPI) Register(server *gin.Engine) {
+	group := server.Group("/api", api.authenticate)
+	group.POST("/downloads", api.startHandler)
+	group.GET("/downloads", api.listHandler)
+	group.GET("/downloads/:id", api.jobHandler)
+	group.POST("/downloads/:id/cancel", api.cancelHandler)
+	group.DELETE("/downloads/:id", api.cancelHandler)
+	group.POST("/downloads/:id/pause", api.pauseHandler)
+	group.POST("/downloads/:id/resume", api.resumeHandler)
+	// scraped without the API token, as Prometheus does by default
+	if api.Metrics != nil {
+		server.GET("/metrics", gin.WrapH(api.Metrics.Handler()))
+	}
+
+	go api.run()
+}
+
+func (api *ControlAPI) authenticate(c *gin.Context) {
+	if api.Token == "" {
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(api.Token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing API token"})
+	}
+}
+
+func (api *ControlAPI) startHandler(c *gin.Context) {
+	var request DownloadRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.CrawlID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "crawlID is required"})
+		return
+	}
+	output, err := api.outputLocation(request.Output)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.Output = output
+	if request.APIToken != "" && (request.Username != "" || request.Password != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either apiToken or username and password can be sent, not both"})
+		return
+	}
+	if request.APIToken == "" && (request.Username == "" || request.Password == "") {
+		request.Username, request.Password, request.APIToken = api.Username, api.Password, api.APIToken
+	}
+	if request.APIToken == "" && (request.Username == "" || request.Password == "") {
+		request.Username, request.Password = getPersistedCredentials()
+	}
+	if request.Mode == "" {
+		request.Mode = downloader.Modes[0]
+	}
+	if !downloader.IsExportMode(request.Mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode has to be 'pages', 'links' or 'hints'"})
+		return
+	}
+
+	job, err := api.newJob(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	select {
+	case api.queue <- job:
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many downloads waiting, try again later"})
+		return
+	}
+	api.lastID++
+	job.ID = strconv.Itoa(api.lastID)
+	api.jobs = append(api.jobs, job)
+	api.byID[job.ID] = job
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (api *ControlAPI) listHandler(c *gin.Context) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"downloads": api.jobs})
+}
+
+func (api *ControlAPI) jobHandler(c *gin.Context) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	job, ok := api.byID[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such download"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (api *ControlAPI) cancelHandler(c *gin.Context) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	job, ok := api.byID[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such download"})
+		return
+	}
+
+	switch job.Status {
+	case JobQueued:
+		// the runner skips it
+		job.Status = JobCancelled
+		now := time.Now()
+		job.FinishedAt = &now
+	case JobRunning, JobPaused:
+		// the status is updated once the download stopped
+		job.cancel()
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("download is already %s", job.Status)})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// pauseHandler pauses a running download once the chunks being downloaded are written, until resumed
+func (api *ControlAPI) pauseHandler(c *gin.Context) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	job, ok := api.byID[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such download"})
+		return
+	}
+	if job.Status != JobRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("download is %s, not running", job.Status)})
+		return
+	}
+	job.download.Pause()
+	job.Status = JobPaused
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (api *ControlAPI) resumeHandler(c *gin.Context) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	job, ok := api.byID[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such download"})
+		return
+	}
+	if job.Status != JobPaused {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("download is %s, not paused", job.Status)})
+		return
+	}
+	job.download.Resume()
+	job.Status = JobRunning
+	c.JSON(http.StatusAccepted, job)
+}
+
+// outputLocation returns the location a download requested to the given output is written to: a path relative
+// to the output directory, not leaving it, or a remote output of an allowed URL scheme
+func (api *ControlAPI) outputLocation(output string) (string, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return "", fmt.Errorf("output is required, a path relative to the output directory")
+	}
+	if i := strings.Index(output, "://"); i > 0 {
+		scheme := strings.ToLower(output[:i])
+		for _, allowed := range api.AllowedOutputs {
+			if strings.ToLower(allowed) == scheme {
+				return output, nil
+			}
+		}
+		return "", fmt.Errorf("%s:// outputs are not allowed by the server", scheme)
+	}
+	path := filepath.Clean(filepath.FromSlash(output))
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || path == ".." ||
+		strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output has to be a path relative to the output directory, inside it")
+	}
+	return filepath.Join(api.OutputDir, path), nil
+}
+
+// newJob prepares the downloader of a request, so invalid options are rejected before it is queued
+func (api *ControlAPI) newJob(request DownloadRequest) (*Job, error) {
+	job := &Job{
+		Status:    JobQueued,
+		CrawlID:   request.CrawlID,
+		Mode:      request.Mode,
+		Output:    downloader.RedactOutput(request.Output),
+		CreatedAt: time.Now(),
+	}
+	options := downloader.Options{
+		Username:     request.Username,
+		Password:     request.Password,
+		APIToken:     request.APIToken,
+		APIBaseURL:   api.APIBaseURL,
+		APIVersion:   api.APIVersion,
+		TLS:          api.TLS,
+		Transport:    api.Transport,
+		Metrics:      api.Metrics,
+		CrawlID:      request.CrawlID,
+		Mode:         request.Mode,
+		Output:       request.Output,
+		Filter:       request.Filter,
+		Order:        request.Order,
+		NoDetails:    request.NoDetails,
+		NoResume:     request.NoResume,
+		Columns:      downloader.ParseColumns(request.Columns),
+		ChunkSize:    request.ChunkSize,
+		Concurrency:  request.Concurrency,
+		OutputFormat: strings.ToLower(request.OutputFormat),
+		Delimiter:    request.Delimiter,
+		Compression:  request.Compression,
+		OnProgress: func(report downloader.StatusReport) {
+			api.report(job, report)
+		},
+	}
+	job.download = downloader.New(options)
+
+	// the same checks as Prepare(), which applies the options again once the job runs
+	download := job.download
+	if err := download.SetOutputFormat(options.OutputFormat); err != nil {
+		return nil, err
+	}
+	if options.OutputFormat == downloader.CSVOutputFormat {
+		if err := download.SetDelimiter(options.Delimiter); err != nil {
+			return nil, err
+		}
+	}
+	if err := download.SetCompression(options.Compression, 0); err != nil {
+		return nil, err
+	}
+	if err := download.SetColumns(options.Columns); err != nil {
+		return nil, err
+	}
+	if options.Concurrency > 0 {
+		if err := download.SetConcurrency(options.Concurrency); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// run runs the queued downloads one after the other
+func (api *ControlAPI) run() {
+	for job := range api.queue {
+		ctx, ok := api.begin(job)
+		if !ok {
+			continue
+		}
+		err := job.download.Run(ctx)
+		if err == nil {
+			api.report(job, job.download.ProgressReport())
+		}
+		api.finish(job, err)
+	}
+}
+
+// begin marks the job as running, it returns false if it was cancelled while queued
+func (api *ControlAPI) begin(job *Job) (context.Context, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if job.Status != JobQueued {
+		return nil, false
+	}
+	now := time.Now()
+	job.Status = JobRunning
+	job.StartedAt = &now
+	var ctx context.Context
+	ctx, job.cancel = context.WithCancel(context.Background())
+	return ctx, true
+}
+
+// report updates the progress of the job
+func (api *ControlAPI) report(job *Job, report downloader.StatusReport) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	job.Progress = JobProgress{
+		TotalElements:   report.TotalElements,
+		DoneElements:    report.DoneElements,
+		Percentage:      report.ProgressPercentage,
+		ETA:             report.ETA.String(),
+		ChunkSize:       report.ChunkSize,
+		ErrorsCount:     report.ErrorsCount,
+		TimeoutsCount:   report.TimeoutsCount,
+		DownloadedBytes: report.DownloadedBytes,
+	}
+}
+
+// finish records the outcome of the job
+func (api *ControlAPI) finish(job *Job, err error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case err == nil:
+		job.Status = JobCompleted
+	case err == context.Canceled:
+		job.Status = JobCancelled
+	default:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+	job.cancel()
+}
@@ -79,7 +79,16 @@ func (wd *WebDownloader) downloadHandler(c *gin.Context) {
 	}
 
 	progressReport = make(chan downloader.StatusReport)
-	down = downloader.New(progressReport)
+	down = downloader.New(downloader.Options{Status: progressReport})
+
+	err = down.SetOutputFormat(downloadOptions.OutputFormat)
+	if err == nil {
+		err = down.SetDelimiter(downloadOptions.Delimiter)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	err = down.Setup(username, password, downloadOptions.CrawlID, downloadOptions.Mode,
 		!downloadOptions.Details, 0, 0, downloadOptions.Output, downloadOptions.Filter,
@@ -107,11 +116,14 @@ func (wd *WebDownloader) downloadHandler(c *gin.Context) {
 		wd.downloaderCount++
 	}()
 
-	go func() {
+	go func(reports <-chan downloader.StatusReport) {
 
-		if progressReport != nil {
-			for progress := range progressReport {
+		if reports != nil {
+			for progress := range reports {
 				if down == nil || down.Stop == true {
+					// drain the remaining reports, the stopped download closes the channel once it's done
+					for range reports {
+					}
 					return
 				}
 				percentage := strconv.FormatFloat(progress.ProgressPercentage, 'f', 2, 64)
@@ -132,7 +144,7 @@ func (wd *WebDownloader) downloadHandler(c *gin.Context) {
 			}
 			wd.downloaderCount--
 		}
-	}()
+	}(progressReport)
 	c.JSON(http.StatusOK, gin.H{"message": "Download started"})
 }
 
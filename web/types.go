@@ -17,16 +17,18 @@ type Credentials struct {
 }
 
 type JsonPayload struct {
-	CrawlID  uint64 `json:"crawlID,string"`
-	Mode     string `json:"mode"`
-	Filter   string `json:"filter"`
-	Order    string `json:"order"`
-	Resume   bool   `json:"resume"`
-	Details  bool   `json:"details"`
-	Target   string `json:"target"`
-	Output   string `json:"output"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	CrawlID      uint64 `json:"crawlID,string"`
+	Mode         string `json:"mode"`
+	Filter       string `json:"filter"`
+	Order        string `json:"order"`
+	Resume       bool   `json:"resume"`
+	Details      bool   `json:"details"`
+	Target       string `json:"target"`
+	Output       string `json:"output"`
+	OutputFormat string `json:"outputFormat"`
+	Delimiter    string `json:"delimiter"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
 }
 
 type ProgressMessage struct {